@@ -2,6 +2,12 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -12,10 +18,13 @@ import (
 	"counters/internal/handler"
 	"counters/pkg/counter"
 	"counters/pkg/iam"
+	"counters/pkg/idempotency"
 	"counters/pkg/logger"
 	"counters/pkg/oauth2"
+	"counters/pkg/postgres"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
 	"github.com/sethvargo/go-envconfig"
 	"go.uber.org/zap"
 )
@@ -38,35 +47,96 @@ func main() {
 
 	l.Info("starting", zap.Any("mode", cfg.Mode))
 
-	cms := counter.NewMemoryStorage()
+	var db *sql.DB
+	if cfg.Storage.Counters == config.PostgresStorage || cfg.Storage.Users == config.PostgresStorage {
+		db, err = postgres.Open(ctx, postgres.Config{
+			DSN:             cfg.Storage.Postgres.DSN,
+			MaxOpenConns:    cfg.Storage.Postgres.MaxOpenConns,
+			MaxIdleConns:    cfg.Storage.Postgres.MaxIdleConns,
+			ConnMaxLifetime: cfg.Storage.Postgres.ConnMaxLifetime,
+		})
+		if err != nil {
+			l.Fatal("PostgreSQL connecting failed", zap.Error(err))
+		}
+		defer db.Close()
+	}
+
+	var rdb redis.UniversalClient
+	if cfg.Storage.Counters == config.RedisStorage ||
+		cfg.Storage.States == config.RedisStorage ||
+		cfg.Storage.Idempotency == config.RedisStorage {
+		rdb, err = newRedisClient(ctx, cfg.Storage.Redis)
+		if err != nil {
+			l.Fatal("Redis connecting failed", zap.Error(err))
+		}
+		defer rdb.Close()
+	}
+
+	cms, err := newCounterStorage(ctx, l, cfg.Storage, db, rdb)
+	if err != nil {
+		l.Fatal("counter storage creating failed", zap.Error(err))
+	}
+	if c, ok := cms.(io.Closer); ok {
+		defer func() {
+			if err := c.Close(); err != nil {
+				l.Error("counter storage closing failed", zap.Error(err))
+			}
+		}()
+	}
 	cm := counter.NewManager(cms)
 
-	ums := iam.NewUserMemoryStorage()
-	iamm := iam.NewManager(ums, map[oauth2.Provider]oauth2.Client{
-		oauth2.Google: oauth2.NewGoogleClient(
-			oauth2.Config{
-				ClientID:     cfg.GoogleOAuth2.ClientID,
-				ClientSecret: cfg.GoogleOAuth2.ClientSecret,
-				RedirectURL:  cfg.GoogleOAuth2.RedirectURL,
-				Scopes:       cfg.GoogleOAuth2.Scopes,
-			},
-			http.DefaultClient,
-		),
-		oauth2.GitHub: oauth2.NewGitHubClient(
-			oauth2.Config{
-				ClientID:     cfg.GitHubOAuth2.ClientID,
-				ClientSecret: cfg.GitHubOAuth2.ClientSecret,
-				RedirectURL:  cfg.GitHubOAuth2.RedirectURL,
-				Scopes:       cfg.GitHubOAuth2.Scopes,
-			},
-			http.DefaultClient,
-		),
+	tokenKeys, err := newTokenKeys(cfg.Tokens)
+	if err != nil {
+		l.Fatal("token keys creating failed", zap.Error(err))
+	}
+	ums, err := newUserStorage(ctx, l, cfg, db, tokenKeys)
+	if err != nil {
+		l.Fatal("user storage creating failed", zap.Error(err))
+	}
+	states, err := newStateStore(cfg.Storage, cfg.OAuth2State, rdb)
+	if err != nil {
+		l.Fatal("OAuth2 state storage creating failed", zap.Error(err))
+	}
+	idempotencyStore, err := newIdempotencyStore(cfg.Storage, cfg.Idempotency, rdb)
+	if err != nil {
+		l.Fatal("idempotency storage creating failed", zap.Error(err))
+	}
+	keys, err := newKeySet(l, cfg.Session)
+	if err != nil {
+		l.Fatal("session key set creating failed", zap.Error(err))
+	}
+	clients, err := newOAuth2Registry(ctx, cfg)
+	if err != nil {
+		l.Fatal("OAuth2 clients creating failed", zap.Error(err))
+	}
+	if len(clients) == 0 {
+		l.Warn("no OAuth2 provider is configured, users cannot sign in")
+	}
+	iamm := iam.NewManager(ums, clients, states, iam.SessionConfig{
+		Keys:       keys,
+		AccessTTL:  cfg.Session.AccessTTL,
+		RefreshTTL: cfg.Session.RefreshTTL,
+	}, cfg.AdminEmails, iam.SignUpPolicy{
+		AllowedDomains: cfg.SignUp.AllowedDomains,
+		DeniedDomains:  cfg.SignUp.DeniedDomains,
+		InviteOnly:     cfg.SignUp.InviteOnly,
 	})
 	handler.MustRegisterMetrics(prometheus.DefaultRegisterer)
 
+	cookieKey, err := newCookieKey(l, cfg.HTTPServer)
+	if err != nil {
+		l.Fatal("cookie key creating failed", zap.Error(err))
+	}
+
 	s := &http.Server{
-		Addr:    cfg.HTTPServer.Addr,
-		Handler: handler.New(l, iamm, cm),
+		Addr: cfg.HTTPServer.Addr,
+		Handler: handler.New(
+			l, iamm, cm,
+			handler.WithCookieKey(cookieKey),
+			handler.WithSecureCookies(cfg.HTTPServer.SecureCookies),
+			handler.WithIdempotencyStore(idempotencyStore),
+			handler.WithGetIncrement(cfg.HTTPServer.GetIncrement),
+		),
 	}
 	go func() {
 		if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -90,3 +160,245 @@ func main() {
 	}
 	l.Info("HTTP server shut down")
 }
+
+func newCounterStorage(ctx context.Context, l *zap.Logger, cfg config.Storage, db *sql.DB, rdb redis.UniversalClient) (counter.Storage, error) {
+	switch cfg.Counters {
+	case config.MemoryStorage:
+		return counter.NewMemoryStorage(), nil
+	case config.FileStorage:
+		return counter.NewFileStorage(counter.FileConfig{
+			Dir:              cfg.File.Dir,
+			Sync:             counter.SyncPolicy(cfg.File.Sync),
+			SyncInterval:     cfg.File.SyncInterval,
+			SnapshotInterval: cfg.File.SnapshotInterval,
+			OnError: func(err error) {
+				l.Error("file storage failed", zap.Error(err))
+			},
+		})
+	case config.PostgresStorage:
+		if err := postgres.Migrate(ctx, db, "counters", counter.PostgresMigrations); err != nil {
+			return nil, err
+		}
+		return counter.NewPostgresStorage(db), nil
+	case config.RedisStorage:
+		return counter.NewRedisStorage(rdb, cfg.Redis.KeyPrefix), nil
+	default:
+		return nil, fmt.Errorf("unknown counter storage type: %q", cfg.Counters)
+	}
+}
+
+// newOAuth2Registry enables the providers that are configured.
+func newOAuth2Registry(ctx context.Context, cfg config.Config) (oauth2.Registry, error) {
+	r := oauth2.Registry{}
+
+	err := r.Register(oauth2.Google, oauth2Config(cfg.GoogleOAuth2), func(c oauth2.Config) (oauth2.Client, error) {
+		return oauth2.NewGoogleClient(c, http.DefaultClient), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Register(oauth2.GitHub, oauth2Config(cfg.GitHubOAuth2), func(c oauth2.Config) (oauth2.Client, error) {
+		return oauth2.NewGitHubClient(c, http.DefaultClient), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	oidc := oauth2Config(cfg.OIDC.OAuth2)
+	if cfg.OIDC.IssuerURL != "" && oidc.ClientID == "" {
+		return nil, fmt.Errorf("%w: %s: missing client ID", oauth2.ErrIncompleteConfig, oauth2.OIDC)
+	}
+	err = r.Register(oauth2.OIDC, oidc, func(c oauth2.Config) (oauth2.Client, error) {
+		return oauth2.NewOIDCClient(ctx, oauth2.OIDCConfig{Config: c, IssuerURL: cfg.OIDC.IssuerURL}, http.DefaultClient)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Register(oauth2.GitLab, oauth2Config(cfg.GitLab.OAuth2), func(c oauth2.Config) (oauth2.Client, error) {
+		return oauth2.NewGitLabClient(oauth2.GitLabConfig{Config: c, BaseURL: cfg.GitLab.BaseURL}, http.DefaultClient), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Register(oauth2.Microsoft, oauth2Config(cfg.Microsoft.OAuth2), func(c oauth2.Config) (oauth2.Client, error) {
+		return oauth2.NewMicrosoftClient(oauth2.MicrosoftConfig{Config: c, Tenant: cfg.Microsoft.Tenant}, http.DefaultClient), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Register(oauth2.Bitbucket, oauth2Config(cfg.Bitbucket), func(c oauth2.Config) (oauth2.Client, error) {
+		return oauth2.NewBitbucketClient(c, http.DefaultClient), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func oauth2Config(cfg config.OAuth2) oauth2.Config {
+	return oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+	}
+}
+
+func newRedisClient(ctx context.Context, cfg config.Redis) (redis.UniversalClient, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:         cfg.Addr,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		PoolTimeout:  cfg.PoolTimeout,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func newStateStore(cfg config.Storage, state config.OAuth2State, rdb redis.UniversalClient) (oauth2.StateStore, error) {
+	switch cfg.States {
+	case config.MemoryStorage:
+		return oauth2.NewMemoryStateStore(state.TTL), nil
+	case config.RedisStorage:
+		return oauth2.NewRedisStateStore(rdb, cfg.Redis.KeyPrefix, state.TTL), nil
+	default:
+		return nil, fmt.Errorf("unknown OAuth2 state storage type: %q", cfg.States)
+	}
+}
+
+func newIdempotencyStore(cfg config.Storage, idem config.Idempotency, rdb redis.UniversalClient) (idempotency.Store, error) {
+	switch cfg.Idempotency {
+	case config.MemoryStorage:
+		return idempotency.NewMemoryStore(idem.TTL), nil
+	case config.RedisStorage:
+		return idempotency.NewRedisStore(rdb, cfg.Redis.KeyPrefix, idem.TTL), nil
+	default:
+		return nil, fmt.Errorf("unknown idempotency storage type: %q", cfg.Idempotency)
+	}
+}
+
+// newUserStorage creates the user storage. Persistent storages encrypt
+// provider tokens with the token keys and re-encrypt the tokens stored with
+// older keys in the background.
+func newUserStorage(ctx context.Context, l *zap.Logger, cfg config.Config, db *sql.DB, keys *iam.TokenKeys) (iam.UserStorage, error) {
+	switch cfg.Storage.Users {
+	case config.MemoryStorage:
+		return iam.NewUserMemoryStorage(), nil
+	case config.PostgresStorage:
+		if err := postgres.Migrate(ctx, db, "iam", iam.PostgresMigrations); err != nil {
+			return nil, err
+		}
+
+		s := iam.NewUserPostgresStorage(db, keys)
+		if keys == nil {
+			l.Warn("no token keys configured, storing provider tokens unencrypted")
+			return s, nil
+		}
+
+		go func() {
+			n, err := s.ReencryptTokens(ctx, cfg.Tokens.ReencryptBatch)
+			if err != nil {
+				l.Error("provider tokens re-encrypting failed", zap.Int("users", n), zap.Error(err))
+				return
+			}
+			l.Info("provider tokens re-encrypted", zap.Int("users", n))
+		}()
+
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown user storage type: %q", cfg.Storage.Users)
+	}
+}
+
+// newTokenKeys decodes the configured token keys, read from the keys file
+// as well. Without any keys tokens are not encrypted.
+func newTokenKeys(cfg config.Tokens) (*iam.TokenKeys, error) {
+	encoded := make(map[string]string, len(cfg.Keys))
+	for id, secret := range cfg.Keys {
+		encoded[id] = secret
+	}
+	if cfg.KeysFile != "" {
+		b, err := os.ReadFile(cfg.KeysFile)
+		if err != nil {
+			return nil, err
+		}
+
+		var file map[string]string
+		if err = json.Unmarshal(b, &file); err != nil {
+			return nil, fmt.Errorf("decoding keys file: %w", err)
+		}
+		for id, secret := range file {
+			encoded[id] = secret
+		}
+	}
+	if len(encoded) == 0 && cfg.PrimaryKey == "" {
+		return nil, nil
+	}
+
+	keys := make(map[string][]byte, len(encoded))
+	for id, secret := range encoded {
+		key, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("decoding key %q: %w", id, err)
+		}
+		keys[id] = key
+	}
+
+	return iam.NewTokenKeys(cfg.PrimaryKey, keys)
+}
+
+// newCookieKey decodes the configured cookie key. Without one it falls back to
+// a random key, so sign-ins in progress do not survive a restart.
+func newCookieKey(l *zap.Logger, cfg config.HTTPServer) ([]byte, error) {
+	if cfg.CookieKey == "" {
+		l.Warn("no cookie key configured, using an ephemeral key")
+
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+
+	return base64.StdEncoding.DecodeString(cfg.CookieKey)
+}
+
+// newKeySet decodes the configured session keys. Without any it falls back to
+// a random key, so sessions do not survive a restart.
+func newKeySet(l *zap.Logger, cfg config.Session) (*iam.KeySet, error) {
+	if len(cfg.Keys) == 0 {
+		l.Warn("no session keys configured, using an ephemeral key")
+
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return iam.NewKeySet("ephemeral", map[string][]byte{"ephemeral": key})
+	}
+
+	keys := make(map[string][]byte, len(cfg.Keys))
+	for id, secret := range cfg.Keys {
+		key, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("decoding key %q: %w", id, err)
+		}
+		keys[id] = key
+	}
+
+	return iam.NewKeySet(cfg.SigningKey, keys)
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type Mode string
 
 const (
@@ -10,17 +12,148 @@ const (
 type Config struct {
 	Mode         `env:"MODE,default=prod"`
 	HTTPServer   `env:",prefix=HTTP_SERVER_"`
-	GoogleOAuth2 OAuth2 `env:",prefix=GOOGLE_OAUTH2_"`
-	GitHubOAuth2 OAuth2 `env:",prefix=GITHUB_OAUTH2_"`
+	Storage      Storage     `env:",prefix=STORAGE_"`
+	GoogleOAuth2 OAuth2      `env:",prefix=GOOGLE_OAUTH2_"`
+	GitHubOAuth2 OAuth2      `env:",prefix=GITHUB_OAUTH2_"`
+	OIDC         OIDC        `env:",prefix=OIDC_"`
+	GitLab       GitLab      `env:",prefix=GITLAB_OAUTH2_"`
+	Microsoft    Microsoft   `env:",prefix=MICROSOFT_OAUTH2_"`
+	Bitbucket    OAuth2      `env:",prefix=BITBUCKET_OAUTH2_"`
+	Session      Session     `env:",prefix=SESSION_"`
+	Tokens       Tokens      `env:",prefix=TOKEN_ENCRYPTION_"`
+	OAuth2State  OAuth2State `env:",prefix=OAUTH2_STATE_"`
+	Idempotency  Idempotency `env:",prefix=IDEMPOTENCY_"`
+	AdminEmails  []string    `env:"ADMIN_EMAILS"`
+	SignUp       SignUp      `env:",prefix=SIGN_UP_"`
 }
 
+// HTTPServer configures the HTTP server. CookieKey is the base64 encoded key
+// cookies are signed with. GetIncrement serves the deprecated GET increment
+// route.
 type HTTPServer struct {
-	Addr string `env:"ADDR,default=0.0.0.0:10000"`
+	Addr          string `env:"ADDR,default=0.0.0.0:10000"`
+	CookieKey     string `env:"COOKIE_KEY"`
+	SecureCookies bool   `env:"SECURE_COOKIES,default=true"`
+	GetIncrement  bool   `env:"GET_INCREMENT,default=false"`
+}
+
+type StorageType string
+
+const (
+	MemoryStorage   StorageType = "memory"
+	FileStorage     StorageType = "file"
+	PostgresStorage StorageType = "postgres"
+	RedisStorage    StorageType = "redis"
+)
+
+type Storage struct {
+	Counters    StorageType `env:"COUNTERS,default=memory"`
+	Users       StorageType `env:"USERS,default=memory"`
+	States      StorageType `env:"STATES,default=memory"`
+	Idempotency StorageType `env:"IDEMPOTENCY,default=memory"`
+	File        File        `env:",prefix=FILE_"`
+	Postgres    Postgres    `env:",prefix=POSTGRES_"`
+	Redis       Redis       `env:",prefix=REDIS_"`
+}
+
+type File struct {
+	Dir              string        `env:"DIR,default=data"`
+	Sync             string        `env:"SYNC,default=interval"`
+	SyncInterval     time.Duration `env:"SYNC_INTERVAL,default=1s"`
+	SnapshotInterval time.Duration `env:"SNAPSHOT_INTERVAL,default=5m"`
+}
+
+type Postgres struct {
+	DSN             string        `env:"DSN"`
+	MaxOpenConns    int           `env:"MAX_OPEN_CONNS,default=10"`
+	MaxIdleConns    int           `env:"MAX_IDLE_CONNS,default=5"`
+	ConnMaxLifetime time.Duration `env:"CONN_MAX_LIFETIME,default=30m"`
+}
+
+type Redis struct {
+	Addr         string        `env:"ADDR,default=localhost:6379"`
+	Username     string        `env:"USERNAME"`
+	Password     string        `env:"PASSWORD"`
+	DB           int           `env:"DB,default=0"`
+	KeyPrefix    string        `env:"KEY_PREFIX,default=counters:"`
+	PoolSize     int           `env:"POOL_SIZE,default=10"`
+	MinIdleConns int           `env:"MIN_IDLE_CONNS,default=0"`
+	PoolTimeout  time.Duration `env:"POOL_TIMEOUT,default=4s"`
+	DialTimeout  time.Duration `env:"DIAL_TIMEOUT,default=5s"`
+	ReadTimeout  time.Duration `env:"READ_TIMEOUT,default=3s"`
+	WriteTimeout time.Duration `env:"WRITE_TIMEOUT,default=3s"`
+}
+
+// OAuth2State configures how long a started OAuth2 authorization can be
+// completed.
+type OAuth2State struct {
+	TTL time.Duration `env:"TTL,default=10m"`
 }
 
+// Idempotency configures how long responses to requests with an
+// Idempotency-Key header are replayed to retries.
+type Idempotency struct {
+	TTL time.Duration `env:"TTL,default=24h"`
+}
+
+// OAuth2 configures a provider. It is enabled when ClientID, ClientSecret
+// and RedirectURL are set and left disabled when none of them is.
 type OAuth2 struct {
 	ClientID     string   `env:"CLIENT_ID"`
 	ClientSecret string   `env:"CLIENT_SECRET"`
 	RedirectURL  string   `env:"REDIRECT_URL"`
 	Scopes       []string `env:"SCOPES"`
 }
+
+// Session configures the signing of session tokens. Keys maps key IDs to
+// base64 encoded secrets and SigningKey is the ID of the key new tokens are
+// signed with.
+type Session struct {
+	SigningKey string            `env:"SIGNING_KEY"`
+	Keys       map[string]string `env:"KEYS"`
+	AccessTTL  time.Duration     `env:"ACCESS_TTL,default=15m"`
+	RefreshTTL time.Duration     `env:"REFRESH_TTL,default=720h"`
+}
+
+// Tokens configures the encryption of stored provider tokens. Keys maps key
+// IDs to base64 encoded 32 byte key-encryption keys and PrimaryKey is the ID
+// of the key tokens are encrypted with. KeysFile is a JSON file of keys in
+// the same format, which are added to Keys. ReencryptBatch is the number of
+// users that are re-encrypted with the primary key at a time on start-up.
+type Tokens struct {
+	PrimaryKey     string            `env:"PRIMARY_KEY"`
+	Keys           map[string]string `env:"KEYS"`
+	KeysFile       string            `env:"KEYS_FILE"`
+	ReencryptBatch int               `env:"REENCRYPT_BATCH,default=100"`
+}
+
+// SignUp restricts who can sign up by the domain of their email. InviteOnly
+// requires an invitation created by an admin.
+type SignUp struct {
+	AllowedDomains []string `env:"ALLOWED_DOMAINS"`
+	DeniedDomains  []string `env:"DENIED_DOMAINS"`
+	InviteOnly     bool     `env:"INVITE_ONLY,default=false"`
+}
+
+// OIDC configures a generic OpenID Connect provider. It is enabled along
+// with its OAuth2 settings and then requires IssuerURL.
+type OIDC struct {
+	OAuth2
+	IssuerURL string `env:"ISSUER_URL"`
+}
+
+// GitLab configures GitLab sign-in. BaseURL is the URL of a self-hosted
+// instance and defaults to gitlab.com.
+type GitLab struct {
+	OAuth2
+	BaseURL string `env:"BASE_URL"`
+}
+
+// Microsoft configures Microsoft Entra ID sign-in. Tenant is the tenant ID or
+// domain, or one of common, organizations and consumers. With common and
+// organizations, work accounts can only sign in if the app registration adds
+// the xms_edov optional claim to ID tokens.
+type Microsoft struct {
+	OAuth2
+	Tenant string `env:"TENANT,default=common"`
+}
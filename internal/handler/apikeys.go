@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"counters/pkg/iam"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type createAPIKeyRequest struct {
+	Name      string    `json:"name" binding:"required"`
+	Scope     iam.Scope `json:"scope" binding:"required"`
+	Prefixes  []string  `json:"prefixes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type apiKeyResponse struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scope     iam.Scope  `json:"scope"`
+	Prefixes  []string   `json:"prefixes,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Key       string     `json:"key,omitempty"`
+}
+
+type listAPIKeysResponse struct {
+	APIKeys []apiKeyResponse `json:"api_keys"`
+}
+
+func newAPIKeyResponse(k *iam.APIKey) apiKeyResponse {
+	r := apiKeyResponse{
+		ID:        k.ID,
+		Name:      k.Name,
+		Scope:     k.Scope,
+		Prefixes:  k.Prefixes,
+		CreatedAt: k.CreatedAt,
+	}
+	if !k.ExpiresAt.IsZero() {
+		r.ExpiresAt = &k.ExpiresAt
+	}
+
+	return r
+}
+
+// createAPIKey creates an API key of the current user. The key is only part
+// of this response.
+func createAPIKey(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r createAPIKeyRequest
+		if err := c.ShouldBindJSON(&r); err != nil {
+			abortWithError(c, l, invalidRequest(err))
+			return
+		}
+
+		k, key, err := iamManager.CreateAPIKey(currentUser(c).ID, iam.APIKeyOptions{
+			Name:      r.Name,
+			Scope:     r.Scope,
+			Prefixes:  r.Prefixes,
+			ExpiresAt: r.ExpiresAt,
+		})
+
+		if err != nil {
+			abortWithError(c, l, err)
+			return
+		}
+
+		resp := newAPIKeyResponse(k)
+		resp.Key = key
+
+		c.AbortWithStatusJSON(http.StatusCreated, resp)
+	}
+}
+
+func listAPIKeys(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := iamManager.APIKeys(currentUser(c).ID)
+		if err != nil {
+			abortWithError(c, l, err)
+			return
+		}
+
+		resp := make([]apiKeyResponse, 0, len(keys))
+		for _, k := range keys {
+			resp = append(resp, newAPIKeyResponse(k))
+		}
+
+		c.AbortWithStatusJSON(http.StatusOK, listAPIKeysResponse{APIKeys: resp})
+	}
+}
+
+func revokeAPIKey(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if err := iamManager.RevokeAPIKey(currentUser(c).ID, id); err != nil {
+			abortWithError(c, l, err, zap.String("id", id))
+			return
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// limitAPIKey enforces the scope and prefixes of the API key the request is
+// authenticated with. Requests authenticated with a session pass through.
+func limitAPIKey(write bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := currentAPIKey(c)
+		if k == nil {
+			c.Next()
+			return
+		}
+
+		if write && !k.CanWrite() {
+			abortWithProblem(c, asError(fmt.Errorf("%w: API key is read-only", errForbidden)))
+			return
+		}
+
+		id, err := requestedCounterID(c)
+		if err != nil {
+			abortWithProblem(c, invalidRequest(err))
+			return
+		}
+		if !k.Allows(id) {
+			abortWithProblem(c, asError(fmt.Errorf("%w: API key does not allow counter %q", errForbidden, id)))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requestedCounterID returns the ID of the counter the request is about, or
+// the prefix of the counters it lists. The body is left for the handler.
+func requestedCounterID(c *gin.Context) (string, error) {
+	if id := c.Param("id"); id != "" {
+		return id, nil
+	}
+	if c.Request.Method != http.MethodPost {
+		return c.Query("prefix"), nil
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var r addCounterRequest
+	if err = json.Unmarshal(body, &r); err != nil {
+		return "", err
+	}
+
+	return r.ID, nil
+}
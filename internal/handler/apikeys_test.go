@@ -0,0 +1,323 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"counters/pkg/iam"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"go.uber.org/zap"
+)
+
+func Test_createAPIKey(t *testing.T) {
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		"Created": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().
+					CreateAPIKey("user", iam.APIKeyOptions{Name: "ci", Scope: iam.ScopeRead, Prefixes: []string{"ci-"}}).
+					Return(&iam.APIKey{ID: "id", Name: "ci", Scope: iam.ScopeRead, Prefixes: []string{"ci-"}, CreatedAt: created}, "ck_id_secret", nil)
+
+				return m
+			},
+			body:     `{"name":"ci","scope":"read","prefixes":["ci-"]}`,
+			wantCode: http.StatusCreated,
+			wantBody: `{"id":"id","name":"ci","scope":"read","prefixes":["ci-"],"created_at":"2023-01-01T00:00:00Z","key":"ck_id_secret"}`,
+		},
+		"BadRequestNoName": {
+			iam: func(c *gomock.Controller) IAManager {
+				return NewMockIAManager(c)
+			},
+			body:     `{"scope":"read"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		"BadRequestErrInvalidAPIKey": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().
+					CreateAPIKey("user", iam.APIKeyOptions{Name: "ci", Scope: "admin"}).
+					Return(nil, "", fmt.Errorf("%w: unknown scope", iam.ErrInvalidAPIKey))
+
+				return m
+			},
+			body:     `{"name":"ci","scope":"admin"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().
+					CreateAPIKey("user", iam.APIKeyOptions{Name: "ci", Scope: iam.ScopeRead}).
+					Return(nil, "", errors.New("unexpected error"))
+
+				return m
+			},
+			body:     `{"name":"ci","scope":"read"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(tt.body))
+			c.Set(userKey, &iam.User{ID: "user"})
+
+			createAPIKey(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_listAPIKeys(t *testing.T) {
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	expires := created.Add(24 * time.Hour)
+
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		wantCode int
+		wantBody string
+	}{
+		"OK": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().APIKeys("user").Return([]*iam.APIKey{
+					{ID: "id", Name: "ci", Scope: iam.ScopeReadWrite, CreatedAt: created, ExpiresAt: expires},
+				}, nil)
+
+				return m
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"api_keys":[{"id":"id","name":"ci","scope":"read-write","created_at":"2023-01-01T00:00:00Z","expires_at":"2023-01-02T00:00:00Z"}]}`,
+		},
+		"OKEmpty": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().APIKeys("user").Return(nil, nil)
+
+				return m
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"api_keys":[]}`,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().APIKeys("user").Return(nil, errors.New("unexpected error"))
+
+				return m
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api-keys", nil)
+			c.Set(userKey, &iam.User{ID: "user"})
+
+			listAPIKeys(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_revokeAPIKey(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		wantCode int
+	}{
+		"NoContent": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().RevokeAPIKey("user", "id").Return(nil)
+
+				return m
+			},
+			wantCode: http.StatusNoContent,
+		},
+		"NotFound": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().RevokeAPIKey("user", "id").Return(iam.ErrAPIKeyNotFound)
+
+				return m
+			},
+			wantCode: http.StatusNotFound,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().RevokeAPIKey("user", "id").Return(errors.New("unexpected error"))
+
+				return m
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodDelete, "/api-keys/id", nil)
+			c.Params = gin.Params{{Key: "id", Value: "id"}}
+			c.Set(userKey, &iam.User{ID: "user"})
+
+			revokeAPIKey(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func Test_limitAPIKey(t *testing.T) {
+	read := &iam.APIKey{ID: "read", Scope: iam.ScopeRead}
+	ci := &iam.APIKey{ID: "ci", Scope: iam.ScopeReadWrite, Prefixes: []string{"ci-"}}
+
+	for name, tt := range map[string]struct {
+		apiKey   *iam.APIKey
+		write    bool
+		method   string
+		target   string
+		id       string
+		body     string
+		wantCode int
+	}{
+		"OKSession": {
+			apiKey:   nil,
+			write:    true,
+			method:   http.MethodPost,
+			target:   "/counters/id/increments",
+			id:       "id",
+			wantCode: http.StatusOK,
+		},
+		"OKRead": {
+			apiKey:   read,
+			write:    false,
+			method:   http.MethodGet,
+			target:   "/counters/id",
+			id:       "id",
+			wantCode: http.StatusOK,
+		},
+		"ForbiddenReadOnly": {
+			apiKey:   read,
+			write:    true,
+			method:   http.MethodPost,
+			target:   "/counters/id/increments",
+			id:       "id",
+			wantCode: http.StatusForbidden,
+		},
+		"OKPrefix": {
+			apiKey:   ci,
+			write:    true,
+			method:   http.MethodPost,
+			target:   "/counters/ci-build/increments",
+			id:       "ci-build",
+			wantCode: http.StatusOK,
+		},
+		"ForbiddenPrefix": {
+			apiKey:   ci,
+			write:    true,
+			method:   http.MethodPost,
+			target:   "/counters/build/increments",
+			id:       "build",
+			wantCode: http.StatusForbidden,
+		},
+		"OKListPrefix": {
+			apiKey:   ci,
+			write:    false,
+			method:   http.MethodGet,
+			target:   "/counters?prefix=ci-build",
+			wantCode: http.StatusOK,
+		},
+		"ForbiddenListWithoutPrefix": {
+			apiKey:   ci,
+			write:    false,
+			method:   http.MethodGet,
+			target:   "/counters",
+			wantCode: http.StatusForbidden,
+		},
+		"OKAddPrefix": {
+			apiKey:   ci,
+			write:    true,
+			method:   http.MethodPost,
+			target:   "/counters",
+			body:     `{"id":"ci-build"}`,
+			wantCode: http.StatusOK,
+		},
+		"ForbiddenAddPrefix": {
+			apiKey:   ci,
+			write:    true,
+			method:   http.MethodPost,
+			target:   "/counters",
+			body:     `{"id":"build"}`,
+			wantCode: http.StatusForbidden,
+		},
+		"BadRequestAdd": {
+			apiKey:   ci,
+			write:    true,
+			method:   http.MethodPost,
+			target:   "/counters",
+			body:     `{`,
+			wantCode: http.StatusBadRequest,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.id != "" {
+				c.Params = gin.Params{{Key: "id", Value: tt.id}}
+			}
+			c.Set(userKey, &iam.User{ID: "user"})
+			if tt.apiKey != nil {
+				c.Set(apiKeyKey, tt.apiKey)
+			}
+
+			limitAPIKey(tt.write)(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if body, _ := io.ReadAll(c.Request.Body); string(body) != tt.body {
+				t.Errorf("want body left: %s, got: %s", tt.body, body)
+			}
+		})
+	}
+}
@@ -1,102 +1,301 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"counters/pkg/iam"
 	"counters/pkg/oauth2"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
-func googleSignIn(l *zap.Logger, iam IAManager) gin.HandlerFunc {
+type providerResponse struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	SignInURL string `json:"sign_in_url"`
+}
+
+type listProvidersResponse struct {
+	Providers []providerResponse `json:"providers"`
+}
+
+// listProviders lists the enabled providers for rendering sign-in buttons.
+func listProviders(providers []oauth2.Provider) gin.HandlerFunc {
+	resp := make([]providerResponse, 0, len(providers))
+	for _, p := range providers {
+		resp = append(resp, providerResponse{
+			ID:        p.String(),
+			Name:      p.DisplayName(),
+			SignInURL: "/v1/oauth/" + p.String() + "/sign-in",
+		})
+	}
+
 	return func(c *gin.Context) {
-		url, err := iam.OAuth2URL(oauth2.Google)
-		if err != nil {
-			l.Error(
-				"internal server error",
-				zap.String("uri", c.Request.RequestURI),
-				zap.Error(err),
-			)
+		c.AbortWithStatusJSON(http.StatusOK, listProvidersResponse{Providers: resp})
+	}
+}
 
-			c.Status(http.StatusInternalServerError)
+type signInRequest struct {
+	Invitation string `form:"invitation"`
+}
+
+// signIn starts an authorization with the provider and binds its state to
+// the browser with a signed cookie that the callback checks. The invitation
+// query parameter signs the user up with an invitation.
+func signIn(l *zap.Logger, iamManager IAManager, cookies *stateCookies, provider oauth2.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r signInRequest
+		if err := c.ShouldBindQuery(&r); err != nil {
+			abortWithError(c, l, invalidRequest(err))
 			return
 		}
 
+		var (
+			url, state string
+			err        error
+		)
+		if r.Invitation != "" {
+			url, state, err = iamManager.OAuth2SignUpURL(provider, r.Invitation)
+		} else {
+			url, state, err = iamManager.OAuth2URL(provider)
+		}
+
+		if err != nil {
+			abortWithError(c, l, err)
+			return
+		}
+
+		cookies.set(c, state)
 		c.Redirect(http.StatusTemporaryRedirect, url)
 	}
 }
 
-type googleCallbackResponse struct {
-	AccessToken string          `json:"access_token"`
-	Provider    oauth2.Provider `json:"provider"`
+type linkResponse struct {
+	URL string `json:"url"`
+}
+
+// link starts an authorization that links the provider to the current user.
+// The URL is returned rather than redirected to, as the request carries the
+// access token of the user, which a browser redirect cannot.
+func link(l *zap.Logger, iamManager IAManager, cookies *stateCookies, provider oauth2.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		url, state, err := iamManager.OAuth2LinkURL(provider, currentUser(c).ID)
+		if err != nil {
+			abortWithError(c, l, err)
+			return
+		}
+
+		cookies.set(c, state)
+		c.AbortWithStatusJSON(http.StatusOK, linkResponse{URL: url})
+	}
+}
+
+type callbackRequest struct {
+	State string `form:"state" binding:"required"`
+	Code  string `form:"code" binding:"required"`
 }
 
-func googleCallback(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+func callback(l *zap.Logger, iamManager IAManager, cookies *stateCookies, provider oauth2.Provider) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		state, code := c.Query("state"), c.Query("code")
+		var r callbackRequest
+		err := c.ShouldBindQuery(&r)
 
-		token, err := iamManager.SignInWithOAuth2(c, oauth2.Google, state, code)
+		ok := cookies.verify(c, r.State)
+		cookies.clear(c)
 		if err != nil {
-			l.Error(
-				"internal server error",
-				zap.String("uri", c.Request.RequestURI),
-				zap.Error(err),
-			)
+			abortWithError(c, l, invalidRequest(err))
+			return
+		}
+		if !ok {
+			abortWithError(c, l, oauth2.ErrInvalidState)
+			return
+		}
 
-			c.Status(http.StatusInternalServerError)
+		session, err := iamManager.SignInWithOAuth2(c, provider, r.State, r.Code)
+		if err != nil {
+			abortWithError(c, l, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, googleCallbackResponse{
-			AccessToken: token.Access,
-			Provider:    token.Provider,
-		})
+		c.JSON(http.StatusOK, newSessionResponse(session))
+	}
+}
+
+type sessionResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func newSessionResponse(s iam.Session) sessionResponse {
+	return sessionResponse{
+		AccessToken:  s.AccessToken,
+		RefreshToken: s.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(s.ExpiresAt).Seconds()),
 	}
 }
 
-func gitHubSignIn(l *zap.Logger, iam IAManager) gin.HandlerFunc {
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// refresh exchanges a refresh token for a new session.
+func refresh(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		url, err := iam.OAuth2URL(oauth2.GitHub)
+		var r refreshRequest
+
+		if err := c.ShouldBindJSON(&r); err != nil {
+			abortWithError(c, l, invalidRequest(err))
+			return
+		}
+
+		session, err := iamManager.Refresh(r.RefreshToken)
 		if err != nil {
-			l.Error(
-				"internal server error",
+			abortWithError(c, l, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newSessionResponse(session))
+	}
+}
+
+// logout ends the session of the access token the request is authenticated
+// with.
+func logout(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := iamManager.Logout(c.GetString(tokenKey)); err != nil {
+			abortWithError(c, l, err)
+			return
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// logoutAll ends every session of the current user. Provider tokens that
+// could not be revoked are logged, as the sessions have ended regardless.
+func logoutAll(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := currentUser(c).ID
+
+		err := iamManager.LogoutAll(c, id)
+
+		switch {
+		case err == nil:
+			c.AbortWithStatus(http.StatusNoContent)
+		case errors.Is(err, oauth2.ErrRevokeFailed):
+			l.Warn(
+				"provider token revocation failed",
 				zap.String("uri", c.Request.RequestURI),
+				zap.String("user", id),
 				zap.Error(err),
 			)
 
-			c.Status(http.StatusInternalServerError)
+			c.AbortWithStatus(http.StatusNoContent)
+		default:
+			abortWithError(c, l, err, zap.String("user", id))
+		}
+	}
+}
+
+// revokeSessions ends every session of the user with the given ID.
+func revokeSessions(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if err := iamManager.RevokeSessions(id); err != nil {
+			abortWithError(c, l, err, zap.String("id", id))
 			return
 		}
 
-		c.Redirect(http.StatusTemporaryRedirect, url)
+		c.AbortWithStatus(http.StatusNoContent)
 	}
 }
 
-type githubCallbackResponse struct {
-	AccessToken string          `json:"access_token"`
-	Provider    oauth2.Provider `json:"provider"`
-}
+const (
+	userKey   = "user"
+	tokenKey  = "token"
+	apiKeyKey = "apiKey"
+)
 
-func githubCallback(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+// authenticate requires a bearer session access token issued on sign-in or an
+// API key and stores the user it belongs to in the context.
+func authenticate(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		state, code := c.Query("state"), c.Query("code")
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			abortWithError(c, l, errUnauthorized)
+			return
+		}
+		token := strings.TrimPrefix(header, "Bearer ")
+
+		var (
+			u   *iam.User
+			k   *iam.APIKey
+			err error
+		)
+		if iam.IsAPIKey(token) {
+			u, k, err = iamManager.AuthenticateAPIKey(token)
+		} else {
+			u, err = iamManager.Authenticate(token)
+		}
 
-		token, err := iamManager.SignInWithOAuth2(c, oauth2.GitHub, state, code)
 		if err != nil {
-			l.Error(
-				"internal server error",
-				zap.String("uri", c.Request.RequestURI),
-				zap.Error(err),
-			)
+			abortWithError(c, l, err)
+			return
+		}
+
+		c.Set(userKey, u)
+		c.Set(tokenKey, token)
+		if k != nil {
+			c.Set(apiKeyKey, k)
+		}
+		c.Next()
+	}
+}
 
-			c.Status(http.StatusInternalServerError)
+// requireSession rejects requests authenticated with an API key, so that keys
+// cannot manage sessions, users or other keys.
+func requireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if currentAPIKey(c) != nil {
+			abortWithProblem(c, asError(errSessionRequired))
 			return
 		}
 
-		c.JSON(http.StatusOK, githubCallbackResponse{
-			AccessToken: token.Access,
-			Provider:    token.Provider,
-		})
+		c.Next()
+	}
+}
+
+// requirePermission only lets users with a role that has the permission
+// through.
+func requirePermission(p iam.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentUser(c).Can(p) {
+			abortWithProblem(c, asError(fmt.Errorf("%w: %s required", errForbidden, p)))
+			return
+		}
+
+		c.Next()
 	}
 }
+
+// currentUser returns the user stored by authenticate.
+func currentUser(c *gin.Context) *iam.User {
+	return c.MustGet(userKey).(*iam.User)
+}
+
+// currentAPIKey returns the API key stored by authenticate, if the request was
+// authenticated with one.
+func currentAPIKey(c *gin.Context) *iam.APIKey {
+	k, _ := c.Get(apiKeyKey)
+	key, _ := k.(*iam.APIKey)
+	return key
+}
@@ -1,19 +1,747 @@
 package handler
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
 
-func Test_googleSignIn(t *testing.T) {
-	// TODO: implement this test
+	"counters/pkg/iam"
+	"counters/pkg/oauth2"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"go.uber.org/zap"
+)
+
+func Test_listProviders(t *testing.T) {
+	for name, tt := range map[string]struct {
+		providers []oauth2.Provider
+		wantBody  string
+	}{
+		"OK": {
+			providers: []oauth2.Provider{oauth2.Google, oauth2.OIDC},
+			wantBody:  `{"providers":[{"id":"google","name":"Google","sign_in_url":"/v1/oauth/google/sign-in"},{"id":"oidc","name":"OpenID Connect","sign_in_url":"/v1/oauth/oidc/sign-in"}]}`,
+		},
+		"OKNone": {
+			providers: nil,
+			wantBody:  `{"providers":[]}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/auth/providers", nil)
+
+			listProviders(tt.providers)(c)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("want status code: 200, got: %d", w.Code)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
 }
 
-func Test_googleCallback(t *testing.T) {
-	// TODO: implement this test
+func Test_signIn(t *testing.T) {
+	cookies := &stateCookies{key: []byte("key"), secure: true}
+
+	for name, tt := range map[string]struct {
+		iam          func(c *gomock.Controller) IAManager
+		query        string
+		wantCode     int
+		wantLocation string
+		wantCookie   bool
+	}{
+		"OK": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().OAuth2URL(oauth2.Google).Return("https://oauth2.url", "state", nil)
+
+				return m
+			},
+			wantCode:     http.StatusTemporaryRedirect,
+			wantLocation: "https://oauth2.url",
+			wantCookie:   true,
+		},
+		"OKInvitation": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().OAuth2SignUpURL(oauth2.Google, "ci_id_secret").Return("https://oauth2.url", "state", nil)
+
+				return m
+			},
+			query:        "?invitation=ci_id_secret",
+			wantCode:     http.StatusTemporaryRedirect,
+			wantLocation: "https://oauth2.url",
+			wantCookie:   true,
+		},
+		"NotFound": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().OAuth2URL(oauth2.Google).Return("", "", iam.ErrInvalidOAuth2Provider)
+
+				return m
+			},
+			wantCode:     http.StatusNotFound,
+			wantLocation: "",
+			wantCookie:   false,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().OAuth2URL(oauth2.Google).Return("", "", errors.New("unexpected error"))
+
+				return m
+			},
+			wantCode:     http.StatusInternalServerError,
+			wantLocation: "",
+			wantCookie:   false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/oauth/google/sign-in"+tt.query, nil)
+
+			signIn(zap.NewNop(), tt.iam(gomock.NewController(t)), cookies, oauth2.Google)(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("want location: %s, got: %s", tt.wantLocation, location)
+			}
+
+			res := w.Result()
+			defer res.Body.Close()
+
+			var cookie *http.Cookie
+			for _, c := range res.Cookies() {
+				if c.Name == stateCookie {
+					cookie = c
+				}
+			}
+			if (cookie != nil) != tt.wantCookie {
+				t.Fatalf("want cookie: %t, got: %+v", tt.wantCookie, cookie)
+			}
+			if cookie != nil && (cookie.Value != "state."+cookies.sign("state") || !cookie.HttpOnly || !cookie.Secure) {
+				t.Errorf("want signed, HTTP only, secure cookie, got: %+v", cookie)
+			}
+		})
+	}
 }
 
-func Test_githubSignIn(t *testing.T) {
-	// TODO: implement this test
+func Test_link(t *testing.T) {
+	cookies := &stateCookies{key: []byte("key")}
+
+	for name, tt := range map[string]struct {
+		iam        func(c *gomock.Controller) IAManager
+		wantCode   int
+		wantBody   string
+		wantCookie bool
+	}{
+		"OK": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().OAuth2LinkURL(oauth2.GitHub, "user").Return("https://oauth2.url", "state", nil)
+
+				return m
+			},
+			wantCode:   http.StatusOK,
+			wantBody:   `{"url":"https://oauth2.url"}`,
+			wantCookie: true,
+		},
+		"NotFound": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().OAuth2LinkURL(oauth2.GitHub, "user").Return("", "", iam.ErrInvalidOAuth2Provider)
+
+				return m
+			},
+			wantCode:   http.StatusNotFound,
+			wantCookie: false,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().OAuth2LinkURL(oauth2.GitHub, "user").Return("", "", errors.New("unexpected error"))
+
+				return m
+			},
+			wantCode:   http.StatusInternalServerError,
+			wantCookie: false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/oauth/github/link", nil)
+			c.Set(userKey, &iam.User{ID: "user"})
+
+			link(zap.NewNop(), tt.iam(gomock.NewController(t)), cookies, oauth2.GitHub)(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+			if got := strings.Contains(w.Header().Get("Set-Cookie"), stateCookie+"=state."); got != tt.wantCookie {
+				t.Errorf("want cookie: %t, got: %s", tt.wantCookie, w.Header().Get("Set-Cookie"))
+			}
+		})
+	}
 }
 
-func Test_githubCallback(t *testing.T) {
-	// TODO: implement this test
+func Test_callback(t *testing.T) {
+	cookies := &stateCookies{key: []byte("key")}
+
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		cookie   string
+		wantCode int
+	}{
+		"OK": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.
+					EXPECT().
+					SignInWithOAuth2(gomock.Any(), oauth2.Google, "state", "code").
+					Return(iam.Session{AccessToken: "accessToken"}, nil)
+
+				return m
+			},
+			cookie:   "state." + cookies.sign("state"),
+			wantCode: http.StatusOK,
+		},
+		"BadRequestNoCookie": {
+			iam: func(c *gomock.Controller) IAManager {
+				return NewMockIAManager(c)
+			},
+			cookie:   "",
+			wantCode: http.StatusBadRequest,
+		},
+		"BadRequestForgedCookie": {
+			iam: func(c *gomock.Controller) IAManager {
+				return NewMockIAManager(c)
+			},
+			cookie:   "state." + (&stateCookies{key: []byte("other")}).sign("state"),
+			wantCode: http.StatusBadRequest,
+		},
+		"BadRequestOtherState": {
+			iam: func(c *gomock.Controller) IAManager {
+				return NewMockIAManager(c)
+			},
+			cookie:   "other." + cookies.sign("other"),
+			wantCode: http.StatusBadRequest,
+		},
+		"BadRequestInvalidState": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.
+					EXPECT().
+					SignInWithOAuth2(gomock.Any(), oauth2.Google, "state", "code").
+					Return(iam.Session{}, oauth2.ErrInvalidState)
+
+				return m
+			},
+			cookie:   "state." + cookies.sign("state"),
+			wantCode: http.StatusBadRequest,
+		},
+		"BadRequestWrappedInvalidCode": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.
+					EXPECT().
+					SignInWithOAuth2(gomock.Any(), oauth2.Google, "state", "code").
+					Return(iam.Session{}, fmt.Errorf("exchange: %w", oauth2.ErrInvalidCode))
+
+				return m
+			},
+			cookie:   "state." + cookies.sign("state"),
+			wantCode: http.StatusBadRequest,
+		},
+		"ForbiddenUnverifiedEmail": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.
+					EXPECT().
+					SignInWithOAuth2(gomock.Any(), oauth2.Google, "state", "code").
+					Return(iam.Session{}, iam.ErrUnverifiedEmail)
+
+				return m
+			},
+			cookie:   "state." + cookies.sign("state"),
+			wantCode: http.StatusForbidden,
+		},
+		"ForbiddenInvitationRequired": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.
+					EXPECT().
+					SignInWithOAuth2(gomock.Any(), oauth2.Google, "state", "code").
+					Return(iam.Session{}, iam.ErrInvitationRequired)
+
+				return m
+			},
+			cookie:   "state." + cookies.sign("state"),
+			wantCode: http.StatusForbidden,
+		},
+		"ConflictIdentityNotLinked": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.
+					EXPECT().
+					SignInWithOAuth2(gomock.Any(), oauth2.Google, "state", "code").
+					Return(iam.Session{}, iam.ErrIdentityNotLinked)
+
+				return m
+			},
+			cookie:   "state." + cookies.sign("state"),
+			wantCode: http.StatusConflict,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.
+					EXPECT().
+					SignInWithOAuth2(gomock.Any(), oauth2.Google, "state", "code").
+					Return(iam.Session{}, errors.New("unexpected error"))
+
+				return m
+			},
+			cookie:   "state." + cookies.sign("state"),
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/oauth/google/callback?state=state&code=code", nil)
+			if tt.cookie != "" {
+				c.Request.AddCookie(&http.Cookie{Name: stateCookie, Value: tt.cookie})
+			}
+
+			callback(zap.NewNop(), tt.iam(gomock.NewController(t)), cookies, oauth2.Google)(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if !strings.Contains(w.Header().Get("Set-Cookie"), stateCookie+"=;") {
+				t.Errorf("want state cookie cleared, got: %s", w.Header().Get("Set-Cookie"))
+			}
+		})
+	}
+}
+
+func Test_authenticate(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam           func(c *gomock.Controller) IAManager
+		authorization string
+		wantCode      int
+		wantUser      *iam.User
+	}{
+		"OK": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Authenticate("accessToken").Return(&iam.User{ID: "user"}, nil)
+
+				return m
+			},
+			authorization: "Bearer accessToken",
+			wantCode:      http.StatusOK,
+			wantUser:      &iam.User{ID: "user"},
+		},
+		"OKAPIKey": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().AuthenticateAPIKey("ck_id_secret").Return(&iam.User{ID: "user"}, &iam.APIKey{ID: "id"}, nil)
+
+				return m
+			},
+			authorization: "Bearer ck_id_secret",
+			wantCode:      http.StatusOK,
+			wantUser:      &iam.User{ID: "user"},
+		},
+		"UnauthorizedInvalidAPIKey": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().AuthenticateAPIKey("ck_id_secret").Return(nil, nil, iam.ErrInvalidToken)
+
+				return m
+			},
+			authorization: "Bearer ck_id_secret",
+			wantCode:      http.StatusUnauthorized,
+			wantUser:      nil,
+		},
+		"UnauthorizedNoToken": {
+			iam: func(c *gomock.Controller) IAManager {
+				return NewMockIAManager(c)
+			},
+			authorization: "",
+			wantCode:      http.StatusUnauthorized,
+			wantUser:      nil,
+		},
+		"UnauthorizedInvalidToken": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Authenticate("accessToken").Return(nil, iam.ErrInvalidToken)
+
+				return m
+			},
+			authorization: "Bearer accessToken",
+			wantCode:      http.StatusUnauthorized,
+			wantUser:      nil,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Authenticate("accessToken").Return(nil, errors.New("unexpected error"))
+
+				return m
+			},
+			authorization: "Bearer accessToken",
+			wantCode:      http.StatusInternalServerError,
+			wantUser:      nil,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/counters", nil)
+			c.Request.Header.Set("Authorization", tt.authorization)
+
+			authenticate(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if u, _ := c.Get(userKey); tt.wantUser != nil && (u == nil || u.(*iam.User).ID != tt.wantUser.ID) {
+				t.Errorf("want user: %+v, got: %+v", tt.wantUser, u)
+			}
+			if tt.wantCode == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("want WWW-Authenticate: Bearer, got: %s", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func Test_refresh(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		"OK": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.
+					EXPECT().
+					Refresh("refreshToken").
+					Return(iam.Session{
+						AccessToken:  "accessToken",
+						RefreshToken: "newRefreshToken",
+						ExpiresAt:    time.Now().Add(time.Minute + time.Second/2),
+					}, nil)
+
+				return m
+			},
+			body:     `{"refresh_token":"refreshToken"}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"access_token":"accessToken","refresh_token":"newRefreshToken","token_type":"Bearer","expires_in":60}`,
+		},
+		"BadRequest": {
+			iam: func(c *gomock.Controller) IAManager {
+				return NewMockIAManager(c)
+			},
+			body:     `{}`,
+			wantCode: http.StatusBadRequest,
+		},
+		"Unauthorized": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Refresh("refreshToken").Return(iam.Session{}, iam.ErrInvalidToken)
+
+				return m
+			},
+			body:     `{"refresh_token":"refreshToken"}`,
+			wantCode: http.StatusUnauthorized,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Refresh("refreshToken").Return(iam.Session{}, errors.New("unexpected error"))
+
+				return m
+			},
+			body:     `{"refresh_token":"refreshToken"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/auth/refresh", strings.NewReader(tt.body))
+
+			refresh(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_logout(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		wantCode int
+	}{
+		"NoContent": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Logout("accessToken").Return(nil)
+
+				return m
+			},
+			wantCode: http.StatusNoContent,
+		},
+		"Unauthorized": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Logout("accessToken").Return(iam.ErrInvalidToken)
+
+				return m
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Logout("accessToken").Return(errors.New("unexpected error"))
+
+				return m
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+			c.Set(userKey, &iam.User{ID: "user"})
+			c.Set(tokenKey, "accessToken")
+
+			logout(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func Test_logoutAll(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		wantCode int
+	}{
+		"NoContent": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().LogoutAll(gomock.Any(), "user").Return(nil)
+
+				return m
+			},
+			wantCode: http.StatusNoContent,
+		},
+		"NoContentRevokeFailed": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().LogoutAll(gomock.Any(), "user").Return(oauth2.ErrRevokeFailed)
+
+				return m
+			},
+			wantCode: http.StatusNoContent,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().LogoutAll(gomock.Any(), "user").Return(errors.New("unexpected error"))
+
+				return m
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/auth/logout-all", nil)
+			c.Set(userKey, &iam.User{ID: "user"})
+
+			logoutAll(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func Test_revokeSessions(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		wantCode int
+	}{
+		"NoContent": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().RevokeSessions("id").Return(nil)
+
+				return m
+			},
+			wantCode: http.StatusNoContent,
+		},
+		"NotFound": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().RevokeSessions("id").Return(iam.ErrUserNotFound)
+
+				return m
+			},
+			wantCode: http.StatusNotFound,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().RevokeSessions("id").Return(errors.New("unexpected error"))
+
+				return m
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodDelete, "/users/id/sessions", nil)
+			c.Params = []gin.Param{{Key: "id", Value: "id"}}
+
+			revokeSessions(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func Test_requirePermission(t *testing.T) {
+	for name, tt := range map[string]struct {
+		user     *iam.User
+		wantCode int
+	}{
+		"OK": {
+			user:     newTestUser("admin", iam.RoleAdmin),
+			wantCode: http.StatusOK,
+		},
+		"ForbiddenEditor": {
+			user:     newTestUser("editor", iam.RoleEditor),
+			wantCode: http.StatusForbidden,
+		},
+		"ForbiddenNoRoles": {
+			user:     &iam.User{ID: "user", Email: "user@x.x"},
+			wantCode: http.StatusForbidden,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodDelete, "/users/id/sessions", nil)
+			c.Set(userKey, tt.user)
+
+			requirePermission(iam.PermissionManageUsers)(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if c.IsAborted() != (tt.wantCode != http.StatusOK) {
+				t.Errorf("want aborted: %t, got: %t", tt.wantCode != http.StatusOK, c.IsAborted())
+			}
+		})
+	}
+}
+
+func Test_requireSession(t *testing.T) {
+	for name, tt := range map[string]struct {
+		apiKey   *iam.APIKey
+		wantCode int
+	}{
+		"OK": {
+			apiKey:   nil,
+			wantCode: http.StatusOK,
+		},
+		"ForbiddenAPIKey": {
+			apiKey:   &iam.APIKey{ID: "id", Scope: iam.ScopeReadWrite},
+			wantCode: http.StatusForbidden,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api-keys", nil)
+			c.Set(userKey, &iam.User{ID: "user"})
+			if tt.apiKey != nil {
+				c.Set(apiKeyKey, tt.apiKey)
+			}
+
+			requireSession()(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+		})
+	}
 }
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const stateCookie = "oauth2_state"
+
+// stateCookies signs the OAuth2 state into a cookie, so that a callback is
+// only accepted from the browser the authorization was started in. The
+// cookie is scoped to the whole site, as the OAuth2 routes are served both
+// under /v1 and at their deprecated aliases.
+type stateCookies struct {
+	key    []byte
+	secure bool
+}
+
+func (s *stateCookies) set(c *gin.Context, state string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(stateCookie, state+"."+s.sign(state), 0, "/", "", s.secure, true)
+}
+
+func (s *stateCookies) clear(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(stateCookie, "", -1, "/", "", s.secure, true)
+}
+
+// verify reports whether the request carries a valid cookie for the state.
+func (s *stateCookies) verify(c *gin.Context, state string) bool {
+	value, err := c.Cookie(stateCookie)
+	if err != nil || state == "" {
+		return false
+	}
+
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 || value[:i] != state {
+		return false
+	}
+
+	return hmac.Equal([]byte(value[i+1:]), []byte(s.sign(state)))
+}
+
+func (s *stateCookies) sign(state string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(state))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -2,10 +2,15 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"counters/pkg/counter"
+	"counters/pkg/iam"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -20,32 +25,21 @@ func addCounter(l *zap.Logger, cm CounterManager) gin.HandlerFunc {
 		start := time.Now()
 
 		var r addCounterRequest
-		if err := c.BindJSON(&r); err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := c.ShouldBindJSON(&r); err != nil {
+			abortWithError(c, l, invalidRequest(err))
 			return
 		}
 
-		err := cm.Add(r.ID)
-
-		switch err {
-		case nil:
-			c.AbortWithStatus(http.StatusCreated)
-
-			defer addCounterRequestDurationHistogram.With(nil).Observe(time.Since(start).Seconds())
-			defer countersNumberGauge.With(nil).Inc()
-		case counter.ErrExists:
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		default:
+		if err := cm.Add(currentUser(c).ID, r.ID); err != nil {
 			body, _ := json.Marshal(r)
-			l.Error(
-				"internal server error",
-				zap.String("uri", c.Request.RequestURI),
-				zap.String("body", string(body)),
-				zap.Error(err),
-			)
-
-			c.AbortWithStatus(http.StatusInternalServerError)
+			abortWithError(c, l, err, zap.String("body", string(body)))
+			return
 		}
+
+		c.AbortWithStatus(http.StatusCreated)
+
+		addCounterRequestDurationHistogram.With(nil).Observe(time.Since(start).Seconds())
+		defer countersNumberGauge.With(nil).Inc()
 	}
 }
 
@@ -58,26 +52,64 @@ func getCounter(l *zap.Logger, cm CounterManager) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id := ctx.Param("id")
 
-		c, err := cm.Get(id)
-
-		switch err {
-		case nil:
-			ctx.AbortWithStatusJSON(http.StatusOK, getCounterResponse{
-				ID:    c.ID,
-				Value: c.Value,
-			})
-		case counter.ErrNotFound:
-			ctx.AbortWithStatus(http.StatusNotFound)
-		default:
-			l.Error(
-				"internal server error",
-				zap.String("uri", ctx.Request.RequestURI),
-				zap.String("id", id),
-				zap.Error(err),
-			)
-
-			ctx.AbortWithStatus(http.StatusInternalServerError)
+		c, err := cm.Get(currentUser(ctx).ID, id)
+		if err != nil {
+			abortWithError(ctx, l, err, zap.String("id", id))
+			return
+		}
+
+		if notModified(ctx, c.Version) {
+			ctx.Header("ETag", etag(c.Version))
+			ctx.AbortWithStatus(http.StatusNotModified)
+			return
 		}
+
+		abortWithCounter(ctx, c)
+	}
+}
+
+type listCountersRequest struct {
+	Prefix string `form:"prefix"`
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=1000"`
+	Sort   string `form:"sort"`
+}
+
+type listCountersResponse struct {
+	Counters   []getCounterResponse `json:"counters"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+	Total      int                  `json:"total"`
+}
+
+func listCounters(l *zap.Logger, cm CounterManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var r listCountersRequest
+		if err := ctx.ShouldBindQuery(&r); err != nil {
+			abortWithError(ctx, l, invalidRequest(err))
+			return
+		}
+
+		page, err := cm.List(currentUser(ctx).ID, counter.ListOptions{
+			Prefix: r.Prefix,
+			Cursor: r.Cursor,
+			Limit:  r.Limit,
+			Sort:   counter.Sort(r.Sort),
+		})
+		if err != nil {
+			abortWithError(ctx, l, err)
+			return
+		}
+
+		resp := listCountersResponse{
+			Counters:   make([]getCounterResponse, 0, len(page.Counters)),
+			NextCursor: page.NextCursor,
+			Total:      page.Total,
+		}
+		for _, c := range page.Counters {
+			resp.Counters = append(resp.Counters, getCounterResponse{ID: c.ID, Value: c.Value})
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusOK, resp)
 	}
 }
 
@@ -85,25 +117,96 @@ func incCounter(l *zap.Logger, cm CounterManager) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id := ctx.Param("id")
 
-		err := cm.Inc(id)
+		if err := cm.Inc(currentUser(ctx).ID, id); err != nil {
+			abortWithError(ctx, l, err, zap.String("id", id))
+			return
+		}
+
+		ctx.AbortWithStatus(http.StatusOK)
+
+		defer incCounterCounter.With(nil).Inc()
+	}
+}
+
+// changeCounterRequest changes a counter by one when the delta or the whole
+// body is left out.
+type changeCounterRequest struct {
+	Delta *uint64 `json:"delta" binding:"omitempty,min=1"`
+}
+
+func incCounterBy(l *zap.Logger, cm CounterManager) gin.HandlerFunc {
+	return changeCounter(l, cm.IncBy, func() { incCounterCounter.With(nil).Inc() })
+}
+
+func decCounterBy(l *zap.Logger, cm CounterManager) gin.HandlerFunc {
+	return changeCounter(l, cm.DecBy, func() { decCounterCounter.With(nil).Inc() })
+}
+
+func changeCounter(
+	l *zap.Logger,
+	change func(user, id string, n uint64, cond counter.Condition) (*counter.Counter, error),
+	observe func(),
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+
+		var r changeCounterRequest
+		if err := ctx.ShouldBindJSON(&r); err != nil && !errors.Is(err, io.EOF) {
+			abortWithError(ctx, l, invalidRequest(err))
+			return
+		}
+		delta := uint64(1)
+		if r.Delta != nil {
+			delta = *r.Delta
+		}
+
+		c, err := change(currentUser(ctx).ID, id, delta, condition(ctx))
+		if err != nil {
+			abortWithError(ctx, l, err, zap.String("id", id), zap.Uint64("delta", delta))
+			return
+		}
+
+		abortWithCounter(ctx, c)
+
+		defer observe()
+	}
+}
+
+func resetCounter(l *zap.Logger, cm CounterManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+
+		c, err := cm.Reset(currentUser(ctx).ID, id, condition(ctx))
+		if err != nil {
+			abortWithError(ctx, l, err, zap.String("id", id))
+			return
+		}
+
+		abortWithCounter(ctx, c)
+	}
+}
+
+type setCounterRequest struct {
+	Value *uint64 `json:"value" binding:"required"`
+}
 
-		switch err {
-		case nil:
-			ctx.AbortWithStatus(http.StatusOK)
+func setCounter(l *zap.Logger, cm CounterManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
 
-			defer incCounterCounter.With(nil).Inc()
-		case counter.ErrNotFound:
-			ctx.AbortWithStatus(http.StatusNotFound)
-		default:
-			l.Error(
-				"internal server error",
-				zap.String("uri", ctx.Request.RequestURI),
-				zap.String("id", id),
-				zap.Error(err),
-			)
+		var r setCounterRequest
+		if err := ctx.ShouldBindJSON(&r); err != nil {
+			abortWithError(ctx, l, invalidRequest(err))
+			return
+		}
 
-			ctx.AbortWithStatus(http.StatusInternalServerError)
+		c, err := cm.Set(currentUser(ctx).ID, id, *r.Value, condition(ctx))
+		if err != nil {
+			abortWithError(ctx, l, err, zap.String("id", id), zap.Uint64("value", *r.Value))
+			return
 		}
+
+		abortWithCounter(ctx, c)
 	}
 }
 
@@ -111,24 +214,144 @@ func deleteCounter(l *zap.Logger, cm CounterManager) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id := ctx.Param("id")
 
-		err := cm.Delete(id)
+		if err := cm.Delete(currentUser(ctx).ID, id, condition(ctx)); err != nil {
+			abortWithError(ctx, l, err, zap.String("id", id))
+			return
+		}
+
+		ctx.AbortWithStatus(http.StatusNoContent)
 
-		switch err {
-		case nil:
-			ctx.AbortWithStatus(http.StatusNoContent)
+		defer countersNumberGauge.With(nil).Dec()
+	}
+}
 
-			defer countersNumberGauge.With(nil).Dec()
-		case counter.ErrNotFound:
-			ctx.AbortWithStatus(http.StatusNotFound)
-		default:
-			l.Error(
-				"internal server error",
-				zap.String("uri", ctx.Request.RequestURI),
-				zap.String("id", id),
-				zap.Error(err),
-			)
+type grantCounterRequest struct {
+	Permission counter.Permission `json:"permission" binding:"required"`
+}
 
-			ctx.AbortWithStatus(http.StatusInternalServerError)
+func grantCounter(l *zap.Logger, iamManager IAManager, cm CounterManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, email := ctx.Param("id"), ctx.Param("email")
+
+		var r grantCounterRequest
+		if err := ctx.ShouldBindJSON(&r); err != nil {
+			abortWithError(ctx, l, invalidRequest(err))
+			return
+		}
+
+		grantee, err := granteeByEmail(iamManager, email)
+		if err == nil {
+			err = cm.Grant(currentUser(ctx).ID, id, grantee.ID, r.Permission)
+		}
+		if err != nil {
+			abortWithError(ctx, l, err, zap.String("id", id), zap.String("email", email))
+			return
 		}
+
+		ctx.AbortWithStatus(http.StatusNoContent)
 	}
 }
+
+func revokeCounter(l *zap.Logger, iamManager IAManager, cm CounterManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, email := ctx.Param("id"), ctx.Param("email")
+
+		grantee, err := granteeByEmail(iamManager, email)
+		if err == nil {
+			err = cm.Revoke(currentUser(ctx).ID, id, grantee.ID)
+		}
+		if err != nil {
+			abortWithError(ctx, l, err, zap.String("id", id), zap.String("email", email))
+			return
+		}
+
+		ctx.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// granteeByEmail returns the user with the email. A missing user is an error
+// in the request rather than a missing resource.
+func granteeByEmail(iamManager IAManager, email string) (*iam.User, error) {
+	u, err := iamManager.User(email)
+	if errors.Is(err, iam.ErrUserNotFound) {
+		return nil, newError(CodeGranteeNotFound, err)
+	}
+
+	return u, err
+}
+
+// abortWithCounter responds with the counter and the ETag of its version.
+func abortWithCounter(ctx *gin.Context, c *counter.Counter) {
+	ctx.Header("ETag", etag(c.Version))
+	ctx.AbortWithStatusJSON(http.StatusOK, getCounterResponse{
+		ID:    c.ID,
+		Value: c.Value,
+	})
+}
+
+// etag returns the strong entity tag of a counter version.
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// parseETags returns the versions in an If-Match or If-None-Match header and
+// whether the header is "*". If-Match uses the strong comparison, so weak
+// tags are only parsed if weak is set. Tags that are not versions cannot
+// match and are skipped.
+func parseETags(header string, weak bool) (versions []uint64, star bool) {
+	versions = []uint64{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if v, err := strconv.ParseUint(tag[1:len(tag)-1], 10, 64); err == nil {
+			versions = append(versions, v)
+		}
+	}
+
+	return versions, false
+}
+
+// condition returns the condition of the If-Match and If-None-Match headers
+// of a change. No counter satisfies If-None-Match: *, since changes are only
+// made to existing counters.
+func condition(ctx *gin.Context) counter.Condition {
+	var cond counter.Condition
+	if h := ctx.GetHeader("If-Match"); h != "" {
+		if versions, star := parseETags(h, false); !star {
+			cond.IfMatch = versions
+		}
+	}
+	if h := ctx.GetHeader("If-None-Match"); h != "" {
+		versions, star := parseETags(h, true)
+		if star {
+			cond.IfMatch = []uint64{}
+		}
+		cond.IfNoneMatch = versions
+	}
+
+	return cond
+}
+
+// notModified reports whether the If-None-Match header of a read matches the
+// version.
+func notModified(ctx *gin.Context, version uint64) bool {
+	h := ctx.GetHeader("If-None-Match")
+	if h == "" {
+		return false
+	}
+
+	versions, star := parseETags(h, true)
+
+	return star || !(counter.Condition{IfNoneMatch: versions}).Holds(version)
+}
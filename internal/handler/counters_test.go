@@ -6,9 +6,11 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 
 	"counters/pkg/counter"
+	"counters/pkg/iam"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
@@ -26,7 +28,7 @@ func Test_addCounter(t *testing.T) {
 			cm: func(c *gomock.Controller) CounterManager {
 				cm := NewMockCounterManager(c)
 
-				cm.EXPECT().Add("id").Return(nil)
+				cm.EXPECT().Add("user", "id").Return(nil)
 
 				return cm
 			},
@@ -40,36 +42,37 @@ func Test_addCounter(t *testing.T) {
 			},
 			body:     ``,
 			wantCode: http.StatusBadRequest,
-			wantBody: `{"error":"EOF"}`,
+			wantBody: problemBody(CodeInvalidRequest, "EOF"),
 		},
 		"BadRequestCounterExists": {
 			cm: func(c *gomock.Controller) CounterManager {
 				cm := NewMockCounterManager(c)
 
-				cm.EXPECT().Add("id").Return(counter.ErrExists)
+				cm.EXPECT().Add("user", "id").Return(counter.ErrExists)
 
 				return cm
 			},
 			body:     `{"id":"id"}`,
 			wantCode: http.StatusBadRequest,
-			wantBody: `{"error":"counter exists"}`,
+			wantBody: problemBody(CodeCounterExists, "counter exists"),
 		},
 		"InternalServerError": {
 			cm: func(c *gomock.Controller) CounterManager {
 				cm := NewMockCounterManager(c)
 
-				cm.EXPECT().Add("id").Return(errors.New("unexpected error"))
+				cm.EXPECT().Add("user", "id").Return(errors.New("unexpected error"))
 
 				return cm
 			},
 			body:     `{"id":"id"}`,
 			wantCode: http.StatusInternalServerError,
-			wantBody: ``,
+			wantBody: problemBody(CodeInternal, ""),
 		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
+			c.Set(userKey, &iam.User{ID: "user"})
 			c.Request = &http.Request{
 				Body: io.NopCloser(bytes.NewBufferString(tt.body)),
 			}
@@ -86,11 +89,114 @@ func Test_addCounter(t *testing.T) {
 	}
 }
 
+func Test_listCounters(t *testing.T) {
+	for name, tt := range map[string]struct {
+		cm       func(c *gomock.Controller) CounterManager
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		"OK": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					List("user", counter.ListOptions{Prefix: "id", Cursor: "cursor", Limit: 1, Sort: counter.SortByValue}).
+					Return(
+						&counter.Page{
+							Counters:   []*counter.Counter{{ID: "id1", Value: 1}},
+							NextCursor: "next",
+							Total:      2,
+						},
+						nil,
+					)
+
+				return cm
+			},
+			query:    "prefix=id&cursor=cursor&limit=1&sort=value",
+			wantCode: http.StatusOK,
+			wantBody: `{"counters":[{"id":"id1","value":1}],"next_cursor":"next","total":2}`,
+		},
+		"OKEmpty": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					List("user", counter.ListOptions{}).
+					Return(&counter.Page{}, nil)
+
+				return cm
+			},
+			query:    "",
+			wantCode: http.StatusOK,
+			wantBody: `{"counters":[],"total":0}`,
+		},
+		"BadRequestInvalidLimit": {
+			cm: func(c *gomock.Controller) CounterManager {
+				return NewMockCounterManager(c)
+			},
+			query:    "limit=1001",
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"type":"urn:counters:error:invalid_request","title":"Invalid request","status":400,"detail":"Key: 'listCountersRequest.Limit' Error:Field validation for 'Limit' failed on the 'max' tag","code":"invalid_request","details":{"fields":{"Limit":"max"}}}`,
+		},
+		"BadRequestInvalidCursor": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					List("user", counter.ListOptions{Cursor: "cursor"}).
+					Return(nil, counter.ErrInvalidCursor)
+
+				return cm
+			},
+			query:    "cursor=cursor",
+			wantCode: http.StatusBadRequest,
+			wantBody: problemBody(CodeInvalidCursor, "invalid cursor"),
+		},
+		"InternalServerError": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					List("user", counter.ListOptions{}).
+					Return(nil, errors.New("unexpected error"))
+
+				return cm
+			},
+			query:    "",
+			wantCode: http.StatusInternalServerError,
+			wantBody: problemBody(CodeInternal, ""),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(userKey, &iam.User{ID: "user"})
+			c.Request = httptest.NewRequest(http.MethodGet, "/counters?"+tt.query, nil)
+
+			listCounters(zap.NewNop(), tt.cm(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
 func Test_getCounter(t *testing.T) {
 	for name, tt := range map[string]struct {
 		cm       func(c *gomock.Controller) CounterManager
 		id       string
+		header   http.Header
 		wantCode int
+		wantETag string
 		wantBody string
 	}{
 		"OK": {
@@ -99,25 +205,66 @@ func Test_getCounter(t *testing.T) {
 
 				cm.
 					EXPECT().
-					Get("id").
+					Get("user", "id").
+					Return(
+						&counter.Counter{ID: "id", Value: 1, Version: 3},
+						nil,
+					)
+
+				return cm
+			},
+			id:       "id",
+			wantCode: http.StatusOK,
+			wantETag: `"3"`,
+			wantBody: `{"id":"id","value":1}`,
+		},
+		"OKModified": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					Get("user", "id").
 					Return(
-						&counter.Counter{ID: "id", Value: 1},
+						&counter.Counter{ID: "id", Value: 1, Version: 3},
 						nil,
 					)
 
 				return cm
 			},
 			id:       "id",
+			header:   http.Header{"If-None-Match": {`"1", "2"`}},
 			wantCode: http.StatusOK,
+			wantETag: `"3"`,
 			wantBody: `{"id":"id","value":1}`,
 		},
+		"NotModified": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					Get("user", "id").
+					Return(
+						&counter.Counter{ID: "id", Value: 1, Version: 3},
+						nil,
+					)
+
+				return cm
+			},
+			id:       "id",
+			header:   http.Header{"If-None-Match": {`"2", W/"3"`}},
+			wantCode: http.StatusNotModified,
+			wantETag: `"3"`,
+			wantBody: ``,
+		},
 		"NotFound": {
 			cm: func(c *gomock.Controller) CounterManager {
 				cm := NewMockCounterManager(c)
 
 				cm.
 					EXPECT().
-					Get("id").
+					Get("user", "id").
 					Return(
 						nil,
 						counter.ErrNotFound,
@@ -127,7 +274,7 @@ func Test_getCounter(t *testing.T) {
 			},
 			id:       "id",
 			wantCode: http.StatusNotFound,
-			wantBody: ``,
+			wantBody: problemBody(CodeCounterNotFound, "counter not found"),
 		},
 		"InternalServerError": {
 			cm: func(c *gomock.Controller) CounterManager {
@@ -135,7 +282,7 @@ func Test_getCounter(t *testing.T) {
 
 				cm.
 					EXPECT().
-					Get("id").
+					Get("user", "id").
 					Return(
 						nil,
 						errors.New("unexpected error"),
@@ -145,13 +292,14 @@ func Test_getCounter(t *testing.T) {
 			},
 			id:       "id",
 			wantCode: http.StatusInternalServerError,
-			wantBody: ``,
+			wantBody: problemBody(CodeInternal, ""),
 		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
-			c.Request = &http.Request{}
+			c.Set(userKey, &iam.User{ID: "user"})
+			c.Request = &http.Request{Header: tt.header}
 			c.Params = []gin.Param{{Key: "id", Value: tt.id}}
 
 			getCounter(zap.NewNop(), tt.cm(gomock.NewController(t)))(c)
@@ -159,6 +307,9 @@ func Test_getCounter(t *testing.T) {
 			if w.Code != tt.wantCode {
 				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
 			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("want ETag: %s, got: %s", tt.wantETag, got)
+			}
 			if w.Body.String() != tt.wantBody {
 				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
 			}
@@ -171,12 +322,13 @@ func Test_incCounter(t *testing.T) {
 		cm       func(c *gomock.Controller) CounterManager
 		id       string
 		wantCode int
+		wantBody string
 	}{
 		"OK": {
 			cm: func(c *gomock.Controller) CounterManager {
 				cm := NewMockCounterManager(c)
 
-				cm.EXPECT().Inc("id").Return(nil)
+				cm.EXPECT().Inc("user", "id").Return(nil)
 
 				return cm
 			},
@@ -187,28 +339,31 @@ func Test_incCounter(t *testing.T) {
 			cm: func(c *gomock.Controller) CounterManager {
 				cm := NewMockCounterManager(c)
 
-				cm.EXPECT().Inc("id").Return(counter.ErrNotFound)
+				cm.EXPECT().Inc("user", "id").Return(counter.ErrNotFound)
 
 				return cm
 			},
 			id:       "id",
 			wantCode: http.StatusNotFound,
+			wantBody: problemBody(CodeCounterNotFound, "counter not found"),
 		},
 		"InternalServerError": {
 			cm: func(c *gomock.Controller) CounterManager {
 				cm := NewMockCounterManager(c)
 
-				cm.EXPECT().Inc("id").Return(errors.New("unexpected error"))
+				cm.EXPECT().Inc("user", "id").Return(errors.New("unexpected error"))
 
 				return cm
 			},
 			id:       "id",
 			wantCode: http.StatusInternalServerError,
+			wantBody: problemBody(CodeInternal, ""),
 		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
+			c.Set(userKey, &iam.User{ID: "user"})
 			c.Request = &http.Request{}
 			c.Params = []gin.Param{{Key: "id", Value: tt.id}}
 
@@ -217,8 +372,8 @@ func Test_incCounter(t *testing.T) {
 			if w.Code != tt.wantCode {
 				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
 			}
-			if w.Body.String() != "" {
-				t.Errorf("want body: , got: %s", w.Body.String())
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
 			}
 		})
 	}
@@ -228,46 +383,76 @@ func Test_deleteCounter(t *testing.T) {
 	for name, tt := range map[string]struct {
 		cm       func(c *gomock.Controller) CounterManager
 		id       string
+		header   http.Header
 		wantCode int
+		wantBody string
 	}{
 		"OK": {
 			cm: func(c *gomock.Controller) CounterManager {
 				cm := NewMockCounterManager(c)
 
-				cm.EXPECT().Delete("id").Return(nil)
+				cm.EXPECT().Delete("user", "id", counter.Condition{}).Return(nil)
 
 				return cm
 			},
 			id:       "id",
 			wantCode: http.StatusNoContent,
 		},
+		"PreconditionFailed": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.EXPECT().Delete("user", "id", counter.Condition{IfMatch: []uint64{1}}).Return(counter.ErrPreconditionFailed)
+
+				return cm
+			},
+			id:       "id",
+			header:   http.Header{"If-Match": {`"1"`}},
+			wantCode: http.StatusPreconditionFailed,
+			wantBody: problemBody(CodePreconditionFailed, "precondition failed"),
+		},
 		"NotFound": {
 			cm: func(c *gomock.Controller) CounterManager {
 				cm := NewMockCounterManager(c)
 
-				cm.EXPECT().Delete("id").Return(counter.ErrNotFound)
+				cm.EXPECT().Delete("user", "id", counter.Condition{}).Return(counter.ErrNotFound)
 
 				return cm
 			},
 			id:       "id",
 			wantCode: http.StatusNotFound,
+			wantBody: problemBody(CodeCounterNotFound, "counter not found"),
+		},
+		"Forbidden": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.EXPECT().Delete("user", "id", counter.Condition{}).Return(counter.ErrForbidden)
+
+				return cm
+			},
+			id:       "id",
+			wantCode: http.StatusForbidden,
+			wantBody: problemBody(CodeCounterForbidden, "forbidden"),
 		},
 		"InternalServerError": {
 			cm: func(c *gomock.Controller) CounterManager {
 				cm := NewMockCounterManager(c)
 
-				cm.EXPECT().Delete("id").Return(errors.New("unexpected error"))
+				cm.EXPECT().Delete("user", "id", counter.Condition{}).Return(errors.New("unexpected error"))
 
 				return cm
 			},
 			id:       "id",
 			wantCode: http.StatusInternalServerError,
+			wantBody: problemBody(CodeInternal, ""),
 		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
-			c.Request = &http.Request{}
+			c.Set(userKey, &iam.User{ID: "user"})
+			c.Request = &http.Request{Header: tt.header}
 			c.Params = []gin.Param{{Key: "id", Value: tt.id}}
 
 			deleteCounter(zap.NewNop(), tt.cm(gomock.NewController(t)))(c)
@@ -275,8 +460,605 @@ func Test_deleteCounter(t *testing.T) {
 			if w.Code != tt.wantCode {
 				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
 			}
-			if w.Body.String() != "" {
-				t.Errorf("want body: , got: %s", w.Body.String())
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_incCounterBy(t *testing.T) {
+	for name, tt := range map[string]struct {
+		cm       func(c *gomock.Controller) CounterManager
+		id       string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		"OK": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					IncBy("user", "id", uint64(5), counter.Condition{}).
+					Return(&counter.Counter{ID: "id", Value: 6}, nil)
+
+				return cm
+			},
+			id:       "id",
+			body:     `{"delta":5}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"id":"id","value":6}`,
+		},
+		"OKEmptyBody": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					IncBy("user", "id", uint64(1), counter.Condition{}).
+					Return(&counter.Counter{ID: "id", Value: 2}, nil)
+
+				return cm
+			},
+			id:       "id",
+			body:     ``,
+			wantCode: http.StatusOK,
+			wantBody: `{"id":"id","value":2}`,
+		},
+		"BadRequestInvalidBody": {
+			cm: func(c *gomock.Controller) CounterManager {
+				return NewMockCounterManager(c)
+			},
+			id:       "id",
+			body:     `{`,
+			wantCode: http.StatusBadRequest,
+			wantBody: problemBody(CodeInvalidRequest, "unexpected EOF"),
+		},
+		"BadRequestZeroDelta": {
+			cm: func(c *gomock.Controller) CounterManager {
+				return NewMockCounterManager(c)
+			},
+			id:       "id",
+			body:     `{"delta":0}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"type":"urn:counters:error:invalid_request","title":"Invalid request","status":400,"detail":"Key: 'changeCounterRequest.Delta' Error:Field validation for 'Delta' failed on the 'min' tag","code":"invalid_request","details":{"fields":{"Delta":"min"}}}`,
+		},
+		"BadRequestOverflow": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					IncBy("user", "id", uint64(5), counter.Condition{}).
+					Return(nil, counter.ErrOverflow)
+
+				return cm
+			},
+			id:       "id",
+			body:     `{"delta":5}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: problemBody(CodeCounterOverflow, "counter overflow"),
+		},
+		"NotFound": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					IncBy("user", "id", uint64(5), counter.Condition{}).
+					Return(nil, counter.ErrNotFound)
+
+				return cm
+			},
+			id:       "id",
+			body:     `{"delta":5}`,
+			wantCode: http.StatusNotFound,
+			wantBody: problemBody(CodeCounterNotFound, "counter not found"),
+		},
+		"InternalServerError": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					IncBy("user", "id", uint64(5), counter.Condition{}).
+					Return(nil, errors.New("unexpected error"))
+
+				return cm
+			},
+			id:       "id",
+			body:     `{"delta":5}`,
+			wantCode: http.StatusInternalServerError,
+			wantBody: problemBody(CodeInternal, ""),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(userKey, &iam.User{ID: "user"})
+			c.Request = &http.Request{
+				Body: io.NopCloser(bytes.NewBufferString(tt.body)),
+			}
+			c.Params = []gin.Param{{Key: "id", Value: tt.id}}
+
+			incCounterBy(zap.NewNop(), tt.cm(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_decCounterBy(t *testing.T) {
+	for name, tt := range map[string]struct {
+		cm       func(c *gomock.Controller) CounterManager
+		id       string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		"OK": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					DecBy("user", "id", uint64(2), counter.Condition{}).
+					Return(&counter.Counter{ID: "id", Value: 1}, nil)
+
+				return cm
+			},
+			id:       "id",
+			body:     `{"delta":2}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"id":"id","value":1}`,
+		},
+		"BadRequestUnderflow": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					DecBy("user", "id", uint64(2), counter.Condition{}).
+					Return(nil, counter.ErrUnderflow)
+
+				return cm
+			},
+			id:       "id",
+			body:     `{"delta":2}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: problemBody(CodeCounterUnderflow, "counter underflow"),
+		},
+		"NotFound": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					DecBy("user", "id", uint64(2), counter.Condition{}).
+					Return(nil, counter.ErrNotFound)
+
+				return cm
+			},
+			id:       "id",
+			body:     `{"delta":2}`,
+			wantCode: http.StatusNotFound,
+			wantBody: problemBody(CodeCounterNotFound, "counter not found"),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(userKey, &iam.User{ID: "user"})
+			c.Request = &http.Request{
+				Body: io.NopCloser(bytes.NewBufferString(tt.body)),
+			}
+			c.Params = []gin.Param{{Key: "id", Value: tt.id}}
+
+			decCounterBy(zap.NewNop(), tt.cm(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_resetCounter(t *testing.T) {
+	for name, tt := range map[string]struct {
+		cm       func(c *gomock.Controller) CounterManager
+		id       string
+		wantCode int
+		wantBody string
+	}{
+		"OK": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					Reset("user", "id", counter.Condition{}).
+					Return(&counter.Counter{ID: "id", Value: 0}, nil)
+
+				return cm
+			},
+			id:       "id",
+			wantCode: http.StatusOK,
+			wantBody: `{"id":"id","value":0}`,
+		},
+		"NotFound": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					Reset("user", "id", counter.Condition{}).
+					Return(nil, counter.ErrNotFound)
+
+				return cm
+			},
+			id:       "id",
+			wantCode: http.StatusNotFound,
+			wantBody: problemBody(CodeCounterNotFound, "counter not found"),
+		},
+		"InternalServerError": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					Reset("user", "id", counter.Condition{}).
+					Return(nil, errors.New("unexpected error"))
+
+				return cm
+			},
+			id:       "id",
+			wantCode: http.StatusInternalServerError,
+			wantBody: problemBody(CodeInternal, ""),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(userKey, &iam.User{ID: "user"})
+			c.Request = &http.Request{}
+			c.Params = []gin.Param{{Key: "id", Value: tt.id}}
+
+			resetCounter(zap.NewNop(), tt.cm(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_setCounter(t *testing.T) {
+	for name, tt := range map[string]struct {
+		cm       func(c *gomock.Controller) CounterManager
+		id       string
+		header   http.Header
+		body     string
+		wantCode int
+		wantETag string
+		wantBody string
+	}{
+		"OK": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					Set("user", "id", uint64(0), counter.Condition{}).
+					Return(&counter.Counter{ID: "id", Value: 0, Version: 2}, nil)
+
+				return cm
+			},
+			id:       "id",
+			body:     `{"value":0}`,
+			wantCode: http.StatusOK,
+			wantETag: `"2"`,
+			wantBody: `{"id":"id","value":0}`,
+		},
+		"OKIfMatch": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					Set("user", "id", uint64(10), counter.Condition{IfMatch: []uint64{1}}).
+					Return(&counter.Counter{ID: "id", Value: 10, Version: 2}, nil)
+
+				return cm
+			},
+			id:       "id",
+			header:   http.Header{"If-Match": {`"1"`}},
+			body:     `{"value":10}`,
+			wantCode: http.StatusOK,
+			wantETag: `"2"`,
+			wantBody: `{"id":"id","value":10}`,
+		},
+		"PreconditionFailed": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					Set("user", "id", uint64(10), counter.Condition{IfMatch: []uint64{1}}).
+					Return(nil, counter.ErrPreconditionFailed)
+
+				return cm
+			},
+			id:       "id",
+			header:   http.Header{"If-Match": {`"1"`}},
+			body:     `{"value":10}`,
+			wantCode: http.StatusPreconditionFailed,
+			wantBody: problemBody(CodePreconditionFailed, "precondition failed"),
+		},
+		"BadRequestMissingValue": {
+			cm: func(c *gomock.Controller) CounterManager {
+				return NewMockCounterManager(c)
+			},
+			id:       "id",
+			body:     `{}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"type":"urn:counters:error:invalid_request","title":"Invalid request","status":400,"detail":"Key: 'setCounterRequest.Value' Error:Field validation for 'Value' failed on the 'required' tag","code":"invalid_request","details":{"fields":{"Value":"required"}}}`,
+		},
+		"NotFound": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					Set("user", "id", uint64(10), counter.Condition{}).
+					Return(nil, counter.ErrNotFound)
+
+				return cm
+			},
+			id:       "id",
+			body:     `{"value":10}`,
+			wantCode: http.StatusNotFound,
+			wantBody: problemBody(CodeCounterNotFound, "counter not found"),
+		},
+		"InternalServerError": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.
+					EXPECT().
+					Set("user", "id", uint64(10), counter.Condition{}).
+					Return(nil, errors.New("unexpected error"))
+
+				return cm
+			},
+			id:       "id",
+			body:     `{"value":10}`,
+			wantCode: http.StatusInternalServerError,
+			wantBody: problemBody(CodeInternal, ""),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(userKey, &iam.User{ID: "user"})
+			c.Request = &http.Request{
+				Header: tt.header,
+				Body:   io.NopCloser(bytes.NewBufferString(tt.body)),
+			}
+			c.Params = []gin.Param{{Key: "id", Value: tt.id}}
+
+			setCounter(zap.NewNop(), tt.cm(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("want ETag: %s, got: %s", tt.wantETag, got)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_grantCounter(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		cm       func(c *gomock.Controller) CounterManager
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		"NoContent": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().User("x@x.x").Return(&iam.User{ID: "grantee"}, nil)
+
+				return m
+			},
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.EXPECT().Grant("user", "id", "grantee", counter.PermissionWrite).Return(nil)
+
+				return cm
+			},
+			body:     `{"permission":"write"}`,
+			wantCode: http.StatusNoContent,
+			wantBody: ``,
+		},
+		"BadRequestUserNotFound": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().User("x@x.x").Return(nil, iam.ErrUserNotFound)
+
+				return m
+			},
+			cm: func(c *gomock.Controller) CounterManager {
+				return NewMockCounterManager(c)
+			},
+			body:     `{"permission":"write"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: problemBody(CodeGranteeNotFound, "user not found"),
+		},
+		"BadRequestInvalidPermission": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().User("x@x.x").Return(&iam.User{ID: "grantee"}, nil)
+
+				return m
+			},
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.EXPECT().Grant("user", "id", "grantee", counter.Permission("admin")).Return(counter.ErrInvalidPermission)
+
+				return cm
+			},
+			body:     `{"permission":"admin"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: problemBody(CodeInvalidPermission, "invalid permission"),
+		},
+		"Forbidden": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().User("x@x.x").Return(&iam.User{ID: "grantee"}, nil)
+
+				return m
+			},
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.EXPECT().Grant("user", "id", "grantee", counter.PermissionRead).Return(counter.ErrForbidden)
+
+				return cm
+			},
+			body:     `{"permission":"read"}`,
+			wantCode: http.StatusForbidden,
+			wantBody: problemBody(CodeCounterForbidden, "forbidden"),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(userKey, &iam.User{ID: "user"})
+			c.Request = &http.Request{
+				Body: io.NopCloser(bytes.NewBufferString(tt.body)),
+			}
+			c.Params = []gin.Param{{Key: "id", Value: "id"}, {Key: "email", Value: "x@x.x"}}
+
+			ctrl := gomock.NewController(t)
+			grantCounter(zap.NewNop(), tt.iam(ctrl), tt.cm(ctrl))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_revokeCounter(t *testing.T) {
+	for name, tt := range map[string]struct {
+		cm       func(c *gomock.Controller) CounterManager
+		wantCode int
+	}{
+		"NoContent": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.EXPECT().Revoke("user", "id", "grantee").Return(nil)
+
+				return cm
+			},
+			wantCode: http.StatusNoContent,
+		},
+		"NotFound": {
+			cm: func(c *gomock.Controller) CounterManager {
+				cm := NewMockCounterManager(c)
+
+				cm.EXPECT().Revoke("user", "id", "grantee").Return(counter.ErrNotFound)
+
+				return cm
+			},
+			wantCode: http.StatusNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(userKey, &iam.User{ID: "user"})
+			c.Request = &http.Request{}
+			c.Params = []gin.Param{{Key: "id", Value: "id"}, {Key: "email", Value: "x@x.x"}}
+
+			ctrl := gomock.NewController(t)
+			iamManager := NewMockIAManager(ctrl)
+			iamManager.EXPECT().User("x@x.x").Return(&iam.User{ID: "grantee"}, nil)
+
+			revokeCounter(zap.NewNop(), iamManager, tt.cm(ctrl))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func Test_condition(t *testing.T) {
+	for name, tt := range map[string]struct {
+		header http.Header
+		want   counter.Condition
+	}{
+		"None": {
+			header: http.Header{},
+			want:   counter.Condition{},
+		},
+		"IfMatch": {
+			header: http.Header{"If-Match": {`"1", W/"2", "x", "3"`}},
+			want:   counter.Condition{IfMatch: []uint64{1, 3}},
+		},
+		"IfMatchInvalid": {
+			header: http.Header{"If-Match": {`W/"1"`}},
+			want:   counter.Condition{IfMatch: []uint64{}},
+		},
+		"IfMatchAny": {
+			header: http.Header{"If-Match": {`*`}},
+			want:   counter.Condition{},
+		},
+		"IfNoneMatch": {
+			header: http.Header{"If-None-Match": {`"1", W/"2"`}},
+			want:   counter.Condition{IfNoneMatch: []uint64{1, 2}},
+		},
+		"IfNoneMatchAny": {
+			header: http.Header{"If-None-Match": {`*`}},
+			want:   counter.Condition{IfMatch: []uint64{}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = &http.Request{Header: tt.header}
+
+			if got := condition(c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want: %+v, got: %+v", tt.want, got)
 			}
 		})
 	}
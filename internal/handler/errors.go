@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"counters/pkg/counter"
+	"counters/pkg/iam"
+	"counters/pkg/idempotency"
+	"counters/pkg/oauth2"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+)
+
+// Code identifies the kind of an error response. Clients switch on codes, so
+// codes are never changed or reused once released. The catalogue is
+// documented in README.md.
+type Code string
+
+const (
+	CodeInternal           Code = "internal"
+	CodeInvalidRequest     Code = "invalid_request"
+	CodeRouteNotFound      Code = "route_not_found"
+	CodeMethodNotAllowed   Code = "method_not_allowed"
+	CodeUnauthorized       Code = "unauthorized"
+	CodeForbidden          Code = "forbidden"
+	CodeSessionRequired    Code = "session_required"
+	CodeProviderNotFound   Code = "provider_not_found"
+	CodeInvalidState       Code = "invalid_state"
+	CodeInvalidCode        Code = "invalid_code"
+	CodeInvalidIDToken     Code = "invalid_id_token"
+	CodeInvalidEmail       Code = "invalid_email"
+	CodeUnverifiedEmail    Code = "unverified_email"
+	CodeSignUpNotAllowed   Code = "sign_up_not_allowed"
+	CodeInvitationRequired Code = "invitation_required"
+	CodeInvalidInvitation  Code = "invalid_invitation"
+	CodeInvitationNotFound Code = "invitation_not_found"
+	CodeIdentityNotLinked  Code = "identity_not_linked"
+	CodeIdentityLinked     Code = "identity_linked"
+	CodeUserNotFound       Code = "user_not_found"
+	CodeInvalidRole        Code = "invalid_role"
+	CodeConfiguredAdmin    Code = "configured_admin"
+	CodeInvalidCursor      Code = "invalid_cursor"
+	CodeInvalidAPIKey      Code = "invalid_api_key"
+	CodeAPIKeyNotFound     Code = "api_key_not_found"
+	CodeCounterNotFound    Code = "counter_not_found"
+	CodeCounterExists      Code = "counter_exists"
+	CodeCounterForbidden   Code = "counter_forbidden"
+	CodeInvalidSort        Code = "invalid_sort"
+	CodeCounterOverflow    Code = "counter_overflow"
+	CodeCounterUnderflow   Code = "counter_underflow"
+	CodePreconditionFailed Code = "precondition_failed"
+	CodeInvalidPermission  Code = "invalid_permission"
+	CodeInvalidGrantee     Code = "invalid_grantee"
+	CodeGranteeNotFound    Code = "grantee_not_found"
+	CodeIdempotencyInUse   Code = "idempotency_key_in_use"
+	CodeIdempotencyReused  Code = "idempotency_key_reused"
+)
+
+// catalogue holds the status and title of every code.
+var catalogue = map[Code]struct {
+	status int
+	title  string
+}{
+	CodeInternal:           {http.StatusInternalServerError, "Internal server error"},
+	CodeInvalidRequest:     {http.StatusBadRequest, "Invalid request"},
+	CodeRouteNotFound:      {http.StatusNotFound, "Route not found"},
+	CodeMethodNotAllowed:   {http.StatusMethodNotAllowed, "Method not allowed"},
+	CodeUnauthorized:       {http.StatusUnauthorized, "Authentication required"},
+	CodeForbidden:          {http.StatusForbidden, "Permission denied"},
+	CodeSessionRequired:    {http.StatusForbidden, "Session required"},
+	CodeProviderNotFound:   {http.StatusNotFound, "OAuth2 provider not found"},
+	CodeInvalidState:       {http.StatusBadRequest, "Invalid OAuth2 state"},
+	CodeInvalidCode:        {http.StatusBadRequest, "Invalid OAuth2 code"},
+	CodeInvalidIDToken:     {http.StatusBadRequest, "Invalid ID token"},
+	CodeInvalidEmail:       {http.StatusBadRequest, "Invalid email"},
+	CodeUnverifiedEmail:    {http.StatusForbidden, "Email not verified"},
+	CodeSignUpNotAllowed:   {http.StatusForbidden, "Sign-up not allowed"},
+	CodeInvitationRequired: {http.StatusForbidden, "Invitation required"},
+	CodeInvalidInvitation:  {http.StatusForbidden, "Invalid invitation"},
+	CodeInvitationNotFound: {http.StatusNotFound, "Invitation not found"},
+	CodeIdentityNotLinked:  {http.StatusConflict, "Identity not linked"},
+	CodeIdentityLinked:     {http.StatusConflict, "Identity linked to another user"},
+	CodeUserNotFound:       {http.StatusNotFound, "User not found"},
+	CodeInvalidRole:        {http.StatusBadRequest, "Invalid role"},
+	CodeConfiguredAdmin:    {http.StatusConflict, "Admin granted by configuration"},
+	CodeInvalidCursor:      {http.StatusBadRequest, "Invalid cursor"},
+	CodeInvalidAPIKey:      {http.StatusBadRequest, "Invalid API key"},
+	CodeAPIKeyNotFound:     {http.StatusNotFound, "API key not found"},
+	CodeCounterNotFound:    {http.StatusNotFound, "Counter not found"},
+	CodeCounterExists:      {http.StatusBadRequest, "Counter exists"},
+	CodeCounterForbidden:   {http.StatusForbidden, "Counter access denied"},
+	CodeInvalidSort:        {http.StatusBadRequest, "Invalid sort"},
+	CodeCounterOverflow:    {http.StatusBadRequest, "Counter overflow"},
+	CodeCounterUnderflow:   {http.StatusBadRequest, "Counter underflow"},
+	CodePreconditionFailed: {http.StatusPreconditionFailed, "Precondition failed"},
+	CodeInvalidPermission:  {http.StatusBadRequest, "Invalid permission"},
+	CodeInvalidGrantee:     {http.StatusBadRequest, "Invalid grantee"},
+	CodeGranteeNotFound:    {http.StatusBadRequest, "Grantee not found"},
+	CodeIdempotencyInUse:   {http.StatusConflict, "Idempotency key in use"},
+	CodeIdempotencyReused:  {http.StatusUnprocessableEntity, "Idempotency key reused"},
+}
+
+var (
+	errRouteNotFound    = errors.New("route not found")
+	errMethodNotAllowed = errors.New("method not allowed")
+	errUnauthorized     = errors.New("bearer token required")
+	errForbidden        = errors.New("forbidden")
+	errSessionRequired  = errors.New("API keys cannot be used here")
+)
+
+// errorCodes maps errors to their codes. Errors that are wrapped by an Error
+// or not listed are internal.
+var errorCodes = []struct {
+	err  error
+	code Code
+}{
+	{errRouteNotFound, CodeRouteNotFound},
+	{errMethodNotAllowed, CodeMethodNotAllowed},
+	{errUnauthorized, CodeUnauthorized},
+	{iam.ErrInvalidToken, CodeUnauthorized},
+	{errForbidden, CodeForbidden},
+	{errSessionRequired, CodeSessionRequired},
+	{iam.ErrInvalidOAuth2Provider, CodeProviderNotFound},
+	{oauth2.ErrInvalidState, CodeInvalidState},
+	{oauth2.ErrInvalidCode, CodeInvalidCode},
+	{oauth2.ErrInvalidIDToken, CodeInvalidIDToken},
+	{iam.ErrInvalidEmail, CodeInvalidEmail},
+	{iam.ErrUnverifiedEmail, CodeUnverifiedEmail},
+	{iam.ErrSignUpNotAllowed, CodeSignUpNotAllowed},
+	{iam.ErrInvitationRequired, CodeInvitationRequired},
+	{iam.ErrInvalidInvitation, CodeInvalidInvitation},
+	{iam.ErrInvitationNotFound, CodeInvitationNotFound},
+	{iam.ErrIdentityNotLinked, CodeIdentityNotLinked},
+	{iam.ErrIdentityLinked, CodeIdentityLinked},
+	{iam.ErrUserNotFound, CodeUserNotFound},
+	{iam.ErrInvalidRole, CodeInvalidRole},
+	{iam.ErrConfiguredAdmin, CodeConfiguredAdmin},
+	{iam.ErrInvalidCursor, CodeInvalidCursor},
+	{counter.ErrInvalidCursor, CodeInvalidCursor},
+	{iam.ErrInvalidAPIKey, CodeInvalidAPIKey},
+	{iam.ErrAPIKeyNotFound, CodeAPIKeyNotFound},
+	{counter.ErrNotFound, CodeCounterNotFound},
+	{counter.ErrExists, CodeCounterExists},
+	{counter.ErrForbidden, CodeCounterForbidden},
+	{counter.ErrInvalidSort, CodeInvalidSort},
+	{counter.ErrOverflow, CodeCounterOverflow},
+	{counter.ErrUnderflow, CodeCounterUnderflow},
+	{counter.ErrPreconditionFailed, CodePreconditionFailed},
+	{counter.ErrInvalidPermission, CodeInvalidPermission},
+	{counter.ErrInvalidGrantee, CodeInvalidGrantee},
+	{idempotency.ErrInProgress, CodeIdempotencyInUse},
+	{idempotency.ErrMismatch, CodeIdempotencyReused},
+}
+
+// Error is an error with a code from the catalogue. Details carry data
+// clients can act on, such as the invalid fields of a request.
+type Error struct {
+	Code    Code
+	Status  int
+	Message string
+	Details map[string]any
+	Err     error
+}
+
+// newError returns an error with the code for the cause.
+func newError(code Code, err error) *Error {
+	return &Error{
+		Code:    code,
+		Status:  catalogue[code].status,
+		Message: err.Error(),
+		Err:     err,
+	}
+}
+
+// invalidRequest returns an error for a request that could not be bound,
+// listing the fields that failed validation.
+func invalidRequest(err error) *Error {
+	e := newError(CodeInvalidRequest, err)
+
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		fields := make(map[string]string, len(verrs))
+		for _, v := range verrs {
+			fields[v.Field()] = v.Tag()
+		}
+		e.Details = map[string]any{"fields": fields}
+	}
+
+	return e
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// asError maps the error to an Error by the catalogue.
+func asError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return newError(c.code, err)
+		}
+	}
+
+	return newError(CodeInternal, err)
+}
+
+// problem is an RFC 7807 problem details object.
+type problem struct {
+	Type    string         `json:"type"`
+	Title   string         `json:"title"`
+	Status  int            `json:"status"`
+	Detail  string         `json:"detail,omitempty"`
+	Code    Code           `json:"code"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+const problemContentType = "application/problem+json"
+
+// abortWithError writes the error as a problem. Internal errors are logged
+// with the fields and their messages are not exposed.
+func abortWithError(c *gin.Context, l *zap.Logger, err error, fields ...zap.Field) {
+	e := asError(err)
+
+	if e.Code == CodeInternal {
+		l.Error(
+			"internal server error",
+			append([]zap.Field{zap.String("uri", c.Request.RequestURI)}, append(fields, zap.Error(err))...)...,
+		)
+	}
+
+	abortWithProblem(c, e)
+}
+
+func abortWithProblem(c *gin.Context, e *Error) {
+	p := problem{
+		Type:    "urn:counters:error:" + string(e.Code),
+		Title:   catalogue[e.Code].title,
+		Status:  e.Status,
+		Code:    e.Code,
+		Details: e.Details,
+	}
+	if e.Code != CodeInternal {
+		p.Detail = e.Message
+	}
+	if e.Status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", "Bearer")
+	}
+
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(e.Status, p)
+}
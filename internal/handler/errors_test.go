@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"counters/pkg/counter"
+	"counters/pkg/iam"
+	"counters/pkg/oauth2"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// problemBody returns the problem written for the code with the detail.
+func problemBody(code Code, detail string) string {
+	if detail == "" {
+		return fmt.Sprintf(
+			`{"type":"urn:counters:error:%s","title":%q,"status":%d,"code":"%s"}`,
+			code, catalogue[code].title, catalogue[code].status, code,
+		)
+	}
+
+	return fmt.Sprintf(
+		`{"type":"urn:counters:error:%s","title":%q,"status":%d,"detail":%q,"code":"%s"}`,
+		code, catalogue[code].title, catalogue[code].status, detail, code,
+	)
+}
+
+func Test_asError(t *testing.T) {
+	for name, tt := range map[string]struct {
+		err        error
+		wantCode   Code
+		wantStatus int
+	}{
+		"Sentinel": {
+			err:        counter.ErrNotFound,
+			wantCode:   CodeCounterNotFound,
+			wantStatus: http.StatusNotFound,
+		},
+		"Wrapped": {
+			err:        fmt.Errorf("exchange: %w", oauth2.ErrInvalidCode),
+			wantCode:   CodeInvalidCode,
+			wantStatus: http.StatusBadRequest,
+		},
+		"WrappedIDToken": {
+			err:        fmt.Errorf("%w: unexpected audience", oauth2.ErrInvalidIDToken),
+			wantCode:   CodeInvalidIDToken,
+			wantStatus: http.StatusBadRequest,
+		},
+		"InvalidEmail": {
+			err:        iam.ErrInvalidEmail,
+			wantCode:   CodeInvalidEmail,
+			wantStatus: http.StatusBadRequest,
+		},
+		"Error": {
+			err:        fmt.Errorf("grant: %w", newError(CodeGranteeNotFound, iam.ErrUserNotFound)),
+			wantCode:   CodeGranteeNotFound,
+			wantStatus: http.StatusBadRequest,
+		},
+		"Unknown": {
+			err:        errors.New("unexpected error"),
+			wantCode:   CodeInternal,
+			wantStatus: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			e := asError(tt.err)
+
+			if e.Code != tt.wantCode {
+				t.Errorf("want code: %s, got: %s", tt.wantCode, e.Code)
+			}
+			if e.Status != tt.wantStatus {
+				t.Errorf("want status: %d, got: %d", tt.wantStatus, e.Status)
+			}
+			if !errors.Is(e, tt.err) && !errors.Is(tt.err, e) {
+				t.Errorf("want error to wrap: %v", tt.err)
+			}
+		})
+	}
+}
+
+func Test_abortWithError(t *testing.T) {
+	for name, tt := range map[string]struct {
+		err        error
+		wantCode   int
+		wantBody   string
+		wantHeader string
+	}{
+		"BadRequest": {
+			err:      counter.ErrOverflow,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"type":"urn:counters:error:counter_overflow","title":"Counter overflow","status":400,"detail":"counter overflow","code":"counter_overflow"}`,
+		},
+		"Unauthorized": {
+			err:        iam.ErrInvalidToken,
+			wantCode:   http.StatusUnauthorized,
+			wantBody:   problemBody(CodeUnauthorized, iam.ErrInvalidToken.Error()),
+			wantHeader: "Bearer",
+		},
+		"InternalServerErrorHidesMessage": {
+			err:      errors.New("connection refused"),
+			wantCode: http.StatusInternalServerError,
+			wantBody: `{"type":"urn:counters:error:internal","title":"Internal server error","status":500,"code":"internal"}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{}
+
+			abortWithError(c, zap.NewNop(), tt.err)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != problemContentType {
+				t.Errorf("want content type: %s, got: %s", problemContentType, got)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.wantHeader {
+				t.Errorf("want WWW-Authenticate: %q, got: %q", tt.wantHeader, got)
+			}
+		})
+	}
+}
+
+func Test_catalogue(t *testing.T) {
+	readme, err := os.ReadFile("../../README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for code, entry := range catalogue {
+		if entry.status == 0 || entry.title == "" {
+			t.Errorf("code %s has no status or title", code)
+		}
+		if !strings.Contains(string(readme), "`"+string(code)+"`") {
+			t.Errorf("code %s is not documented in README.md", code)
+		}
+	}
+	for _, c := range errorCodes {
+		if _, ok := catalogue[c.code]; !ok {
+			t.Errorf("error %q maps to unknown code %s", c.err, c.code)
+		}
+	}
+}
@@ -3,9 +3,12 @@ package handler
 
 import (
 	"context"
+	"crypto/rand"
 	"net/http"
 
 	"counters/pkg/counter"
+	"counters/pkg/iam"
+	"counters/pkg/idempotency"
 	"counters/pkg/oauth2"
 
 	"github.com/gin-gonic/gin"
@@ -14,18 +17,103 @@ import (
 )
 
 type IAManager interface {
-	OAuth2URL(provider oauth2.Provider) (string, error)
-	SignInWithOAuth2(ctx context.Context, provider oauth2.Provider, state, code string) (oauth2.Token, error)
+	Providers() []oauth2.Provider
+	OAuth2URL(provider oauth2.Provider) (url, state string, err error)
+	OAuth2LinkURL(provider oauth2.Provider, userID string) (url, state string, err error)
+	OAuth2SignUpURL(provider oauth2.Provider, invitation string) (url, state string, err error)
+	SignInWithOAuth2(ctx context.Context, provider oauth2.Provider, state, code string) (iam.Session, error)
+	Refresh(token string) (iam.Session, error)
+	Authenticate(token string) (*iam.User, error)
+	Logout(token string) error
+	LogoutAll(ctx context.Context, userID string) error
+	RevokeSessions(userID string) error
+	GrantRole(userID string, role iam.Role) error
+	RevokeRole(userID string, role iam.Role) error
+	User(email string) (*iam.User, error)
+	UserByID(id string) (*iam.User, error)
+	Users(opts iam.UserListOptions) (*iam.UserPage, error)
+	DeleteUser(ctx context.Context, id string) error
+	CreateAPIKey(userID string, opts iam.APIKeyOptions) (*iam.APIKey, string, error)
+	APIKeys(userID string) ([]*iam.APIKey, error)
+	RevokeAPIKey(userID, id string) error
+	AuthenticateAPIKey(token string) (*iam.User, *iam.APIKey, error)
+	CreateInvitation(createdBy string, opts iam.InvitationOptions) (*iam.Invitation, string, error)
+	Invitations() ([]*iam.Invitation, error)
+	RevokeInvitation(id string) error
 }
 
 type CounterManager interface {
-	Add(id string) error
-	Get(id string) (*counter.Counter, error)
-	Inc(id string) error
-	Delete(id string) error
+	Add(user, id string) error
+	Get(user, id string) (*counter.Counter, error)
+	List(user string, opts counter.ListOptions) (*counter.Page, error)
+	Inc(user, id string) error
+	IncBy(user, id string, n uint64, cond counter.Condition) (*counter.Counter, error)
+	DecBy(user, id string, n uint64, cond counter.Condition) (*counter.Counter, error)
+	Reset(user, id string, cond counter.Condition) (*counter.Counter, error)
+	Set(user, id string, value uint64, cond counter.Condition) (*counter.Counter, error)
+	Grant(user, id, grantee string, permission counter.Permission) error
+	Revoke(user, id, grantee string) error
+	Delete(user, id string, cond counter.Condition) error
+	DeleteUser(user string) error
 }
 
-func New(l *zap.Logger, iam IAManager, cm CounterManager) http.Handler {
+type options struct {
+	cookieKey     []byte
+	secureCookies bool
+	idempotency   idempotency.Store
+	getIncrement  bool
+}
+
+type Option func(opts *options)
+
+// WithCookieKey sets the key cookies are signed with. Replicas serving the
+// same users have to share it. Without it a random key is used.
+func WithCookieKey(key []byte) Option {
+	return func(opts *options) {
+		opts.cookieKey = key
+	}
+}
+
+// WithSecureCookies restricts cookies to HTTPS.
+func WithSecureCookies(secure bool) Option {
+	return func(opts *options) {
+		opts.secureCookies = secure
+	}
+}
+
+// WithIdempotencyStore sets the store of responses to requests with an
+// Idempotency-Key header. Replicas have to share it. Without it responses are
+// kept in memory for idempotency.DefaultTTL.
+func WithIdempotencyStore(store idempotency.Store) Option {
+	return func(opts *options) {
+		opts.idempotency = store
+	}
+}
+
+// WithGetIncrement serves the deprecated GET /counters/:id/inc for clients
+// that have not moved to POST /counters/:id/increments.
+func WithGetIncrement(enabled bool) Option {
+	return func(opts *options) {
+		opts.getIncrement = enabled
+	}
+}
+
+func New(l *zap.Logger, iamManager IAManager, cm CounterManager, opts ...Option) http.Handler {
+	o := options{secureCookies: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.cookieKey == nil {
+		o.cookieKey = make([]byte, 32)
+		if _, err := rand.Read(o.cookieKey); err != nil {
+			panic(err)
+		}
+	}
+	if o.idempotency == nil {
+		o.idempotency = idempotency.NewMemoryStore(idempotency.DefaultTTL)
+	}
+	cookies := &stateCookies{key: o.cookieKey, secure: o.secureCookies}
+
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(gin.Recovery(), withInternalServerErrorCounter())
@@ -36,32 +124,104 @@ func New(l *zap.Logger, iam IAManager, cm CounterManager) http.Handler {
 	r.GET("/health", health())
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
-	oauth := r.Group("/oauth")
-	google := oauth.Group("/google")
-	google.GET("/sign-in", googleSignIn(l, iam))
-	google.GET("/callback", googleCallback(l, iam))
-	github := oauth.Group("/github")
-	github.GET("/sign-in", gitHubSignIn(l, iam))
-	github.GET("/callback", githubCallback(l, iam))
+	providers := iamManager.Providers()
+
+	v1 := r.Group("/v1")
+	v1.GET("/openapi.json", openAPI(newOpenAPI(providers, o.getIncrement)))
+	routes(v1, l, iamManager, cm, cookies, providers, o)
 
-	counters := r.Group("/counters")
-	counters.POST("", addCounter(l, cm))
-	counters.GET("/:id", getCounter(l, cm))
-	counters.GET("/:id/inc", incCounter(l, cm))
-	counters.DELETE("/:id", deleteCounter(l, cm))
+	// The unversioned routes are kept for existing clients.
+	routes(r.Group("", deprecated()), l, iamManager, cm, cookies, providers, o)
 
 	return r
 }
 
+// routes registers the API on the group. Every route has to be documented by
+// an operation in openapi.go.
+func routes(
+	g *gin.RouterGroup,
+	l *zap.Logger,
+	iamManager IAManager,
+	cm CounterManager,
+	cookies *stateCookies,
+	providers []oauth2.Provider,
+	o options,
+) {
+	oauth := g.Group("/oauth")
+	for _, p := range providers {
+		provider := oauth.Group("/" + p.String())
+		provider.GET("/sign-in", signIn(l, iamManager, cookies, p))
+		provider.GET("/callback", callback(l, iamManager, cookies, p))
+		provider.POST("/link", authenticate(l, iamManager), requireSession(), link(l, iamManager, cookies, p))
+	}
+
+	auth := g.Group("/auth")
+	auth.GET("/providers", listProviders(providers))
+	auth.POST("/refresh", refresh(l, iamManager))
+	auth.POST("/logout", authenticate(l, iamManager), requireSession(), logout(l, iamManager))
+	auth.POST("/logout-all", authenticate(l, iamManager), requireSession(), logoutAll(l, iamManager))
+
+	me := g.Group("/me", authenticate(l, iamManager))
+	me.GET("", getMe())
+	me.DELETE("", requireSession(), deleteMe(l, iamManager, cm))
+
+	users := g.Group("/users", authenticate(l, iamManager), requireSession(), requirePermission(iam.PermissionManageUsers))
+	users.GET("", listUsers(l, iamManager))
+	users.GET("/:id", getUser(l, iamManager))
+	users.DELETE("/:id", deleteUser(l, iamManager, cm))
+	users.DELETE("/:id/sessions", revokeSessions(l, iamManager))
+	users.PUT("/:id/roles/:role", grantRole(l, iamManager))
+	users.DELETE("/:id/roles/:role", revokeRole(l, iamManager))
+
+	invitations := g.Group("/invitations", authenticate(l, iamManager), requireSession(), requirePermission(iam.PermissionManageUsers))
+	invitations.POST("", createInvitation(l, iamManager))
+	invitations.GET("", listInvitations(l, iamManager))
+	invitations.DELETE("/:id", revokeInvitation(l, iamManager))
+
+	apiKeys := g.Group("/api-keys", authenticate(l, iamManager), requireSession())
+	apiKeys.POST("", createAPIKey(l, iamManager))
+	apiKeys.GET("", listAPIKeys(l, iamManager))
+	apiKeys.DELETE("/:id", revokeAPIKey(l, iamManager))
+
+	read := requirePermission(iam.PermissionReadCounters)
+	write := requirePermission(iam.PermissionWriteCounters)
+	readKey, writeKey := limitAPIKey(false), limitAPIKey(true)
+	counters := g.Group("/counters", authenticate(l, iamManager))
+	counters.POST("", write, writeKey, addCounter(l, cm))
+	counters.GET("", read, readKey, listCounters(l, cm))
+	counters.GET("/:id", read, readKey, getCounter(l, cm))
+	counters.PATCH("/:id", write, writeKey, setCounter(l, cm))
+	if o.getIncrement {
+		counters.GET("/:id/inc", write, writeKey, incCounter(l, cm))
+	}
+	idempotent := idempotent(l, o.idempotency)
+	counters.POST("/:id/increments", write, writeKey, idempotent, incCounterBy(l, cm))
+	counters.POST("/:id/decrements", write, writeKey, idempotent, decCounterBy(l, cm))
+	counters.POST("/:id/reset", write, writeKey, resetCounter(l, cm))
+	counters.DELETE("/:id", write, writeKey, deleteCounter(l, cm))
+	counters.PUT("/:id/grants/:email", write, writeKey, grantCounter(l, iamManager, cm))
+	counters.DELETE("/:id/grants/:email", write, writeKey, revokeCounter(l, iamManager, cm))
+}
+
+// deprecated marks the unversioned aliases of the routes and links to the
+// versioned route.
+func deprecated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", "</v1"+c.Request.URL.Path+`>; rel="successor-version"`)
+		c.Next()
+	}
+}
+
 func noRoute() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.AbortWithStatus(http.StatusNotFound)
+		abortWithProblem(c, asError(errRouteNotFound))
 	}
 }
 
 func noMethod() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.AbortWithStatus(http.StatusMethodNotAllowed)
+		abortWithProblem(c, asError(errMethodNotAllowed))
 	}
 }
 
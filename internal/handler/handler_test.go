@@ -2,9 +2,13 @@ package handler
 
 import (
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"testing"
 
+	"counters/pkg/iam"
+	"counters/pkg/oauth2"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
 	"go.uber.org/zap"
@@ -13,13 +17,175 @@ import (
 func TestNewHandler(t *testing.T) {
 	c := gomock.NewController(t)
 
-	h := New(zap.NewNop(), NewMockIAManager(c), NewMockCounterManager(c))
+	m := NewMockIAManager(c)
+	m.EXPECT().Providers().Return([]oauth2.Provider{oauth2.GitLab})
+
+	h := New(zap.NewNop(), m, NewMockCounterManager(c))
 
 	if h == nil {
 		t.Errorf("want handler: <non-nil>, got: <nil>")
 	}
 }
 
+func TestNewHandler_providers(t *testing.T) {
+	for name, tt := range map[string]struct {
+		path           string
+		wantStatusCode int
+	}{
+		"OKConfigured": {
+			path:           "/v1/oauth/gitlab/sign-in",
+			wantStatusCode: http.StatusTemporaryRedirect,
+		},
+		"OKConfiguredDeprecated": {
+			path:           "/oauth/gitlab/sign-in",
+			wantStatusCode: http.StatusTemporaryRedirect,
+		},
+		"ErrNotConfigured": {
+			path:           "/v1/oauth/google/sign-in",
+			wantStatusCode: http.StatusNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := gomock.NewController(t)
+
+			m := NewMockIAManager(c)
+			m.EXPECT().Providers().Return([]oauth2.Provider{oauth2.GitLab})
+			m.EXPECT().OAuth2URL(oauth2.GitLab).Return("https://gitlab.com/oauth/authorize", "state", nil).AnyTimes()
+
+			w := httptest.NewRecorder()
+			New(zap.NewNop(), m, NewMockCounterManager(c)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.wantStatusCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantStatusCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestNewHandler_signIn(t *testing.T) {
+	for name, prefix := range map[string]string{"Versioned": "/v1", "Unversioned": ""} {
+		t.Run(name, func(t *testing.T) {
+			c := gomock.NewController(t)
+
+			m := NewMockIAManager(c)
+			m.EXPECT().Providers().Return([]oauth2.Provider{oauth2.GitLab})
+			m.EXPECT().OAuth2URL(oauth2.GitLab).Return("https://gitlab.com/oauth/authorize", "state", nil)
+			m.EXPECT().SignInWithOAuth2(gomock.Any(), oauth2.GitLab, "state", "code").Return(iam.Session{AccessToken: "token"}, nil)
+
+			srv := httptest.NewServer(New(zap.NewNop(), m, NewMockCounterManager(c), WithSecureCookies(false)))
+			defer srv.Close()
+
+			jar, err := cookiejar.New(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{
+				Jar:           jar,
+				CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+			}
+
+			resp, err := client.Get(srv.URL + prefix + "/oauth/gitlab/sign-in")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusTemporaryRedirect {
+				t.Fatalf("want status code: %d, got: %d", http.StatusTemporaryRedirect, resp.StatusCode)
+			}
+
+			resp, err = client.Get(srv.URL + prefix + "/oauth/gitlab/callback?state=state&code=code")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("want status code: %d, got: %d", http.StatusOK, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestNewHandler_deprecated(t *testing.T) {
+	for name, tt := range map[string]struct {
+		path            string
+		wantDeprecation string
+		wantLink        string
+	}{
+		"Versioned": {
+			path:            "/v1/auth/providers",
+			wantDeprecation: "",
+			wantLink:        "",
+		},
+		"Unversioned": {
+			path:            "/auth/providers",
+			wantDeprecation: "true",
+			wantLink:        `</v1/auth/providers>; rel="successor-version"`,
+		},
+		"Health": {
+			path:            "/health",
+			wantDeprecation: "",
+			wantLink:        "",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := gomock.NewController(t)
+
+			m := NewMockIAManager(c)
+			m.EXPECT().Providers().Return(nil)
+
+			w := httptest.NewRecorder()
+			New(zap.NewNop(), m, NewMockCounterManager(c)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != http.StatusOK {
+				t.Errorf("want status code: 200, got: %d", w.Code)
+			}
+			if got := w.Header().Get("Deprecation"); got != tt.wantDeprecation {
+				t.Errorf("want Deprecation: %q, got: %q", tt.wantDeprecation, got)
+			}
+			if got := w.Header().Get("Link"); got != tt.wantLink {
+				t.Errorf("want Link: %q, got: %q", tt.wantLink, got)
+			}
+		})
+	}
+}
+
+func TestNewHandler_getIncrement(t *testing.T) {
+	for name, tt := range map[string]struct {
+		opts           []Option
+		wantStatusCode int
+	}{
+		"OKEnabled": {
+			opts:           []Option{WithGetIncrement(true)},
+			wantStatusCode: http.StatusOK,
+		},
+		"ErrDisabled": {
+			opts:           nil,
+			wantStatusCode: http.StatusNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := gomock.NewController(t)
+
+			m := NewMockIAManager(c)
+			m.EXPECT().Providers().Return(nil)
+			m.EXPECT().Authenticate("token").Return(newTestUser("user", iam.RoleEditor), nil).AnyTimes()
+
+			cm := NewMockCounterManager(c)
+			cm.EXPECT().Inc("user", "id").Return(nil).AnyTimes()
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/counters/id/inc", nil)
+			req.Header.Set("Authorization", "Bearer token")
+
+			w := httptest.NewRecorder()
+			New(zap.NewNop(), m, cm, tt.opts...).ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatusCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantStatusCode, w.Code)
+			}
+		})
+	}
+}
+
 func Test_noRoute(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -29,8 +195,8 @@ func Test_noRoute(t *testing.T) {
 	if w.Code != http.StatusNotFound {
 		t.Errorf("want status code: 404, got: %d", w.Code)
 	}
-	if w.Body.String() != "" {
-		t.Errorf("want body: , got: %s", w.Body.String())
+	if want := problemBody(CodeRouteNotFound, "route not found"); w.Body.String() != want {
+		t.Errorf("want body: %s, got: %s", want, w.Body.String())
 	}
 }
 
@@ -43,8 +209,8 @@ func Test_noMethod(t *testing.T) {
 	if w.Code != http.StatusMethodNotAllowed {
 		t.Errorf("want status code: 405, got: %d", w.Code)
 	}
-	if w.Body.String() != "" {
-		t.Errorf("want body: , got: %s", w.Body.String())
+	if want := problemBody(CodeMethodNotAllowed, "method not allowed"); w.Body.String() != want {
+		t.Errorf("want body: %s, got: %s", want, w.Body.String())
 	}
 }
 
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"counters/pkg/idempotency"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
+// idempotent handles requests with an Idempotency-Key header once: retries
+// with the key get the stored response of the first request. Keys are scoped
+// to the user and path, where the versioned routes share the paths of their
+// deprecated aliases, and a key reused for another body is rejected.
+// Responses to server errors are not stored, so those requests can be
+// retried.
+func idempotent(l *zap.Logger, store idempotency.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			abortWithError(c, l, newError(
+				CodeInvalidRequest,
+				fmt.Errorf("%s is longer than %d characters", idempotencyKeyHeader, maxIdempotencyKeyLen),
+			))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithError(c, l, invalidRequest(err))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		key = currentUser(c).ID + ":" + unversionedPath(c) + ":" + key
+		sum := sha256.Sum256(append([]byte(c.Request.Method+" "), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+
+		resp, err := store.Begin(key, fingerprint)
+		if err != nil {
+			abortWithError(c, l, err, zap.String("key", key))
+			return
+		}
+		if resp != nil {
+			c.Header("Idempotent-Replayed", "true")
+			if resp.ETag != "" {
+				c.Header("ETag", resp.ETag)
+			}
+			c.Data(resp.Status, resp.ContentType, resp.Body)
+			c.Abort()
+			return
+		}
+
+		// The key is released unless the response is stored, also when the
+		// handler panics, so that the request can be retried.
+		stored := false
+		defer func() {
+			if stored {
+				return
+			}
+			if err := store.Release(key); err != nil {
+				logStoreError(l, c, key, err)
+			}
+		}()
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		if w.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		err = store.Complete(key, fingerprint, idempotency.Response{
+			Status:      w.Status(),
+			ContentType: w.Header().Get("Content-Type"),
+			ETag:        w.Header().Get("ETag"),
+			Body:        w.body.Bytes(),
+		})
+		if err != nil {
+			logStoreError(l, c, key, err)
+			return
+		}
+		stored = true
+	}
+}
+
+// unversionedPath returns the path of the request without the version
+// prefix if it was routed to a versioned route.
+func unversionedPath(c *gin.Context) string {
+	if strings.HasPrefix(c.FullPath(), "/v1/") {
+		return strings.TrimPrefix(c.Request.URL.Path, "/v1")
+	}
+
+	return c.Request.URL.Path
+}
+
+func logStoreError(l *zap.Logger, c *gin.Context, key string, err error) {
+	l.Error(
+		"idempotent response storing failed",
+		zap.String("uri", c.Request.RequestURI),
+		zap.String("key", key),
+		zap.Error(err),
+	)
+}
+
+// recordingWriter keeps a copy of the response body.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
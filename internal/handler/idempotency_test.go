@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"counters/pkg/iam"
+	"counters/pkg/idempotency"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func Test_idempotent(t *testing.T) {
+	type request struct {
+		user, key, body string
+	}
+
+	for name, tt := range map[string]struct {
+		status       int
+		requests     [2]request
+		wantCalls    int
+		wantCode     int
+		wantBody     string
+		wantETag     string
+		wantReplayed string
+	}{
+		"OKReplayed": {
+			status:       http.StatusOK,
+			requests:     [2]request{{"user", "key", `{"delta":1}`}, {"user", "key", `{"delta":1}`}},
+			wantCalls:    1,
+			wantCode:     http.StatusOK,
+			wantBody:     `{"calls":1}`,
+			wantETag:     `"1"`,
+			wantReplayed: "true",
+		},
+		"OKNoKey": {
+			status:    http.StatusOK,
+			requests:  [2]request{{"user", "", `{"delta":1}`}, {"user", "", `{"delta":1}`}},
+			wantCalls: 2,
+			wantCode:  http.StatusOK,
+			wantBody:  `{"calls":2}`,
+			wantETag:  `"2"`,
+		},
+		"OKOtherUser": {
+			status:    http.StatusOK,
+			requests:  [2]request{{"user", "key", `{"delta":1}`}, {"other", "key", `{"delta":1}`}},
+			wantCalls: 2,
+			wantCode:  http.StatusOK,
+			wantBody:  `{"calls":2}`,
+			wantETag:  `"2"`,
+		},
+		"OKRetriedAfterServerError": {
+			status:    http.StatusInternalServerError,
+			requests:  [2]request{{"user", "key", `{"delta":1}`}, {"user", "key", `{"delta":1}`}},
+			wantCalls: 2,
+			wantCode:  http.StatusInternalServerError,
+			wantBody:  `{"calls":2}`,
+		},
+		"UnprocessableEntityOtherBody": {
+			status:    http.StatusOK,
+			requests:  [2]request{{"user", "key", `{"delta":1}`}, {"user", "key", `{"delta":2}`}},
+			wantCalls: 1,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  problemBody(CodeIdempotencyReused, idempotency.ErrMismatch.Error()),
+		},
+		"BadRequestLongKey": {
+			status:    http.StatusOK,
+			requests:  [2]request{{"user", "", `{}`}, {"user", strings.Repeat("k", 256), `{}`}},
+			wantCalls: 1,
+			wantCode:  http.StatusBadRequest,
+			wantBody:  problemBody(CodeInvalidRequest, "Idempotency-Key is longer than 255 characters"),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+
+			gin.SetMode(gin.ReleaseMode)
+			r := gin.New()
+			r.POST(
+				"/counters/:id/increments",
+				func(c *gin.Context) { c.Set(userKey, &iam.User{ID: c.GetHeader("User")}) },
+				idempotent(zap.NewNop(), idempotency.NewMemoryStore(time.Minute)),
+				func(c *gin.Context) {
+					calls++
+					if tt.status == http.StatusOK {
+						c.Header("ETag", etag(uint64(calls)))
+					}
+					c.AbortWithStatusJSON(tt.status, gin.H{"calls": calls})
+				},
+			)
+
+			var w *httptest.ResponseRecorder
+			for _, req := range tt.requests {
+				w = httptest.NewRecorder()
+				httpReq := httptest.NewRequest(http.MethodPost, "/counters/id/increments", strings.NewReader(req.body))
+				httpReq.Header.Set("User", req.user)
+				if req.key != "" {
+					httpReq.Header.Set(idempotencyKeyHeader, req.key)
+				}
+
+				r.ServeHTTP(w, httpReq)
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("want calls: %d, got: %d", tt.wantCalls, calls)
+			}
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("want ETag: %q, got: %q", tt.wantETag, got)
+			}
+			if got := w.Header().Get("Idempotent-Replayed"); got != tt.wantReplayed {
+				t.Errorf("want Idempotent-Replayed: %q, got: %q", tt.wantReplayed, got)
+			}
+		})
+	}
+}
+
+func Test_idempotent_panic(t *testing.T) {
+	calls := 0
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, _ any) { c.AbortWithStatus(http.StatusInternalServerError) }))
+	r.POST(
+		"/counters/:id/increments",
+		func(c *gin.Context) { c.Set(userKey, &iam.User{ID: "user"}) },
+		idempotent(zap.NewNop(), idempotency.NewMemoryStore(time.Minute)),
+		func(c *gin.Context) {
+			calls++
+			if calls == 1 {
+				panic("handler failed")
+			}
+			c.AbortWithStatusJSON(http.StatusOK, gin.H{"calls": calls})
+		},
+	)
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/counters/id/increments", strings.NewReader(`{"delta":1}`))
+		req.Header.Set(idempotencyKeyHeader, "key")
+
+		r.ServeHTTP(w, req)
+	}
+
+	if w.Code != http.StatusOK {
+		t.Errorf("want retry after panic: %d, got: %d", http.StatusOK, w.Code)
+	}
+	if want := `{"calls":2}`; w.Body.String() != want {
+		t.Errorf("want body: %s, got: %s", want, w.Body.String())
+	}
+}
+
+func Test_idempotent_alias(t *testing.T) {
+	for name, tt := range map[string]struct {
+		paths     [2]string
+		wantCalls int
+	}{
+		"OKReplayedOnAlias": {
+			paths:     [2]string{"/v1/counters/id/increments", "/counters/id/increments"},
+			wantCalls: 1,
+		},
+		"OKReplayedOnVersioned": {
+			paths:     [2]string{"/counters/id/increments", "/v1/counters/id/increments"},
+			wantCalls: 1,
+		},
+		"OKOtherCounter": {
+			paths:     [2]string{"/v1/counters/id/increments", "/counters/other/increments"},
+			wantCalls: 2,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			store := idempotency.NewMemoryStore(time.Minute)
+
+			gin.SetMode(gin.ReleaseMode)
+			r := gin.New()
+			for _, g := range []*gin.RouterGroup{r.Group("/v1"), r.Group("")} {
+				g.POST(
+					"/counters/:id/increments",
+					func(c *gin.Context) { c.Set(userKey, &iam.User{ID: "user"}) },
+					idempotent(zap.NewNop(), store),
+					func(c *gin.Context) {
+						calls++
+						c.AbortWithStatusJSON(http.StatusOK, gin.H{"calls": calls})
+					},
+				)
+			}
+
+			for _, path := range tt.paths {
+				req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"delta":1}`))
+				req.Header.Set(idempotencyKeyHeader, "key")
+
+				r.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("want calls: %d, got: %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
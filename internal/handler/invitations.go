@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"counters/pkg/iam"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type createInvitationRequest struct {
+	Email     string    `json:"email" binding:"required"`
+	Role      iam.Role  `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type invitationResponse struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Role      iam.Role  `json:"role"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Token     string    `json:"token,omitempty"`
+}
+
+type listInvitationsResponse struct {
+	Invitations []invitationResponse `json:"invitations"`
+}
+
+func newInvitationResponse(i *iam.Invitation) invitationResponse {
+	return invitationResponse{
+		ID:        i.ID,
+		Email:     i.Email,
+		Role:      i.Role,
+		CreatedBy: i.CreatedBy,
+		CreatedAt: i.CreatedAt,
+		ExpiresAt: i.ExpiresAt,
+	}
+}
+
+// createInvitation invites an email to sign up. The token is only part of
+// this response and is sent to the invitee out-of-band.
+func createInvitation(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r createInvitationRequest
+		if err := c.ShouldBindJSON(&r); err != nil {
+			abortWithError(c, l, invalidRequest(err))
+			return
+		}
+
+		i, token, err := iamManager.CreateInvitation(currentUser(c).ID, iam.InvitationOptions{
+			Email:     r.Email,
+			Role:      r.Role,
+			ExpiresAt: r.ExpiresAt,
+		})
+
+		if errors.Is(err, iam.ErrInvalidInvitation) {
+			err = newError(CodeInvalidRequest, err)
+		}
+		if err != nil {
+			abortWithError(c, l, err)
+			return
+		}
+
+		resp := newInvitationResponse(i)
+		resp.Token = token
+
+		c.AbortWithStatusJSON(http.StatusCreated, resp)
+	}
+}
+
+func listInvitations(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		invitations, err := iamManager.Invitations()
+		if err != nil {
+			abortWithError(c, l, err)
+			return
+		}
+
+		resp := make([]invitationResponse, 0, len(invitations))
+		for _, i := range invitations {
+			resp = append(resp, newInvitationResponse(i))
+		}
+
+		c.AbortWithStatusJSON(http.StatusOK, listInvitationsResponse{Invitations: resp})
+	}
+}
+
+func revokeInvitation(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if err := iamManager.RevokeInvitation(id); err != nil {
+			abortWithError(c, l, err, zap.String("id", id))
+			return
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"counters/pkg/iam"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"go.uber.org/zap"
+)
+
+func Test_createInvitation(t *testing.T) {
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	expires := created.Add(24 * time.Hour)
+
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		"Created": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().
+					CreateInvitation("user", iam.InvitationOptions{Email: "x@x.x", Role: iam.RoleViewer}).
+					Return(&iam.Invitation{ID: "id", Email: "x@x.x", Role: iam.RoleViewer, CreatedBy: "user", CreatedAt: created, ExpiresAt: expires}, "ci_id_secret", nil)
+
+				return m
+			},
+			body:     `{"email":"x@x.x","role":"viewer"}`,
+			wantCode: http.StatusCreated,
+			wantBody: `{"id":"id","email":"x@x.x","role":"viewer","created_by":"user","created_at":"2023-01-01T00:00:00Z","expires_at":"2023-01-02T00:00:00Z","token":"ci_id_secret"}`,
+		},
+		"BadRequestNoEmail": {
+			iam: func(c *gomock.Controller) IAManager {
+				return NewMockIAManager(c)
+			},
+			body:     `{"role":"viewer"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		"BadRequestErrInvalidInvitation": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().
+					CreateInvitation("user", iam.InvitationOptions{Email: "x@x.x", Role: "owner"}).
+					Return(nil, "", fmt.Errorf("%w: %v", iam.ErrInvalidInvitation, iam.ErrInvalidRole))
+
+				return m
+			},
+			body:     `{"email":"x@x.x","role":"owner"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().
+					CreateInvitation("user", iam.InvitationOptions{Email: "x@x.x"}).
+					Return(nil, "", errors.New("unexpected error"))
+
+				return m
+			},
+			body:     `{"email":"x@x.x"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/invitations", strings.NewReader(tt.body))
+			c.Set(userKey, &iam.User{ID: "user"})
+
+			createInvitation(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_listInvitations(t *testing.T) {
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	expires := created.Add(24 * time.Hour)
+
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		wantCode int
+		wantBody string
+	}{
+		"OK": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Invitations().Return([]*iam.Invitation{
+					{ID: "id", Email: "x@x.x", Role: iam.RoleEditor, CreatedBy: "user", CreatedAt: created, ExpiresAt: expires},
+				}, nil)
+
+				return m
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"invitations":[{"id":"id","email":"x@x.x","role":"editor","created_by":"user","created_at":"2023-01-01T00:00:00Z","expires_at":"2023-01-02T00:00:00Z"}]}`,
+		},
+		"OKEmpty": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Invitations().Return(nil, nil)
+
+				return m
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"invitations":[]}`,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Invitations().Return(nil, errors.New("unexpected error"))
+
+				return m
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/invitations", nil)
+
+			listInvitations(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_revokeInvitation(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		wantCode int
+	}{
+		"NoContent": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().RevokeInvitation("id").Return(nil)
+
+				return m
+			},
+			wantCode: http.StatusNoContent,
+		},
+		"NotFound": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().RevokeInvitation("id").Return(iam.ErrInvitationNotFound)
+
+				return m
+			},
+			wantCode: http.StatusNotFound,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().RevokeInvitation("id").Return(errors.New("unexpected error"))
+
+				return m
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodDelete, "/invitations/id", nil)
+			c.Params = gin.Params{{Key: "id", Value: "id"}}
+
+			revokeInvitation(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
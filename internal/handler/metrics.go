@@ -30,6 +30,13 @@ var (
 		Help:      "Number of requests to increment counter",
 	}, nil)
 
+	decCounterCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "counters",
+		Subsystem: "http",
+		Name:      "dec_counter",
+		Help:      "Number of requests to decrement counter",
+	}, nil)
+
 	internalServerErrorCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "counters",
 		Subsystem: "http",
@@ -43,6 +50,7 @@ func MustRegisterMetrics(registerer prometheus.Registerer) {
 		addCounterRequestDurationHistogram,
 		countersNumberGauge,
 		incCounterCounter,
+		decCounterCounter,
 		internalServerErrorCounter,
 	)
 }
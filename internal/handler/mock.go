@@ -7,6 +7,7 @@ package handler
 import (
 	context "context"
 	counter "counters/pkg/counter"
+	iam "counters/pkg/iam"
 	oauth2 "counters/pkg/oauth2"
 	reflect "reflect"
 
@@ -36,13 +37,195 @@ func (m *MockIAManager) EXPECT() *MockIAManagerMockRecorder {
 	return m.recorder
 }
 
+// APIKeys mocks base method.
+func (m *MockIAManager) APIKeys(userID string) ([]*iam.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "APIKeys", userID)
+	ret0, _ := ret[0].([]*iam.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// APIKeys indicates an expected call of APIKeys.
+func (mr *MockIAManagerMockRecorder) APIKeys(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "APIKeys", reflect.TypeOf((*MockIAManager)(nil).APIKeys), userID)
+}
+
+// Authenticate mocks base method.
+func (m *MockIAManager) Authenticate(token string) (*iam.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Authenticate", token)
+	ret0, _ := ret[0].(*iam.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Authenticate indicates an expected call of Authenticate.
+func (mr *MockIAManagerMockRecorder) Authenticate(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authenticate", reflect.TypeOf((*MockIAManager)(nil).Authenticate), token)
+}
+
+// AuthenticateAPIKey mocks base method.
+func (m *MockIAManager) AuthenticateAPIKey(token string) (*iam.User, *iam.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AuthenticateAPIKey", token)
+	ret0, _ := ret[0].(*iam.User)
+	ret1, _ := ret[1].(*iam.APIKey)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// AuthenticateAPIKey indicates an expected call of AuthenticateAPIKey.
+func (mr *MockIAManagerMockRecorder) AuthenticateAPIKey(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthenticateAPIKey", reflect.TypeOf((*MockIAManager)(nil).AuthenticateAPIKey), token)
+}
+
+// CreateAPIKey mocks base method.
+func (m *MockIAManager) CreateAPIKey(userID string, opts iam.APIKeyOptions) (*iam.APIKey, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAPIKey", userID, opts)
+	ret0, _ := ret[0].(*iam.APIKey)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CreateAPIKey indicates an expected call of CreateAPIKey.
+func (mr *MockIAManagerMockRecorder) CreateAPIKey(userID, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAPIKey", reflect.TypeOf((*MockIAManager)(nil).CreateAPIKey), userID, opts)
+}
+
+// CreateInvitation mocks base method.
+func (m *MockIAManager) CreateInvitation(createdBy string, opts iam.InvitationOptions) (*iam.Invitation, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateInvitation", createdBy, opts)
+	ret0, _ := ret[0].(*iam.Invitation)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CreateInvitation indicates an expected call of CreateInvitation.
+func (mr *MockIAManagerMockRecorder) CreateInvitation(createdBy, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateInvitation", reflect.TypeOf((*MockIAManager)(nil).CreateInvitation), createdBy, opts)
+}
+
+// DeleteUser mocks base method.
+func (m *MockIAManager) DeleteUser(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockIAManagerMockRecorder) DeleteUser(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockIAManager)(nil).DeleteUser), ctx, id)
+}
+
+// GrantRole mocks base method.
+func (m *MockIAManager) GrantRole(userID string, role iam.Role) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantRole", userID, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GrantRole indicates an expected call of GrantRole.
+func (mr *MockIAManagerMockRecorder) GrantRole(userID, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantRole", reflect.TypeOf((*MockIAManager)(nil).GrantRole), userID, role)
+}
+
+// Invitations mocks base method.
+func (m *MockIAManager) Invitations() ([]*iam.Invitation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Invitations")
+	ret0, _ := ret[0].([]*iam.Invitation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Invitations indicates an expected call of Invitations.
+func (mr *MockIAManagerMockRecorder) Invitations() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Invitations", reflect.TypeOf((*MockIAManager)(nil).Invitations))
+}
+
+// Logout mocks base method.
+func (m *MockIAManager) Logout(token string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Logout", token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Logout indicates an expected call of Logout.
+func (mr *MockIAManagerMockRecorder) Logout(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockIAManager)(nil).Logout), token)
+}
+
+// LogoutAll mocks base method.
+func (m *MockIAManager) LogoutAll(ctx context.Context, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LogoutAll", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LogoutAll indicates an expected call of LogoutAll.
+func (mr *MockIAManagerMockRecorder) LogoutAll(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LogoutAll", reflect.TypeOf((*MockIAManager)(nil).LogoutAll), ctx, userID)
+}
+
+// OAuth2LinkURL mocks base method.
+func (m *MockIAManager) OAuth2LinkURL(provider oauth2.Provider, userID string) (string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OAuth2LinkURL", provider, userID)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// OAuth2LinkURL indicates an expected call of OAuth2LinkURL.
+func (mr *MockIAManagerMockRecorder) OAuth2LinkURL(provider, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OAuth2LinkURL", reflect.TypeOf((*MockIAManager)(nil).OAuth2LinkURL), provider, userID)
+}
+
+// OAuth2SignUpURL mocks base method.
+func (m *MockIAManager) OAuth2SignUpURL(provider oauth2.Provider, invitation string) (string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OAuth2SignUpURL", provider, invitation)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// OAuth2SignUpURL indicates an expected call of OAuth2SignUpURL.
+func (mr *MockIAManagerMockRecorder) OAuth2SignUpURL(provider, invitation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OAuth2SignUpURL", reflect.TypeOf((*MockIAManager)(nil).OAuth2SignUpURL), provider, invitation)
+}
+
 // OAuth2URL mocks base method.
-func (m *MockIAManager) OAuth2URL(provider oauth2.Provider) (string, error) {
+func (m *MockIAManager) OAuth2URL(provider oauth2.Provider) (string, string, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "OAuth2URL", provider)
 	ret0, _ := ret[0].(string)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // OAuth2URL indicates an expected call of OAuth2URL.
@@ -51,11 +234,96 @@ func (mr *MockIAManagerMockRecorder) OAuth2URL(provider interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OAuth2URL", reflect.TypeOf((*MockIAManager)(nil).OAuth2URL), provider)
 }
 
+// Providers mocks base method.
+func (m *MockIAManager) Providers() []oauth2.Provider {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Providers")
+	ret0, _ := ret[0].([]oauth2.Provider)
+	return ret0
+}
+
+// Providers indicates an expected call of Providers.
+func (mr *MockIAManagerMockRecorder) Providers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Providers", reflect.TypeOf((*MockIAManager)(nil).Providers))
+}
+
+// Refresh mocks base method.
+func (m *MockIAManager) Refresh(token string) (iam.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Refresh", token)
+	ret0, _ := ret[0].(iam.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Refresh indicates an expected call of Refresh.
+func (mr *MockIAManagerMockRecorder) Refresh(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Refresh", reflect.TypeOf((*MockIAManager)(nil).Refresh), token)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockIAManager) RevokeAPIKey(userID, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", userID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockIAManagerMockRecorder) RevokeAPIKey(userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockIAManager)(nil).RevokeAPIKey), userID, id)
+}
+
+// RevokeInvitation mocks base method.
+func (m *MockIAManager) RevokeInvitation(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeInvitation", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeInvitation indicates an expected call of RevokeInvitation.
+func (mr *MockIAManagerMockRecorder) RevokeInvitation(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeInvitation", reflect.TypeOf((*MockIAManager)(nil).RevokeInvitation), id)
+}
+
+// RevokeRole mocks base method.
+func (m *MockIAManager) RevokeRole(userID string, role iam.Role) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRole", userID, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRole indicates an expected call of RevokeRole.
+func (mr *MockIAManagerMockRecorder) RevokeRole(userID, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRole", reflect.TypeOf((*MockIAManager)(nil).RevokeRole), userID, role)
+}
+
+// RevokeSessions mocks base method.
+func (m *MockIAManager) RevokeSessions(userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSessions", userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSessions indicates an expected call of RevokeSessions.
+func (mr *MockIAManagerMockRecorder) RevokeSessions(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSessions", reflect.TypeOf((*MockIAManager)(nil).RevokeSessions), userID)
+}
+
 // SignInWithOAuth2 mocks base method.
-func (m *MockIAManager) SignInWithOAuth2(ctx context.Context, provider oauth2.Provider, state, code string) (oauth2.Token, error) {
+func (m *MockIAManager) SignInWithOAuth2(ctx context.Context, provider oauth2.Provider, state, code string) (iam.Session, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "SignInWithOAuth2", ctx, provider, state, code)
-	ret0, _ := ret[0].(oauth2.Token)
+	ret0, _ := ret[0].(iam.Session)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -66,6 +334,51 @@ func (mr *MockIAManagerMockRecorder) SignInWithOAuth2(ctx, provider, state, code
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignInWithOAuth2", reflect.TypeOf((*MockIAManager)(nil).SignInWithOAuth2), ctx, provider, state, code)
 }
 
+// User mocks base method.
+func (m *MockIAManager) User(email string) (*iam.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "User", email)
+	ret0, _ := ret[0].(*iam.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// User indicates an expected call of User.
+func (mr *MockIAManagerMockRecorder) User(email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "User", reflect.TypeOf((*MockIAManager)(nil).User), email)
+}
+
+// UserByID mocks base method.
+func (m *MockIAManager) UserByID(id string) (*iam.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserByID", id)
+	ret0, _ := ret[0].(*iam.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UserByID indicates an expected call of UserByID.
+func (mr *MockIAManagerMockRecorder) UserByID(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserByID", reflect.TypeOf((*MockIAManager)(nil).UserByID), id)
+}
+
+// Users mocks base method.
+func (m *MockIAManager) Users(opts iam.UserListOptions) (*iam.UserPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Users", opts)
+	ret0, _ := ret[0].(*iam.UserPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Users indicates an expected call of Users.
+func (mr *MockIAManagerMockRecorder) Users(opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Users", reflect.TypeOf((*MockIAManager)(nil).Users), opts)
+}
+
 // MockCounterManager is a mock of CounterManager interface.
 type MockCounterManager struct {
 	ctrl     *gomock.Controller
@@ -90,58 +403,175 @@ func (m *MockCounterManager) EXPECT() *MockCounterManagerMockRecorder {
 }
 
 // Add mocks base method.
-func (m *MockCounterManager) Add(id string) error {
+func (m *MockCounterManager) Add(user, id string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Add", id)
+	ret := m.ctrl.Call(m, "Add", user, id)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Add indicates an expected call of Add.
-func (mr *MockCounterManagerMockRecorder) Add(id interface{}) *gomock.Call {
+func (mr *MockCounterManagerMockRecorder) Add(user, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockCounterManager)(nil).Add), user, id)
+}
+
+// DecBy mocks base method.
+func (m *MockCounterManager) DecBy(user, id string, n uint64, cond counter.Condition) (*counter.Counter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DecBy", user, id, n, cond)
+	ret0, _ := ret[0].(*counter.Counter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DecBy indicates an expected call of DecBy.
+func (mr *MockCounterManagerMockRecorder) DecBy(user, id, n, cond interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockCounterManager)(nil).Add), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DecBy", reflect.TypeOf((*MockCounterManager)(nil).DecBy), user, id, n, cond)
 }
 
 // Delete mocks base method.
-func (m *MockCounterManager) Delete(id string) error {
+func (m *MockCounterManager) Delete(user, id string, cond counter.Condition) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Delete", id)
+	ret := m.ctrl.Call(m, "Delete", user, id, cond)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Delete indicates an expected call of Delete.
-func (mr *MockCounterManagerMockRecorder) Delete(id interface{}) *gomock.Call {
+func (mr *MockCounterManagerMockRecorder) Delete(user, id, cond interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockCounterManager)(nil).Delete), user, id, cond)
+}
+
+// DeleteUser mocks base method.
+func (m *MockCounterManager) DeleteUser(user string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockCounterManagerMockRecorder) DeleteUser(user interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockCounterManager)(nil).Delete), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockCounterManager)(nil).DeleteUser), user)
 }
 
 // Get mocks base method.
-func (m *MockCounterManager) Get(id string) (*counter.Counter, error) {
+func (m *MockCounterManager) Get(user, id string) (*counter.Counter, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Get", id)
+	ret := m.ctrl.Call(m, "Get", user, id)
 	ret0, _ := ret[0].(*counter.Counter)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Get indicates an expected call of Get.
-func (mr *MockCounterManagerMockRecorder) Get(id interface{}) *gomock.Call {
+func (mr *MockCounterManagerMockRecorder) Get(user, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCounterManager)(nil).Get), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCounterManager)(nil).Get), user, id)
+}
+
+// Grant mocks base method.
+func (m *MockCounterManager) Grant(user, id, grantee string, permission counter.Permission) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Grant", user, id, grantee, permission)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Grant indicates an expected call of Grant.
+func (mr *MockCounterManagerMockRecorder) Grant(user, id, grantee, permission interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Grant", reflect.TypeOf((*MockCounterManager)(nil).Grant), user, id, grantee, permission)
 }
 
 // Inc mocks base method.
-func (m *MockCounterManager) Inc(id string) error {
+func (m *MockCounterManager) Inc(user, id string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Inc", id)
+	ret := m.ctrl.Call(m, "Inc", user, id)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Inc indicates an expected call of Inc.
-func (mr *MockCounterManagerMockRecorder) Inc(id interface{}) *gomock.Call {
+func (mr *MockCounterManagerMockRecorder) Inc(user, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Inc", reflect.TypeOf((*MockCounterManager)(nil).Inc), user, id)
+}
+
+// IncBy mocks base method.
+func (m *MockCounterManager) IncBy(user, id string, n uint64, cond counter.Condition) (*counter.Counter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncBy", user, id, n, cond)
+	ret0, _ := ret[0].(*counter.Counter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncBy indicates an expected call of IncBy.
+func (mr *MockCounterManagerMockRecorder) IncBy(user, id, n, cond interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncBy", reflect.TypeOf((*MockCounterManager)(nil).IncBy), user, id, n, cond)
+}
+
+// List mocks base method.
+func (m *MockCounterManager) List(user string, opts counter.ListOptions) (*counter.Page, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", user, opts)
+	ret0, _ := ret[0].(*counter.Page)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockCounterManagerMockRecorder) List(user, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockCounterManager)(nil).List), user, opts)
+}
+
+// Reset mocks base method.
+func (m *MockCounterManager) Reset(user, id string, cond counter.Condition) (*counter.Counter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reset", user, id, cond)
+	ret0, _ := ret[0].(*counter.Counter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reset indicates an expected call of Reset.
+func (mr *MockCounterManagerMockRecorder) Reset(user, id, cond interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockCounterManager)(nil).Reset), user, id, cond)
+}
+
+// Revoke mocks base method.
+func (m *MockCounterManager) Revoke(user, id, grantee string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", user, id, grantee)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Revoke indicates an expected call of Revoke.
+func (mr *MockCounterManagerMockRecorder) Revoke(user, id, grantee interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockCounterManager)(nil).Revoke), user, id, grantee)
+}
+
+// Set mocks base method.
+func (m *MockCounterManager) Set(user, id string, value uint64, cond counter.Condition) (*counter.Counter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Set", user, id, value, cond)
+	ret0, _ := ret[0].(*counter.Counter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Set indicates an expected call of Set.
+func (mr *MockCounterManagerMockRecorder) Set(user, id, value, cond interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Inc", reflect.TypeOf((*MockCounterManager)(nil).Inc), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockCounterManager)(nil).Set), user, id, value, cond)
 }
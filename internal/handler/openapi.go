@@ -0,0 +1,400 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"counters/pkg/oauth2"
+
+	"github.com/gin-gonic/gin"
+)
+
+// operation documents a route of the API. Paths are relative to /v1 and use
+// the syntax of the router. The schemas of the query, body and response are
+// generated from the types of the handler. Compat operations are deprecated
+// and only served when enabled. Idempotent operations take an
+// Idempotency-Key header. Conditional operations respond with an ETag and
+// take If-None-Match, and If-Match unless they are reads.
+type operation struct {
+	method      string
+	path        string
+	summary     string
+	auth        bool
+	compat      bool
+	idempotent  bool
+	conditional bool
+	query       any
+	body        any
+	status      int
+	response    any
+}
+
+var operations = []operation{
+	{method: http.MethodGet, path: "/openapi.json", summary: "Get this document", status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/oauth/:provider/sign-in", summary: "Start signing in with the provider", query: signInRequest{}, status: http.StatusTemporaryRedirect},
+	{method: http.MethodGet, path: "/oauth/:provider/callback", summary: "Finish signing in with the provider", query: callbackRequest{}, status: http.StatusOK, response: sessionResponse{}},
+	{method: http.MethodPost, path: "/oauth/:provider/link", summary: "Start linking the provider to the current user", auth: true, status: http.StatusOK, response: linkResponse{}},
+
+	{method: http.MethodGet, path: "/auth/providers", summary: "List the enabled providers", status: http.StatusOK, response: listProvidersResponse{}},
+	{method: http.MethodPost, path: "/auth/refresh", summary: "Refresh a session", body: refreshRequest{}, status: http.StatusOK, response: sessionResponse{}},
+	{method: http.MethodPost, path: "/auth/logout", summary: "End the current session", auth: true, status: http.StatusNoContent},
+	{method: http.MethodPost, path: "/auth/logout-all", summary: "End every session of the current user", auth: true, status: http.StatusNoContent},
+
+	{method: http.MethodGet, path: "/me", summary: "Get the current user", auth: true, status: http.StatusOK, response: userResponse{}},
+	{method: http.MethodDelete, path: "/me", summary: "Delete the current user", auth: true, status: http.StatusNoContent},
+
+	{method: http.MethodGet, path: "/users", summary: "List users", auth: true, query: listUsersRequest{}, status: http.StatusOK, response: listUsersResponse{}},
+	{method: http.MethodGet, path: "/users/:id", summary: "Get a user", auth: true, status: http.StatusOK, response: userResponse{}},
+	{method: http.MethodDelete, path: "/users/:id", summary: "Delete a user", auth: true, status: http.StatusNoContent},
+	{method: http.MethodDelete, path: "/users/:id/sessions", summary: "End every session of a user", auth: true, status: http.StatusNoContent},
+	{method: http.MethodPut, path: "/users/:id/roles/:role", summary: "Grant a role to a user", auth: true, status: http.StatusNoContent},
+	{method: http.MethodDelete, path: "/users/:id/roles/:role", summary: "Revoke a role from a user", auth: true, status: http.StatusNoContent},
+
+	{method: http.MethodPost, path: "/invitations", summary: "Invite an email to sign up", auth: true, body: createInvitationRequest{}, status: http.StatusCreated, response: invitationResponse{}},
+	{method: http.MethodGet, path: "/invitations", summary: "List invitations", auth: true, status: http.StatusOK, response: listInvitationsResponse{}},
+	{method: http.MethodDelete, path: "/invitations/:id", summary: "Revoke an invitation", auth: true, status: http.StatusNoContent},
+
+	{method: http.MethodPost, path: "/api-keys", summary: "Create an API key", auth: true, body: createAPIKeyRequest{}, status: http.StatusCreated, response: apiKeyResponse{}},
+	{method: http.MethodGet, path: "/api-keys", summary: "List the API keys of the current user", auth: true, status: http.StatusOK, response: listAPIKeysResponse{}},
+	{method: http.MethodDelete, path: "/api-keys/:id", summary: "Revoke an API key", auth: true, status: http.StatusNoContent},
+
+	{method: http.MethodPost, path: "/counters", summary: "Create a counter", auth: true, body: addCounterRequest{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/counters", summary: "List counters", auth: true, query: listCountersRequest{}, status: http.StatusOK, response: listCountersResponse{}},
+	{method: http.MethodGet, path: "/counters/:id", summary: "Get a counter", auth: true, conditional: true, status: http.StatusOK, response: getCounterResponse{}},
+	{method: http.MethodPatch, path: "/counters/:id", summary: "Set a counter", auth: true, conditional: true, body: setCounterRequest{}, status: http.StatusOK, response: getCounterResponse{}},
+	{method: http.MethodGet, path: "/counters/:id/inc", summary: "Increment a counter by one", auth: true, compat: true, status: http.StatusOK},
+	{method: http.MethodPost, path: "/counters/:id/increments", summary: "Increment a counter", auth: true, idempotent: true, conditional: true, body: changeCounterRequest{}, status: http.StatusOK, response: getCounterResponse{}},
+	{method: http.MethodPost, path: "/counters/:id/decrements", summary: "Decrement a counter", auth: true, idempotent: true, conditional: true, body: changeCounterRequest{}, status: http.StatusOK, response: getCounterResponse{}},
+	{method: http.MethodPost, path: "/counters/:id/reset", summary: "Reset a counter", auth: true, conditional: true, status: http.StatusOK, response: getCounterResponse{}},
+	{method: http.MethodDelete, path: "/counters/:id", summary: "Delete a counter", auth: true, conditional: true, status: http.StatusNoContent},
+	{method: http.MethodPut, path: "/counters/:id/grants/:email", summary: "Share a counter with a user", auth: true, body: grantCounterRequest{}, status: http.StatusNoContent},
+	{method: http.MethodDelete, path: "/counters/:id/grants/:email", summary: "Stop sharing a counter with a user", auth: true, status: http.StatusNoContent},
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Servers    []openAPIServer                         `json:"servers"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                    `json:"required"`
+	Content  map[string]openAPIMedia `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                   `json:"description"`
+	Headers     map[string]openAPIHeader `json:"headers,omitempty"`
+	Content     map[string]openAPIMedia  `json:"content,omitempty"`
+}
+
+type openAPIHeader struct {
+	Schema *schema `json:"schema"`
+}
+
+type openAPIMedia struct {
+	Schema *schema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*schema               `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+// schema is a JSON schema as used by OpenAPI 3.0.
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Maximum              *int64             `json:"maximum,omitempty"`
+	MaxLength            int                `json:"maxLength,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+// newOpenAPI generates the document of the API with the enabled providers and
+// compat operations, if enabled.
+func newOpenAPI(providers []oauth2.Provider, compat bool) *openAPIDocument {
+	doc := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "Counters", Version: "1"},
+		Servers: []openAPIServer{{URL: "/v1"}},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+		Components: openAPIComponents{
+			Schemas:         make(map[string]*schema),
+			SecuritySchemes: map[string]openAPISecurityScheme{"bearer": {Type: "http", Scheme: "bearer"}},
+		},
+	}
+
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		names = append(names, p.String())
+	}
+
+	problemRef := doc.schemaFor(reflect.TypeOf(problem{}))
+	for _, op := range operations {
+		if op.compat && !compat {
+			continue
+		}
+
+		o := &openAPIOperation{
+			Summary:    op.summary,
+			Deprecated: op.compat,
+			Responses: map[string]openAPIResponse{
+				"default": {
+					Description: "Problem",
+					Content:     map[string]openAPIMedia{problemContentType: {Schema: problemRef}},
+				},
+			},
+		}
+		if op.auth {
+			o.Security = []map[string][]string{{"bearer": {}}}
+		}
+
+		for _, segment := range strings.Split(op.path, "/") {
+			if !strings.HasPrefix(segment, ":") {
+				continue
+			}
+
+			p := openAPIParameter{Name: segment[1:], In: "path", Required: true, Schema: &schema{Type: "string"}}
+			if p.Name == "provider" {
+				p.Schema.Enum = names
+			}
+			o.Parameters = append(o.Parameters, p)
+		}
+		if op.idempotent {
+			o.Parameters = append(o.Parameters, openAPIParameter{
+				Name:   idempotencyKeyHeader,
+				In:     "header",
+				Schema: &schema{Type: "string", MaxLength: maxIdempotencyKeyLen},
+			})
+		}
+		if op.conditional {
+			if op.method != http.MethodGet {
+				o.Parameters = append(o.Parameters, openAPIParameter{Name: "If-Match", In: "header", Schema: &schema{Type: "string"}})
+			}
+			o.Parameters = append(o.Parameters, openAPIParameter{Name: "If-None-Match", In: "header", Schema: &schema{Type: "string"}})
+		}
+		if op.query != nil {
+			o.Parameters = append(o.Parameters, queryParameters(reflect.TypeOf(op.query))...)
+		}
+		if op.body != nil {
+			o.RequestBody = &openAPIRequestBody{
+				Required: hasRequired(reflect.TypeOf(op.body)),
+				Content:  map[string]openAPIMedia{"application/json": {Schema: doc.schemaFor(reflect.TypeOf(op.body))}},
+			}
+		}
+
+		resp := openAPIResponse{Description: http.StatusText(op.status)}
+		if op.response != nil {
+			resp.Content = map[string]openAPIMedia{"application/json": {Schema: doc.schemaFor(reflect.TypeOf(op.response))}}
+		}
+		if op.conditional && op.response != nil {
+			resp.Headers = map[string]openAPIHeader{"ETag": {Schema: &schema{Type: "string"}}}
+			if op.method == http.MethodGet {
+				o.Responses[strconv.Itoa(http.StatusNotModified)] = openAPIResponse{
+					Description: http.StatusText(http.StatusNotModified),
+					Headers:     resp.Headers,
+				}
+			}
+		}
+		o.Responses[strconv.Itoa(op.status)] = resp
+
+		path := openAPIPath(op.path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(op.method)] = o
+	}
+
+	return doc
+}
+
+// openAPIPath converts the router syntax of path parameters to templates.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the schema of the type. Structs are added to the
+// components and referenced.
+func (doc *openAPIDocument) schemaFor(t reflect.Type) *schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct:
+		name := []rune(t.Name())
+		name[0] = unicode.ToUpper(name[0])
+		ref := &schema{Ref: "#/components/schemas/" + string(name)}
+		if _, ok := doc.Components.Schemas[string(name)]; ok {
+			return ref
+		}
+
+		s := &schema{Type: "object", Properties: make(map[string]*schema)}
+		doc.Components.Schemas[string(name)] = s
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			field, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if field == "" || field == "-" {
+				continue
+			}
+
+			s.Properties[field] = doc.schemaFor(f.Type)
+			if binding(f).required {
+				s.Required = append(s.Required, field)
+			}
+		}
+
+		return ref
+	case t.Kind() == reflect.Slice:
+		return &schema{Type: "array", Items: doc.schemaFor(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: doc.schemaFor(t.Elem())}
+	case t.Kind() == reflect.Interface:
+		return &schema{}
+	default:
+		return scalarSchema(t)
+	}
+}
+
+func scalarSchema(t reflect.Type) *schema {
+	switch t.Kind() {
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64:
+		return &schema{Type: "integer", Format: "int64"}
+	case reflect.Int32:
+		return &schema{Type: "integer", Format: "int32"}
+	case reflect.Uint, reflect.Uint64, reflect.Uint32:
+		var zero int64
+		return &schema{Type: "integer", Format: "int64", Minimum: &zero}
+	default:
+		return &schema{Type: "string"}
+	}
+}
+
+// queryParameters returns the parameters of the form fields of the type.
+func queryParameters(t reflect.Type) []openAPIParameter {
+	params := make([]openAPIParameter, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("form")
+		if name == "" {
+			continue
+		}
+
+		b := binding(f)
+		s := scalarSchema(f.Type)
+		if b.min != nil {
+			s.Minimum = b.min
+		}
+		s.Maximum = b.max
+		params = append(params, openAPIParameter{Name: name, In: "query", Required: b.required, Schema: s})
+	}
+
+	return params
+}
+
+// hasRequired reports whether the struct has a required field, without which
+// a body is optional.
+func hasRequired(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if binding(t.Field(i)).required {
+			return true
+		}
+	}
+
+	return false
+}
+
+type bindingRules struct {
+	required bool
+	min, max *int64
+}
+
+// binding returns the validation rules of the field that the schema can
+// express.
+func binding(f reflect.StructField) bindingRules {
+	var b bindingRules
+	for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+		name, value, _ := strings.Cut(rule, "=")
+		n, err := strconv.ParseInt(value, 10, 64)
+
+		switch {
+		case name == "required":
+			b.required = true
+		case name == "min" && err == nil:
+			b.min = &n
+		case name == "max" && err == nil:
+			b.max = &n
+		}
+	}
+
+	return b
+}
+
+// openAPI serves the document, which is encoded once.
+func openAPI(doc *openAPIDocument) gin.HandlerFunc {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", b)
+	}
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"counters/pkg/oauth2"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"go.uber.org/zap"
+)
+
+// TestOpenAPI_routes fails when a route is added, changed or removed without
+// its operation, or the other way around.
+func TestOpenAPI_routes(t *testing.T) {
+	c := gomock.NewController(t)
+
+	m := NewMockIAManager(c)
+	m.EXPECT().Providers().Return([]oauth2.Provider{oauth2.Google})
+
+	r := New(zap.NewNop(), m, NewMockCounterManager(c)).(*gin.Engine)
+
+	var versioned, unversioned []string
+	for _, route := range r.Routes() {
+		path := strings.Replace(route.Path, "/oauth/google/", "/oauth/:provider/", 1)
+
+		switch {
+		case path == "/health" || path == "/metrics":
+		case strings.HasPrefix(path, "/v1/"):
+			versioned = append(versioned, route.Method+" "+openAPIPath(strings.TrimPrefix(path, "/v1")))
+		default:
+			unversioned = append(unversioned, route.Method+" "+openAPIPath(path))
+		}
+	}
+
+	var documented []string
+	for path, ops := range newOpenAPI([]oauth2.Provider{oauth2.Google}, false).Paths {
+		for method := range ops {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	sort.Strings(versioned)
+	sort.Strings(documented)
+	if !reflect.DeepEqual(versioned, documented) {
+		t.Errorf("want routes: %v, got: %v", documented, versioned)
+	}
+
+	// Every route but the document has a deprecated alias.
+	var aliased []string
+	for _, route := range versioned {
+		if route != "GET /openapi.json" {
+			aliased = append(aliased, route)
+		}
+	}
+	sort.Strings(unversioned)
+	if !reflect.DeepEqual(unversioned, aliased) {
+		t.Errorf("want deprecated aliases: %v, got: %v", aliased, unversioned)
+	}
+}
+
+func TestOpenAPI_serve(t *testing.T) {
+	c := gomock.NewController(t)
+
+	m := NewMockIAManager(c)
+	m.EXPECT().Providers().Return([]oauth2.Provider{oauth2.GitHub, oauth2.Google})
+
+	w := httptest.NewRecorder()
+	New(zap.NewNop(), m, NewMockCounterManager(c)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status code: 200, got: %d", w.Code)
+	}
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			Parameters []struct {
+				Name   string `json:"name"`
+				Schema struct {
+					Enum []string `json:"enum"`
+				} `json:"schema"`
+			} `json:"parameters"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("want openapi: 3.0.3, got: %s", doc.OpenAPI)
+	}
+	params := doc.Paths["/oauth/{provider}/sign-in"]["get"].Parameters
+	if len(params) == 0 || !reflect.DeepEqual(params[0].Schema.Enum, []string{"github", "google"}) {
+		t.Errorf("want provider enum: [github google], got: %+v", params)
+	}
+}
+
+func TestNewOpenAPI_conditional(t *testing.T) {
+	doc := newOpenAPI(nil, false)
+
+	for method, want := range map[string][]string{"get": {"If-None-Match"}, "patch": {"If-Match", "If-None-Match"}} {
+		o := doc.Paths["/counters/{id}"][method]
+
+		var headers []string
+		for _, p := range o.Parameters {
+			if p.In == "header" {
+				headers = append(headers, p.Name)
+			}
+		}
+		if !reflect.DeepEqual(headers, want) {
+			t.Errorf("%s: want headers: %v, got: %v", method, want, headers)
+		}
+		if _, ok := o.Responses["200"].Headers["ETag"]; !ok {
+			t.Errorf("%s: want ETag response header", method)
+		}
+	}
+
+	if _, ok := doc.Paths["/counters/{id}"]["get"].Responses["304"]; !ok {
+		t.Errorf("want 304 response")
+	}
+
+	o := doc.Paths["/counters/{id}"]["delete"]
+	if n := len(o.Parameters); n != 3 {
+		t.Errorf("delete: want id, If-Match and If-None-Match parameters, got: %d", n)
+	}
+	if headers := o.Responses["204"].Headers; headers != nil {
+		t.Errorf("delete: want no response headers, got: %v", headers)
+	}
+}
+
+func TestOpenAPIDocument_schemaFor(t *testing.T) {
+	doc := newOpenAPI(nil, false)
+
+	ref := doc.schemaFor(reflect.TypeOf(createAPIKeyRequest{}))
+	if ref.Ref != "#/components/schemas/CreateAPIKeyRequest" {
+		t.Fatalf("want ref: #/components/schemas/CreateAPIKeyRequest, got: %s", ref.Ref)
+	}
+
+	got, err := json.Marshal(doc.Components.Schemas["CreateAPIKeyRequest"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"type":"object","properties":{"expires_at":{"type":"string","format":"date-time"},"name":{"type":"string"},"prefixes":{"type":"array","items":{"type":"string"}},"scope":{"type":"string"}},"required":["name","scope"]}`
+	if string(got) != want {
+		t.Errorf("want schema: %s, got: %s", want, got)
+	}
+}
+
+func Test_queryParameters(t *testing.T) {
+	params := queryParameters(reflect.TypeOf(listCountersRequest{}))
+
+	got, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[{"name":"prefix","in":"query","required":false,"schema":{"type":"string"}},` +
+		`{"name":"cursor","in":"query","required":false,"schema":{"type":"string"}},` +
+		`{"name":"limit","in":"query","required":false,"schema":{"type":"integer","format":"int64","minimum":1,"maximum":1000}},` +
+		`{"name":"sort","in":"query","required":false,"schema":{"type":"string"}}]`
+	if string(got) != want {
+		t.Errorf("want parameters: %s, got: %s", want, got)
+	}
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+
+	"counters/pkg/iam"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func grantRole(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return changeRole(l, iamManager.GrantRole)
+}
+
+func revokeRole(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return changeRole(l, iamManager.RevokeRole)
+}
+
+func changeRole(l *zap.Logger, change func(userID string, role iam.Role) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, role := c.Param("id"), iam.Role(c.Param("role"))
+
+		if err := change(id, role); err != nil {
+			abortWithError(c, l, err, zap.String("id", id))
+			return
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
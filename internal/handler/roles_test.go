@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"counters/pkg/iam"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"go.uber.org/zap"
+)
+
+func newTestUser(id string, roles ...iam.Role) *iam.User {
+	u := &iam.User{ID: id, Email: id + "@x.x"}
+	for _, r := range roles {
+		u.AddRole(r)
+	}
+
+	return u
+}
+
+func Test_grantRole(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		role     string
+		wantCode int
+	}{
+		"NoContent": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().GrantRole("id", iam.RoleViewer).Return(nil)
+
+				return m
+			},
+			role:     "viewer",
+			wantCode: http.StatusNoContent,
+		},
+		"BadRequest": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().GrantRole("id", iam.Role("owner")).Return(iam.ErrInvalidRole)
+
+				return m
+			},
+			role:     "owner",
+			wantCode: http.StatusBadRequest,
+		},
+		"NotFound": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().GrantRole("id", iam.RoleViewer).Return(iam.ErrUserNotFound)
+
+				return m
+			},
+			role:     "viewer",
+			wantCode: http.StatusNotFound,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().GrantRole("id", iam.RoleViewer).Return(errors.New("unexpected error"))
+
+				return m
+			},
+			role:     "viewer",
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPut, "/users/id/roles/"+tt.role, nil)
+			c.Params = gin.Params{{Key: "id", Value: "id"}, {Key: "role", Value: tt.role}}
+			c.Set(userKey, newTestUser("admin", iam.RoleAdmin))
+
+			grantRole(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func Test_revokeRole(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		wantCode int
+	}{
+		"NoContent": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().RevokeRole("id", iam.RoleEditor).Return(nil)
+
+				return m
+			},
+			wantCode: http.StatusNoContent,
+		},
+		"NotFound": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().RevokeRole("id", iam.RoleEditor).Return(iam.ErrUserNotFound)
+
+				return m
+			},
+			wantCode: http.StatusNotFound,
+		},
+		"Conflict": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().RevokeRole("id", iam.RoleEditor).Return(iam.ErrConfiguredAdmin)
+
+				return m
+			},
+			wantCode: http.StatusConflict,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodDelete, "/users/id/roles/editor", nil)
+			c.Params = gin.Params{{Key: "id", Value: "id"}, {Key: "role", Value: "editor"}}
+			c.Set(userKey, newTestUser("admin", iam.RoleAdmin))
+
+			revokeRole(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
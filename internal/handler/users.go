@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"counters/pkg/iam"
+	"counters/pkg/oauth2"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type userResponse struct {
+	ID    string     `json:"id"`
+	Email string     `json:"email"`
+	Roles []iam.Role `json:"roles"`
+}
+
+func newUserResponse(u *iam.User) userResponse {
+	return userResponse{ID: u.ID, Email: u.Email, Roles: u.Roles()}
+}
+
+func getMe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.AbortWithStatusJSON(http.StatusOK, newUserResponse(currentUser(c)))
+	}
+}
+
+// deleteMe deletes the current user along with its counters, API keys and
+// provider tokens.
+func deleteMe(l *zap.Logger, iamManager IAManager, cm CounterManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		removeUser(c, l, iamManager, cm, currentUser(c).ID)
+	}
+}
+
+type listUsersRequest struct {
+	Email  string `form:"email"`
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=1000"`
+}
+
+type listUsersResponse struct {
+	Users      []userResponse `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Total      int            `json:"total"`
+}
+
+func listUsers(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r listUsersRequest
+		if err := c.ShouldBindQuery(&r); err != nil {
+			abortWithError(c, l, invalidRequest(err))
+			return
+		}
+
+		page, err := iamManager.Users(iam.UserListOptions{
+			Email:  r.Email,
+			Cursor: r.Cursor,
+			Limit:  r.Limit,
+		})
+
+		if err != nil {
+			abortWithError(c, l, err)
+			return
+		}
+
+		resp := listUsersResponse{
+			Users:      make([]userResponse, 0, len(page.Users)),
+			NextCursor: page.NextCursor,
+			Total:      page.Total,
+		}
+		for _, u := range page.Users {
+			resp.Users = append(resp.Users, newUserResponse(u))
+		}
+
+		c.AbortWithStatusJSON(http.StatusOK, resp)
+	}
+}
+
+func getUser(l *zap.Logger, iamManager IAManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		u, err := iamManager.UserByID(id)
+		if err != nil {
+			abortWithError(c, l, err, zap.String("id", id))
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusOK, newUserResponse(u))
+	}
+}
+
+func deleteUser(l *zap.Logger, iamManager IAManager, cm CounterManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		removeUser(c, l, iamManager, cm, c.Param("id"))
+	}
+}
+
+// removeUser deletes the counters of the user before the user itself, so
+// that no counters are left without an owner. Provider tokens that could not
+// be revoked are logged, as the user is deleted regardless.
+func removeUser(c *gin.Context, l *zap.Logger, iamManager IAManager, cm CounterManager, id string) {
+	err := cm.DeleteUser(id)
+	if err == nil {
+		err = iamManager.DeleteUser(c, id)
+	}
+
+	switch {
+	case err == nil:
+		c.AbortWithStatus(http.StatusNoContent)
+	case errors.Is(err, oauth2.ErrRevokeFailed):
+		l.Warn(
+			"provider token revocation failed",
+			zap.String("uri", c.Request.RequestURI),
+			zap.String("user", id),
+			zap.Error(err),
+		)
+
+		c.AbortWithStatus(http.StatusNoContent)
+	default:
+		abortWithError(c, l, err, zap.String("user", id))
+	}
+}
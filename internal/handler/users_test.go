@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"counters/pkg/iam"
+	"counters/pkg/oauth2"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"go.uber.org/zap"
+)
+
+func Test_getMe(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/me", nil)
+	c.Set(userKey, newTestUser("user", iam.RoleViewer))
+
+	getMe()(c)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("want status code: %d, got: %d", http.StatusOK, w.Code)
+	}
+	if want := `{"id":"user","email":"user@x.x","roles":["viewer"]}`; w.Body.String() != want {
+		t.Errorf("want body: %s, got: %s", want, w.Body.String())
+	}
+}
+
+func Test_deleteMe(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		cm       func(c *gomock.Controller) CounterManager
+		wantCode int
+	}{
+		"NoContent": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().DeleteUser(gomock.Any(), "user").Return(nil)
+
+				return m
+			},
+			cm: func(c *gomock.Controller) CounterManager {
+				m := NewMockCounterManager(c)
+
+				m.EXPECT().DeleteUser("user").Return(nil)
+
+				return m
+			},
+			wantCode: http.StatusNoContent,
+		},
+		"NoContentRevokeFailed": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().DeleteUser(gomock.Any(), "user").Return(fmt.Errorf("revoking: %w", oauth2.ErrRevokeFailed))
+
+				return m
+			},
+			cm: func(c *gomock.Controller) CounterManager {
+				m := NewMockCounterManager(c)
+
+				m.EXPECT().DeleteUser("user").Return(nil)
+
+				return m
+			},
+			wantCode: http.StatusNoContent,
+		},
+		"InternalServerErrorCounters": {
+			iam: func(c *gomock.Controller) IAManager {
+				return NewMockIAManager(c)
+			},
+			cm: func(c *gomock.Controller) CounterManager {
+				m := NewMockCounterManager(c)
+
+				m.EXPECT().DeleteUser("user").Return(errors.New("unexpected error"))
+
+				return m
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().DeleteUser(gomock.Any(), "user").Return(errors.New("unexpected error"))
+
+				return m
+			},
+			cm: func(c *gomock.Controller) CounterManager {
+				m := NewMockCounterManager(c)
+
+				m.EXPECT().DeleteUser("user").Return(nil)
+
+				return m
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodDelete, "/me", nil)
+			c.Set(userKey, newTestUser("user", iam.RoleEditor))
+
+			ctrl := gomock.NewController(t)
+			deleteMe(zap.NewNop(), tt.iam(ctrl), tt.cm(ctrl))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func Test_listUsers(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		"OK": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().
+					Users(iam.UserListOptions{Email: "x.x", Cursor: "cursor", Limit: 1}).
+					Return(&iam.UserPage{
+						Users:      []*iam.User{newTestUser("user", iam.RoleEditor)},
+						NextCursor: "next",
+						Total:      2,
+					}, nil)
+
+				return m
+			},
+			query:    "?email=x.x&cursor=cursor&limit=1",
+			wantCode: http.StatusOK,
+			wantBody: `{"users":[{"id":"user","email":"user@x.x","roles":["editor"]}],"next_cursor":"next","total":2}`,
+		},
+		"BadRequestLimit": {
+			iam: func(c *gomock.Controller) IAManager {
+				return NewMockIAManager(c)
+			},
+			query:    "?limit=1001",
+			wantCode: http.StatusBadRequest,
+		},
+		"BadRequestErrInvalidCursor": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Users(iam.UserListOptions{Cursor: "!"}).Return(nil, iam.ErrInvalidCursor)
+
+				return m
+			},
+			query:    "?cursor=!",
+			wantCode: http.StatusBadRequest,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().Users(iam.UserListOptions{}).Return(nil, errors.New("unexpected error"))
+
+				return m
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/users"+tt.query, nil)
+			c.Set(userKey, newTestUser("admin", iam.RoleAdmin))
+
+			listUsers(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("want body: %s, got: %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_getUser(t *testing.T) {
+	for name, tt := range map[string]struct {
+		iam      func(c *gomock.Controller) IAManager
+		wantCode int
+	}{
+		"OK": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().UserByID("id").Return(newTestUser("id"), nil)
+
+				return m
+			},
+			wantCode: http.StatusOK,
+		},
+		"NotFound": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().UserByID("id").Return(nil, iam.ErrUserNotFound)
+
+				return m
+			},
+			wantCode: http.StatusNotFound,
+		},
+		"InternalServerError": {
+			iam: func(c *gomock.Controller) IAManager {
+				m := NewMockIAManager(c)
+
+				m.EXPECT().UserByID("id").Return(nil, errors.New("unexpected error"))
+
+				return m
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/users/id", nil)
+			c.Params = gin.Params{{Key: "id", Value: "id"}}
+			c.Set(userKey, newTestUser("admin", iam.RoleAdmin))
+
+			getUser(zap.NewNop(), tt.iam(gomock.NewController(t)))(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func Test_deleteUser(t *testing.T) {
+	for name, tt := range map[string]struct {
+		err      error
+		wantCode int
+	}{
+		"NoContent": {
+			err:      nil,
+			wantCode: http.StatusNoContent,
+		},
+		"NotFound": {
+			err:      iam.ErrUserNotFound,
+			wantCode: http.StatusNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodDelete, "/users/id", nil)
+			c.Params = gin.Params{{Key: "id", Value: "id"}}
+			c.Set(userKey, newTestUser("admin", iam.RoleAdmin))
+
+			ctrl := gomock.NewController(t)
+			im := NewMockIAManager(ctrl)
+			im.EXPECT().DeleteUser(gomock.Any(), "id").Return(tt.err)
+			cm := NewMockCounterManager(ctrl)
+			cm.EXPECT().DeleteUser("id").Return(nil)
+
+			deleteUser(zap.NewNop(), im, cm)(c)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code: %d, got: %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
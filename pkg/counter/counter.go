@@ -1,10 +1,100 @@
 package counter
 
+import (
+	"errors"
+	"math"
+)
+
+var (
+	ErrOverflow  = errors.New("counter overflow")
+	ErrUnderflow = errors.New("counter underflow")
+)
+
+// Permission is the access a user other than the owner has to a counter.
+// Write access implies read access.
+type Permission string
+
+const (
+	PermissionRead  Permission = "read"
+	PermissionWrite Permission = "write"
+)
+
+func (p Permission) Valid() bool {
+	return p == PermissionRead || p == PermissionWrite
+}
+
+// Counter is a named value. Version is incremented by every change of the
+// value, so that changes can be made conditional on the version that was
+// read.
 type Counter struct {
-	ID    string
-	Value uint64
+	ID      string
+	Value   uint64
+	Version uint64                `json:",omitempty"`
+	Owner   string                `json:",omitempty"`
+	Grants  map[string]Permission `json:",omitempty"`
+}
+
+func (c *Counter) CanRead(user string) bool {
+	return c.IsOwner(user) || c.Grants[user].Valid()
+}
+
+func (c *Counter) CanWrite(user string) bool {
+	return c.IsOwner(user) || c.Grants[user] == PermissionWrite
+}
+
+func (c *Counter) IsOwner(user string) bool {
+	return user != "" && c.Owner == user
+}
+
+func (c *Counter) clone() *Counter {
+	clone := *c
+	if c.Grants != nil {
+		clone.Grants = make(map[string]Permission, len(c.Grants))
+		for user, p := range c.Grants {
+			clone.Grants[user] = p
+		}
+	}
+
+	return &clone
+}
+
+// readers returns the owner and every user with a grant.
+func (c *Counter) readers() []string {
+	var readers []string
+	if c.Owner != "" {
+		readers = append(readers, c.Owner)
+	}
+	for user := range c.Grants {
+		readers = append(readers, user)
+	}
+
+	return readers
+}
+
+func (c *Counter) Inc() error {
+	return c.IncBy(1)
+}
+
+func (c *Counter) IncBy(n uint64) error {
+	if c.Value > math.MaxUint64-n {
+		return ErrOverflow
+	}
+
+	c.Value += n
+
+	return nil
 }
 
-func (c *Counter) Inc() {
-	c.Value++
+func (c *Counter) Dec() error {
+	return c.DecBy(1)
+}
+
+func (c *Counter) DecBy(n uint64) error {
+	if c.Value < n {
+		return ErrUnderflow
+	}
+
+	c.Value -= n
+
+	return nil
 }
@@ -1,6 +1,10 @@
 package counter
 
-import "testing"
+import (
+	"errors"
+	"math"
+	"testing"
+)
 
 func TestCounter_Inc(t *testing.T) {
 	var c Counter
@@ -11,3 +15,91 @@ func TestCounter_Inc(t *testing.T) {
 		t.Errorf("want: %d, got: %d", 1, c.Value)
 	}
 }
+
+func TestCounter_IncBy(t *testing.T) {
+	for name, tt := range map[string]struct {
+		c         Counter
+		n         uint64
+		wantValue uint64
+		wantErr   error
+	}{
+		"OK": {
+			c:         Counter{Value: 1},
+			n:         2,
+			wantValue: 3,
+			wantErr:   nil,
+		},
+		"OKMaxValue": {
+			c:         Counter{Value: math.MaxUint64 - 1},
+			n:         1,
+			wantValue: math.MaxUint64,
+			wantErr:   nil,
+		},
+		"ErrOverflow": {
+			c:         Counter{Value: math.MaxUint64},
+			n:         1,
+			wantValue: math.MaxUint64,
+			wantErr:   ErrOverflow,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := tt.c.IncBy(tt.n)
+
+			if tt.c.Value != tt.wantValue {
+				t.Errorf("want: %d, got: %d", tt.wantValue, tt.c.Value)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCounter_Dec(t *testing.T) {
+	c := Counter{Value: 1}
+
+	c.Dec()
+
+	if c.Value != 0 {
+		t.Errorf("want: %d, got: %d", 0, c.Value)
+	}
+}
+
+func TestCounter_DecBy(t *testing.T) {
+	for name, tt := range map[string]struct {
+		c         Counter
+		n         uint64
+		wantValue uint64
+		wantErr   error
+	}{
+		"OK": {
+			c:         Counter{Value: 3},
+			n:         2,
+			wantValue: 1,
+			wantErr:   nil,
+		},
+		"OKZeroValue": {
+			c:         Counter{Value: 2},
+			n:         2,
+			wantValue: 0,
+			wantErr:   nil,
+		},
+		"ErrUnderflow": {
+			c:         Counter{Value: 1},
+			n:         2,
+			wantValue: 1,
+			wantErr:   ErrUnderflow,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := tt.c.DecBy(tt.n)
+
+			if tt.c.Value != tt.wantValue {
+				t.Errorf("want: %d, got: %d", tt.wantValue, tt.c.Value)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,526 @@
+package counter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type SyncPolicy string
+
+const (
+	SyncAlways   SyncPolicy = "always"
+	SyncInterval SyncPolicy = "interval"
+	SyncNever    SyncPolicy = "never"
+)
+
+var ErrInvalidSyncPolicy = errors.New("invalid sync policy")
+
+type FileConfig struct {
+	Dir              string
+	Sync             SyncPolicy
+	SyncInterval     time.Duration
+	SnapshotInterval time.Duration
+	// OnError is called with the errors of the background sync and
+	// snapshot, which have no caller to return them to.
+	OnError func(error)
+}
+
+const (
+	walFileName      = "counters.wal"
+	snapshotFileName = "counters.snapshot"
+)
+
+type walOp string
+
+const (
+	walOpSet    walOp = "set"
+	walOpDelete walOp = "delete"
+)
+
+type walRecord struct {
+	Op      walOp   `json:"op"`
+	Counter Counter `json:"counter"`
+}
+
+// FileStorage keeps counters in memory and makes them durable by appending
+// every mutation to a write-ahead log, which is periodically compacted into
+// a snapshot. Mutations are serialized so that the log order matches the
+// order in which they were applied.
+type FileStorage struct {
+	mu       sync.Mutex
+	cfg      FileConfig
+	counters *MemoryStorage
+	wal      *os.File
+	records  int
+	// syncErr is the error of the last background sync. Records written
+	// before it are not known to be durable, so writes fail until a sync
+	// succeeds.
+	syncErr error
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func NewFileStorage(cfg FileConfig) (*FileStorage, error) {
+	switch cfg.Sync {
+	case SyncAlways, SyncNever:
+	case SyncInterval:
+		if cfg.SyncInterval <= 0 {
+			return nil, fmt.Errorf("%w: sync interval must be positive", ErrInvalidSyncPolicy)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSyncPolicy, cfg.Sync)
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &FileStorage{
+		cfg:      cfg,
+		counters: NewMemoryStorage(),
+		done:     make(chan struct{}),
+	}
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(s.path(walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.wal = wal
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+func (s *FileStorage) Create(counter *Counter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.counters.Get(counter.ID); err != ErrNotFound {
+		if err == nil {
+			return ErrExists
+		}
+		return err
+	}
+
+	return s.set(counter)
+}
+
+func (s *FileStorage) Set(counter *Counter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.set(counter)
+}
+
+func (s *FileStorage) Get(id string) (*Counter, error) {
+	return s.counters.Get(id)
+}
+
+func (s *FileStorage) List(opts ListOptions) (*Page, error) {
+	return s.counters.List(opts)
+}
+
+func (s *FileStorage) Increment(id string, delta uint64) (*Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, err := s.counters.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = counter.IncBy(delta); err != nil {
+		return nil, err
+	}
+	counter.Version++
+
+	return counter, s.set(counter)
+}
+
+func (s *FileStorage) Decrement(id string, delta uint64) (*Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, err := s.counters.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = counter.DecBy(delta); err != nil {
+		return nil, err
+	}
+	counter.Version++
+
+	return counter, s.set(counter)
+}
+
+func (s *FileStorage) CompareAndSwap(id string, old, new uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, err := s.counters.Get(id)
+	if err != nil {
+		return false, err
+	}
+	if counter.Value != old {
+		return false, nil
+	}
+
+	counter.Value = new
+	counter.Version++
+
+	return true, s.set(counter)
+}
+
+func (s *FileStorage) CompareAndSet(id string, version, value uint64) (*Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, err := s.counters.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if counter.Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	counter.Value = value
+	counter.Version++
+
+	return counter, s.set(counter)
+}
+
+func (s *FileStorage) Grant(id, user string, permission Permission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, err := s.counters.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if counter.Grants == nil {
+		counter.Grants = map[string]Permission{}
+	}
+	counter.Grants[user] = permission
+
+	return s.set(counter)
+}
+
+func (s *FileStorage) Revoke(id, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, err := s.counters.Get(id)
+	if err != nil {
+		return err
+	}
+	if _, ok := counter.Grants[user]; !ok {
+		return nil
+	}
+
+	delete(counter.Grants, user)
+
+	return s.set(counter)
+}
+
+func (s *FileStorage) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, err := s.counters.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if err = s.append(walRecord{Op: walOpDelete, Counter: *counter}); err != nil {
+		return err
+	}
+
+	return s.counters.Delete(id)
+}
+
+func (s *FileStorage) CompareAndDelete(id string, version uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, err := s.counters.Get(id)
+	if err != nil {
+		return err
+	}
+	if counter.Version != version {
+		return ErrVersionMismatch
+	}
+
+	if err = s.append(walRecord{Op: walOpDelete, Counter: *counter}); err != nil {
+		return err
+	}
+
+	return s.counters.Delete(id)
+}
+
+// Snapshot writes all counters to a new snapshot and truncates the log.
+func (s *FileStorage) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.snapshot()
+}
+
+// Close stops the background sync and snapshot, writes a final snapshot and
+// closes the log. Calling it again returns the result of the first call.
+func (s *FileStorage) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.close()
+	})
+
+	return s.closeErr
+}
+
+func (s *FileStorage) close() error {
+	close(s.done)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.snapshot(); err != nil {
+		s.wal.Close()
+		return err
+	}
+
+	return s.wal.Close()
+}
+
+func (s *FileStorage) set(counter *Counter) error {
+	if err := s.append(walRecord{Op: walOpSet, Counter: *counter}); err != nil {
+		return err
+	}
+
+	return s.counters.Set(counter)
+}
+
+func (s *FileStorage) append(r walRecord) error {
+	if s.syncErr != nil {
+		if err := s.wal.Sync(); err != nil {
+			return fmt.Errorf("syncing WAL: %w", err)
+		}
+		s.syncErr = nil
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.wal.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	s.records++
+
+	if s.cfg.Sync == SyncAlways {
+		return s.wal.Sync()
+	}
+
+	return nil
+}
+
+func (s *FileStorage) snapshot() error {
+	if s.records == 0 {
+		return nil
+	}
+
+	s.counters.mu.RLock()
+	counters := make([]*Counter, 0, len(s.counters.counters))
+	for _, c := range s.counters.counters {
+		counters = append(counters, c)
+	}
+	b, err := json.Marshal(counters)
+	s.counters.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileSync(s.path(snapshotFileName), b); err != nil {
+		return err
+	}
+
+	if err = s.wal.Truncate(0); err != nil {
+		return err
+	}
+	if err = s.wal.Sync(); err != nil {
+		return err
+	}
+	s.records = 0
+
+	return nil
+}
+
+func (s *FileStorage) loadSnapshot() error {
+	b, err := os.ReadFile(s.path(snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var counters []*Counter
+	if err = json.Unmarshal(b, &counters); err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	for _, c := range counters {
+		if err = s.counters.Set(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replay applies the log on top of the snapshot. A trailing record without
+// a newline is the result of a torn write and is cut off.
+func (s *FileStorage) replay() error {
+	f, err := os.OpenFile(s.path(walFileName), os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var offset int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return f.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec walRecord
+		if err = json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("reading WAL record at offset %d: %w", offset, err)
+		}
+
+		switch rec.Op {
+		case walOpSet:
+			err = s.counters.Set(&rec.Counter)
+		case walOpDelete:
+			if err = s.counters.Delete(rec.Counter.ID); err == ErrNotFound {
+				err = nil
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", rec.Op)
+		}
+		if err != nil {
+			return fmt.Errorf("applying WAL record at offset %d: %w", offset, err)
+		}
+
+		offset += int64(len(line))
+		s.records++
+	}
+}
+
+func (s *FileStorage) run() {
+	defer s.wg.Done()
+
+	var syncC, snapshotC <-chan time.Time
+	if s.cfg.Sync == SyncInterval {
+		t := time.NewTicker(s.cfg.SyncInterval)
+		defer t.Stop()
+		syncC = t.C
+	}
+	if s.cfg.SnapshotInterval > 0 {
+		t := time.NewTicker(s.cfg.SnapshotInterval)
+		defer t.Stop()
+		snapshotC = t.C
+	}
+
+	for {
+		select {
+		case <-syncC:
+			s.mu.Lock()
+			err := s.wal.Sync()
+			s.syncErr = err
+			s.mu.Unlock()
+			if err != nil {
+				s.onError(fmt.Errorf("syncing WAL: %w", err))
+			}
+		case <-snapshotC:
+			if err := s.Snapshot(); err != nil {
+				s.onError(fmt.Errorf("writing snapshot: %w", err))
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *FileStorage) onError(err error) {
+	if s.cfg.OnError != nil {
+		s.cfg.OnError(err)
+	}
+}
+
+func (s *FileStorage) path(name string) string {
+	return filepath.Join(s.cfg.Dir, name)
+}
+
+func writeFileSync(path string, b []byte) error {
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -0,0 +1,265 @@
+package counter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestFileStorage(t *testing.T, dir string) *FileStorage {
+	t.Helper()
+
+	s, err := NewFileStorage(FileConfig{Dir: dir, Sync: SyncAlways})
+	if err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	return s
+}
+
+func TestNewFileStorage(t *testing.T) {
+	for name, tt := range map[string]struct {
+		cfg     FileConfig
+		wantErr error
+	}{
+		"OK": {
+			cfg:     FileConfig{Sync: SyncInterval, SyncInterval: time.Second},
+			wantErr: nil,
+		},
+		"ErrInvalidSyncPolicy": {
+			cfg:     FileConfig{Sync: "sometimes"},
+			wantErr: ErrInvalidSyncPolicy,
+		},
+		"ErrInvalidSyncPolicyInterval": {
+			cfg:     FileConfig{Sync: SyncInterval},
+			wantErr: ErrInvalidSyncPolicy,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tt.cfg.Dir = t.TempDir()
+
+			s, err := NewFileStorage(tt.cfg)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if err == nil {
+				s.Close()
+			}
+		})
+	}
+}
+
+func TestFileStorage_Replay(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestFileStorage(t, dir)
+	if err := s.Set(&Counter{ID: "a"}); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if err := s.Set(&Counter{ID: "b", Value: 10}); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if _, err := s.Increment("a", 5); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if _, err := s.Decrement("a", 2); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if _, err := s.CompareAndSwap("b", 10, 20); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if _, err := s.CompareAndSet("b", 1, 30); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if err := s.Set(&Counter{ID: "c"}); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if err := s.Delete("c"); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	// Simulate a crash: the log is not compacted into a snapshot.
+	s.wal.Close()
+	close(s.done)
+	s.wg.Wait()
+
+	s = newTestFileStorage(t, dir)
+	defer s.Close()
+
+	want := map[string]*Counter{
+		"a": {ID: "a", Value: 3, Version: 2},
+		"b": {ID: "b", Value: 30, Version: 2},
+	}
+	if !reflect.DeepEqual(s.counters.counters, want) {
+		t.Errorf("want: %+v, got: %+v", want, s.counters.counters)
+	}
+}
+
+func TestFileStorage_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestFileStorage(t, dir)
+	if err := s.Set(&Counter{ID: "a", Value: 1}); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	if err := s.Snapshot(); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	if info, err := os.Stat(filepath.Join(dir, walFileName)); err != nil || info.Size() != 0 {
+		t.Errorf("want: empty WAL, got: %+v, %v", info, err)
+	}
+
+	if _, err := s.Increment("a", 1); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	s = newTestFileStorage(t, dir)
+	defer s.Close()
+
+	c, err := s.Get("a")
+	if want := (&Counter{ID: "a", Value: 2, Version: 1}); !reflect.DeepEqual(c, want) {
+		t.Errorf("want: %+v, got: %+v", want, c)
+	}
+	if err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+}
+
+func TestFileStorage_TornWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	wal := `{"op":"set","counter":{"ID":"a","Value":1}}` + "\n" + `{"op":"set","coun`
+	if err := os.WriteFile(filepath.Join(dir, walFileName), []byte(wal), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestFileStorage(t, dir)
+	defer s.Close()
+
+	want := map[string]*Counter{"a": {ID: "a", Value: 1}}
+	if !reflect.DeepEqual(s.counters.counters, want) {
+		t.Errorf("want: %+v, got: %+v", want, s.counters.counters)
+	}
+
+	if _, err := s.Increment("a", 1); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantWAL := `{"op":"set","counter":{"ID":"a","Value":1}}` + "\n" + `{"op":"set","counter":{"ID":"a","Value":2,"Version":1}}` + "\n"
+	if string(b) != wantWAL {
+		t.Errorf("want: %s, got: %s", wantWAL, b)
+	}
+}
+
+func TestFileStorage_CorruptedWAL(t *testing.T) {
+	dir := t.TempDir()
+
+	wal := `{"op":"set",` + "\n" + `{"op":"set","counter":{"ID":"a","Value":1}}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, walFileName), []byte(wal), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewFileStorage(FileConfig{Dir: dir, Sync: SyncNever})
+
+	if err == nil {
+		t.Errorf("want: <non-nil>, got: <nil>")
+	}
+}
+
+func TestFileStorage_Errors(t *testing.T) {
+	s := newTestFileStorage(t, t.TempDir())
+	defer s.Close()
+
+	if err := s.Set(&Counter{ID: "a"}); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	if _, err := s.Decrement("a", 1); err != ErrUnderflow {
+		t.Errorf("want: %v, got: %v", ErrUnderflow, err)
+	}
+	if _, err := s.Increment("b", 1); err != ErrNotFound {
+		t.Errorf("want: %v, got: %v", ErrNotFound, err)
+	}
+	if err := s.Delete("b"); err != ErrNotFound {
+		t.Errorf("want: %v, got: %v", ErrNotFound, err)
+	}
+	if swapped, err := s.CompareAndSwap("a", 1, 2); swapped || err != nil {
+		t.Errorf("want: false, <nil>, got: %t, %v", swapped, err)
+	}
+	if _, err := s.CompareAndSet("a", 1, 2); err != ErrVersionMismatch {
+		t.Errorf("want: %v, got: %v", ErrVersionMismatch, err)
+	}
+	if err := s.CompareAndDelete("a", 1); err != ErrVersionMismatch {
+		t.Errorf("want: %v, got: %v", ErrVersionMismatch, err)
+	}
+	if s.records != 1 {
+		t.Errorf("want: %d WAL records, got: %d", 1, s.records)
+	}
+}
+
+func TestFileStorage_Access(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestFileStorage(t, dir)
+	testStorageAccess(t, s)
+	if err := s.Close(); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	s = newTestFileStorage(t, dir)
+	want := &Counter{ID: "c", Value: 3, Owner: "alice"}
+	if c, err := s.Get("c"); err != nil || !reflect.DeepEqual(c, want) {
+		t.Errorf("want: %+v, got: %+v, %v", want, c, err)
+	}
+}
+
+func TestFileStorage_syncErr(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestFileStorage(t, dir)
+	defer s.Close()
+
+	closed, err := os.Create(filepath.Join(dir, "closed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	wal := s.wal
+	s.wal, s.syncErr = closed, errors.New("sync failed")
+	if err = s.Set(&Counter{ID: "a"}); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("want write failed while sync fails: %v, got: %v", os.ErrClosed, err)
+	}
+	if _, err = s.Get("a"); err != ErrNotFound {
+		t.Errorf("want: %v, got: %v", ErrNotFound, err)
+	}
+
+	s.wal = wal
+	if err = s.Set(&Counter{ID: "a"}); err != nil {
+		t.Errorf("want write once sync succeeds: <nil>, got: %v", err)
+	}
+	if s.syncErr != nil {
+		t.Errorf("want: <nil>, got: %v", s.syncErr)
+	}
+}
+
+func TestFileStorage_Close(t *testing.T) {
+	s := newTestFileStorage(t, t.TempDir())
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("want second close: <nil>, got: %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package counter
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// index keeps counter IDs sorted, and (value, ID) pairs ordered in a
+// skiplist. Values change on every increment, so they are kept in a
+// structure that is updated in logarithmic time. IDs only change when
+// counters are created, deleted or shared.
+type index struct {
+	ids    []string
+	values valueList
+}
+
+type valueKey struct {
+	value uint64
+	id    string
+}
+
+func (k valueKey) less(o valueKey) bool {
+	if k.value != o.value {
+		return k.value < o.value
+	}
+
+	return k.id < o.id
+}
+
+func (x *index) insert(id string, value uint64) {
+	i := sort.SearchStrings(x.ids, id)
+	x.ids = append(x.ids, "")
+	copy(x.ids[i+1:], x.ids[i:])
+	x.ids[i] = id
+
+	x.values.insert(valueKey{value: value, id: id})
+}
+
+func (x *index) remove(id string, value uint64) {
+	if i := sort.SearchStrings(x.ids, id); i < len(x.ids) && x.ids[i] == id {
+		x.ids = append(x.ids[:i], x.ids[i+1:]...)
+	}
+
+	x.values.remove(valueKey{value: value, id: id})
+}
+
+func (x *index) update(id string, old, new uint64) {
+	if old == new {
+		return
+	}
+
+	x.values.remove(valueKey{value: old, id: id})
+	x.values.insert(valueKey{value: new, id: id})
+}
+
+const (
+	valueListMaxLevel = 16
+	// valueListP is the inverse of the probability that a node is linked on
+	// the next level too.
+	valueListP = 4
+)
+
+// valueList is a skiplist of value keys. Nodes are linked back on the
+// lowest level, so that pages sorted in descending order can be walked too.
+type valueList struct {
+	head  valueNode
+	level int
+}
+
+type valueNode struct {
+	key  valueKey
+	prev *valueNode
+	next []*valueNode
+}
+
+// path returns the last node with a key less than k, which is the head if
+// there is none, and fills in the last such node on each level.
+func (l *valueList) path(k valueKey, update *[valueListMaxLevel]*valueNode) *valueNode {
+	n := &l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for n.next[i] != nil && n.next[i].key.less(k) {
+			n = n.next[i]
+		}
+		if update != nil {
+			update[i] = n
+		}
+	}
+
+	return n
+}
+
+func (l *valueList) insert(k valueKey) {
+	if l.head.next == nil {
+		l.head.next = make([]*valueNode, valueListMaxLevel)
+	}
+
+	var update [valueListMaxLevel]*valueNode
+	l.path(k, &update)
+
+	level := 1
+	for level < valueListMaxLevel && rand.Intn(valueListP) == 0 {
+		level++
+	}
+	for ; l.level < level; l.level++ {
+		update[l.level] = &l.head
+	}
+
+	n := &valueNode{key: k, next: make([]*valueNode, level)}
+	for i := range n.next {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	if update[0] != &l.head {
+		n.prev = update[0]
+	}
+	if n.next[0] != nil {
+		n.next[0].prev = n
+	}
+}
+
+func (l *valueList) remove(k valueKey) {
+	if l.level == 0 {
+		return
+	}
+
+	var update [valueListMaxLevel]*valueNode
+	n := l.path(k, &update).next[0]
+	if n == nil || n.key != k {
+		return
+	}
+
+	for i := range n.next {
+		update[i].next[i] = n.next[i]
+	}
+	if n.next[0] != nil {
+		n.next[0].prev = n.prev
+	}
+	for l.level > 0 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+}
+
+// first returns the node with the smallest key, or nil if the list is
+// empty.
+func (l *valueList) first() *valueNode {
+	if l.level == 0 {
+		return nil
+	}
+
+	return l.head.next[0]
+}
+
+// last returns the node with the largest key, or nil if the list is empty.
+func (l *valueList) last() *valueNode {
+	n := &l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for n.next[i] != nil {
+			n = n.next[i]
+		}
+	}
+	if n == &l.head {
+		return nil
+	}
+
+	return n
+}
+
+// after returns the first node with a key greater than k, or nil if there
+// is none.
+func (l *valueList) after(k valueKey) *valueNode {
+	if l.level == 0 {
+		return nil
+	}
+
+	n := &l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for n.next[i] != nil && !k.less(n.next[i].key) {
+			n = n.next[i]
+		}
+	}
+
+	return n.next[0]
+}
+
+// before returns the last node with a key less than k, or nil if there is
+// none.
+func (l *valueList) before(k valueKey) *valueNode {
+	if n := l.path(k, nil); n != &l.head {
+		return n
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package counter
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestValueList(t *testing.T) {
+	var (
+		l    valueList
+		want []valueKey
+	)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		k := valueKey{value: uint64(r.Intn(50)), id: strconv.Itoa(r.Intn(200))}
+		j := sort.Search(len(want), func(j int) bool { return !want[j].less(k) })
+		if j < len(want) && want[j] == k {
+			l.remove(k)
+			want = append(want[:j], want[j+1:]...)
+		} else {
+			l.insert(k)
+			want = append(want[:j], append([]valueKey{k}, want[j:]...)...)
+		}
+	}
+
+	var asc, desc []valueKey
+	for n := l.first(); n != nil; n = n.next[0] {
+		asc = append(asc, n.key)
+	}
+	for n := l.last(); n != nil; n = n.prev {
+		desc = append([]valueKey{n.key}, desc...)
+	}
+	if !reflect.DeepEqual(asc, want) {
+		t.Errorf("want ascending: %v, got: %v", want, asc)
+	}
+	if !reflect.DeepEqual(desc, want) {
+		t.Errorf("want descending: %v, got: %v", want, desc)
+	}
+
+	for _, k := range []valueKey{want[0], want[len(want)/2], want[len(want)-1], {value: 25, id: "x"}} {
+		i := sort.Search(len(want), func(i int) bool { return k.less(want[i]) })
+		if n := l.after(k); (n == nil) != (i == len(want)) || n != nil && n.key != want[i] {
+			t.Errorf("after %v: want: %v, got: %v", k, want[i:], n)
+		}
+
+		i = sort.Search(len(want), func(i int) bool { return !want[i].less(k) }) - 1
+		if n := l.before(k); (n == nil) != (i < 0) || n != nil && n.key != want[i] {
+			t.Errorf("before %v: want: %v, got: %v", k, want[:i+1], n)
+		}
+	}
+
+	for _, k := range want {
+		l.remove(k)
+	}
+	if l.first() != nil || l.last() != nil || l.level != 0 {
+		t.Errorf("want empty list, got: %+v", l)
+	}
+}
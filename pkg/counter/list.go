@@ -0,0 +1,152 @@
+package counter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+type Sort string
+
+const (
+	SortByID        Sort = "id"
+	SortByIDDesc    Sort = "-id"
+	SortByValue     Sort = "value"
+	SortByValueDesc Sort = "-value"
+)
+
+func (s Sort) Valid() bool {
+	switch s {
+	case SortByID, SortByIDDesc, SortByValue, SortByValueDesc:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s Sort) byValue() bool {
+	return s == SortByValue || s == SortByValueDesc
+}
+
+func (s Sort) desc() bool {
+	return s == SortByIDDesc || s == SortByValueDesc
+}
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+type ListOptions struct {
+	Prefix string
+	Cursor string
+	Limit  int
+	Sort   Sort
+	// Reader restricts the list to the counters the user can read. All
+	// counters are listed if it is empty.
+	Reader string
+}
+
+// parseListOptions fills in the defaults, validates the options and decodes
+// the cursor, which is nil for the first page.
+func parseListOptions(opts ListOptions) (ListOptions, *cursor, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortByID
+	}
+	if !opts.Sort.Valid() {
+		return opts, nil, ErrInvalidSort
+	}
+
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultListLimit
+	}
+	if opts.Limit > MaxListLimit {
+		opts.Limit = MaxListLimit
+	}
+
+	cur, err := decodeCursor(opts.Sort, opts.Cursor)
+
+	return opts, cur, err
+}
+
+type Page struct {
+	Counters   []*Counter
+	NextCursor string
+	Total      int
+}
+
+// paginate drops the counter that was fetched past the limit to find out
+// whether there is a next page, and points the next cursor at the last one.
+func paginate(page *Page, opts ListOptions) *Page {
+	if len(page.Counters) > opts.Limit {
+		page.Counters = page.Counters[:opts.Limit]
+		page.NextCursor = encodeCursor(opts.Sort, page.Counters[opts.Limit-1])
+	}
+
+	return page
+}
+
+// cursor points at the last counter of a page. It also records the sort
+// order, so that a cursor cannot be reused with a different one.
+type cursor struct {
+	Sort  Sort   `json:"s"`
+	ID    string `json:"i"`
+	Value uint64 `json:"v,omitempty"`
+}
+
+func encodeCursor(sort Sort, c *Counter) string {
+	cur := cursor{Sort: sort, ID: c.ID}
+	if sort.byValue() {
+		cur.Value = c.Value
+	}
+
+	b, _ := json.Marshal(cur)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(sort Sort, s string) (*cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cur cursor
+	if err = json.Unmarshal(b, &cur); err != nil || cur.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cur, nil
+}
+
+// after reports whether c goes after the cursor in the sort order.
+func (cur *cursor) after(c *Counter) bool {
+	if cur.Sort.byValue() && c.Value != cur.Value {
+		return (c.Value > cur.Value) != cur.Sort.desc()
+	}
+
+	return c.ID != cur.ID && (c.ID > cur.ID) != cur.Sort.desc()
+}
+
+// prefixEnd returns the smallest string greater than every string with the
+// given prefix, or "" if there is none.
+func prefixEnd(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+
+	return ""
+}
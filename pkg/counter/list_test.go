@@ -0,0 +1,231 @@
+package counter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrefixEnd(t *testing.T) {
+	for prefix, want := range map[string]string{
+		"":         "",
+		"a":        "b",
+		"ab":       "ac",
+		"a\xff":    "b",
+		"\xff\xff": "",
+	} {
+		if got := prefixEnd(prefix); got != want {
+			t.Errorf("prefixEnd(%q): want: %q, got: %q", prefix, want, got)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	for name, tt := range map[string]struct {
+		sort       Sort
+		cursor     string
+		wantCursor *cursor
+		wantErr    error
+	}{
+		"OK": {
+			sort:       SortByValue,
+			cursor:     encodeCursor(SortByValue, &Counter{ID: "id", Value: 1}),
+			wantCursor: &cursor{Sort: SortByValue, ID: "id", Value: 1},
+			wantErr:    nil,
+		},
+		"Empty": {
+			sort:       SortByID,
+			cursor:     "",
+			wantCursor: nil,
+			wantErr:    nil,
+		},
+		"ErrInvalidCursor": {
+			sort:       SortByID,
+			cursor:     "!",
+			wantCursor: nil,
+			wantErr:    ErrInvalidCursor,
+		},
+		"ErrInvalidCursorSort": {
+			sort:       SortByID,
+			cursor:     encodeCursor(SortByValue, &Counter{ID: "id", Value: 1}),
+			wantCursor: nil,
+			wantErr:    ErrInvalidCursor,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cur, err := decodeCursor(tt.sort, tt.cursor)
+
+			if !reflect.DeepEqual(cur, tt.wantCursor) {
+				t.Errorf("want: %+v, got: %+v", tt.wantCursor, cur)
+			}
+			if err != tt.wantErr {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// testStorageList checks a storage's List against a fixed set of counters,
+// walking all pages with the given limit.
+func testStorageList(t *testing.T, newStorage func(t *testing.T, counters map[string]uint64) Storage) {
+	t.Helper()
+
+	counters := map[string]uint64{
+		"a":   3,
+		"a_b": 1,
+		"aa":  2,
+		"ab":  1,
+		"b":   0,
+		"ba":  5,
+	}
+
+	for name, tt := range map[string]struct {
+		opts      ListOptions
+		wantIDs   []string
+		wantTotal int
+		wantErr   error
+	}{
+		"ByID": {
+			opts:      ListOptions{Limit: 2},
+			wantIDs:   []string{"a", "a_b", "aa", "ab", "b", "ba"},
+			wantTotal: 6,
+		},
+		"ByIDDesc": {
+			opts:      ListOptions{Limit: 4, Sort: SortByIDDesc},
+			wantIDs:   []string{"ba", "b", "ab", "aa", "a_b", "a"},
+			wantTotal: 6,
+		},
+		"ByValue": {
+			opts:      ListOptions{Limit: 1, Sort: SortByValue},
+			wantIDs:   []string{"b", "a_b", "ab", "aa", "a", "ba"},
+			wantTotal: 6,
+		},
+		"ByValueDesc": {
+			opts:      ListOptions{Limit: 5, Sort: SortByValueDesc},
+			wantIDs:   []string{"ba", "a", "aa", "ab", "a_b", "b"},
+			wantTotal: 6,
+		},
+		"Prefix": {
+			opts:      ListOptions{Prefix: "a_", Limit: 1},
+			wantIDs:   []string{"a_b"},
+			wantTotal: 1,
+		},
+		"PrefixByValueDesc": {
+			opts:      ListOptions{Prefix: "a", Limit: 2, Sort: SortByValueDesc},
+			wantIDs:   []string{"a", "aa", "ab", "a_b"},
+			wantTotal: 4,
+		},
+		"NoMatches": {
+			opts:      ListOptions{Prefix: "c"},
+			wantIDs:   nil,
+			wantTotal: 0,
+		},
+		"ErrInvalidSort": {
+			opts:    ListOptions{Sort: "name"},
+			wantErr: ErrInvalidSort,
+		},
+		"ErrInvalidCursor": {
+			opts:    ListOptions{Cursor: encodeCursor(SortByValue, &Counter{ID: "a"})},
+			wantErr: ErrInvalidCursor,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newStorage(t, counters)
+
+			var ids []string
+			for pages := 0; ; pages++ {
+				if pages > len(counters) {
+					t.Fatal("too many pages")
+				}
+
+				page, err := s.List(tt.opts)
+				if err != tt.wantErr {
+					t.Fatalf("want: %v, got: %v", tt.wantErr, err)
+				}
+				if err != nil {
+					return
+				}
+				if page.Total != tt.wantTotal {
+					t.Errorf("want: %d, got: %d", tt.wantTotal, page.Total)
+				}
+				for _, c := range page.Counters {
+					if c.Value != counters[c.ID] {
+						t.Errorf("want: %d, got: %d", counters[c.ID], c.Value)
+					}
+					ids = append(ids, c.ID)
+				}
+
+				if page.NextCursor == "" {
+					break
+				}
+				tt.opts.Cursor = page.NextCursor
+			}
+
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("want: %v, got: %v", tt.wantIDs, ids)
+			}
+		})
+	}
+}
+
+// testStorageAccess checks that a storage keeps the owner and the grants of
+// counters and lists only the counters a reader can read.
+func testStorageAccess(t *testing.T, s Storage) {
+	t.Helper()
+
+	for _, c := range []*Counter{
+		{ID: "a", Value: 1, Owner: "alice"},
+		{ID: "b", Value: 2, Owner: "bob"},
+		{ID: "c", Value: 3, Owner: "alice", Grants: map[string]Permission{"bob": PermissionRead}},
+	} {
+		if err := s.Create(c); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+	}
+	if err := s.Create(&Counter{ID: "a", Owner: "bob"}); err != ErrExists {
+		t.Errorf("want: %v, got: %v", ErrExists, err)
+	}
+
+	if err := s.Grant("a", "bob", PermissionWrite); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if err := s.Revoke("c", "bob"); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if err := s.Grant("d", "bob", PermissionWrite); err != ErrNotFound {
+		t.Errorf("want: %v, got: %v", ErrNotFound, err)
+	}
+	if _, err := s.Increment("a", 2); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	want := &Counter{ID: "a", Value: 3, Version: 1, Owner: "alice", Grants: map[string]Permission{"bob": PermissionWrite}}
+	if c, err := s.Get("a"); err != nil || !reflect.DeepEqual(c, want) {
+		t.Errorf("want: %+v, got: %+v, %v", want, c, err)
+	}
+
+	for reader, wantIDs := range map[string][]string{
+		"alice": {"c", "a"},
+		"bob":   {"a", "b"},
+		"carol": nil,
+	} {
+		page, err := s.List(ListOptions{Sort: SortByValueDesc, Reader: reader})
+		if err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+
+		var ids []string
+		for _, c := range page.Counters {
+			ids = append(ids, c.ID)
+		}
+		if !reflect.DeepEqual(ids, wantIDs) || page.Total != len(wantIDs) {
+			t.Errorf("%s: want: %v, got: %v (total %d)", reader, wantIDs, ids, page.Total)
+		}
+	}
+
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if page, err := s.List(ListOptions{Reader: "bob"}); err != nil || page.Total != 1 {
+		t.Errorf("want: 1, got: %+v, %v", page, err)
+	}
+}
@@ -10,35 +10,214 @@ func NewManager(s Storage) *Manager {
 	return &Manager{s: s}
 }
 
-var ErrExists = errors.New("counter exists")
+var (
+	ErrForbidden          = errors.New("forbidden")
+	ErrInvalidPermission  = errors.New("invalid permission")
+	ErrInvalidGrantee     = errors.New("invalid grantee")
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
 
-func (m *Manager) Add(id string) error {
-	_, err := m.s.Get(id)
-	if err == nil {
-		return ErrExists
+// Condition makes a change depend on the version of the counter. A nil
+// IfMatch allows any version and an empty one none. The zero Condition
+// always holds.
+type Condition struct {
+	IfMatch     []uint64
+	IfNoneMatch []uint64
+}
+
+func (c Condition) Holds(version uint64) bool {
+	if c.IfMatch != nil && !containsVersion(c.IfMatch, version) {
+		return false
 	}
-	if err != ErrNotFound {
-		return err
+
+	return !containsVersion(c.IfNoneMatch, version)
+}
+
+func (c Condition) isZero() bool {
+	return c.IfMatch == nil && len(c.IfNoneMatch) == 0
+}
+
+func containsVersion(versions []uint64, version uint64) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
 	}
 
-	return m.s.Set(&Counter{ID: id})
+	return false
 }
 
-func (m *Manager) Get(id string) (*Counter, error) {
-	return m.s.Get(id)
+func (m *Manager) Add(user, id string) error {
+	return m.s.Create(&Counter{ID: id, Version: 1, Owner: user})
 }
 
-func (m *Manager) Inc(id string) error {
-	counter, err := m.s.Get(id)
+func (m *Manager) Get(user, id string) (*Counter, error) {
+	return m.authorize(user, id, (*Counter).CanRead)
+}
+
+func (m *Manager) List(user string, opts ListOptions) (*Page, error) {
+	opts.Reader = user
+
+	return m.s.List(opts)
+}
+
+func (m *Manager) Inc(user, id string) error {
+	_, err := m.IncBy(user, id, 1, Condition{})
+
+	return err
+}
+
+func (m *Manager) IncBy(user, id string, n uint64, cond Condition) (*Counter, error) {
+	if !cond.isZero() {
+		return m.change(user, id, cond, func(c *Counter) error { return c.IncBy(n) })
+	}
+
+	if _, err := m.authorize(user, id, (*Counter).CanWrite); err != nil {
+		return nil, err
+	}
+
+	return m.s.Increment(id, n)
+}
+
+func (m *Manager) Dec(user, id string) error {
+	_, err := m.DecBy(user, id, 1, Condition{})
+
+	return err
+}
+
+func (m *Manager) DecBy(user, id string, n uint64, cond Condition) (*Counter, error) {
+	if !cond.isZero() {
+		return m.change(user, id, cond, func(c *Counter) error { return c.DecBy(n) })
+	}
+
+	if _, err := m.authorize(user, id, (*Counter).CanWrite); err != nil {
+		return nil, err
+	}
+
+	return m.s.Decrement(id, n)
+}
+
+func (m *Manager) Reset(user, id string, cond Condition) (*Counter, error) {
+	return m.Set(user, id, 0, cond)
+}
+
+func (m *Manager) Set(user, id string, value uint64, cond Condition) (*Counter, error) {
+	return m.change(user, id, cond, func(c *Counter) error {
+		c.Value = value
+		return nil
+	})
+}
+
+// change applies f to the value of the counter if the condition holds, and
+// starts over when the counter is changed concurrently.
+func (m *Manager) change(user, id string, cond Condition, f func(*Counter) error) (*Counter, error) {
+	for {
+		counter, err := m.authorize(user, id, (*Counter).CanWrite)
+		if err != nil {
+			return nil, err
+		}
+		if !cond.Holds(counter.Version) {
+			return nil, ErrPreconditionFailed
+		}
+
+		if err = f(counter); err != nil {
+			return nil, err
+		}
+
+		counter, err = m.s.CompareAndSet(id, counter.Version, counter.Value)
+		if err != ErrVersionMismatch {
+			return counter, err
+		}
+	}
+}
+
+func (m *Manager) Grant(user, id, grantee string, permission Permission) error {
+	if !permission.Valid() {
+		return ErrInvalidPermission
+	}
+
+	counter, err := m.authorize(user, id, (*Counter).IsOwner)
 	if err != nil {
 		return err
 	}
+	if grantee == "" || grantee == counter.Owner {
+		return ErrInvalidGrantee
+	}
 
-	counter.Inc()
+	return m.s.Grant(id, grantee, permission)
+}
+
+func (m *Manager) Revoke(user, id, grantee string) error {
+	if _, err := m.authorize(user, id, (*Counter).IsOwner); err != nil {
+		return err
+	}
 
-	return m.s.Set(counter)
+	return m.s.Revoke(id, grantee)
 }
 
-func (m *Manager) Delete(id string) error {
-	return m.s.Delete(id)
+// Delete deletes the counter if the condition holds, and starts over when
+// the counter is changed concurrently.
+func (m *Manager) Delete(user, id string, cond Condition) error {
+	for {
+		counter, err := m.authorize(user, id, (*Counter).IsOwner)
+		if err != nil {
+			return err
+		}
+		if cond.isZero() {
+			return m.s.Delete(id)
+		}
+		if !cond.Holds(counter.Version) {
+			return ErrPreconditionFailed
+		}
+
+		if err = m.s.CompareAndDelete(id, counter.Version); err != ErrVersionMismatch {
+			return err
+		}
+	}
+}
+
+// DeleteUser deletes the counters the user owns and revokes its grants on
+// the counters of other users.
+func (m *Manager) DeleteUser(user string) error {
+	opts := ListOptions{Reader: user, Limit: MaxListLimit}
+	for {
+		page, err := m.s.List(opts)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range page.Counters {
+			if c.IsOwner(user) {
+				err = m.s.Delete(c.ID)
+			} else {
+				err = m.s.Revoke(c.ID, user)
+			}
+			if err != nil && err != ErrNotFound {
+				return err
+			}
+		}
+
+		if page.NextCursor == "" {
+			return nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// authorize gets the counter and checks that the user is allowed to access
+// it. Users who cannot read a counter get ErrNotFound rather than
+// ErrForbidden, so that they cannot find out which counters exist.
+func (m *Manager) authorize(user, id string, allowed func(*Counter, string) bool) (*Counter, error) {
+	counter, err := m.s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !counter.CanRead(user) {
+		return nil, ErrNotFound
+	}
+	if !allowed(counter, user) {
+		return nil, ErrForbidden
+	}
+
+	return counter, nil
 }
@@ -2,7 +2,9 @@ package counter
 
 import (
 	"errors"
+	"math"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -33,11 +35,7 @@ func TestManager_Add(t *testing.T) {
 
 				s.
 					EXPECT().
-					Get("id").
-					Return(nil, ErrNotFound)
-				s.
-					EXPECT().
-					Set(&Counter{ID: "id"}).
+					Create(&Counter{ID: "id", Version: 1, Owner: "owner"}).
 					Return(nil)
 
 				return s
@@ -51,8 +49,8 @@ func TestManager_Add(t *testing.T) {
 
 				s.
 					EXPECT().
-					Get("id").
-					Return(&Counter{ID: "id"}, nil)
+					Create(&Counter{ID: "id", Version: 1, Owner: "owner"}).
+					Return(ErrExists)
 
 				return s
 			},
@@ -65,8 +63,8 @@ func TestManager_Add(t *testing.T) {
 
 				s.
 					EXPECT().
-					Get("id").
-					Return(nil, errUnexpected)
+					Create(&Counter{ID: "id", Version: 1, Owner: "owner"}).
+					Return(errUnexpected)
 
 				return s
 			},
@@ -76,7 +74,7 @@ func TestManager_Add(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			m := &Manager{s: tt.s(gomock.NewController(t))}
 
-			err := m.Add(tt.id)
+			err := m.Add("owner", tt.id)
 
 			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("want: %v, got: %v", tt.wantErr, err)
@@ -88,7 +86,7 @@ func TestManager_Add(t *testing.T) {
 func TestManager_Get(t *testing.T) {
 	for name, tt := range map[string]struct {
 		s           func(*gomock.Controller) Storage
-		id          string
+		user        string
 		wantCounter *Counter
 		wantErr     error
 	}{
@@ -99,12 +97,27 @@ func TestManager_Get(t *testing.T) {
 				s.
 					EXPECT().
 					Get("id").
-					Return(&Counter{ID: "id", Value: 1}, nil)
+					Return(&Counter{ID: "id", Value: 1, Owner: "owner"}, nil)
+
+				return s
+			},
+			user:        "owner",
+			wantCounter: &Counter{ID: "id", Value: 1, Owner: "owner"},
+			wantErr:     nil,
+		},
+		"OKGranted": {
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Owner: "owner", Grants: map[string]Permission{"user": PermissionRead}}, nil)
 
 				return s
 			},
-			id:          "id",
-			wantCounter: &Counter{ID: "id", Value: 1},
+			user:        "user",
+			wantCounter: &Counter{ID: "id", Owner: "owner", Grants: map[string]Permission{"user": PermissionRead}},
 			wantErr:     nil,
 		},
 		"ErrNotFound": {
@@ -118,7 +131,22 @@ func TestManager_Get(t *testing.T) {
 
 				return s
 			},
-			id:          "id",
+			user:        "owner",
+			wantCounter: nil,
+			wantErr:     ErrNotFound,
+		},
+		"ErrNotFoundNotReadable": {
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 1, Owner: "owner"}, nil)
+
+				return s
+			},
+			user:        "user",
 			wantCounter: nil,
 			wantErr:     ErrNotFound,
 		},
@@ -126,12 +154,65 @@ func TestManager_Get(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			m := &Manager{s: tt.s(gomock.NewController(t))}
 
-			c, err := m.Get(tt.id)
+			c, err := m.Get(tt.user, "id")
 
 			if !reflect.DeepEqual(c, tt.wantCounter) {
 				t.Errorf("want: %+v, got: %+v", tt.wantCounter, c)
 			}
-			if !errors.Is(err, tt.wantErr) {
+			if err != tt.wantErr {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestManager_List(t *testing.T) {
+	for name, tt := range map[string]struct {
+		s        func(*gomock.Controller) Storage
+		opts     ListOptions
+		wantPage *Page
+		wantErr  error
+	}{
+		"OK": {
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					List(ListOptions{Prefix: "id", Limit: 1, Reader: "user"}).
+					Return(&Page{Counters: []*Counter{{ID: "id", Value: 1}}, Total: 1}, nil)
+
+				return s
+			},
+			opts:     ListOptions{Prefix: "id", Limit: 1, Reader: "other"},
+			wantPage: &Page{Counters: []*Counter{{ID: "id", Value: 1}}, Total: 1},
+			wantErr:  nil,
+		},
+		"ErrInvalidSort": {
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					List(ListOptions{Sort: "name", Reader: "user"}).
+					Return(nil, ErrInvalidSort)
+
+				return s
+			},
+			opts:     ListOptions{Sort: "name"},
+			wantPage: nil,
+			wantErr:  ErrInvalidSort,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := &Manager{s: tt.s(gomock.NewController(t))}
+
+			page, err := m.List("user", tt.opts)
+
+			if !reflect.DeepEqual(page, tt.wantPage) {
+				t.Errorf("want: %+v, got: %+v", tt.wantPage, page)
+			}
+			if err != tt.wantErr {
 				t.Errorf("want: %v, got: %v", tt.wantErr, err)
 			}
 		})
@@ -154,11 +235,11 @@ func TestManager_Inc(t *testing.T) {
 				s.
 					EXPECT().
 					Get("id").
-					Return(&Counter{ID: "id", Value: 1}, nil)
+					Return(&Counter{ID: "id", Value: 1, Owner: "owner"}, nil)
 				s.
 					EXPECT().
-					Set(&Counter{ID: "id", Value: 2}).
-					Return(nil)
+					Increment("id", uint64(1)).
+					Return(&Counter{ID: "id", Value: 2, Owner: "owner"}, nil)
 
 				return s
 			},
@@ -186,11 +267,11 @@ func TestManager_Inc(t *testing.T) {
 				s.
 					EXPECT().
 					Get("id").
-					Return(&Counter{ID: "id", Value: 1}, nil)
+					Return(&Counter{ID: "id", Value: 1, Owner: "owner"}, nil)
 				s.
 					EXPECT().
-					Set(&Counter{ID: "id", Value: 2}).
-					Return(errUnexpected)
+					Increment("id", uint64(1)).
+					Return(nil, errUnexpected)
 
 				return s
 			},
@@ -200,7 +281,7 @@ func TestManager_Inc(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			m := &Manager{s: tt.s(gomock.NewController(t))}
 
-			err := m.Inc(tt.id)
+			err := m.Inc("owner", tt.id)
 
 			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("want: %v, got: %v", tt.wantErr, err)
@@ -209,7 +290,209 @@ func TestManager_Inc(t *testing.T) {
 	}
 }
 
-func TestManager_Delete(t *testing.T) {
+func TestManager_Inc_Concurrent(t *testing.T) {
+	const n = 1000
+
+	m := NewManager(NewMemoryStorage())
+	if err := m.Add("owner", "id"); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+
+			if err := m.Inc("owner", "id"); err != nil {
+				t.Errorf("want: <nil>, got: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	c, err := m.Get("owner", "id")
+	if err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if c.Value != n {
+		t.Errorf("want: %d, got: %d", n, c.Value)
+	}
+}
+
+func TestManager_IncBy(t *testing.T) {
+	for name, tt := range map[string]struct {
+		user        string
+		n           uint64
+		cond        Condition
+		s           func(*gomock.Controller) Storage
+		wantCounter *Counter
+		wantErr     error
+	}{
+		"OK": {
+			user: "owner",
+			n:    5,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 1, Owner: "owner"}, nil)
+				s.
+					EXPECT().
+					Increment("id", uint64(5)).
+					Return(&Counter{ID: "id", Value: 6, Owner: "owner"}, nil)
+
+				return s
+			},
+			wantCounter: &Counter{ID: "id", Value: 6, Owner: "owner"},
+			wantErr:     nil,
+		},
+		"OKGrantedWrite": {
+			user: "user",
+			n:    5,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 1, Owner: "owner", Grants: map[string]Permission{"user": PermissionWrite}}, nil)
+				s.
+					EXPECT().
+					Increment("id", uint64(5)).
+					Return(&Counter{ID: "id", Value: 6, Owner: "owner"}, nil)
+
+				return s
+			},
+			wantCounter: &Counter{ID: "id", Value: 6, Owner: "owner"},
+			wantErr:     nil,
+		},
+		"OKIfMatch": {
+			user: "owner",
+			n:    5,
+			cond: Condition{IfMatch: []uint64{1, 2}},
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 1, Version: 2, Owner: "owner"}, nil)
+				s.
+					EXPECT().
+					CompareAndSet("id", uint64(2), uint64(6)).
+					Return(&Counter{ID: "id", Value: 6, Version: 3, Owner: "owner"}, nil)
+
+				return s
+			},
+			wantCounter: &Counter{ID: "id", Value: 6, Version: 3, Owner: "owner"},
+			wantErr:     nil,
+		},
+		"ErrPreconditionFailed": {
+			user: "owner",
+			n:    5,
+			cond: Condition{IfNoneMatch: []uint64{2}},
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 1, Version: 2, Owner: "owner"}, nil)
+
+				return s
+			},
+			wantCounter: nil,
+			wantErr:     ErrPreconditionFailed,
+		},
+		"ErrOverflowIfMatch": {
+			user: "owner",
+			n:    5,
+			cond: Condition{IfMatch: []uint64{2}},
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: math.MaxUint64, Version: 2, Owner: "owner"}, nil)
+
+				return s
+			},
+			wantCounter: nil,
+			wantErr:     ErrOverflow,
+		},
+		"ErrOverflow": {
+			user: "owner",
+			n:    5,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 1, Owner: "owner"}, nil)
+				s.
+					EXPECT().
+					Increment("id", uint64(5)).
+					Return(nil, ErrOverflow)
+
+				return s
+			},
+			wantCounter: nil,
+			wantErr:     ErrOverflow,
+		},
+		"ErrForbidden": {
+			user: "user",
+			n:    5,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 1, Owner: "owner", Grants: map[string]Permission{"user": PermissionRead}}, nil)
+
+				return s
+			},
+			wantCounter: nil,
+			wantErr:     ErrForbidden,
+		},
+		"ErrNotFound": {
+			user: "user",
+			n:    5,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 1, Owner: "owner"}, nil)
+
+				return s
+			},
+			wantCounter: nil,
+			wantErr:     ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := &Manager{s: tt.s(gomock.NewController(t))}
+
+			c, err := m.IncBy(tt.user, "id", tt.n, tt.cond)
+
+			if !reflect.DeepEqual(c, tt.wantCounter) {
+				t.Errorf("want: %+v, got: %+v", tt.wantCounter, c)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestManager_Dec(t *testing.T) {
 	for name, tt := range map[string]struct {
 		id      string
 		s       func(*gomock.Controller) Storage
@@ -222,32 +505,40 @@ func TestManager_Delete(t *testing.T) {
 
 				s.
 					EXPECT().
-					Delete("id").
-					Return(nil)
+					Get("id").
+					Return(&Counter{ID: "id", Value: 1, Owner: "owner"}, nil)
+				s.
+					EXPECT().
+					Decrement("id", uint64(1)).
+					Return(&Counter{ID: "id", Value: 0, Owner: "owner"}, nil)
 
 				return s
 			},
 			wantErr: nil,
 		},
-		"ErrNotFound": {
+		"ErrUnderflow": {
 			id: "id",
 			s: func(c *gomock.Controller) Storage {
 				s := NewMockStorage(c)
 
 				s.
 					EXPECT().
-					Delete("id").
-					Return(ErrNotFound)
+					Get("id").
+					Return(&Counter{ID: "id", Value: 0, Owner: "owner"}, nil)
+				s.
+					EXPECT().
+					Decrement("id", uint64(1)).
+					Return(nil, ErrUnderflow)
 
 				return s
 			},
-			wantErr: ErrNotFound,
+			wantErr: ErrUnderflow,
 		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			m := &Manager{s: tt.s(gomock.NewController(t))}
 
-			err := m.Delete(tt.id)
+			err := m.Dec("owner", tt.id)
 
 			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("want: %v, got: %v", tt.wantErr, err)
@@ -255,3 +546,577 @@ func TestManager_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestManager_DecBy(t *testing.T) {
+	for name, tt := range map[string]struct {
+		id          string
+		n           uint64
+		s           func(*gomock.Controller) Storage
+		wantCounter *Counter
+		wantErr     error
+	}{
+		"OK": {
+			id: "id",
+			n:  2,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 3, Owner: "owner"}, nil)
+				s.
+					EXPECT().
+					Decrement("id", uint64(2)).
+					Return(&Counter{ID: "id", Value: 1, Owner: "owner"}, nil)
+
+				return s
+			},
+			wantCounter: &Counter{ID: "id", Value: 1, Owner: "owner"},
+			wantErr:     nil,
+		},
+		"ErrNotFound": {
+			id: "id",
+			n:  2,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(nil, ErrNotFound)
+
+				return s
+			},
+			wantCounter: nil,
+			wantErr:     ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := &Manager{s: tt.s(gomock.NewController(t))}
+
+			c, err := m.DecBy("owner", tt.id, tt.n, Condition{})
+
+			if !reflect.DeepEqual(c, tt.wantCounter) {
+				t.Errorf("want: %+v, got: %+v", tt.wantCounter, c)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestManager_Reset(t *testing.T) {
+	s := NewMockStorage(gomock.NewController(t))
+	s.
+		EXPECT().
+		Get("id").
+		Return(&Counter{ID: "id", Value: 7, Version: 3, Owner: "owner"}, nil)
+	s.
+		EXPECT().
+		CompareAndSet("id", uint64(3), uint64(0)).
+		Return(&Counter{ID: "id", Value: 0, Version: 4, Owner: "owner"}, nil)
+	m := &Manager{s: s}
+
+	c, err := m.Reset("owner", "id", Condition{})
+
+	if want := (&Counter{ID: "id", Value: 0, Version: 4, Owner: "owner"}); !reflect.DeepEqual(c, want) {
+		t.Errorf("want: %+v, got: %+v", want, c)
+	}
+	if err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+}
+
+func TestManager_Set(t *testing.T) {
+	errUnexpected := errors.New("unexpected error")
+
+	for name, tt := range map[string]struct {
+		id          string
+		value       uint64
+		cond        Condition
+		s           func(*gomock.Controller) Storage
+		wantCounter *Counter
+		wantErr     error
+	}{
+		"OK": {
+			id:    "id",
+			value: 10,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 1, Version: 1, Owner: "owner"}, nil)
+				s.
+					EXPECT().
+					CompareAndSet("id", uint64(1), uint64(10)).
+					Return(&Counter{ID: "id", Value: 10, Version: 2, Owner: "owner"}, nil)
+
+				return s
+			},
+			wantCounter: &Counter{ID: "id", Value: 10, Version: 2, Owner: "owner"},
+			wantErr:     nil,
+		},
+		"OKRetried": {
+			id:    "id",
+			value: 10,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				gomock.InOrder(
+					s.
+						EXPECT().
+						Get("id").
+						Return(&Counter{ID: "id", Value: 1, Version: 1, Owner: "owner"}, nil),
+					s.
+						EXPECT().
+						CompareAndSet("id", uint64(1), uint64(10)).
+						Return(nil, ErrVersionMismatch),
+					s.
+						EXPECT().
+						Get("id").
+						Return(&Counter{ID: "id", Value: 2, Version: 2, Owner: "owner"}, nil),
+					s.
+						EXPECT().
+						CompareAndSet("id", uint64(2), uint64(10)).
+						Return(&Counter{ID: "id", Value: 10, Version: 3, Owner: "owner"}, nil),
+				)
+
+				return s
+			},
+			wantCounter: &Counter{ID: "id", Value: 10, Version: 3, Owner: "owner"},
+			wantErr:     nil,
+		},
+		"OKIfMatch": {
+			id:    "id",
+			value: 10,
+			cond:  Condition{IfMatch: []uint64{1}},
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 1, Version: 1, Owner: "owner"}, nil)
+				s.
+					EXPECT().
+					CompareAndSet("id", uint64(1), uint64(10)).
+					Return(&Counter{ID: "id", Value: 10, Version: 2, Owner: "owner"}, nil)
+
+				return s
+			},
+			wantCounter: &Counter{ID: "id", Value: 10, Version: 2, Owner: "owner"},
+			wantErr:     nil,
+		},
+		"ErrPreconditionFailed": {
+			id:    "id",
+			value: 10,
+			cond:  Condition{IfMatch: []uint64{1}},
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 2, Version: 2, Owner: "owner"}, nil)
+
+				return s
+			},
+			wantCounter: nil,
+			wantErr:     ErrPreconditionFailed,
+		},
+		"ErrPreconditionFailedChangedConcurrently": {
+			id:    "id",
+			value: 10,
+			cond:  Condition{IfMatch: []uint64{1}},
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				gomock.InOrder(
+					s.
+						EXPECT().
+						Get("id").
+						Return(&Counter{ID: "id", Value: 1, Version: 1, Owner: "owner"}, nil),
+					s.
+						EXPECT().
+						CompareAndSet("id", uint64(1), uint64(10)).
+						Return(nil, ErrVersionMismatch),
+					s.
+						EXPECT().
+						Get("id").
+						Return(&Counter{ID: "id", Value: 2, Version: 2, Owner: "owner"}, nil),
+				)
+
+				return s
+			},
+			wantCounter: nil,
+			wantErr:     ErrPreconditionFailed,
+		},
+		"ErrNotFound": {
+			id:    "id",
+			value: 10,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(nil, ErrNotFound)
+
+				return s
+			},
+			wantCounter: nil,
+			wantErr:     ErrNotFound,
+		},
+		"ErrUnexpected": {
+			id:    "id",
+			value: 10,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Value: 1, Version: 1, Owner: "owner"}, nil)
+				s.
+					EXPECT().
+					CompareAndSet("id", uint64(1), uint64(10)).
+					Return(nil, errUnexpected)
+
+				return s
+			},
+			wantCounter: nil,
+			wantErr:     errUnexpected,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := &Manager{s: tt.s(gomock.NewController(t))}
+
+			c, err := m.Set("owner", tt.id, tt.value, tt.cond)
+
+			if !reflect.DeepEqual(c, tt.wantCounter) {
+				t.Errorf("want: %+v, got: %+v", tt.wantCounter, c)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCondition_Holds(t *testing.T) {
+	for name, tt := range map[string]struct {
+		cond Condition
+		want bool
+	}{
+		"Zero":             {cond: Condition{}, want: true},
+		"IfMatch":          {cond: Condition{IfMatch: []uint64{1, 2}}, want: true},
+		"IfMatchOther":     {cond: Condition{IfMatch: []uint64{1}}, want: false},
+		"IfMatchNone":      {cond: Condition{IfMatch: []uint64{}}, want: false},
+		"IfNoneMatch":      {cond: Condition{IfNoneMatch: []uint64{2}}, want: false},
+		"IfNoneMatchOther": {cond: Condition{IfNoneMatch: []uint64{1}}, want: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.cond.Holds(2); got != tt.want {
+				t.Errorf("want: %t, got: %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestManager_Grant(t *testing.T) {
+	for name, tt := range map[string]struct {
+		user       string
+		grantee    string
+		permission Permission
+		s          func(*gomock.Controller) Storage
+		wantErr    error
+	}{
+		"OK": {
+			user:       "owner",
+			grantee:    "user",
+			permission: PermissionWrite,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Owner: "owner"}, nil)
+				s.
+					EXPECT().
+					Grant("id", "user", PermissionWrite).
+					Return(nil)
+
+				return s
+			},
+			wantErr: nil,
+		},
+		"ErrInvalidPermission": {
+			user:       "owner",
+			grantee:    "user",
+			permission: "admin",
+			s: func(c *gomock.Controller) Storage {
+				return NewMockStorage(c)
+			},
+			wantErr: ErrInvalidPermission,
+		},
+		"ErrInvalidGrantee": {
+			user:       "owner",
+			grantee:    "owner",
+			permission: PermissionRead,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Owner: "owner"}, nil)
+
+				return s
+			},
+			wantErr: ErrInvalidGrantee,
+		},
+		"ErrForbidden": {
+			user:       "user",
+			grantee:    "other",
+			permission: PermissionRead,
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Owner: "owner", Grants: map[string]Permission{"user": PermissionWrite}}, nil)
+
+				return s
+			},
+			wantErr: ErrForbidden,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := &Manager{s: tt.s(gomock.NewController(t))}
+
+			err := m.Grant(tt.user, "id", tt.grantee, tt.permission)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestManager_Revoke(t *testing.T) {
+	for name, tt := range map[string]struct {
+		user    string
+		s       func(*gomock.Controller) Storage
+		wantErr error
+	}{
+		"OK": {
+			user: "owner",
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Owner: "owner", Grants: map[string]Permission{"user": PermissionRead}}, nil)
+				s.
+					EXPECT().
+					Revoke("id", "user").
+					Return(nil)
+
+				return s
+			},
+			wantErr: nil,
+		},
+		"ErrForbidden": {
+			user: "user",
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Owner: "owner", Grants: map[string]Permission{"user": PermissionRead}}, nil)
+
+				return s
+			},
+			wantErr: ErrForbidden,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := &Manager{s: tt.s(gomock.NewController(t))}
+
+			err := m.Revoke(tt.user, "id", "user")
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestManager_Delete(t *testing.T) {
+	for name, tt := range map[string]struct {
+		user    string
+		cond    Condition
+		s       func(*gomock.Controller) Storage
+		wantErr error
+	}{
+		"OK": {
+			user: "owner",
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Owner: "owner"}, nil)
+				s.
+					EXPECT().
+					Delete("id").
+					Return(nil)
+
+				return s
+			},
+			wantErr: nil,
+		},
+		"OKIfMatch": {
+			user: "owner",
+			cond: Condition{IfMatch: []uint64{2}},
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Version: 2, Owner: "owner"}, nil)
+				s.
+					EXPECT().
+					CompareAndDelete("id", uint64(2)).
+					Return(nil)
+
+				return s
+			},
+			wantErr: nil,
+		},
+		"OKRetried": {
+			user: "owner",
+			cond: Condition{IfNoneMatch: []uint64{1}},
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				gomock.InOrder(
+					s.
+						EXPECT().
+						Get("id").
+						Return(&Counter{ID: "id", Version: 2, Owner: "owner"}, nil),
+					s.
+						EXPECT().
+						CompareAndDelete("id", uint64(2)).
+						Return(ErrVersionMismatch),
+					s.
+						EXPECT().
+						Get("id").
+						Return(&Counter{ID: "id", Version: 3, Owner: "owner"}, nil),
+					s.
+						EXPECT().
+						CompareAndDelete("id", uint64(3)).
+						Return(nil),
+				)
+
+				return s
+			},
+			wantErr: nil,
+		},
+		"ErrPreconditionFailed": {
+			user: "owner",
+			cond: Condition{IfMatch: []uint64{1}},
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Version: 2, Owner: "owner"}, nil)
+
+				return s
+			},
+			wantErr: ErrPreconditionFailed,
+		},
+		"ErrNotFound": {
+			user: "owner",
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(nil, ErrNotFound)
+
+				return s
+			},
+			wantErr: ErrNotFound,
+		},
+		"ErrForbidden": {
+			user: "user",
+			s: func(c *gomock.Controller) Storage {
+				s := NewMockStorage(c)
+
+				s.
+					EXPECT().
+					Get("id").
+					Return(&Counter{ID: "id", Owner: "owner", Grants: map[string]Permission{"user": PermissionWrite}}, nil)
+
+				return s
+			},
+			wantErr: ErrForbidden,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := &Manager{s: tt.s(gomock.NewController(t))}
+
+			err := m.Delete(tt.user, "id", tt.cond)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestManager_DeleteUser(t *testing.T) {
+	m := NewManager(NewMemoryStorage())
+	for _, id := range []string{"a", "b"} {
+		if err := m.Add("owner", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Add("other", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Grant("other", "c", "owner", PermissionWrite); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.DeleteUser("owner"); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		if _, err := m.s.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("want %s: %v, got: %v", id, ErrNotFound, err)
+		}
+	}
+	c, err := m.Get("other", "c")
+	if err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if _, ok := c.Grants["owner"]; ok {
+		t.Errorf("want grant revoked, got: %+v", c.Grants)
+	}
+}
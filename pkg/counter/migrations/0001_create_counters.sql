@@ -0,0 +1,5 @@
+CREATE TABLE counters (
+    id    TEXT           PRIMARY KEY,
+    value NUMERIC(20, 0) NOT NULL DEFAULT 0,
+    CONSTRAINT counters_value_range CHECK (value BETWEEN 0 AND 18446744073709551615)
+);
@@ -0,0 +1,5 @@
+-- Byte-wise ordering keeps pagination consistent with the other storages
+-- and lets prefix searches use the primary key index.
+ALTER TABLE counters ALTER COLUMN id TYPE TEXT COLLATE "C";
+
+CREATE INDEX counters_value_id ON counters (value, id);
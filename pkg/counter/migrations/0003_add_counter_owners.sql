@@ -0,0 +1,8 @@
+-- Counters created before ownership was introduced have no owner and can
+-- only be reached directly through the storage.
+ALTER TABLE counters
+    ADD COLUMN owner  TEXT  NOT NULL DEFAULT '',
+    ADD COLUMN grants JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX counters_owner ON counters (owner);
+CREATE INDEX counters_grants ON counters USING GIN (grants);
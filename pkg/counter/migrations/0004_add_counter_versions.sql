@@ -0,0 +1,3 @@
+-- Every change of the value increments the version, so that clients can make
+-- changes conditional on the version they have read.
+ALTER TABLE counters ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -33,6 +33,79 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 	return m.recorder
 }
 
+// CompareAndDelete mocks base method.
+func (m *MockStorage) CompareAndDelete(id string, version uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareAndDelete", id, version)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompareAndDelete indicates an expected call of CompareAndDelete.
+func (mr *MockStorageMockRecorder) CompareAndDelete(id, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareAndDelete", reflect.TypeOf((*MockStorage)(nil).CompareAndDelete), id, version)
+}
+
+// CompareAndSet mocks base method.
+func (m *MockStorage) CompareAndSet(id string, version, value uint64) (*Counter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareAndSet", id, version, value)
+	ret0, _ := ret[0].(*Counter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompareAndSet indicates an expected call of CompareAndSet.
+func (mr *MockStorageMockRecorder) CompareAndSet(id, version, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareAndSet", reflect.TypeOf((*MockStorage)(nil).CompareAndSet), id, version, value)
+}
+
+// CompareAndSwap mocks base method.
+func (m *MockStorage) CompareAndSwap(id string, old, new uint64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareAndSwap", id, old, new)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompareAndSwap indicates an expected call of CompareAndSwap.
+func (mr *MockStorageMockRecorder) CompareAndSwap(id, old, new interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareAndSwap", reflect.TypeOf((*MockStorage)(nil).CompareAndSwap), id, old, new)
+}
+
+// Create mocks base method.
+func (m *MockStorage) Create(counter *Counter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", counter)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockStorageMockRecorder) Create(counter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockStorage)(nil).Create), counter)
+}
+
+// Decrement mocks base method.
+func (m *MockStorage) Decrement(id string, delta uint64) (*Counter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Decrement", id, delta)
+	ret0, _ := ret[0].(*Counter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Decrement indicates an expected call of Decrement.
+func (mr *MockStorageMockRecorder) Decrement(id, delta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Decrement", reflect.TypeOf((*MockStorage)(nil).Decrement), id, delta)
+}
+
 // Delete mocks base method.
 func (m *MockStorage) Delete(id string) error {
 	m.ctrl.T.Helper()
@@ -62,6 +135,64 @@ func (mr *MockStorageMockRecorder) Get(id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStorage)(nil).Get), id)
 }
 
+// Grant mocks base method.
+func (m *MockStorage) Grant(id, user string, permission Permission) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Grant", id, user, permission)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Grant indicates an expected call of Grant.
+func (mr *MockStorageMockRecorder) Grant(id, user, permission interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Grant", reflect.TypeOf((*MockStorage)(nil).Grant), id, user, permission)
+}
+
+// Increment mocks base method.
+func (m *MockStorage) Increment(id string, delta uint64) (*Counter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Increment", id, delta)
+	ret0, _ := ret[0].(*Counter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Increment indicates an expected call of Increment.
+func (mr *MockStorageMockRecorder) Increment(id, delta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Increment", reflect.TypeOf((*MockStorage)(nil).Increment), id, delta)
+}
+
+// List mocks base method.
+func (m *MockStorage) List(opts ListOptions) (*Page, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", opts)
+	ret0, _ := ret[0].(*Page)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockStorageMockRecorder) List(opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockStorage)(nil).List), opts)
+}
+
+// Revoke mocks base method.
+func (m *MockStorage) Revoke(id, user string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", id, user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Revoke indicates an expected call of Revoke.
+func (mr *MockStorageMockRecorder) Revoke(id, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockStorage)(nil).Revoke), id, user)
+}
+
 // Set mocks base method.
 func (m *MockStorage) Set(counter *Counter) error {
 	m.ctrl.T.Helper()
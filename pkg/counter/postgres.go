@@ -0,0 +1,294 @@
+package counter
+
+import (
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"counters/pkg/postgres"
+
+	"github.com/lib/pq"
+)
+
+//go:embed migrations/*.sql
+var PostgresMigrations embed.FS
+
+const pqCheckViolation = "23514"
+
+type PostgresStorage struct {
+	db *sql.DB
+}
+
+func NewPostgresStorage(db *sql.DB) *PostgresStorage {
+	return &PostgresStorage{db: db}
+}
+
+func (s *PostgresStorage) Create(counter *Counter) error {
+	grants, err := marshalGrants(counter.Grants)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.Exec(
+		`INSERT INTO counters (id, value, version, owner, grants) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING`,
+		counter.ID, strconv.FormatUint(counter.Value, 10), strconv.FormatUint(counter.Version, 10), counter.Owner, grants,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrExists
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) Set(counter *Counter) error {
+	grants, err := marshalGrants(counter.Grants)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO counters (id, value, version, owner, grants) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE
+		SET value = EXCLUDED.value, version = EXCLUDED.version, owner = EXCLUDED.owner, grants = EXCLUDED.grants`,
+		counter.ID, strconv.FormatUint(counter.Value, 10), strconv.FormatUint(counter.Version, 10), counter.Owner, grants,
+	)
+
+	return err
+}
+
+func (s *PostgresStorage) Get(id string) (*Counter, error) {
+	c, err := scanCounter(s.db.QueryRow(`SELECT `+counterColumns+` FROM counters WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return c, err
+}
+
+func (s *PostgresStorage) List(opts ListOptions) (*Page, error) {
+	opts, cur, err := parseListOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := postgres.EscapeLike(opts.Prefix) + "%"
+
+	where := `WHERE id LIKE $1`
+	args := []any{pattern}
+	if opts.Reader != "" {
+		where += ` AND (owner = $2 OR grants ? $2)`
+		args = append(args, opts.Reader)
+	}
+
+	page := &Page{}
+	if err = s.db.QueryRow(`SELECT count(*) FROM counters `+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	cmp, order := ">", "ASC"
+	if opts.Sort.desc() {
+		cmp, order = "<", "DESC"
+	}
+
+	query := `SELECT ` + counterColumns + ` FROM counters ` + where
+	switch {
+	case cur != nil && opts.Sort.byValue():
+		query += fmt.Sprintf(` AND (value, id) %s ($%d, $%d)`, cmp, len(args)+1, len(args)+2)
+		args = append(args, strconv.FormatUint(cur.Value, 10), cur.ID)
+	case cur != nil:
+		query += fmt.Sprintf(` AND id %s $%d`, cmp, len(args)+1)
+		args = append(args, cur.ID)
+	}
+	if opts.Sort.byValue() {
+		query += ` ORDER BY value ` + order + `, id ` + order
+	} else {
+		query += ` ORDER BY id ` + order
+	}
+	query += fmt.Sprintf(` LIMIT $%d`, len(args)+1)
+	args = append(args, opts.Limit+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanCounter(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Counters = append(page.Counters, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return paginate(page, opts), nil
+}
+
+func (s *PostgresStorage) Increment(id string, delta uint64) (*Counter, error) {
+	c, err := s.add(id, "+", delta)
+	if isCheckViolation(err) {
+		return nil, ErrOverflow
+	}
+
+	return c, err
+}
+
+func (s *PostgresStorage) Decrement(id string, delta uint64) (*Counter, error) {
+	c, err := s.add(id, "-", delta)
+	if isCheckViolation(err) {
+		return nil, ErrUnderflow
+	}
+
+	return c, err
+}
+
+func (s *PostgresStorage) add(id, op string, delta uint64) (*Counter, error) {
+	c, err := scanCounter(s.db.QueryRow(
+		`UPDATE counters SET value = value `+op+` $2, version = version + 1 WHERE id = $1 RETURNING `+counterColumns,
+		id, strconv.FormatUint(delta, 10),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return c, err
+}
+
+func (s *PostgresStorage) CompareAndSwap(id string, old, new uint64) (bool, error) {
+	var swapped, exists bool
+
+	err := s.db.QueryRow(
+		`WITH updated AS (
+			UPDATE counters SET value = $3, version = version + 1 WHERE id = $1 AND value = $2 RETURNING id
+		)
+		SELECT
+			EXISTS (SELECT 1 FROM updated),
+			EXISTS (SELECT 1 FROM counters WHERE id = $1)`,
+		id, strconv.FormatUint(old, 10), strconv.FormatUint(new, 10),
+	).Scan(&swapped, &exists)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, ErrNotFound
+	}
+
+	return swapped, nil
+}
+
+func (s *PostgresStorage) CompareAndSet(id string, version, value uint64) (*Counter, error) {
+	c, err := scanCounter(s.db.QueryRow(
+		`UPDATE counters SET value = $3, version = version + 1 WHERE id = $1 AND version = $2 RETURNING `+counterColumns,
+		id, strconv.FormatUint(version, 10), strconv.FormatUint(value, 10),
+	))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return c, err
+	}
+
+	// No row was updated, so the counter either does not exist or has
+	// another version.
+	if _, err = s.Get(id); err != nil {
+		return nil, err
+	}
+
+	return nil, ErrVersionMismatch
+}
+
+func (s *PostgresStorage) Grant(id, user string, permission Permission) error {
+	return s.exec(
+		`UPDATE counters SET grants = grants || jsonb_build_object($2::text, $3::text) WHERE id = $1`,
+		id, user, string(permission),
+	)
+}
+
+func (s *PostgresStorage) Revoke(id, user string) error {
+	return s.exec(`UPDATE counters SET grants = grants - $2::text WHERE id = $1`, id, user)
+}
+
+func (s *PostgresStorage) Delete(id string) error {
+	return s.exec(`DELETE FROM counters WHERE id = $1`, id)
+}
+
+func (s *PostgresStorage) CompareAndDelete(id string, version uint64) error {
+	err := s.exec(`DELETE FROM counters WHERE id = $1 AND version = $2`, id, strconv.FormatUint(version, 10))
+	if err != ErrNotFound {
+		return err
+	}
+
+	// No row was deleted, so the counter either does not exist or has
+	// another version.
+	if _, err = s.Get(id); err != nil {
+		return err
+	}
+
+	return ErrVersionMismatch
+}
+
+// exec runs a statement on a single counter and returns ErrNotFound if it
+// has not affected any row.
+func (s *PostgresStorage) exec(query string, args ...any) error {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+const counterColumns = `id, value, version, owner, grants`
+
+func scanCounter(row interface{ Scan(dest ...any) error }) (*Counter, error) {
+	var (
+		c      Counter
+		grants []byte
+	)
+
+	if err := row.Scan(&c.ID, &c.Value, &c.Version, &c.Owner, &grants); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(grants, &c.Grants); err != nil {
+		return nil, err
+	}
+	if len(c.Grants) == 0 {
+		c.Grants = nil
+	}
+
+	return &c, nil
+}
+
+func marshalGrants(grants map[string]Permission) ([]byte, error) {
+	if grants == nil {
+		return []byte(`{}`), nil
+	}
+
+	return json.Marshal(grants)
+}
+
+func isCheckViolation(err error) bool {
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) && pqErr.Code == pqCheckViolation
+}
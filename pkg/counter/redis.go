@@ -0,0 +1,563 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStorage keeps every counter in its own Redis hash. Redis integers are
+// signed 64-bit, so values above math.MaxInt64 are rejected with
+// ErrOverflow.
+//
+// Counters are indexed by pairs of sorted sets, one pair for all counters
+// and one for the counters each user can read: one set holds the IDs with
+// the same score, so that they are ordered lexicographically, and the other
+// one is scored by value. Scores are doubles, so ordering by value is exact
+// up to 2^53. The scripts derive the per-user index keys, so the storage
+// does not work with Redis Cluster.
+type RedisStorage struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisStorage(client redis.UniversalClient, prefix string) *RedisStorage {
+	return &RedisStorage{client: client, prefix: prefix}
+}
+
+const (
+	redisValueField   = "value"
+	redisVersionField = "version"
+	redisOwnerField   = "owner"
+	redisGrantField   = "grant:"
+)
+
+// redisIndex is prepended to the scripts. They take the counter key, the ID
+// and the value index keys, and the counter ID and the prefix of the
+// per-user index keys as the first arguments. Counters stored before
+// versions were introduced have no version field and are at version 1.
+const redisIndex = `
+local function readers()
+	local fields = redis.call('HGETALL', KEYS[1])
+	local users = {}
+	for i = 1, #fields, 2 do
+		if fields[i] == 'owner' and fields[i + 1] ~= '' then
+			table.insert(users, fields[i + 1])
+		elseif string.sub(fields[i], 1, 6) == 'grant:' then
+			table.insert(users, string.sub(fields[i], 7))
+		end
+	end
+	return users
+end
+
+local function index(user, value)
+	redis.call('ZADD', ARGV[2] .. user .. ':ids', 0, ARGV[1])
+	redis.call('ZADD', ARGV[2] .. user .. ':values', value, ARGV[1])
+end
+
+local function unindex(user)
+	redis.call('ZREM', ARGV[2] .. user .. ':ids', ARGV[1])
+	redis.call('ZREM', ARGV[2] .. user .. ':values', ARGV[1])
+end
+
+local function indexAll(value)
+	redis.call('ZADD', KEYS[2], 0, ARGV[1])
+	redis.call('ZADD', KEYS[3], value, ARGV[1])
+	for _, user in ipairs(readers()) do
+		index(user, value)
+	end
+end
+
+local function unindexAll()
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	redis.call('ZREM', KEYS[3], ARGV[1])
+	for _, user in ipairs(readers()) do
+		unindex(user)
+	end
+end
+
+local function bump()
+	redis.call('HSETNX', KEYS[1], 'version', 1)
+	redis.call('HINCRBY', KEYS[1], 'version', 1)
+end
+
+local function canRead(user)
+	return redis.call('HGET', KEYS[1], 'owner') == user or redis.call('HEXISTS', KEYS[1], 'grant:' .. user) == 1
+end
+`
+
+// The scripts return the value with HGET rather than the HINCRBY reply,
+// because Lua numbers are doubles and lose precision above 2^53. Redis
+// itself refuses to overflow, but the sign check also covers servers that
+// wrap around.
+var (
+	redisCreate = redis.NewScript(redisIndex + `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 3))
+indexAll(redis.call('HGET', KEYS[1], 'value'))
+return 1
+`)
+
+	redisSet = redis.NewScript(redisIndex + `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	unindexAll()
+	redis.call('DEL', KEYS[1])
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 3))
+indexAll(redis.call('HGET', KEYS[1], 'value'))
+return 1
+`)
+
+	redisIncrement = redis.NewScript(redisIndex + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+if redis.call('HINCRBY', KEYS[1], 'value', ARGV[3]) < 0 then
+	redis.call('HINCRBY', KEYS[1], 'value', '-' .. ARGV[3])
+	return redis.error_reply('overflow')
+end
+bump()
+indexAll(redis.call('HGET', KEYS[1], 'value'))
+return redis.call('HGETALL', KEYS[1])
+`)
+
+	redisDecrement = redis.NewScript(redisIndex + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+if redis.call('HINCRBY', KEYS[1], 'value', '-' .. ARGV[3]) < 0 then
+	redis.call('HINCRBY', KEYS[1], 'value', ARGV[3])
+	return redis.error_reply('underflow')
+end
+bump()
+indexAll(redis.call('HGET', KEYS[1], 'value'))
+return redis.call('HGETALL', KEYS[1])
+`)
+
+	redisCompareAndSwap = redis.NewScript(redisIndex + `
+local value = redis.call('HGET', KEYS[1], 'value')
+if not value then
+	return -1
+end
+if value ~= ARGV[3] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'value', ARGV[4])
+bump()
+indexAll(ARGV[4])
+return 1
+`)
+
+	redisCompareAndSet = redis.NewScript(redisIndex + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+if (redis.call('HGET', KEYS[1], 'version') or '1') ~= ARGV[3] then
+	return redis.error_reply('version mismatch')
+end
+redis.call('HSET', KEYS[1], 'value', ARGV[4])
+bump()
+indexAll(ARGV[4])
+return redis.call('HGETALL', KEYS[1])
+`)
+
+	redisGrant = redis.NewScript(redisIndex + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+if not canRead(ARGV[3]) then
+	index(ARGV[3], redis.call('HGET', KEYS[1], 'value'))
+end
+redis.call('HSET', KEYS[1], 'grant:' .. ARGV[3], ARGV[4])
+return 1
+`)
+
+	redisRevoke = redis.NewScript(redisIndex + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+if redis.call('HDEL', KEYS[1], 'grant:' .. ARGV[3]) == 1 and not canRead(ARGV[3]) then
+	unindex(ARGV[3])
+end
+return 1
+`)
+
+	redisDelete = redis.NewScript(redisIndex + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+unindexAll()
+return redis.call('DEL', KEYS[1])
+`)
+
+	redisCompareAndDelete = redis.NewScript(redisIndex + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+if (redis.call('HGET', KEYS[1], 'version') or '1') ~= ARGV[3] then
+	return redis.error_reply('version mismatch')
+end
+unindexAll()
+return redis.call('DEL', KEYS[1])
+`)
+)
+
+func (s *RedisStorage) Create(counter *Counter) error {
+	if counter.Value > math.MaxInt64 {
+		return ErrOverflow
+	}
+
+	created, err := s.run(redisCreate, counter.ID, s.fields(counter)...).Int()
+	if err != nil {
+		return err
+	}
+	if created == 0 {
+		return ErrExists
+	}
+
+	return nil
+}
+
+func (s *RedisStorage) Set(counter *Counter) error {
+	if counter.Value > math.MaxInt64 {
+		return ErrOverflow
+	}
+
+	return s.run(redisSet, counter.ID, s.fields(counter)...).Err()
+}
+
+func (s *RedisStorage) Get(id string) (*Counter, error) {
+	fields, err := s.client.HGetAll(context.Background(), s.key(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return parseRedisCounter(id, fields)
+}
+
+func (s *RedisStorage) List(opts ListOptions) (*Page, error) {
+	opts, cur, err := parseListOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	idsKey, valuesKey := s.idsKey(), s.valuesKey()
+	if opts.Reader != "" {
+		idsKey, valuesKey = s.readerKey(opts.Reader)+":ids", s.readerKey(opts.Reader)+":values"
+	}
+
+	page := &Page{}
+	if page.Total, err = s.count(ctx, idsKey, opts.Prefix); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	if opts.Sort.byValue() {
+		ids, err = s.idsByValue(ctx, valuesKey, opts, cur)
+	} else {
+		ids, err = s.idsByID(ctx, idsKey, opts, cur)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return page, nil
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	if _, err = s.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = p.HGetAll(ctx, s.key(id))
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	for i, cmd := range cmds {
+		// The counter was deleted after the index was read.
+		if len(cmd.Val()) == 0 {
+			continue
+		}
+
+		c, err := parseRedisCounter(ids[i], cmd.Val())
+		if err != nil {
+			return nil, err
+		}
+		page.Counters = append(page.Counters, c)
+	}
+
+	return paginate(page, opts), nil
+}
+
+func (s *RedisStorage) count(ctx context.Context, key, prefix string) (int, error) {
+	if prefix == "" {
+		n, err := s.client.ZCard(ctx, key).Result()
+		return int(n), err
+	}
+
+	min, max := lexRange(prefix)
+	n, err := s.client.ZLexCount(ctx, key, min, max).Result()
+
+	return int(n), err
+}
+
+func (s *RedisStorage) idsByID(ctx context.Context, key string, opts ListOptions, cur *cursor) ([]string, error) {
+	min, max := lexRange(opts.Prefix)
+	end := prefixEnd(opts.Prefix)
+
+	by := &redis.ZRangeBy{Min: min, Max: max, Count: int64(opts.Limit + 1)}
+
+	if !opts.Sort.desc() {
+		if cur != nil && cur.ID >= opts.Prefix {
+			by.Min = "(" + cur.ID
+		}
+		return s.client.ZRangeByLex(ctx, key, by).Result()
+	}
+
+	if cur != nil && (end == "" || cur.ID < end) {
+		by.Max = "(" + cur.ID
+	}
+	return s.client.ZRevRangeByLex(ctx, key, by).Result()
+}
+
+// idsByValue reads the value index in batches from the cursor value on,
+// skipping counters with that value which precede the cursor and counters
+// without the requested prefix.
+func (s *RedisStorage) idsByValue(ctx context.Context, key string, opts ListOptions, cur *cursor) ([]string, error) {
+	by := &redis.ZRangeBy{Min: "-inf", Max: "+inf", Count: int64(opts.Limit + 1)}
+	if cur != nil {
+		score := strconv.FormatFloat(float64(cur.Value), 'f', -1, 64)
+		if opts.Sort.desc() {
+			by.Max = score
+		} else {
+			by.Min = score
+		}
+	}
+
+	var ids []string
+	for len(ids) <= opts.Limit {
+		var (
+			zs  []redis.Z
+			err error
+		)
+		if opts.Sort.desc() {
+			zs, err = s.client.ZRevRangeByScoreWithScores(ctx, key, by).Result()
+		} else {
+			zs, err = s.client.ZRangeByScoreWithScores(ctx, key, by).Result()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, z := range zs {
+			id := z.Member.(string)
+			if cur != nil && !cur.after(&Counter{ID: id, Value: uint64(z.Score)}) {
+				continue
+			}
+			if strings.HasPrefix(id, opts.Prefix) && len(ids) <= opts.Limit {
+				ids = append(ids, id)
+			}
+		}
+
+		if int64(len(zs)) < by.Count {
+			break
+		}
+		by.Offset += by.Count
+	}
+
+	return ids, nil
+}
+
+func (s *RedisStorage) Increment(id string, delta uint64) (*Counter, error) {
+	if delta > math.MaxInt64 {
+		return nil, ErrOverflow
+	}
+
+	fields, err := s.run(redisIncrement, id, delta).StringSlice()
+	if err != nil && strings.Contains(err.Error(), "overflow") {
+		return nil, ErrOverflow
+	}
+
+	return s.counter(id, fields, err)
+}
+
+func (s *RedisStorage) Decrement(id string, delta uint64) (*Counter, error) {
+	if delta > math.MaxInt64 {
+		return nil, ErrUnderflow
+	}
+
+	fields, err := s.run(redisDecrement, id, delta).StringSlice()
+	if err != nil && strings.Contains(err.Error(), "underflow") {
+		return nil, ErrUnderflow
+	}
+
+	return s.counter(id, fields, err)
+}
+
+func (s *RedisStorage) CompareAndSwap(id string, old, new uint64) (bool, error) {
+	if new > math.MaxInt64 {
+		return false, ErrOverflow
+	}
+
+	res, err := s.run(redisCompareAndSwap, id, strconv.FormatUint(old, 10), strconv.FormatUint(new, 10)).Int()
+	if err != nil {
+		return false, err
+	}
+	if res < 0 {
+		return false, ErrNotFound
+	}
+
+	return res == 1, nil
+}
+
+func (s *RedisStorage) CompareAndSet(id string, version, value uint64) (*Counter, error) {
+	if value > math.MaxInt64 {
+		return nil, ErrOverflow
+	}
+
+	fields, err := s.run(redisCompareAndSet, id, strconv.FormatUint(version, 10), strconv.FormatUint(value, 10)).StringSlice()
+	if err != nil && strings.Contains(err.Error(), "version mismatch") {
+		return nil, ErrVersionMismatch
+	}
+
+	return s.counter(id, fields, err)
+}
+
+func (s *RedisStorage) Grant(id, user string, permission Permission) error {
+	return s.update(redisGrant, id, user, string(permission))
+}
+
+func (s *RedisStorage) Revoke(id, user string) error {
+	return s.update(redisRevoke, id, user)
+}
+
+func (s *RedisStorage) Delete(id string) error {
+	return s.update(redisDelete, id)
+}
+
+func (s *RedisStorage) CompareAndDelete(id string, version uint64) error {
+	err := s.update(redisCompareAndDelete, id, strconv.FormatUint(version, 10))
+	if err != nil && strings.Contains(err.Error(), "version mismatch") {
+		return ErrVersionMismatch
+	}
+
+	return err
+}
+
+func (s *RedisStorage) run(script *redis.Script, id string, args ...any) *redis.Cmd {
+	return script.Run(
+		context.Background(),
+		s.client,
+		[]string{s.key(id), s.idsKey(), s.valuesKey()},
+		append([]any{id, s.readerKey("")}, args...)...,
+	)
+}
+
+// update runs a script that returns 0 if the counter does not exist.
+func (s *RedisStorage) update(script *redis.Script, id string, args ...any) error {
+	n, err := s.run(script, id, args...).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// fields returns the hash fields of the counter as HSET arguments.
+func (s *RedisStorage) fields(counter *Counter) []any {
+	fields := []any{
+		redisValueField, strconv.FormatUint(counter.Value, 10),
+		redisVersionField, strconv.FormatUint(counter.Version, 10),
+		redisOwnerField, counter.Owner,
+	}
+	for user, p := range counter.Grants {
+		fields = append(fields, redisGrantField+user, string(p))
+	}
+
+	return fields
+}
+
+func (s *RedisStorage) key(id string) string {
+	return s.prefix + "counter:" + id
+}
+
+func (s *RedisStorage) idsKey() string {
+	return s.prefix + "ids"
+}
+
+func (s *RedisStorage) valuesKey() string {
+	return s.prefix + "values"
+}
+
+func (s *RedisStorage) readerKey(user string) string {
+	return s.prefix + "reader:" + user
+}
+
+func (s *RedisStorage) counter(id string, fields []string, err error) (*Counter, error) {
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		m[fields[i]] = fields[i+1]
+	}
+
+	return parseRedisCounter(id, m)
+}
+
+func parseRedisCounter(id string, fields map[string]string) (*Counter, error) {
+	value, err := strconv.ParseUint(fields[redisValueField], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	version := uint64(1)
+	if v, ok := fields[redisVersionField]; ok {
+		if version, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &Counter{ID: id, Value: value, Version: version, Owner: fields[redisOwnerField]}
+	for field, p := range fields {
+		if user := strings.TrimPrefix(field, redisGrantField); user != field {
+			if c.Grants == nil {
+				c.Grants = map[string]Permission{}
+			}
+			c.Grants[user] = Permission(p)
+		}
+	}
+
+	return c, nil
+}
+
+// lexRange returns the ZRANGEBYLEX bounds of the members with the prefix.
+func lexRange(prefix string) (min, max string) {
+	min, max = "-", "+"
+	if prefix != "" {
+		min = "[" + prefix
+	}
+	if end := prefixEnd(prefix); end != "" {
+		max = "(" + end
+	}
+
+	return min, max
+}
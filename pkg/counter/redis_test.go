@@ -0,0 +1,411 @@
+package counter
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisStorage(t *testing.T, counters map[string]uint64) (*RedisStorage, *miniredis.Miniredis) {
+	t.Helper()
+
+	r := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: r.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	s := NewRedisStorage(client, "prefix:")
+	for id, value := range counters {
+		if err := s.Set(&Counter{ID: id, Value: value}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s, r
+}
+
+func TestRedisStorage_Set(t *testing.T) {
+	for name, tt := range map[string]struct {
+		counter *Counter
+		wantErr error
+	}{
+		"OK": {
+			counter: &Counter{ID: "id", Value: 1},
+			wantErr: nil,
+		},
+		"ErrOverflow": {
+			counter: &Counter{ID: "id", Value: math.MaxInt64 + 1},
+			wantErr: ErrOverflow,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, r := newTestRedisStorage(t, nil)
+
+			err := s.Set(tt.counter)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if err == nil {
+				if got := r.HGet("prefix:counter:id", "value"); got != strconv.FormatUint(tt.counter.Value, 10) {
+					t.Errorf("want: %s, got: %s", strconv.FormatUint(tt.counter.Value, 10), got)
+				}
+			}
+		})
+	}
+}
+
+func TestRedisStorage_Get(t *testing.T) {
+	for name, tt := range map[string]struct {
+		counters    map[string]uint64
+		wantCounter *Counter
+		wantErr     error
+	}{
+		"OK": {
+			counters:    map[string]uint64{"id": 1},
+			wantCounter: &Counter{ID: "id", Value: 1},
+			wantErr:     nil,
+		},
+		"ErrNotFound": {
+			counters:    nil,
+			wantCounter: nil,
+			wantErr:     ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, _ := newTestRedisStorage(t, tt.counters)
+
+			c, err := s.Get("id")
+
+			if !reflect.DeepEqual(c, tt.wantCounter) {
+				t.Errorf("want: %+v, got: %+v", tt.wantCounter, c)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRedisStorage_Increment(t *testing.T) {
+	for name, tt := range map[string]struct {
+		counters    map[string]uint64
+		delta       uint64
+		wantCounter *Counter
+		wantErr     error
+	}{
+		"OK": {
+			counters:    map[string]uint64{"id": 1},
+			delta:       2,
+			wantCounter: &Counter{ID: "id", Value: 3, Version: 1},
+			wantErr:     nil,
+		},
+		"OKPrecise": {
+			counters:    map[string]uint64{"id": math.MaxInt64 - 1},
+			delta:       1,
+			wantCounter: &Counter{ID: "id", Value: math.MaxInt64, Version: 1},
+			wantErr:     nil,
+		},
+		"ErrOverflow": {
+			counters:    map[string]uint64{"id": math.MaxInt64},
+			delta:       1,
+			wantCounter: nil,
+			wantErr:     ErrOverflow,
+		},
+		"ErrOverflowDelta": {
+			counters:    map[string]uint64{"id": 0},
+			delta:       math.MaxInt64 + 1,
+			wantCounter: nil,
+			wantErr:     ErrOverflow,
+		},
+		"ErrNotFound": {
+			counters:    nil,
+			delta:       1,
+			wantCounter: nil,
+			wantErr:     ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, r := newTestRedisStorage(t, tt.counters)
+
+			c, err := s.Increment("id", tt.delta)
+
+			if !reflect.DeepEqual(c, tt.wantCounter) {
+				t.Errorf("want: %+v, got: %+v", tt.wantCounter, c)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if tt.counters == nil && r.Exists("prefix:counter:id") {
+				t.Errorf("want: no key, got: %s", "prefix:counter:id")
+			}
+		})
+	}
+}
+
+func TestRedisStorage_Decrement(t *testing.T) {
+	for name, tt := range map[string]struct {
+		counters    map[string]uint64
+		delta       uint64
+		wantCounter *Counter
+		wantValue   string
+		wantErr     error
+	}{
+		"OK": {
+			counters:    map[string]uint64{"id": 3},
+			delta:       2,
+			wantCounter: &Counter{ID: "id", Value: 1, Version: 1},
+			wantValue:   "1",
+			wantErr:     nil,
+		},
+		"ErrUnderflow": {
+			counters:    map[string]uint64{"id": 1},
+			delta:       2,
+			wantCounter: nil,
+			wantValue:   "1",
+			wantErr:     ErrUnderflow,
+		},
+		"ErrNotFound": {
+			counters:    nil,
+			delta:       1,
+			wantCounter: nil,
+			wantErr:     ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, r := newTestRedisStorage(t, tt.counters)
+
+			c, err := s.Decrement("id", tt.delta)
+
+			if !reflect.DeepEqual(c, tt.wantCounter) {
+				t.Errorf("want: %+v, got: %+v", tt.wantCounter, c)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if tt.wantValue != "" {
+				if got := r.HGet("prefix:counter:id", "value"); got != tt.wantValue {
+					t.Errorf("want: %s, got: %s", tt.wantValue, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRedisStorage_CompareAndSwap(t *testing.T) {
+	for name, tt := range map[string]struct {
+		counters    map[string]uint64
+		wantSwapped bool
+		wantValue   string
+		wantErr     error
+	}{
+		"Swapped": {
+			counters:    map[string]uint64{"id": 1},
+			wantSwapped: true,
+			wantValue:   "5",
+			wantErr:     nil,
+		},
+		"NotSwapped": {
+			counters:    map[string]uint64{"id": 2},
+			wantSwapped: false,
+			wantValue:   "2",
+			wantErr:     nil,
+		},
+		"ErrNotFound": {
+			counters:    nil,
+			wantSwapped: false,
+			wantErr:     ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, r := newTestRedisStorage(t, tt.counters)
+
+			swapped, err := s.CompareAndSwap("id", 1, 5)
+
+			if swapped != tt.wantSwapped {
+				t.Errorf("want: %t, got: %t", tt.wantSwapped, swapped)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if tt.wantValue != "" {
+				if got := r.HGet("prefix:counter:id", "value"); got != tt.wantValue {
+					t.Errorf("want: %s, got: %s", tt.wantValue, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRedisStorage_CompareAndSet(t *testing.T) {
+	for name, tt := range map[string]struct {
+		counters    map[string]uint64
+		version     uint64
+		value       uint64
+		unversioned bool
+		wantCounter *Counter
+		wantValue   string
+		wantErr     error
+	}{
+		"OK": {
+			counters:    map[string]uint64{"id": 1},
+			version:     0,
+			value:       5,
+			wantCounter: &Counter{ID: "id", Value: 5, Version: 1},
+			wantValue:   "5",
+			wantErr:     nil,
+		},
+		"OKUnversioned": {
+			counters:    map[string]uint64{"id": 1},
+			version:     1,
+			value:       5,
+			unversioned: true,
+			wantCounter: &Counter{ID: "id", Value: 5, Version: 2},
+			wantValue:   "5",
+			wantErr:     nil,
+		},
+		"ErrVersionMismatch": {
+			counters:    map[string]uint64{"id": 1},
+			version:     1,
+			value:       5,
+			wantCounter: nil,
+			wantValue:   "1",
+			wantErr:     ErrVersionMismatch,
+		},
+		"ErrOverflow": {
+			counters:    map[string]uint64{"id": 1},
+			version:     0,
+			value:       math.MaxInt64 + 1,
+			wantCounter: nil,
+			wantValue:   "1",
+			wantErr:     ErrOverflow,
+		},
+		"ErrNotFound": {
+			counters:    nil,
+			version:     0,
+			value:       5,
+			wantCounter: nil,
+			wantErr:     ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, r := newTestRedisStorage(t, tt.counters)
+			if tt.unversioned {
+				r.HDel("prefix:counter:id", "version")
+			}
+
+			c, err := s.CompareAndSet("id", tt.version, tt.value)
+
+			if !reflect.DeepEqual(c, tt.wantCounter) {
+				t.Errorf("want: %+v, got: %+v", tt.wantCounter, c)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if tt.wantValue != "" {
+				if got := r.HGet("prefix:counter:id", "value"); got != tt.wantValue {
+					t.Errorf("want: %s, got: %s", tt.wantValue, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRedisStorage_Delete(t *testing.T) {
+	for name, tt := range map[string]struct {
+		counters map[string]uint64
+		wantErr  error
+	}{
+		"OK": {
+			counters: map[string]uint64{"id": 1},
+			wantErr:  nil,
+		},
+		"ErrNotFound": {
+			counters: nil,
+			wantErr:  ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, r := newTestRedisStorage(t, tt.counters)
+
+			err := s.Delete("id")
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if r.Exists("prefix:counter:id") {
+				t.Errorf("want: no key, got: %s", "prefix:counter:id")
+			}
+		})
+	}
+}
+
+func TestRedisStorage_CompareAndDelete(t *testing.T) {
+	for name, tt := range map[string]struct {
+		counters    map[string]uint64
+		version     uint64
+		unversioned bool
+		wantExists  bool
+		wantErr     error
+	}{
+		"OK": {
+			counters:   map[string]uint64{"id": 1},
+			version:    0,
+			wantExists: false,
+			wantErr:    nil,
+		},
+		"OKUnversioned": {
+			counters:    map[string]uint64{"id": 1},
+			version:     1,
+			unversioned: true,
+			wantExists:  false,
+			wantErr:     nil,
+		},
+		"ErrVersionMismatch": {
+			counters:   map[string]uint64{"id": 1},
+			version:    1,
+			wantExists: true,
+			wantErr:    ErrVersionMismatch,
+		},
+		"ErrNotFound": {
+			counters:   nil,
+			version:    0,
+			wantExists: false,
+			wantErr:    ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, r := newTestRedisStorage(t, tt.counters)
+			if tt.unversioned {
+				r.HDel("prefix:counter:id", "version")
+			}
+
+			err := s.CompareAndDelete("id", tt.version)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if got := r.Exists("prefix:counter:id"); got != tt.wantExists {
+				t.Errorf("want key exists: %t, got: %t", tt.wantExists, got)
+			}
+		})
+	}
+}
+
+func TestRedisStorage_List(t *testing.T) {
+	testStorageList(t, func(t *testing.T, counters map[string]uint64) Storage {
+		s, _ := newTestRedisStorage(t, counters)
+		return s
+	})
+}
+
+func TestRedisStorage_Access(t *testing.T) {
+	s, _ := newTestRedisStorage(t, nil)
+
+	testStorageAccess(t, s)
+}
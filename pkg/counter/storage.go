@@ -3,31 +3,78 @@ package counter
 
 import (
 	"errors"
+	"sort"
+	"strings"
 	"sync"
 )
 
-var ErrNotFound = errors.New("counter not found")
+var (
+	ErrNotFound        = errors.New("counter not found")
+	ErrExists          = errors.New("counter exists")
+	ErrVersionMismatch = errors.New("counter version mismatch")
+)
 
 type Storage interface {
+	Create(counter *Counter) error
 	Set(counter *Counter) error
 	Get(id string) (*Counter, error)
+	List(opts ListOptions) (*Page, error)
+	Increment(id string, delta uint64) (*Counter, error)
+	Decrement(id string, delta uint64) (*Counter, error)
+	CompareAndSwap(id string, old, new uint64) (bool, error)
+	// CompareAndSet sets the value of the counter if it has the version and
+	// returns ErrVersionMismatch otherwise.
+	CompareAndSet(id string, version, value uint64) (*Counter, error)
+	Grant(id, user string, permission Permission) error
+	Revoke(id, user string) error
 	Delete(id string) error
+	// CompareAndDelete deletes the counter if it has the version and
+	// returns ErrVersionMismatch otherwise.
+	CompareAndDelete(id string, version uint64) error
 }
 
+// MemoryStorage indexes all counters, and separately the counters each user
+// can read, so that pages can be found by binary search.
 type MemoryStorage struct {
 	mu       sync.RWMutex
 	counters map[string]*Counter
+	all      index
+	readers  map[string]*index
 }
 
 func NewMemoryStorage() *MemoryStorage {
-	return &MemoryStorage{counters: map[string]*Counter{}}
+	return &MemoryStorage{
+		counters: map[string]*Counter{},
+		readers:  map[string]*index{},
+	}
+}
+
+func (s *MemoryStorage) Create(counter *Counter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.counters[counter.ID]; ok {
+		return ErrExists
+	}
+
+	c := counter.clone()
+	s.index(c)
+	s.counters[c.ID] = c
+
+	return nil
 }
 
 func (s *MemoryStorage) Set(counter *Counter) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.counters[counter.ID] = counter
+	c := counter.clone()
+	if old, ok := s.counters[c.ID]; ok {
+		s.replace(old, c)
+	} else {
+		s.index(c)
+	}
+	s.counters[c.ID] = c
 
 	return nil
 }
@@ -41,18 +88,309 @@ func (s *MemoryStorage) Get(id string) (*Counter, error) {
 		return nil, ErrNotFound
 	}
 
-	return counter, nil
+	return counter.clone(), nil
+}
+
+func (s *MemoryStorage) List(opts ListOptions) (*Page, error) {
+	opts, cur, err := parseListOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	x := &s.all
+	if opts.Reader != "" {
+		if x = s.readers[opts.Reader]; x == nil {
+			return &Page{}, nil
+		}
+	}
+
+	lo := sort.SearchStrings(x.ids, opts.Prefix)
+	hi := len(x.ids)
+	if end := prefixEnd(opts.Prefix); end != "" {
+		hi = sort.SearchStrings(x.ids, end)
+	}
+
+	page := &Page{Total: hi - lo}
+	if opts.Sort.byValue() {
+		s.listByValue(x, page, opts, cur)
+	} else {
+		s.listByID(x, page, opts, cur, lo, hi)
+	}
+
+	return paginate(page, opts), nil
+}
+
+// listByID collects up to opts.Limit+1 counters from x.ids[lo:hi], which
+// holds exactly the IDs with the requested prefix.
+func (s *MemoryStorage) listByID(x *index, page *Page, opts ListOptions, cur *cursor, lo, hi int) {
+	if !opts.Sort.desc() {
+		if cur != nil {
+			if i := sort.Search(len(x.ids), func(i int) bool { return x.ids[i] > cur.ID }); i > lo {
+				lo = i
+			}
+		}
+		for i := lo; i < hi && len(page.Counters) <= opts.Limit; i++ {
+			page.Counters = append(page.Counters, s.counters[x.ids[i]].clone())
+		}
+		return
+	}
+
+	if cur != nil {
+		if i := sort.SearchStrings(x.ids, cur.ID); i < hi {
+			hi = i
+		}
+	}
+	for i := hi - 1; i >= lo && len(page.Counters) <= opts.Limit; i-- {
+		page.Counters = append(page.Counters, s.counters[x.ids[i]].clone())
+	}
+}
+
+// listByValue walks x.values from the cursor and skips counters without
+// the requested prefix.
+func (s *MemoryStorage) listByValue(x *index, page *Page, opts ListOptions, cur *cursor) {
+	if !opts.Sort.desc() {
+		n := x.values.first()
+		if cur != nil {
+			n = x.values.after(valueKey{value: cur.Value, id: cur.ID})
+		}
+		for ; n != nil && len(page.Counters) <= opts.Limit; n = n.next[0] {
+			if strings.HasPrefix(n.key.id, opts.Prefix) {
+				page.Counters = append(page.Counters, s.counters[n.key.id].clone())
+			}
+		}
+		return
+	}
+
+	n := x.values.last()
+	if cur != nil {
+		n = x.values.before(valueKey{value: cur.Value, id: cur.ID})
+	}
+	for ; n != nil && len(page.Counters) <= opts.Limit; n = n.prev {
+		if strings.HasPrefix(n.key.id, opts.Prefix) {
+			page.Counters = append(page.Counters, s.counters[n.key.id].clone())
+		}
+	}
+}
+
+func (s *MemoryStorage) Increment(id string, delta uint64) (*Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	old := counter.Value
+	if err := counter.IncBy(delta); err != nil {
+		return nil, err
+	}
+	counter.Version++
+	s.reindex(counter, old)
+
+	return counter.clone(), nil
+}
+
+func (s *MemoryStorage) Decrement(id string, delta uint64) (*Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	old := counter.Value
+	if err := counter.DecBy(delta); err != nil {
+		return nil, err
+	}
+	counter.Version++
+	s.reindex(counter, old)
+
+	return counter.clone(), nil
+}
+
+func (s *MemoryStorage) CompareAndSwap(id string, old, new uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[id]
+	if !ok {
+		return false, ErrNotFound
+	}
+	if counter.Value != old {
+		return false, nil
+	}
+
+	counter.Value = new
+	counter.Version++
+	s.reindex(counter, old)
+
+	return true, nil
+}
+
+func (s *MemoryStorage) CompareAndSet(id string, version, value uint64) (*Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if counter.Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	old := counter.Value
+	counter.Value = value
+	counter.Version++
+	s.reindex(counter, old)
+
+	return counter.clone(), nil
+}
+
+func (s *MemoryStorage) Grant(id, user string, permission Permission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if !counter.CanRead(user) {
+		s.reader(user).insert(counter.ID, counter.Value)
+	}
+	if counter.Grants == nil {
+		counter.Grants = map[string]Permission{}
+	}
+	counter.Grants[user] = permission
+
+	return nil
+}
+
+func (s *MemoryStorage) Revoke(id, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if _, ok = counter.Grants[user]; !ok {
+		return nil
+	}
+
+	delete(counter.Grants, user)
+	if !counter.CanRead(user) {
+		s.removeReader(user, counter)
+	}
+
+	return nil
 }
 
 func (s *MemoryStorage) Delete(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, ok := s.counters[id]; !ok {
+	counter, ok := s.counters[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	s.unindex(counter)
+	delete(s.counters, id)
+
+	return nil
+}
+
+func (s *MemoryStorage) CompareAndDelete(id string, version uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[id]
+	if !ok {
 		return ErrNotFound
 	}
+	if counter.Version != version {
+		return ErrVersionMismatch
+	}
 
+	s.unindex(counter)
 	delete(s.counters, id)
 
 	return nil
 }
+
+func (s *MemoryStorage) index(c *Counter) {
+	s.all.insert(c.ID, c.Value)
+	for _, user := range c.readers() {
+		s.reader(user).insert(c.ID, c.Value)
+	}
+}
+
+func (s *MemoryStorage) unindex(c *Counter) {
+	s.all.remove(c.ID, c.Value)
+	for _, user := range c.readers() {
+		s.removeReader(user, c)
+	}
+}
+
+// replace moves the index entries of the old counter to the new one with
+// the same ID, and only adds and removes the readers that changed.
+func (s *MemoryStorage) replace(old, c *Counter) {
+	s.all.update(c.ID, old.Value, c.Value)
+
+	readers, oldReaders := map[string]bool{}, map[string]bool{}
+	for _, user := range c.readers() {
+		readers[user] = true
+	}
+	for _, user := range old.readers() {
+		oldReaders[user] = true
+	}
+
+	for user := range oldReaders {
+		if readers[user] {
+			s.reader(user).update(c.ID, old.Value, c.Value)
+		} else {
+			s.removeReader(user, old)
+		}
+	}
+	for user := range readers {
+		if !oldReaders[user] {
+			s.reader(user).insert(c.ID, c.Value)
+		}
+	}
+}
+
+func (s *MemoryStorage) reindex(c *Counter, old uint64) {
+	s.all.update(c.ID, old, c.Value)
+	for _, user := range c.readers() {
+		s.reader(user).update(c.ID, old, c.Value)
+	}
+}
+
+func (s *MemoryStorage) reader(user string) *index {
+	x, ok := s.readers[user]
+	if !ok {
+		x = &index{}
+		s.readers[user] = x
+	}
+
+	return x
+}
+
+func (s *MemoryStorage) removeReader(user string, c *Counter) {
+	x, ok := s.readers[user]
+	if !ok {
+		return
+	}
+
+	x.remove(c.ID, c.Value)
+	if len(x.ids) == 0 {
+		delete(s.readers, user)
+	}
+}
@@ -1,12 +1,13 @@
 package counter
 
 import (
+	"math"
 	"reflect"
 	"testing"
 )
 
 func TestNewMemoryStorage(t *testing.T) {
-	want := &MemoryStorage{counters: map[string]*Counter{}}
+	want := &MemoryStorage{counters: map[string]*Counter{}, readers: map[string]*index{}}
 
 	got := NewMemoryStorage()
 
@@ -29,6 +30,30 @@ func TestMemoryStorage_Set(t *testing.T) {
 	}
 }
 
+func TestMemoryStorage_Set_readers(t *testing.T) {
+	s := NewMemoryStorage()
+	if err := s.Set(&Counter{ID: "id", Value: 1, Owner: "owner", Grants: map[string]Permission{"a": PermissionRead}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set(&Counter{ID: "id", Value: 2, Owner: "owner", Grants: map[string]Permission{"b": PermissionRead}}); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	for reader, want := range map[string]int{"owner": 1, "a": 0, "b": 1} {
+		page, err := s.List(ListOptions{Reader: reader, Sort: SortByValueDesc})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Counters) != want || want > 0 && page.Counters[0].Value != 2 {
+			t.Errorf("%s: want %d counters with value 2, got: %+v", reader, want, page.Counters)
+		}
+	}
+	if _, ok := s.readers["a"]; ok {
+		t.Errorf("want index of reader a removed")
+	}
+}
+
 func TestMemoryStorage_Get(t *testing.T) {
 	for name, tt := range map[string]struct {
 		s           *MemoryStorage
@@ -96,3 +121,267 @@ func TestMemoryStorage_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestMemoryStorage_Increment(t *testing.T) {
+	for name, tt := range map[string]struct {
+		s           *MemoryStorage
+		id          string
+		delta       uint64
+		wantCounter *Counter
+		wantErr     error
+	}{
+		"OK": {
+			s: &MemoryStorage{
+				counters: map[string]*Counter{
+					"id": {ID: "id", Value: 1},
+				},
+			},
+			id:          "id",
+			delta:       2,
+			wantCounter: &Counter{ID: "id", Value: 3, Version: 1},
+			wantErr:     nil,
+		},
+		"ErrOverflow": {
+			s: &MemoryStorage{
+				counters: map[string]*Counter{
+					"id": {ID: "id", Value: math.MaxUint64},
+				},
+			},
+			id:          "id",
+			delta:       1,
+			wantCounter: nil,
+			wantErr:     ErrOverflow,
+		},
+		"ErrNotFound": {
+			s:           &MemoryStorage{counters: map[string]*Counter{}},
+			id:          "id",
+			delta:       1,
+			wantCounter: nil,
+			wantErr:     ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := tt.s.Increment(tt.id, tt.delta)
+
+			if !reflect.DeepEqual(c, tt.wantCounter) {
+				t.Errorf("want: %+v, got: %+v", tt.wantCounter, c)
+			}
+			if err != tt.wantErr {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMemoryStorage_Decrement(t *testing.T) {
+	for name, tt := range map[string]struct {
+		s           *MemoryStorage
+		id          string
+		delta       uint64
+		wantCounter *Counter
+		wantErr     error
+	}{
+		"OK": {
+			s: &MemoryStorage{
+				counters: map[string]*Counter{
+					"id": {ID: "id", Value: 3},
+				},
+			},
+			id:          "id",
+			delta:       2,
+			wantCounter: &Counter{ID: "id", Value: 1, Version: 1},
+			wantErr:     nil,
+		},
+		"ErrUnderflow": {
+			s: &MemoryStorage{
+				counters: map[string]*Counter{
+					"id": {ID: "id", Value: 1},
+				},
+			},
+			id:          "id",
+			delta:       2,
+			wantCounter: nil,
+			wantErr:     ErrUnderflow,
+		},
+		"ErrNotFound": {
+			s:           &MemoryStorage{counters: map[string]*Counter{}},
+			id:          "id",
+			delta:       1,
+			wantCounter: nil,
+			wantErr:     ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := tt.s.Decrement(tt.id, tt.delta)
+
+			if !reflect.DeepEqual(c, tt.wantCounter) {
+				t.Errorf("want: %+v, got: %+v", tt.wantCounter, c)
+			}
+			if err != tt.wantErr {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMemoryStorage_CompareAndSwap(t *testing.T) {
+	for name, tt := range map[string]struct {
+		s           *MemoryStorage
+		id          string
+		old, new    uint64
+		wantSwapped bool
+		wantValue   uint64
+		wantErr     error
+	}{
+		"Swapped": {
+			s: &MemoryStorage{
+				counters: map[string]*Counter{
+					"id": {ID: "id", Value: 1},
+				},
+			},
+			id:          "id",
+			old:         1,
+			new:         5,
+			wantSwapped: true,
+			wantValue:   5,
+			wantErr:     nil,
+		},
+		"NotSwapped": {
+			s: &MemoryStorage{
+				counters: map[string]*Counter{
+					"id": {ID: "id", Value: 2},
+				},
+			},
+			id:          "id",
+			old:         1,
+			new:         5,
+			wantSwapped: false,
+			wantValue:   2,
+			wantErr:     nil,
+		},
+		"ErrNotFound": {
+			s:           &MemoryStorage{counters: map[string]*Counter{}},
+			id:          "id",
+			old:         1,
+			new:         5,
+			wantSwapped: false,
+			wantErr:     ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			swapped, err := tt.s.CompareAndSwap(tt.id, tt.old, tt.new)
+
+			if swapped != tt.wantSwapped {
+				t.Errorf("want: %t, got: %t", tt.wantSwapped, swapped)
+			}
+			if err != tt.wantErr {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if c, ok := tt.s.counters[tt.id]; ok && c.Value != tt.wantValue {
+				t.Errorf("want: %d, got: %d", tt.wantValue, c.Value)
+			}
+		})
+	}
+}
+
+func TestMemoryStorage_CompareAndSet(t *testing.T) {
+	for name, tt := range map[string]struct {
+		s           *MemoryStorage
+		id          string
+		version     uint64
+		wantCounter *Counter
+		wantErr     error
+	}{
+		"OK": {
+			s: &MemoryStorage{
+				counters: map[string]*Counter{
+					"id": {ID: "id", Value: 1, Version: 2},
+				},
+			},
+			id:          "id",
+			version:     2,
+			wantCounter: &Counter{ID: "id", Value: 5, Version: 3},
+			wantErr:     nil,
+		},
+		"ErrVersionMismatch": {
+			s: &MemoryStorage{
+				counters: map[string]*Counter{
+					"id": {ID: "id", Value: 1, Version: 3},
+				},
+			},
+			id:          "id",
+			version:     2,
+			wantCounter: nil,
+			wantErr:     ErrVersionMismatch,
+		},
+		"ErrNotFound": {
+			s:           &MemoryStorage{counters: map[string]*Counter{}},
+			id:          "id",
+			version:     2,
+			wantCounter: nil,
+			wantErr:     ErrNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := tt.s.CompareAndSet(tt.id, tt.version, 5)
+
+			if !reflect.DeepEqual(c, tt.wantCounter) {
+				t.Errorf("want: %+v, got: %+v", tt.wantCounter, c)
+			}
+			if err != tt.wantErr {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMemoryStorage_CompareAndDelete(t *testing.T) {
+	for name, tt := range map[string]struct {
+		version uint64
+		wantErr error
+	}{
+		"OK": {
+			version: 2,
+			wantErr: nil,
+		},
+		"ErrVersionMismatch": {
+			version: 1,
+			wantErr: ErrVersionMismatch,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := NewMemoryStorage()
+			if err := s.Set(&Counter{ID: "id", Value: 1, Version: 2}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := s.CompareAndDelete("id", tt.version)
+
+			if err != tt.wantErr {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if _, err = s.Get("id"); (err == ErrNotFound) != (tt.wantErr == nil) {
+				t.Errorf("want deleted: %t, got: %v", tt.wantErr == nil, err)
+			}
+		})
+	}
+
+	if err := NewMemoryStorage().CompareAndDelete("id", 1); err != ErrNotFound {
+		t.Errorf("want: %v, got: %v", ErrNotFound, err)
+	}
+}
+
+func TestMemoryStorage_List(t *testing.T) {
+	testStorageList(t, func(t *testing.T, counters map[string]uint64) Storage {
+		s := NewMemoryStorage()
+		for id, value := range counters {
+			_ = s.Set(&Counter{ID: id, Value: value})
+		}
+
+		return s
+	})
+}
+
+func TestMemoryStorage_Access(t *testing.T) {
+	testStorageAccess(t, NewMemoryStorage())
+}
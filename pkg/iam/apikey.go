@@ -0,0 +1,213 @@
+package iam
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrInvalidAPIKey  = errors.New("invalid API key")
+)
+
+type Scope string
+
+const (
+	ScopeRead      Scope = "read"
+	ScopeReadWrite Scope = "read-write"
+)
+
+func (s Scope) Valid() bool {
+	return s == ScopeRead || s == ScopeReadWrite
+}
+
+// APIKey lets machine clients act on behalf of a user. Only a hash of the
+// secret is stored. Prefixes limit the counters the key can access by ID.
+type APIKey struct {
+	ID        string
+	UserID    string
+	Name      string
+	Scope     Scope
+	Prefixes  []string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+
+	hash []byte
+}
+
+// apiKeyPrefix starts every API key, which tells them apart from session
+// tokens and makes them easy to find by secret scanners.
+const apiKeyPrefix = "ck_"
+
+// IsAPIKey reports whether the bearer token looks like an API key.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+func (k *APIKey) CanWrite() bool {
+	return k.Scope == ScopeReadWrite
+}
+
+// Allows reports whether the key can access the counter, or every counter
+// with IDs starting with id when listing.
+func (k *APIKey) Allows(id string) bool {
+	if len(k.Prefixes) == 0 {
+		return true
+	}
+
+	for _, p := range k.Prefixes {
+		if strings.HasPrefix(id, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (k *APIKey) expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+type APIKeyOptions struct {
+	Name      string
+	Scope     Scope
+	Prefixes  []string
+	ExpiresAt time.Time
+}
+
+// newAPIKey returns the key along with the secret the client authenticates
+// with, which cannot be recovered later.
+func newAPIKey(userID string, opts APIKeyOptions) (*APIKey, string, error) {
+	now := time.Now()
+
+	switch {
+	case strings.TrimSpace(opts.Name) == "":
+		return nil, "", fmt.Errorf("%w: name is required", ErrInvalidAPIKey)
+	case !opts.Scope.Valid():
+		return nil, "", fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKey, opts.Scope)
+	case !opts.ExpiresAt.IsZero() && !now.Before(opts.ExpiresAt):
+		return nil, "", fmt.Errorf("%w: expiry is in the past", ErrInvalidAPIKey)
+	}
+	for _, p := range opts.Prefixes {
+		if p == "" {
+			return nil, "", fmt.Errorf("%w: empty prefix", ErrInvalidAPIKey)
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+
+	k := &APIKey{
+		ID:        strings.ReplaceAll(uuid.NewString(), "-", ""),
+		UserID:    userID,
+		Name:      opts.Name,
+		Scope:     opts.Scope,
+		Prefixes:  opts.Prefixes,
+		CreatedAt: now,
+		ExpiresAt: opts.ExpiresAt,
+		hash:      hashSecret(secret),
+	}
+
+	return k, apiKeyPrefix + k.ID + "_" + secret, nil
+}
+
+// parseAPIKey splits the API key into its ID and secret.
+func parseAPIKey(token string) (id, secret string, ok bool) {
+	if !IsAPIKey(token) {
+		return "", "", false
+	}
+
+	id, secret, ok = strings.Cut(strings.TrimPrefix(token, apiKeyPrefix), "_")
+
+	return id, secret, ok && id != "" && secret != ""
+}
+
+func (k *APIKey) verify(secret string) bool {
+	return verifySecret(k.hash, secret)
+}
+
+// hashSecret hashes the secret of an API key or invitation. The secrets are
+// random, so a fast hash does not make them easier to guess.
+func hashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+func verifySecret(hash []byte, secret string) bool {
+	return subtle.ConstantTimeCompare(hash, hashSecret(secret)) == 1
+}
+
+// CreateAPIKey creates an API key of the user and returns it along with the
+// key to hand out, which is shown once.
+func (m *Manager) CreateAPIKey(userID string, opts APIKeyOptions) (*APIKey, string, error) {
+	k, secret, err := newAPIKey(userID, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err = m.users.SetAPIKey(k); err != nil {
+		return nil, "", err
+	}
+
+	return k, secret, nil
+}
+
+func (m *Manager) APIKeys(userID string) ([]*APIKey, error) {
+	return m.users.ListAPIKeys(userID)
+}
+
+// RevokeAPIKey deletes the API key of the user. Keys of other users are not
+// found.
+func (m *Manager) RevokeAPIKey(userID, id string) error {
+	k, err := m.users.GetAPIKey(id)
+	if err != nil {
+		return err
+	}
+	if k.UserID != userID {
+		return ErrAPIKeyNotFound
+	}
+
+	return m.users.DeleteAPIKey(id)
+}
+
+// AuthenticateAPIKey returns the user the API key belongs to and the key
+// itself for checking its scope.
+func (m *Manager) AuthenticateAPIKey(token string) (*User, *APIKey, error) {
+	id, secret, ok := parseAPIKey(token)
+	if !ok {
+		return nil, nil, ErrInvalidToken
+	}
+
+	k, err := m.users.GetAPIKey(id)
+	if err == ErrAPIKeyNotFound {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !k.verify(secret) || k.expired(time.Now()) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	u, err := m.users.GetByID(k.UserID)
+	if err == ErrUserNotFound {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return u, k, nil
+}
@@ -0,0 +1,143 @@
+package iam
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_newAPIKey(t *testing.T) {
+	for name, tt := range map[string]struct {
+		opts    APIKeyOptions
+		wantErr error
+	}{
+		"OK": {
+			opts:    APIKeyOptions{Name: "ci", Scope: ScopeReadWrite, Prefixes: []string{"ci-"}},
+			wantErr: nil,
+		},
+		"OKExpiring": {
+			opts:    APIKeyOptions{Name: "ci", Scope: ScopeRead, ExpiresAt: time.Now().Add(time.Hour)},
+			wantErr: nil,
+		},
+		"ErrInvalidAPIKeyNoName": {
+			opts:    APIKeyOptions{Name: " ", Scope: ScopeRead},
+			wantErr: ErrInvalidAPIKey,
+		},
+		"ErrInvalidAPIKeyScope": {
+			opts:    APIKeyOptions{Name: "ci", Scope: "admin"},
+			wantErr: ErrInvalidAPIKey,
+		},
+		"ErrInvalidAPIKeyExpired": {
+			opts:    APIKeyOptions{Name: "ci", Scope: ScopeRead, ExpiresAt: time.Now().Add(-time.Hour)},
+			wantErr: ErrInvalidAPIKey,
+		},
+		"ErrInvalidAPIKeyEmptyPrefix": {
+			opts:    APIKeyOptions{Name: "ci", Scope: ScopeRead, Prefixes: []string{""}},
+			wantErr: ErrInvalidAPIKey,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			k, token, err := newAPIKey("x-x-x-x-x", tt.opts)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			id, secret, ok := parseAPIKey(token)
+			if !ok || id != k.ID || !k.verify(secret) {
+				t.Errorf("want key %s to verify, got: %s", k.ID, token)
+			}
+			if strings.Contains(string(k.hash), secret) {
+				t.Error("want secret not stored")
+			}
+		})
+	}
+}
+
+func TestAPIKey_Allows(t *testing.T) {
+	for name, tt := range map[string]struct {
+		prefixes []string
+		id       string
+		want     bool
+	}{
+		"NoPrefixes": {
+			prefixes: nil,
+			id:       "id",
+			want:     true,
+		},
+		"MatchingPrefix": {
+			prefixes: []string{"ci-", "build-"},
+			id:       "build-1",
+			want:     true,
+		},
+		"OtherPrefix": {
+			prefixes: []string{"ci-"},
+			id:       "build-1",
+			want:     false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			k := &APIKey{Prefixes: tt.prefixes}
+
+			if got := k.Allows(tt.id); got != tt.want {
+				t.Errorf("want: %t, got: %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestManager_APIKeys(t *testing.T) {
+	users := NewUserMemoryStorage()
+	m := &Manager{users: users}
+
+	u := &User{ID: "x-x-x-x-x", Email: "x@x.x"}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+
+	k, token, err := m.CreateAPIKey(u.ID, APIKeyOptions{Name: "ci", Scope: ScopeRead})
+	if err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	gotUser, gotKey, err := m.AuthenticateAPIKey(token)
+	if !reflect.DeepEqual(gotUser, u) || gotKey != k || err != nil {
+		t.Errorf("want: %+v, %+v, got: %+v, %+v, %v", u, k, gotUser, gotKey, err)
+	}
+
+	for name, token := range map[string]string{
+		"WrongSecret": token[:len(token)-1] + "x",
+		"UnknownID":   "ck_unknown_secret",
+		"Malformed":   "ck_",
+		"NoPrefix":    strings.TrimPrefix(token, "ck_"),
+	} {
+		if _, _, err := m.AuthenticateAPIKey(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: want: %v, got: %v", name, ErrInvalidToken, err)
+		}
+	}
+
+	k.ExpiresAt = time.Now().Add(-time.Second)
+	if _, _, err = m.AuthenticateAPIKey(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("want expired key: %v, got: %v", ErrInvalidToken, err)
+	}
+	k.ExpiresAt = time.Time{}
+
+	if keys, err := m.APIKeys(u.ID); len(keys) != 1 || keys[0] != k || err != nil {
+		t.Errorf("want: [%+v], got: %+v, %v", k, keys, err)
+	}
+
+	if err = m.RevokeAPIKey("y-y-y-y-y", k.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("want revoking key of other user: %v, got: %v", ErrAPIKeyNotFound, err)
+	}
+	if err = m.RevokeAPIKey(u.ID, k.ID); err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+	if _, _, err = m.AuthenticateAPIKey(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("want revoked key: %v, got: %v", ErrInvalidToken, err)
+	}
+}
@@ -0,0 +1,154 @@
+package iam
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"counters/pkg/oauth2"
+)
+
+var (
+	ErrInvalidTokenKeys   = errors.New("invalid token encryption keys")
+	ErrTokenDecryptFailed = errors.New("token decryption failed")
+)
+
+// TokenKeys holds the key-encryption keys that stored provider tokens are
+// encrypted with, by ID. Tokens are encrypted with a random data key, which
+// is wrapped by the primary key and stored along with the ID of that key.
+// Keys are rotated by adding a new key, making it the primary key and
+// removing the old one once the stored tokens have been re-encrypted.
+type TokenKeys struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+func NewTokenKeys(primary string, keys map[string][]byte) (*TokenKeys, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("%w: no primary key %q", ErrInvalidTokenKeys, primary)
+	}
+
+	k := &TokenKeys{primary: primary, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("%w: key %q is not 32 bytes long", ErrInvalidTokenKeys, id)
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+	}
+
+	return k, nil
+}
+
+// Primary returns the ID of the key tokens are encrypted with.
+func (k *TokenKeys) Primary() string {
+	return k.primary
+}
+
+// encryptedTokens are the tokens of a user encrypted with the data key, which
+// is wrapped by the key with the ID.
+type encryptedTokens struct {
+	KeyID string `json:"kid"`
+	Key   []byte `json:"key"`
+	Data  []byte `json:"data"`
+}
+
+// encrypt encrypts the tokens of the user. The user ID is authenticated along
+// with the tokens, so they cannot be moved to another user.
+func (k *TokenKeys) encrypt(userID string, tokens []oauth2.Token) (*encryptedTokens, error) {
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err = rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &encryptedTokens{KeyID: k.primary}
+	if e.Key, err = seal(k.keys[k.primary], dataKey, []byte(k.primary)); err != nil {
+		return nil, err
+	}
+	if e.Data, err = seal(aead, data, []byte(userID)); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (k *TokenKeys) decrypt(userID string, e *encryptedTokens) ([]oauth2.Token, error) {
+	if k == nil {
+		return nil, fmt.Errorf("%w: no keys configured", ErrTokenDecryptFailed)
+	}
+
+	key, ok := k.keys[e.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrTokenDecryptFailed, e.KeyID)
+	}
+
+	dataKey, err := open(key, e.Key, []byte(e.KeyID))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenDecryptFailed, err)
+	}
+	data, err := open(aead, e.Data, []byte(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []oauth2.Token
+	if err = json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the plaintext and prepends the random nonce.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrTokenDecryptFailed)
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenDecryptFailed, err)
+	}
+
+	return plaintext, nil
+}
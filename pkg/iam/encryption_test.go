@@ -0,0 +1,145 @@
+package iam
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"counters/pkg/oauth2"
+)
+
+func testTokenKeys(t *testing.T, primary string, ids ...string) *TokenKeys {
+	t.Helper()
+
+	keys := make(map[string][]byte, len(ids))
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[:1]), 32)
+	}
+
+	k, err := NewTokenKeys(primary, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return k
+}
+
+func TestNewTokenKeys(t *testing.T) {
+	for name, tt := range map[string]struct {
+		primary string
+		keys    map[string][]byte
+		wantErr error
+	}{
+		"OK": {
+			primary: "new",
+			keys: map[string][]byte{
+				"old": bytes.Repeat([]byte("o"), 32),
+				"new": bytes.Repeat([]byte("n"), 32),
+			},
+			wantErr: nil,
+		},
+		"ErrInvalidTokenKeysNoPrimaryKey": {
+			primary: "new",
+			keys:    map[string][]byte{"old": bytes.Repeat([]byte("o"), 32)},
+			wantErr: ErrInvalidTokenKeys,
+		},
+		"ErrInvalidTokenKeysKeyLength": {
+			primary: "new",
+			keys: map[string][]byte{
+				"old": bytes.Repeat([]byte("o"), 16),
+				"new": bytes.Repeat([]byte("n"), 32),
+			},
+			wantErr: ErrInvalidTokenKeys,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewTokenKeys(tt.primary, tt.keys)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTokenKeys_decrypt(t *testing.T) {
+	tokens := []oauth2.Token{{
+		Access:   "accessToken",
+		Refresh:  "refreshToken",
+		Expiry:   time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		Provider: oauth2.Google,
+	}}
+
+	old := testTokenKeys(t, "old", "old")
+	e, err := old.encrypt("x-x-x-x-x", tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.KeyID != "old" || bytes.Contains(e.Data, []byte("accessToken")) {
+		t.Fatalf("want tokens encrypted with old, got: %+v", e)
+	}
+
+	tampered := *e
+	tampered.Data = append([]byte(nil), e.Data...)
+	tampered.Data[len(tampered.Data)-1] ^= 1
+
+	for name, tt := range map[string]struct {
+		keys       *TokenKeys
+		userID     string
+		encrypted  *encryptedTokens
+		wantTokens []oauth2.Token
+		wantErr    error
+	}{
+		"OK": {
+			keys:       old,
+			userID:     "x-x-x-x-x",
+			encrypted:  e,
+			wantTokens: tokens,
+			wantErr:    nil,
+		},
+		"OKRotated": {
+			keys:       testTokenKeys(t, "new", "old", "new"),
+			userID:     "x-x-x-x-x",
+			encrypted:  e,
+			wantTokens: tokens,
+			wantErr:    nil,
+		},
+		"ErrOtherUser": {
+			keys:      old,
+			userID:    "y-y-y-y-y",
+			encrypted: e,
+			wantErr:   ErrTokenDecryptFailed,
+		},
+		"ErrTampered": {
+			keys:      old,
+			userID:    "x-x-x-x-x",
+			encrypted: &tampered,
+			wantErr:   ErrTokenDecryptFailed,
+		},
+		"ErrUnknownKey": {
+			keys:      testTokenKeys(t, "new", "new"),
+			userID:    "x-x-x-x-x",
+			encrypted: e,
+			wantErr:   ErrTokenDecryptFailed,
+		},
+		"ErrNoKeys": {
+			keys:      nil,
+			userID:    "x-x-x-x-x",
+			encrypted: e,
+			wantErr:   ErrTokenDecryptFailed,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := tt.keys.decrypt(tt.userID, tt.encrypted)
+
+			if !reflect.DeepEqual(got, tt.wantTokens) {
+				t.Errorf("want: %+v, got: %+v", tt.wantTokens, got)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
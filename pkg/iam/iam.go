@@ -3,6 +3,7 @@ package iam
 import (
 	"errors"
 	"net/mail"
+	"time"
 
 	"counters/pkg/oauth2"
 
@@ -16,6 +17,12 @@ type User struct {
 	Email string
 
 	tokens []oauth2.Token
+	// sessions holds the IDs of the active sessions of the user along with
+	// the time their refresh tokens expire.
+	sessions map[string]time.Time
+	roles    map[Role]bool
+	// identities are the users at OAuth2 providers the user signs in as.
+	identities []Identity
 }
 
 func NewUser(email string) (*User, error) {
@@ -39,3 +46,58 @@ func (u *User) SetToken(token oauth2.Token) {
 
 	u.tokens = append(u.tokens, token)
 }
+
+// Token returns the token of the provider, if the user has signed in with it.
+func (u *User) Token(provider oauth2.Provider) (oauth2.Token, bool) {
+	for _, t := range u.tokens {
+		if t.Provider == provider {
+			return t, true
+		}
+	}
+
+	return oauth2.Token{}, false
+}
+
+func (u *User) addSession(id string, expiresAt time.Time) {
+	now := time.Now()
+	for id, exp := range u.sessions {
+		if !now.Before(exp) {
+			delete(u.sessions, id)
+		}
+	}
+
+	if u.sessions == nil {
+		u.sessions = make(map[string]time.Time)
+	}
+	u.sessions[id] = expiresAt
+}
+
+func (u *User) hasSession(id string) bool {
+	exp, ok := u.sessions[id]
+	return ok && time.Now().Before(exp)
+}
+
+// clone returns a copy of the user that shares no state with it.
+func (u *User) clone() *User {
+	c := *u
+	if u.tokens != nil {
+		c.tokens = append(make([]oauth2.Token, 0, len(u.tokens)), u.tokens...)
+	}
+	if u.identities != nil {
+		c.identities = append(make([]Identity, 0, len(u.identities)), u.identities...)
+	}
+	if u.sessions != nil {
+		c.sessions = make(map[string]time.Time, len(u.sessions))
+		for id, exp := range u.sessions {
+			c.sessions[id] = exp
+		}
+	}
+	if u.roles != nil {
+		c.roles = make(map[Role]bool, len(u.roles))
+		for r := range u.roles {
+			c.roles[r] = true
+		}
+	}
+
+	return &c
+}
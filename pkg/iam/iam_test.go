@@ -89,3 +89,14 @@ func TestUser_SetToken(t *testing.T) {
 		})
 	}
 }
+
+func TestUser_Token(t *testing.T) {
+	u := User{tokens: []oauth2.Token{{Access: "accessToken", Provider: oauth2.Google}}}
+
+	if token, ok := u.Token(oauth2.Google); !ok || token.Access != "accessToken" {
+		t.Errorf("want: accessToken, got: %+v, %t", token, ok)
+	}
+	if token, ok := u.Token(oauth2.GitHub); ok {
+		t.Errorf("want: <none>, got: %+v", token)
+	}
+}
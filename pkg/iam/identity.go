@@ -0,0 +1,104 @@
+package iam
+
+import (
+	"errors"
+
+	"counters/pkg/oauth2"
+)
+
+var (
+	ErrUnverifiedEmail   = errors.New("email is not verified by the provider")
+	ErrIdentityNotLinked = errors.New("a user with the email exists, sign in with a linked provider to link this one")
+	ErrIdentityLinked    = errors.New("identity is linked to another user")
+	ErrMissingSubject    = errors.New("provider returned no subject")
+)
+
+// Identity is a user at an OAuth2 provider, identified by the stable subject
+// ID of the provider rather than the email.
+type Identity struct {
+	Provider oauth2.Provider `json:"provider"`
+	Subject  string          `json:"subject"`
+}
+
+func (u *User) Identities() []Identity {
+	return append([]Identity(nil), u.identities...)
+}
+
+func (u *User) hasIdentity(identity Identity) bool {
+	for _, i := range u.identities {
+		if i == identity {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (u *User) addIdentity(identity Identity) {
+	if !u.hasIdentity(identity) {
+		u.identities = append(u.identities, identity)
+	}
+}
+
+// OAuth2LinkURL starts an authorization with the provider that links it to
+// the user once the callback completes it.
+func (m *Manager) OAuth2LinkURL(provider oauth2.Provider, userID string) (url, state string, err error) {
+	return m.authURL(oauth2.State{Provider: provider, User: userID})
+}
+
+// identifiedUser returns the user the identity belongs to. Users are found
+// by email only if they signed up before identities existed, so that another
+// provider asserting the same email cannot take the account over. Unknown
+// users are not found.
+func (m *Manager) identifiedUser(identity Identity, info oauth2.UserInfo) (*User, error) {
+	if !info.EmailVerified {
+		return nil, ErrUnverifiedEmail
+	}
+
+	u, err := m.users.GetByIdentity(identity)
+	if err != ErrUserNotFound {
+		return u, err
+	}
+
+	u, err = m.users.Get(info.Email)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.identities) > 0 {
+		return nil, ErrIdentityNotLinked
+	}
+
+	return u, nil
+}
+
+// newUser signs a new user up with the email if the sign-up policy allows
+// it, and returns the invitation it used up along with it. The user still
+// has to be stored.
+func (m *Manager) newUser(email, invitation string) (*User, *Invitation, error) {
+	u, err := NewUser(email)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	role, used, err := m.checkSignUp(u.Email, invitation)
+	if err != nil {
+		return nil, nil, err
+	}
+	u.AddRole(role)
+
+	return u, used, nil
+}
+
+// checkLink checks that the identity can be linked to the user with the
+// given ID, which it cannot if it belongs to another user.
+func (m *Manager) checkLink(userID string, identity Identity) error {
+	owner, err := m.users.GetByIdentity(identity)
+	switch {
+	case err == nil && owner.ID != userID:
+		return ErrIdentityLinked
+	case err != nil && err != ErrUserNotFound:
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"counters/pkg/oauth2"
+
+	"github.com/golang/mock/gomock"
+)
+
+// testIdentityManager returns a manager that signs in with Google and GitHub
+// as the users the infos map codes to.
+func testIdentityManager(t *testing.T, infos map[string]oauth2.UserInfo) (*Manager, *UserMemoryStorage) {
+	t.Helper()
+
+	clients := make(map[oauth2.Provider]oauth2.Client)
+	for _, p := range []oauth2.Provider{oauth2.Google, oauth2.GitHub} {
+		p := p
+		c := oauth2.NewMockClient(gomock.NewController(t))
+		c.EXPECT().AuthURL(gomock.Any(), gomock.Any()).Return("url").AnyTimes()
+		c.EXPECT().
+			Exchange(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, code, _ string) (oauth2.Token, error) {
+				return oauth2.Token{Access: code, Provider: p}, nil
+			}).
+			AnyTimes()
+		c.EXPECT().
+			UserInfo(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, token oauth2.Token) (oauth2.UserInfo, error) {
+				return infos[token.Access], nil
+			}).
+			AnyTimes()
+		clients[p] = c
+	}
+
+	users := NewUserMemoryStorage()
+
+	return NewManager(users, clients, oauth2.NewMemoryStateStore(time.Minute), testSessions(t), nil, SignUpPolicy{}), users
+}
+
+func TestManager_SignInWithOAuth2_identities(t *testing.T) {
+	m, users := testIdentityManager(t, map[string]oauth2.UserInfo{
+		"google":        {Subject: "1", Email: "x@x.x", EmailVerified: true},
+		"googleChanged": {Subject: "1", Email: "new@x.x", EmailVerified: true},
+		"github":        {Subject: "2", Email: "x@x.x", EmailVerified: true},
+		"unverified":    {Subject: "3", Email: "y@x.x", EmailVerified: false},
+		"noSubject":     {Subject: "", Email: "z@x.x", EmailVerified: true},
+	})
+
+	signIn := func(provider oauth2.Provider, code string) error {
+		_, state, err := m.OAuth2URL(provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = m.SignInWithOAuth2(context.TODO(), provider, state, code)
+		return err
+	}
+
+	if err := signIn(oauth2.Google, "google"); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	u, err := users.Get("x@x.x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Identity{{Provider: oauth2.Google, Subject: "1"}}; !reflect.DeepEqual(u.Identities(), want) {
+		t.Errorf("want: %+v, got: %+v", want, u.Identities())
+	}
+
+	if err = signIn(oauth2.Google, "googleChanged"); err != nil {
+		t.Errorf("want changed email signed in by subject: <nil>, got: %v", err)
+	}
+	if _, err = users.Get("new@x.x"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("want no user for changed email: %v, got: %v", ErrUserNotFound, err)
+	}
+
+	if err = signIn(oauth2.GitHub, "github"); !errors.Is(err, ErrIdentityNotLinked) {
+		t.Errorf("want other provider with the same email: %v, got: %v", ErrIdentityNotLinked, err)
+	}
+
+	if err = signIn(oauth2.GitHub, "unverified"); !errors.Is(err, ErrUnverifiedEmail) {
+		t.Errorf("want: %v, got: %v", ErrUnverifiedEmail, err)
+	}
+	if _, err = users.Get("y@x.x"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("want no user for unverified email: %v, got: %v", ErrUserNotFound, err)
+	}
+
+	if err = signIn(oauth2.Google, "noSubject"); !errors.Is(err, ErrMissingSubject) {
+		t.Errorf("want: %v, got: %v", ErrMissingSubject, err)
+	}
+	if _, err = users.Get("z@x.x"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("want no user without subject: %v, got: %v", ErrUserNotFound, err)
+	}
+}
+
+func TestManager_SignInWithOAuth2_legacyUser(t *testing.T) {
+	m, users := testIdentityManager(t, map[string]oauth2.UserInfo{
+		"google": {Subject: "1", Email: "x@x.x", EmailVerified: true},
+	})
+	legacy := &User{ID: "x-x-x-x-x", Email: "x@x.x"}
+	if err := users.Create(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	_, state, err := m.OAuth2URL(oauth2.Google)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.SignInWithOAuth2(context.TODO(), oauth2.Google, state, "google"); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	if u, err := users.GetByIdentity(Identity{Provider: oauth2.Google, Subject: "1"}); err != nil || u.ID != legacy.ID {
+		t.Errorf("want legacy user linked, got: %+v, %v", u, err)
+	}
+}
+
+func TestManager_OAuth2LinkURL(t *testing.T) {
+	m, users := testIdentityManager(t, map[string]oauth2.UserInfo{
+		"google":      {Subject: "1", Email: "x@x.x", EmailVerified: true},
+		"github":      {Subject: "2", Email: "other@x.x", EmailVerified: true},
+		"otherGoogle": {Subject: "3", Email: "y@x.x", EmailVerified: true},
+	})
+
+	signIn := func(provider oauth2.Provider, userID, code string) error {
+		var (
+			state string
+			err   error
+		)
+		if userID == "" {
+			_, state, err = m.OAuth2URL(provider)
+		} else {
+			_, state, err = m.OAuth2LinkURL(provider, userID)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = m.SignInWithOAuth2(context.TODO(), provider, state, code)
+		return err
+	}
+
+	for _, code := range []string{"google", "otherGoogle"} {
+		if err := signIn(oauth2.Google, "", code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u, err := users.Get("x@x.x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = signIn(oauth2.GitHub, u.ID, "github"); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if u, err = users.GetByID(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	want := []Identity{{Provider: oauth2.Google, Subject: "1"}, {Provider: oauth2.GitHub, Subject: "2"}}
+	if !reflect.DeepEqual(u.Identities(), want) {
+		t.Errorf("want: %+v, got: %+v", want, u.Identities())
+	}
+
+	if err = signIn(oauth2.GitHub, "", "github"); err != nil {
+		t.Errorf("want linked provider signed in: <nil>, got: %v", err)
+	}
+
+	if err = signIn(oauth2.Google, u.ID, "otherGoogle"); !errors.Is(err, ErrIdentityLinked) {
+		t.Errorf("want: %v, got: %v", ErrIdentityLinked, err)
+	}
+}
@@ -0,0 +1,210 @@
+package iam
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSignUpNotAllowed   = errors.New("sign-up is not allowed for the email domain")
+	ErrInvitationRequired = errors.New("sign-up requires an invitation")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvalidInvitation  = errors.New("invalid invitation")
+)
+
+// DefaultInvitationTTL is how long invitations without an expiry are valid.
+const DefaultInvitationTTL = 7 * 24 * time.Hour
+
+// SignUpPolicy restricts who can sign up. Users that exist keep access, and
+// the admin emails can always sign up. DeniedDomains take precedence over
+// AllowedDomains, and an empty AllowedDomains allows every domain.
+// InviteOnly requires an invitation for the email.
+type SignUpPolicy struct {
+	AllowedDomains []string
+	DeniedDomains  []string
+	InviteOnly     bool
+}
+
+// allowsDomain reports whether users with the email can sign up. Domains are
+// matched exactly and case-insensitively, so subdomains are listed on their
+// own.
+func (p SignUpPolicy) allowsDomain(email string) bool {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return false
+	}
+	domain := email[i+1:]
+
+	for _, d := range p.DeniedDomains {
+		if strings.EqualFold(d, domain) {
+			return false
+		}
+	}
+	if len(p.AllowedDomains) == 0 {
+		return true
+	}
+	for _, d := range p.AllowedDomains {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Invitation lets the email sign up with the role. Only a hash of the token
+// the invitee signs up with is stored, and the invitation is deleted once it
+// is used.
+type Invitation struct {
+	ID        string
+	Email     string
+	Role      Role
+	CreatedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+
+	hash []byte
+}
+
+// invitationPrefix starts every invitation token.
+const invitationPrefix = "ci_"
+
+func (i *Invitation) expired(now time.Time) bool {
+	return !now.Before(i.ExpiresAt)
+}
+
+type InvitationOptions struct {
+	Email     string
+	Role      Role
+	ExpiresAt time.Time
+}
+
+// newInvitation returns the invitation along with the token to send to the
+// invitee, which cannot be recovered later.
+func newInvitation(createdBy string, opts InvitationOptions) (*Invitation, string, error) {
+	now := time.Now()
+
+	if _, err := NewUser(opts.Email); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidInvitation, err)
+	}
+	if opts.Role == "" {
+		opts.Role = DefaultRole
+	}
+	if !opts.Role.Valid() {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidInvitation, ErrInvalidRole)
+	}
+	switch {
+	case opts.ExpiresAt.IsZero():
+		opts.ExpiresAt = now.Add(DefaultInvitationTTL)
+	case !now.Before(opts.ExpiresAt):
+		return nil, "", fmt.Errorf("%w: expiry is in the past", ErrInvalidInvitation)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+
+	i := &Invitation{
+		ID:        strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Email:     opts.Email,
+		Role:      opts.Role,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: opts.ExpiresAt,
+		hash:      hashSecret(secret),
+	}
+
+	return i, invitationPrefix + i.ID + "_" + secret, nil
+}
+
+// parseInvitation splits the invitation token into its ID and secret.
+func parseInvitation(token string) (id, secret string, ok bool) {
+	if !strings.HasPrefix(token, invitationPrefix) {
+		return "", "", false
+	}
+
+	id, secret, ok = strings.Cut(strings.TrimPrefix(token, invitationPrefix), "_")
+
+	return id, secret, ok && id != "" && secret != ""
+}
+
+// CreateInvitation invites the email to sign up and returns the invitation
+// along with the token to send to the invitee, which is shown once.
+func (m *Manager) CreateInvitation(createdBy string, opts InvitationOptions) (*Invitation, string, error) {
+	i, token, err := newInvitation(createdBy, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	if !m.signUp.allowsDomain(i.Email) {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidInvitation, ErrSignUpNotAllowed)
+	}
+
+	if err = m.users.SetInvitation(i); err != nil {
+		return nil, "", err
+	}
+
+	return i, token, nil
+}
+
+func (m *Manager) Invitations() ([]*Invitation, error) {
+	return m.users.ListInvitations()
+}
+
+func (m *Manager) RevokeInvitation(id string) error {
+	return m.users.DeleteInvitation(id)
+}
+
+// checkSignUp returns the role the email signs up with, along with the
+// invitation it used up, if any. The invitation token is required in
+// invite-only mode and optional otherwise, and it is used up once the check
+// passes. The invitation has to be restored if the user cannot be stored.
+func (m *Manager) checkSignUp(email, token string) (Role, *Invitation, error) {
+	if m.admin(email) {
+		return DefaultRole, nil, nil
+	}
+	if !m.signUp.allowsDomain(email) {
+		return "", nil, ErrSignUpNotAllowed
+	}
+	if token == "" {
+		if m.signUp.InviteOnly {
+			return "", nil, ErrInvitationRequired
+		}
+		return DefaultRole, nil, nil
+	}
+
+	id, secret, ok := parseInvitation(token)
+	if !ok {
+		return "", nil, ErrInvalidInvitation
+	}
+
+	i, err := m.users.GetInvitation(id)
+	if err == ErrInvitationNotFound {
+		return "", nil, ErrInvalidInvitation
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !verifySecret(i.hash, secret) || i.expired(time.Now()) || !strings.EqualFold(i.Email, email) {
+		return "", nil, ErrInvalidInvitation
+	}
+
+	// Deleting the invitation uses it up, so only one sign-up can win it.
+	err = m.users.DeleteInvitation(id)
+	if err == ErrInvitationNotFound {
+		return "", nil, ErrInvalidInvitation
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	return i.Role, i, nil
+}
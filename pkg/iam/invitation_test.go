@@ -0,0 +1,216 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"counters/pkg/oauth2"
+)
+
+func TestSignUpPolicy_allowsDomain(t *testing.T) {
+	for name, tt := range map[string]struct {
+		policy SignUpPolicy
+		email  string
+		want   bool
+	}{
+		"OKNoLists": {
+			policy: SignUpPolicy{},
+			email:  "x@x.x",
+			want:   true,
+		},
+		"OKAllowed": {
+			policy: SignUpPolicy{AllowedDomains: []string{"example.com"}},
+			email:  "x@Example.com",
+			want:   true,
+		},
+		"NotAllowed": {
+			policy: SignUpPolicy{AllowedDomains: []string{"example.com"}},
+			email:  "x@sub.example.com",
+			want:   false,
+		},
+		"Denied": {
+			policy: SignUpPolicy{DeniedDomains: []string{"x.x"}},
+			email:  "x@x.x",
+			want:   false,
+		},
+		"DeniedOverAllowed": {
+			policy: SignUpPolicy{AllowedDomains: []string{"x.x"}, DeniedDomains: []string{"x.x"}},
+			email:  "x@x.x",
+			want:   false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.policy.allowsDomain(tt.email); got != tt.want {
+				t.Errorf("want: %t, got: %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_newInvitation(t *testing.T) {
+	for name, tt := range map[string]struct {
+		opts     InvitationOptions
+		wantRole Role
+		wantErr  error
+	}{
+		"OK": {
+			opts:     InvitationOptions{Email: "x@x.x", Role: RoleViewer},
+			wantRole: RoleViewer,
+			wantErr:  nil,
+		},
+		"OKDefaultRole": {
+			opts:     InvitationOptions{Email: "x@x.x"},
+			wantRole: DefaultRole,
+			wantErr:  nil,
+		},
+		"ErrInvalidEmail": {
+			opts:    InvitationOptions{Email: "x"},
+			wantErr: ErrInvalidInvitation,
+		},
+		"ErrInvalidRole": {
+			opts:    InvitationOptions{Email: "x@x.x", Role: "owner"},
+			wantErr: ErrInvalidInvitation,
+		},
+		"ErrExpired": {
+			opts:    InvitationOptions{Email: "x@x.x", ExpiresAt: time.Now().Add(-time.Second)},
+			wantErr: ErrInvalidInvitation,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			i, token, err := newInvitation("x-x-x-x-x", tt.opts)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if i.Role != tt.wantRole {
+				t.Errorf("want role: %s, got: %s", tt.wantRole, i.Role)
+			}
+			if id, secret, ok := parseInvitation(token); !ok || id != i.ID || !verifySecret(i.hash, secret) {
+				t.Errorf("want token of the invitation, got: %s", token)
+			}
+			if !i.ExpiresAt.After(time.Now()) {
+				t.Errorf("want expiry in the future, got: %v", i.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestManager_SignInWithOAuth2_signUp(t *testing.T) {
+	m, users := testIdentityManager(t, map[string]oauth2.UserInfo{
+		"invited":  {Subject: "1", Email: "x@x.x", EmailVerified: true},
+		"other":    {Subject: "2", Email: "y@x.x", EmailVerified: true},
+		"denied":   {Subject: "3", Email: "z@denied.x", EmailVerified: true},
+		"admin":    {Subject: "4", Email: "admin@x.x", EmailVerified: true},
+		"existing": {Subject: "5", Email: "existing@x.x", EmailVerified: true},
+	})
+	m.signUp = SignUpPolicy{DeniedDomains: []string{"denied.x"}, InviteOnly: true}
+	m.admins = map[string]bool{"admin@x.x": true}
+	if err := users.Create(&User{ID: "e-e-e-e-e", Email: "existing@x.x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	signIn := func(code, invitation string) error {
+		_, state, err := m.OAuth2SignUpURL(oauth2.Google, invitation)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = m.SignInWithOAuth2(context.TODO(), oauth2.Google, state, code)
+		return err
+	}
+
+	_, token, err := m.CreateInvitation("a-a-a-a-a", InvitationOptions{Email: "x@x.x", Role: RoleViewer})
+	if err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if _, _, err = m.CreateInvitation("a-a-a-a-a", InvitationOptions{Email: "z@denied.x"}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("want inviting denied domain: %v, got: %v", ErrInvalidInvitation, err)
+	}
+
+	for name, tt := range map[string]struct {
+		code       string
+		invitation string
+		wantErr    error
+	}{
+		"ErrInvitationRequired": {code: "invited", invitation: "", wantErr: ErrInvitationRequired},
+		"ErrOtherEmail":         {code: "other", invitation: token, wantErr: ErrInvalidInvitation},
+		"ErrMalformed":          {code: "invited", invitation: "ci_", wantErr: ErrInvalidInvitation},
+		"ErrSignUpNotAllowed":   {code: "denied", invitation: "", wantErr: ErrSignUpNotAllowed},
+		"OKAdmin":               {code: "admin", invitation: "", wantErr: nil},
+		"OKExisting":            {code: "existing", invitation: "", wantErr: nil},
+	} {
+		if err = signIn(tt.code, tt.invitation); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: want: %v, got: %v", name, tt.wantErr, err)
+		}
+	}
+
+	if err = signIn("invited", token); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	u, err := users.Get("x@x.x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Role{RoleViewer}; len(u.Roles()) != 1 || u.Roles()[0] != want[0] {
+		t.Errorf("want roles: %v, got: %v", want, u.Roles())
+	}
+	if invitations, _ := m.Invitations(); len(invitations) != 0 {
+		t.Errorf("want used invitation deleted, got: %+v", invitations)
+	}
+
+	if err = users.Delete(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = signIn("invited", token); !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("want reused invitation: %v, got: %v", ErrInvalidInvitation, err)
+	}
+}
+
+// failingUserStorage fails to store users.
+type failingUserStorage struct {
+	*UserMemoryStorage
+}
+
+func (failingUserStorage) Create(*User) error {
+	return errors.New("storage failed")
+}
+
+func TestManager_SignInWithOAuth2_signUpFailed(t *testing.T) {
+	m, users := testIdentityManager(t, map[string]oauth2.UserInfo{
+		"invited": {Subject: "1", Email: "x@x.x", EmailVerified: true},
+	})
+	m.signUp = SignUpPolicy{InviteOnly: true}
+
+	_, token, err := m.CreateInvitation("a-a-a-a-a", InvitationOptions{Email: "x@x.x", Role: RoleViewer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signIn := func() error {
+		_, state, err := m.OAuth2SignUpURL(oauth2.Google, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = m.SignInWithOAuth2(context.TODO(), oauth2.Google, state, "invited")
+		return err
+	}
+
+	m.users = failingUserStorage{users}
+	if err = signIn(); err == nil {
+		t.Fatalf("want: <non-nil>, got: <nil>")
+	}
+	if invitations, _ := m.Invitations(); len(invitations) != 1 {
+		t.Errorf("want invitation restored, got: %+v", invitations)
+	}
+
+	m.users = users
+	if err = signIn(); err != nil {
+		t.Errorf("want retried sign-up: <nil>, got: %v", err)
+	}
+}
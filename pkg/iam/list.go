@@ -0,0 +1,60 @@
+package iam
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	DefaultUserListLimit = 100
+	MaxUserListLimit     = 1000
+)
+
+// UserListOptions lists users by email. Email matches the users whose emails
+// contain it, regardless of case.
+type UserListOptions struct {
+	Email  string
+	Cursor string
+	Limit  int
+}
+
+type UserPage struct {
+	Users      []*User
+	NextCursor string
+	Total      int
+}
+
+// parseUserListOptions fills in the defaults and decodes the cursor, which is
+// the email of the last user of the previous page, or "" for the first page.
+func parseUserListOptions(opts UserListOptions) (UserListOptions, string, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultUserListLimit
+	}
+	if opts.Limit > MaxUserListLimit {
+		opts.Limit = MaxUserListLimit
+	}
+
+	if opts.Cursor == "" {
+		return opts, "", nil
+	}
+
+	after, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil || len(after) == 0 {
+		return opts, "", ErrInvalidCursor
+	}
+
+	return opts, string(after), nil
+}
+
+// paginateUsers drops the user that was fetched past the limit to find out
+// whether there is a next page, and points the next cursor at the last one.
+func paginateUsers(page *UserPage, opts UserListOptions) *UserPage {
+	if len(page.Users) > opts.Limit {
+		page.Users = page.Users[:opts.Limit]
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(page.Users[opts.Limit-1].Email))
+	}
+
+	return page
+}
@@ -3,6 +3,9 @@ package iam
 import (
 	"context"
 	"errors"
+	"sort"
+	"strings"
+	"time"
 
 	"counters/pkg/oauth2"
 )
@@ -10,56 +13,311 @@ import (
 type Manager struct {
 	users UserStorage
 
-	oauth2 map[oauth2.Provider]oauth2.Client
+	oauth2   map[oauth2.Provider]oauth2.Client
+	states   oauth2.StateStore
+	sessions SessionConfig
+	// admins holds the lowercased emails of the users that are granted the
+	// admin role when they sign in.
+	admins map[string]bool
+	signUp SignUpPolicy
 }
 
-func NewManager(users UserStorage, oauth2 map[oauth2.Provider]oauth2.Client) *Manager {
-	return &Manager{users: users, oauth2: oauth2}
+func NewManager(
+	users UserStorage,
+	oauth2 map[oauth2.Provider]oauth2.Client,
+	states oauth2.StateStore,
+	sessions SessionConfig,
+	admins []string,
+	signUp SignUpPolicy,
+) *Manager {
+	m := &Manager{
+		users:    users,
+		oauth2:   oauth2,
+		states:   states,
+		sessions: sessions,
+		admins:   make(map[string]bool, len(admins)),
+		signUp:   signUp,
+	}
+	for _, email := range admins {
+		m.admins[strings.ToLower(email)] = true
+	}
+
+	return m
 }
 
-var ErrInvalidOAuth2Provider = errors.New("invalid OAuth2 provider")
+var (
+	ErrInvalidOAuth2Provider = errors.New("invalid OAuth2 provider")
+	ErrInvalidToken          = errors.New("invalid token")
+)
 
-func (m *Manager) OAuth2URL(provider oauth2.Provider) (string, error) {
-	c, ok := m.oauth2[provider]
+// Providers returns the configured OAuth2 providers in order.
+func (m *Manager) Providers() []oauth2.Provider {
+	providers := make([]oauth2.Provider, 0, len(m.oauth2))
+	for p := range m.oauth2 {
+		providers = append(providers, p)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i] < providers[j] })
+
+	return providers
+}
+
+// OAuth2URL starts an authorization with the provider and returns the URL to
+// redirect the user to along with the state the callback has to present.
+func (m *Manager) OAuth2URL(provider oauth2.Provider) (url, state string, err error) {
+	return m.authURL(oauth2.State{Provider: provider})
+}
+
+// OAuth2SignUpURL starts an authorization with the provider like OAuth2URL
+// that signs the user up with the invitation.
+func (m *Manager) OAuth2SignUpURL(provider oauth2.Provider, invitation string) (url, state string, err error) {
+	return m.authURL(oauth2.State{Provider: provider, Invitation: invitation})
+}
+
+func (m *Manager) authURL(s oauth2.State) (url, state string, err error) {
+	c, ok := m.oauth2[s.Provider]
 	if !ok {
-		return "", ErrInvalidOAuth2Provider
+		return "", "", ErrInvalidOAuth2Provider
+	}
+
+	state, s.Verifier, err = oauth2.NewState()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err = m.states.Save(state, s); err != nil {
+		return "", "", err
 	}
 
-	return c.AuthURL(), nil
+	return c.AuthURL(state, s.Verifier), state, nil
 }
 
-func (m *Manager) SignInWithOAuth2(ctx context.Context, provider oauth2.Provider, state, code string) (oauth2.Token, error) {
+// SignInWithOAuth2 signs the user in with the authorization code returned
+// by the provider and starts a new session. Authorizations started by
+// OAuth2LinkURL link the provider to the user that started them instead.
+// The provider token is kept for calls to the provider and is never handed
+// out.
+func (m *Manager) SignInWithOAuth2(ctx context.Context, provider oauth2.Provider, state, code string) (Session, error) {
 	c, ok := m.oauth2[provider]
 	if !ok {
-		return oauth2.Token{}, ErrInvalidOAuth2Provider
+		return Session{}, ErrInvalidOAuth2Provider
 	}
 
-	token, err := c.Exchange(ctx, state, code)
+	s, err := m.states.Consume(state)
 	if err != nil {
-		return oauth2.Token{}, err
+		return Session{}, err
+	}
+	if s.Provider != provider {
+		return Session{}, oauth2.ErrInvalidState
+	}
+
+	token, err := c.Exchange(ctx, code, s.Verifier)
+	if err != nil {
+		return Session{}, err
 	}
 
 	info, err := c.UserInfo(ctx, token)
 	if err != nil {
-		return oauth2.Token{}, err
+		return Session{}, err
+	}
+	// Every user without a subject would share the same identity.
+	if info.Subject == "" {
+		return Session{}, ErrMissingSubject
 	}
 
-	u, err := m.users.Get(info.Email)
-	if err != nil && err != ErrUserNotFound {
-		return oauth2.Token{}, err
+	identity := Identity{Provider: provider, Subject: info.Subject}
+	signIn := func(u *User) error {
+		u.addIdentity(identity)
+		if m.admin(u.Email) {
+			u.AddRole(RoleAdmin)
+		}
+		u.SetToken(token)
+
+		return nil
 	}
 
-	if err == ErrUserNotFound {
-		if u, err = NewUser(info.Email); err != nil {
-			return oauth2.Token{}, err
+	if s.User != "" {
+		if err = m.checkLink(s.User, identity); err != nil {
+			return Session{}, err
+		}
+
+		return m.startSession(s.User, signIn)
+	}
+
+	u, err := m.identifiedUser(identity, info)
+	if err == nil {
+		return m.startSession(u.ID, signIn)
+	}
+	if err != ErrUserNotFound {
+		return Session{}, err
+	}
+
+	u, used, err := m.newUser(info.Email, s.Invitation)
+	if err != nil {
+		return Session{}, err
+	}
+	_ = signIn(u)
+
+	session, err := m.addSession(u)
+	if err == nil {
+		err = m.users.Create(u)
+	}
+	if err != nil {
+		if used != nil {
+			// The user was not signed up, so the invitee can try again.
+			// The error of the sign-up is the one that matters.
+			_ = m.users.SetInvitation(used)
+		}
+		if err == ErrUserExists {
+			// A concurrent sign-in with the email signed the user up first,
+			// so this one signs in as that user if it may.
+			if u, err = m.identifiedUser(identity, info); err == nil {
+				return m.startSession(u.ID, signIn)
+			}
+		}
+		return Session{}, err
+	}
+
+	return session, nil
+}
+
+// Authenticate returns the user the session access token belongs to.
+func (m *Manager) Authenticate(token string) (*User, error) {
+	u, _, err := m.session(token, accessToken)
+	return u, err
+}
+
+// Refresh starts a new session in exchange for the refresh token of the
+// current one, which ends. A refresh token can therefore be used once.
+func (m *Manager) Refresh(token string) (Session, error) {
+	u, id, err := m.session(token, refreshToken)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return m.startSession(u.ID, func(u *User) error {
+		// A concurrent refresh may have ended the session in the meantime.
+		if !u.hasSession(id) {
+			return ErrInvalidToken
+		}
+		delete(u.sessions, id)
+
+		return nil
+	})
+}
+
+// Logout ends the session the access token belongs to.
+func (m *Manager) Logout(token string) error {
+	u, id, err := m.session(token, accessToken)
+	if err != nil {
+		return err
+	}
+
+	return m.users.Update(u.ID, func(u *User) error {
+		delete(u.sessions, id)
+		return nil
+	})
+}
+
+// LogoutAll ends every session of the user and revokes the provider tokens
+// stored for it. Failures to revoke provider tokens are returned after the
+// sessions have ended.
+func (m *Manager) LogoutAll(ctx context.Context, userID string) error {
+	if err := m.RevokeSessions(userID); err != nil {
+		return err
+	}
+
+	return m.RevokeTokens(ctx, userID)
+}
+
+// RevokeSessions ends every session of the user.
+func (m *Manager) RevokeSessions(userID string) error {
+	return m.users.Update(userID, func(u *User) error {
+		u.sessions = nil
+		return nil
+	})
+}
+
+// startSession applies f to the stored user with the given ID and starts a
+// new session of it in the same update.
+func (m *Manager) startSession(userID string, f func(*User) error) (Session, error) {
+	var s Session
+	err := m.users.Update(userID, func(u *User) error {
+		if err := f(u); err != nil {
+			return err
 		}
+
+		var err error
+		s, err = m.addSession(u)
+
+		return err
+	})
+	if err != nil {
+		return Session{}, err
 	}
 
-	u.SetToken(token)
+	return s, nil
+}
+
+// addSession issues a new session of the user and adds it to the sessions of
+// the user, which still has to be stored.
+func (m *Manager) addSession(u *User) (Session, error) {
+	s, err := m.sessions.issue(u)
+	if err != nil {
+		return Session{}, err
+	}
+
+	u.addSession(s.ID, time.Now().Add(m.sessions.RefreshTTL))
+
+	return s, nil
+}
+
+// session returns the user and the ID of the active session the token of the
+// given type belongs to.
+func (m *Manager) session(token string, typ tokenType) (*User, string, error) {
+	claims, err := m.sessions.verify(token, typ)
+	if err != nil {
+		return nil, "", err
+	}
+
+	u, err := m.users.GetByID(claims.Subject)
+	if err == ErrUserNotFound {
+		return nil, "", ErrInvalidToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !u.hasSession(claims.SessionID) {
+		return nil, "", ErrInvalidToken
+	}
+
+	return u, claims.SessionID, nil
+}
+
+func (m *Manager) User(email string) (*User, error) {
+	return m.users.Get(email)
+}
+
+func (m *Manager) UserByID(id string) (*User, error) {
+	return m.users.GetByID(id)
+}
+
+func (m *Manager) Users(opts UserListOptions) (*UserPage, error) {
+	return m.users.List(opts)
+}
+
+// DeleteUser revokes the provider tokens of the user and deletes it along
+// with its API keys. Failures to revoke provider tokens are returned after
+// the user is deleted.
+func (m *Manager) DeleteUser(ctx context.Context, id string) error {
+	revokeErr := m.RevokeTokens(ctx, id)
+	if revokeErr != nil && !errors.Is(revokeErr, oauth2.ErrRevokeFailed) {
+		return revokeErr
+	}
 
-	if err = m.users.Set(u); err != nil {
-		return oauth2.Token{}, err
+	if err := m.users.Delete(id); err != nil {
+		return err
 	}
 
-	return token, nil
+	return revokeErr
 }
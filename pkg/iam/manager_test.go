@@ -5,7 +5,9 @@ import (
 	"errors"
 	"github.com/google/uuid"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"counters/pkg/oauth2"
 
@@ -14,21 +16,42 @@ import (
 
 func TestNewManager(t *testing.T) {
 	wantManager := &Manager{
-		users:  NewMockUserStorage(gomock.NewController(t)),
-		oauth2: map[oauth2.Provider]oauth2.Client{},
+		users:    NewMockUserStorage(gomock.NewController(t)),
+		oauth2:   map[oauth2.Provider]oauth2.Client{},
+		states:   oauth2.NewMockStateStore(gomock.NewController(t)),
+		sessions: testSessions(t),
+		admins:   map[string]bool{"admin@x.x": true},
+		signUp:   SignUpPolicy{InviteOnly: true},
 	}
 
-	m := NewManager(wantManager.users, wantManager.oauth2)
+	m := NewManager(wantManager.users, wantManager.oauth2, wantManager.states, wantManager.sessions, []string{"admin@x.x"}, wantManager.signUp)
 
 	if !reflect.DeepEqual(m, wantManager) {
 		t.Errorf("want: %+v, got: %+v", wantManager, m)
 	}
 }
 
+func TestManager_Providers(t *testing.T) {
+	c := gomock.NewController(t)
+	m := &Manager{oauth2: map[oauth2.Provider]oauth2.Client{
+		oauth2.Bitbucket: oauth2.NewMockClient(c),
+		oauth2.Google:    oauth2.NewMockClient(c),
+		oauth2.GitLab:    oauth2.NewMockClient(c),
+	}}
+
+	want := []oauth2.Provider{oauth2.Google, oauth2.GitLab, oauth2.Bitbucket}
+	if got := m.Providers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
 func TestManager_OAuth2URL(t *testing.T) {
+	errUnexpected := errors.New("unexpected error")
+
 	for name, tt := range map[string]struct {
 		provider      oauth2.Provider
 		oauth2        func(*gomock.Controller) map[oauth2.Provider]oauth2.Client
+		states        func(*gomock.Controller) oauth2.StateStore
 		wantOAuth2URL string
 		wantErr       error
 	}{
@@ -39,13 +62,23 @@ func TestManager_OAuth2URL(t *testing.T) {
 
 				client.
 					EXPECT().
-					AuthURL().
+					AuthURL(gomock.Any(), gomock.Any()).
 					Return("oauth2.url")
 
 				return map[oauth2.Provider]oauth2.Client{
 					oauth2.Google: client,
 				}
 			},
+			states: func(c *gomock.Controller) oauth2.StateStore {
+				s := oauth2.NewMockStateStore(c)
+
+				s.
+					EXPECT().
+					Save(gomock.Any(), gomock.AssignableToTypeOf(oauth2.State{})).
+					Return(nil)
+
+				return s
+			},
 			wantOAuth2URL: "oauth2.url",
 			wantErr:       nil,
 		},
@@ -54,18 +87,45 @@ func TestManager_OAuth2URL(t *testing.T) {
 			oauth2: func(c *gomock.Controller) map[oauth2.Provider]oauth2.Client {
 				return map[oauth2.Provider]oauth2.Client{}
 			},
+			states: func(c *gomock.Controller) oauth2.StateStore {
+				return oauth2.NewMockStateStore(c)
+			},
 			wantOAuth2URL: "",
 			wantErr:       ErrInvalidOAuth2Provider,
 		},
+		"SaveUnexpectedError": {
+			provider: oauth2.Google,
+			oauth2: func(c *gomock.Controller) map[oauth2.Provider]oauth2.Client {
+				return map[oauth2.Provider]oauth2.Client{
+					oauth2.Google: oauth2.NewMockClient(c),
+				}
+			},
+			states: func(c *gomock.Controller) oauth2.StateStore {
+				s := oauth2.NewMockStateStore(c)
+
+				s.
+					EXPECT().
+					Save(gomock.Any(), gomock.Any()).
+					Return(errUnexpected)
+
+				return s
+			},
+			wantOAuth2URL: "",
+			wantErr:       errUnexpected,
+		},
 	} {
 		t.Run(name, func(t *testing.T) {
-			m := &Manager{oauth2: tt.oauth2(gomock.NewController(t))}
+			c := gomock.NewController(t)
+			m := &Manager{oauth2: tt.oauth2(c), states: tt.states(c)}
 
-			oauth2URL, err := m.OAuth2URL(tt.provider)
+			oauth2URL, state, err := m.OAuth2URL(tt.provider)
 
 			if oauth2URL != tt.wantOAuth2URL {
 				t.Errorf("want: %s, got: %s", tt.wantOAuth2URL, oauth2URL)
 			}
+			if wantState := tt.wantErr == nil; (state != "") != wantState {
+				t.Errorf("want state: %t, got: %q", wantState, state)
+			}
 			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("want: %v, got: %v", tt.wantErr, err)
 			}
@@ -81,7 +141,7 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 		state, code string
 		users       func(*gomock.Controller) UserStorage
 		oauth2      func(controller *gomock.Controller) map[oauth2.Provider]oauth2.Client
-		wantToken   oauth2.Token
+		wantSession bool
 		wantErr     error
 	}{
 		"OK_NewUserIsSignedIn": {
@@ -91,13 +151,17 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 			users: func(c *gomock.Controller) UserStorage {
 				s := NewMockUserStorage(c)
 
+				s.
+					EXPECT().
+					GetByIdentity(Identity{Provider: oauth2.Google, Subject: "subject"}).
+					Return(nil, ErrUserNotFound)
 				s.
 					EXPECT().
 					Get("x@x.x").
 					Return(nil, ErrUserNotFound)
 				s.
 					EXPECT().
-					Set(gomock.AssignableToTypeOf(&User{})).
+					Create(gomock.AssignableToTypeOf(&User{})).
 					Return(nil)
 
 				return s
@@ -107,7 +171,7 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 
 				client.
 					EXPECT().
-					Exchange(context.TODO(), "state", "code").
+					Exchange(context.TODO(), "code", "verifier").
 					Return(
 						oauth2.Token{
 							Access:   "accessToken",
@@ -124,17 +188,14 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 							Provider: oauth2.Google,
 						},
 					).
-					Return(oauth2.UserInfo{Email: "x@x.x"}, nil)
+					Return(oauth2.UserInfo{Subject: "subject", Email: "x@x.x", EmailVerified: true}, nil)
 
 				return map[oauth2.Provider]oauth2.Client{
 					oauth2.Google: client,
 				}
 			},
-			wantToken: oauth2.Token{
-				Access:   "accessToken",
-				Provider: oauth2.Google,
-			},
-			wantErr: nil,
+			wantSession: true,
+			wantErr:     nil,
 		},
 		"OK_ExistingUserIsSignedIn": {
 			provider: oauth2.Google,
@@ -142,21 +203,26 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 			code:     "code",
 			users: func(c *gomock.Controller) UserStorage {
 				s := NewMockUserStorage(c)
+				existing := &User{
+					ID:    uuid.NewString(),
+					Email: "x@x.x",
+					tokens: []oauth2.Token{
+						{Access: "accessToken", Provider: oauth2.GitHub},
+					},
+				}
 
+				s.
+					EXPECT().
+					GetByIdentity(Identity{Provider: oauth2.Google, Subject: "subject"}).
+					Return(nil, ErrUserNotFound)
 				s.
 					EXPECT().
 					Get("x@x.x").
-					Return(&User{
-						ID:    uuid.NewString(),
-						Email: "x@x.x",
-						tokens: []oauth2.Token{
-							{Access: "accessToken", Provider: oauth2.GitHub},
-						},
-					}, nil)
+					Return(existing, nil)
 				s.
 					EXPECT().
-					Set(gomock.AssignableToTypeOf(&User{})).
-					Return(nil)
+					Update(existing.ID, gomock.Any()).
+					DoAndReturn(updateUser(existing))
 
 				return s
 			},
@@ -165,7 +231,7 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 
 				client.
 					EXPECT().
-					Exchange(context.TODO(), "state", "code").
+					Exchange(context.TODO(), "code", "verifier").
 					Return(
 						oauth2.Token{
 							Access:   "newAccessToken",
@@ -182,17 +248,44 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 							Provider: oauth2.Google,
 						},
 					).
-					Return(oauth2.UserInfo{Email: "x@x.x"}, nil)
+					Return(oauth2.UserInfo{Subject: "subject", Email: "x@x.x", EmailVerified: true}, nil)
 
 				return map[oauth2.Provider]oauth2.Client{
 					oauth2.Google: client,
 				}
 			},
-			wantToken: oauth2.Token{
-				Access:   "newAccessToken",
-				Provider: oauth2.Google,
+			wantSession: true,
+			wantErr:     nil,
+		},
+		"ErrInvalidStateUnknown": {
+			provider: oauth2.Google,
+			state:    "unknown",
+			code:     "code",
+			users: func(c *gomock.Controller) UserStorage {
+				return NewMockUserStorage(c)
+			},
+			oauth2: func(c *gomock.Controller) map[oauth2.Provider]oauth2.Client {
+				return map[oauth2.Provider]oauth2.Client{
+					oauth2.Google: oauth2.NewMockClient(c),
+				}
+			},
+			wantSession: false,
+			wantErr:     oauth2.ErrInvalidState,
+		},
+		"ErrInvalidStateOtherProvider": {
+			provider: oauth2.GitHub,
+			state:    "state",
+			code:     "code",
+			users: func(c *gomock.Controller) UserStorage {
+				return NewMockUserStorage(c)
+			},
+			oauth2: func(c *gomock.Controller) map[oauth2.Provider]oauth2.Client {
+				return map[oauth2.Provider]oauth2.Client{
+					oauth2.GitHub: oauth2.NewMockClient(c),
+				}
 			},
-			wantErr: nil,
+			wantSession: false,
+			wantErr:     oauth2.ErrInvalidState,
 		},
 		"ErrInvalidOAuth2Provider": {
 			provider: oauth2.GitHub,
@@ -206,8 +299,8 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 					oauth2.Google: oauth2.NewMockClient(c),
 				}
 			},
-			wantToken: oauth2.Token{},
-			wantErr:   ErrInvalidOAuth2Provider,
+			wantSession: false,
+			wantErr:     ErrInvalidOAuth2Provider,
 		},
 		"ExchangeUnexpectedError": {
 			provider: oauth2.Google,
@@ -221,15 +314,15 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 
 				client.
 					EXPECT().
-					Exchange(context.TODO(), "state", "code").
+					Exchange(context.TODO(), "code", "verifier").
 					Return(oauth2.Token{}, errUnexpected)
 
 				return map[oauth2.Provider]oauth2.Client{
 					oauth2.Google: client,
 				}
 			},
-			wantToken: oauth2.Token{},
-			wantErr:   errUnexpected,
+			wantSession: false,
+			wantErr:     errUnexpected,
 		},
 		"UserInfoUnexpectedError": {
 			provider: oauth2.Google,
@@ -243,7 +336,7 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 
 				client.
 					EXPECT().
-					Exchange(context.TODO(), "state", "code").
+					Exchange(context.TODO(), "code", "verifier").
 					Return(
 						oauth2.Token{
 							Access:   "accessToken",
@@ -264,8 +357,8 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 					oauth2.Google: client,
 				}
 			},
-			wantToken: oauth2.Token{},
-			wantErr:   errUnexpected,
+			wantSession: false,
+			wantErr:     errUnexpected,
 		},
 		"GetUserUnexptedError": {
 			provider: oauth2.Google,
@@ -274,6 +367,10 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 			users: func(c *gomock.Controller) UserStorage {
 				s := NewMockUserStorage(c)
 
+				s.
+					EXPECT().
+					GetByIdentity(Identity{Provider: oauth2.Google, Subject: "subject"}).
+					Return(nil, ErrUserNotFound)
 				s.
 					EXPECT().
 					Get("x@x.x").
@@ -286,7 +383,7 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 
 				client.
 					EXPECT().
-					Exchange(context.TODO(), "state", "code").
+					Exchange(context.TODO(), "code", "verifier").
 					Return(
 						oauth2.Token{
 							Access:   "accessToken",
@@ -303,14 +400,14 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 							Provider: oauth2.Google,
 						},
 					).
-					Return(oauth2.UserInfo{Email: "x@x.x"}, nil)
+					Return(oauth2.UserInfo{Subject: "subject", Email: "x@x.x", EmailVerified: true}, nil)
 
 				return map[oauth2.Provider]oauth2.Client{
 					oauth2.Google: client,
 				}
 			},
-			wantToken: oauth2.Token{},
-			wantErr:   errUnexpected,
+			wantSession: false,
+			wantErr:     errUnexpected,
 		},
 		"NewUserInvalidEmailError": {
 			provider: oauth2.Google,
@@ -319,6 +416,10 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 			users: func(c *gomock.Controller) UserStorage {
 				s := NewMockUserStorage(c)
 
+				s.
+					EXPECT().
+					GetByIdentity(Identity{Provider: oauth2.Google, Subject: "subject"}).
+					Return(nil, ErrUserNotFound)
 				s.
 					EXPECT().
 					Get("x").
@@ -331,7 +432,7 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 
 				client.
 					EXPECT().
-					Exchange(context.TODO(), "state", "code").
+					Exchange(context.TODO(), "code", "verifier").
 					Return(
 						oauth2.Token{
 							Access:   "accessToken",
@@ -348,29 +449,85 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 							Provider: oauth2.Google,
 						},
 					).
-					Return(oauth2.UserInfo{Email: "x"}, nil)
+					Return(oauth2.UserInfo{Subject: "subject", Email: "x", EmailVerified: true}, nil)
 
 				return map[oauth2.Provider]oauth2.Client{
 					oauth2.Google: client,
 				}
 			},
-			wantToken: oauth2.Token{},
-			wantErr:   ErrInvalidEmail,
+			wantSession: false,
+			wantErr:     ErrInvalidEmail,
 		},
-		"SetUserUnexpectedError": {
+		"OK_ConcurrentSignUpIsSignedIn": {
 			provider: oauth2.Google,
 			state:    "state",
 			code:     "code",
 			users: func(c *gomock.Controller) UserStorage {
 				s := NewMockUserStorage(c)
+				existing := &User{ID: uuid.NewString(), Email: "x@x.x", identities: []Identity{{Provider: oauth2.Google, Subject: "subject"}}}
+
+				gomock.InOrder(
+					s.
+						EXPECT().
+						GetByIdentity(Identity{Provider: oauth2.Google, Subject: "subject"}).
+						Return(nil, ErrUserNotFound),
+					s.
+						EXPECT().
+						Get("x@x.x").
+						Return(nil, ErrUserNotFound),
+					s.
+						EXPECT().
+						Create(gomock.AssignableToTypeOf(&User{})).
+						Return(ErrUserExists),
+					s.
+						EXPECT().
+						GetByIdentity(Identity{Provider: oauth2.Google, Subject: "subject"}).
+						Return(existing, nil),
+					s.
+						EXPECT().
+						Update(existing.ID, gomock.Any()).
+						DoAndReturn(updateUser(existing)),
+				)
 
+				return s
+			},
+			oauth2: func(c *gomock.Controller) map[oauth2.Provider]oauth2.Client {
+				client := oauth2.NewMockClient(c)
+
+				client.
+					EXPECT().
+					Exchange(context.TODO(), "code", "verifier").
+					Return(oauth2.Token{Access: "accessToken", Provider: oauth2.Google}, nil)
+				client.
+					EXPECT().
+					UserInfo(context.TODO(), oauth2.Token{Access: "accessToken", Provider: oauth2.Google}).
+					Return(oauth2.UserInfo{Subject: "subject", Email: "x@x.x", EmailVerified: true}, nil)
+
+				return map[oauth2.Provider]oauth2.Client{
+					oauth2.Google: client,
+				}
+			},
+			wantSession: true,
+			wantErr:     nil,
+		},
+		"CreateUserUnexpectedError": {
+			provider: oauth2.Google,
+			state:    "state",
+			code:     "code",
+			users: func(c *gomock.Controller) UserStorage {
+				s := NewMockUserStorage(c)
+
+				s.
+					EXPECT().
+					GetByIdentity(Identity{Provider: oauth2.Google, Subject: "subject"}).
+					Return(nil, ErrUserNotFound)
 				s.
 					EXPECT().
 					Get("x@x.x").
 					Return(nil, ErrUserNotFound)
 				s.
 					EXPECT().
-					Set(gomock.AssignableToTypeOf(&User{})).
+					Create(gomock.AssignableToTypeOf(&User{})).
 					Return(errUnexpected)
 
 				return s
@@ -380,7 +537,7 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 
 				client.
 					EXPECT().
-					Exchange(context.TODO(), "state", "code").
+					Exchange(context.TODO(), "code", "verifier").
 					Return(
 						oauth2.Token{
 							Access:   "accessToken",
@@ -397,27 +554,255 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 							Provider: oauth2.Google,
 						},
 					).
-					Return(oauth2.UserInfo{Email: "x@x.x"}, nil)
+					Return(oauth2.UserInfo{Subject: "subject", Email: "x@x.x", EmailVerified: true}, nil)
 
 				return map[oauth2.Provider]oauth2.Client{
 					oauth2.Google: client,
 				}
 			},
-			wantToken: oauth2.Token{},
-			wantErr:   errUnexpected,
+			wantSession: false,
+			wantErr:     errUnexpected,
 		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			c := gomock.NewController(t)
+			states := oauth2.NewMemoryStateStore(time.Minute)
+			if err := states.Save("state", oauth2.State{Provider: oauth2.Google, Verifier: "verifier"}); err != nil {
+				t.Fatal(err)
+			}
 			m := &Manager{
-				users:  tt.users(c),
-				oauth2: tt.oauth2(c),
+				users:    tt.users(c),
+				oauth2:   tt.oauth2(c),
+				states:   states,
+				sessions: testSessions(t),
+			}
+
+			session, err := m.SignInWithOAuth2(context.TODO(), tt.provider, tt.state, tt.code)
+
+			if got := session != (Session{}); got != tt.wantSession {
+				t.Errorf("want session: %t, got: %+v", tt.wantSession, session)
+			}
+			if tt.wantSession {
+				if _, err := m.sessions.verify(session.AccessToken, accessToken); err != nil {
+					t.Errorf("want valid access token, got: %v", err)
+				}
+				if _, err := m.sessions.verify(session.RefreshToken, refreshToken); err != nil {
+					t.Errorf("want valid refresh token, got: %v", err)
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestManager_Authenticate(t *testing.T) {
+	errUnexpected := errors.New("unexpected error")
+	sessions := testSessions(t)
+	session, err := sessions.issue(&User{ID: "x-x-x-x-x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := map[string]time.Time{session.ID: time.Now().Add(time.Hour)}
+
+	for name, tt := range map[string]struct {
+		token    string
+		users    func(*gomock.Controller) UserStorage
+		wantUser *User
+		wantErr  error
+	}{
+		"OK": {
+			token: session.AccessToken,
+			users: func(c *gomock.Controller) UserStorage {
+				s := NewMockUserStorage(c)
+				s.
+					EXPECT().
+					GetByID("x-x-x-x-x").
+					Return(&User{ID: "x-x-x-x-x", Email: "x@x.x", sessions: active}, nil)
+				return s
+			},
+			wantUser: &User{ID: "x-x-x-x-x", Email: "x@x.x", sessions: active},
+			wantErr:  nil,
+		},
+		"ErrInvalidTokenEndedSession": {
+			token: session.AccessToken,
+			users: func(c *gomock.Controller) UserStorage {
+				s := NewMockUserStorage(c)
+				s.
+					EXPECT().
+					GetByID("x-x-x-x-x").
+					Return(&User{ID: "x-x-x-x-x", Email: "x@x.x"}, nil)
+				return s
+			},
+			wantUser: nil,
+			wantErr:  ErrInvalidToken,
+		},
+		"ErrInvalidTokenEmpty": {
+			token: "",
+			users: func(c *gomock.Controller) UserStorage {
+				return NewMockUserStorage(c)
+			},
+			wantUser: nil,
+			wantErr:  ErrInvalidToken,
+		},
+		"ErrInvalidTokenRefreshToken": {
+			token: session.RefreshToken,
+			users: func(c *gomock.Controller) UserStorage {
+				return NewMockUserStorage(c)
+			},
+			wantUser: nil,
+			wantErr:  ErrInvalidToken,
+		},
+		"ErrInvalidTokenUserNotFound": {
+			token: session.AccessToken,
+			users: func(c *gomock.Controller) UserStorage {
+				s := NewMockUserStorage(c)
+				s.
+					EXPECT().
+					GetByID("x-x-x-x-x").
+					Return(nil, ErrUserNotFound)
+				return s
+			},
+			wantUser: nil,
+			wantErr:  ErrInvalidToken,
+		},
+		"ErrUnexpected": {
+			token: session.AccessToken,
+			users: func(c *gomock.Controller) UserStorage {
+				s := NewMockUserStorage(c)
+				s.
+					EXPECT().
+					GetByID("x-x-x-x-x").
+					Return(nil, errUnexpected)
+				return s
+			},
+			wantUser: nil,
+			wantErr:  errUnexpected,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := &Manager{users: tt.users(gomock.NewController(t)), sessions: sessions}
+
+			u, err := m.Authenticate(tt.token)
+
+			if !reflect.DeepEqual(u, tt.wantUser) {
+				t.Errorf("want: %+v, got: %+v", tt.wantUser, u)
 			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
 
-			token, err := m.SignInWithOAuth2(context.TODO(), tt.provider, tt.state, tt.code)
+func TestManager_Refresh(t *testing.T) {
+	errUnexpected := errors.New("unexpected error")
+	sessions := testSessions(t)
+	session, err := sessions.issue(&User{ID: "x-x-x-x-x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := map[string]time.Time{session.ID: time.Now().Add(time.Hour)}
 
-			if token != tt.wantToken {
-				t.Errorf("want: %+v, got: %+v", tt.wantToken, token)
+	for name, tt := range map[string]struct {
+		token       string
+		users       func(*gomock.Controller) UserStorage
+		wantSession bool
+		wantErr     error
+	}{
+		"OK": {
+			token: session.RefreshToken,
+			users: func(c *gomock.Controller) UserStorage {
+				s := NewMockUserStorage(c)
+				s.
+					EXPECT().
+					GetByID("x-x-x-x-x").
+					Return(&User{ID: "x-x-x-x-x", Email: "x@x.x", sessions: active}, nil)
+				s.
+					EXPECT().
+					Update("x-x-x-x-x", gomock.Any()).
+					DoAndReturn(updateUser(&User{ID: "x-x-x-x-x", Email: "x@x.x", sessions: map[string]time.Time{session.ID: time.Now().Add(time.Hour)}}))
+				return s
+			},
+			wantSession: true,
+			wantErr:     nil,
+		},
+		"ErrInvalidTokenRefreshedConcurrently": {
+			token: session.RefreshToken,
+			users: func(c *gomock.Controller) UserStorage {
+				s := NewMockUserStorage(c)
+				s.
+					EXPECT().
+					GetByID("x-x-x-x-x").
+					Return(&User{ID: "x-x-x-x-x", Email: "x@x.x", sessions: active}, nil)
+				s.
+					EXPECT().
+					Update("x-x-x-x-x", gomock.Any()).
+					DoAndReturn(updateUser(&User{ID: "x-x-x-x-x", Email: "x@x.x"}))
+				return s
+			},
+			wantSession: false,
+			wantErr:     ErrInvalidToken,
+		},
+		"ErrInvalidTokenEndedSession": {
+			token: session.RefreshToken,
+			users: func(c *gomock.Controller) UserStorage {
+				s := NewMockUserStorage(c)
+				s.
+					EXPECT().
+					GetByID("x-x-x-x-x").
+					Return(&User{ID: "x-x-x-x-x", Email: "x@x.x"}, nil)
+				return s
+			},
+			wantSession: false,
+			wantErr:     ErrInvalidToken,
+		},
+		"ErrInvalidTokenAccessToken": {
+			token: session.AccessToken,
+			users: func(c *gomock.Controller) UserStorage {
+				return NewMockUserStorage(c)
+			},
+			wantSession: false,
+			wantErr:     ErrInvalidToken,
+		},
+		"ErrInvalidTokenUserNotFound": {
+			token: session.RefreshToken,
+			users: func(c *gomock.Controller) UserStorage {
+				s := NewMockUserStorage(c)
+				s.
+					EXPECT().
+					GetByID("x-x-x-x-x").
+					Return(nil, ErrUserNotFound)
+				return s
+			},
+			wantSession: false,
+			wantErr:     ErrInvalidToken,
+		},
+		"ErrUnexpected": {
+			token: session.RefreshToken,
+			users: func(c *gomock.Controller) UserStorage {
+				s := NewMockUserStorage(c)
+				s.
+					EXPECT().
+					GetByID("x-x-x-x-x").
+					Return(nil, errUnexpected)
+				return s
+			},
+			wantSession: false,
+			wantErr:     errUnexpected,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := &Manager{users: tt.users(gomock.NewController(t)), sessions: sessions}
+
+			got, err := m.Refresh(tt.token)
+
+			if ok := got != (Session{}); ok != tt.wantSession {
+				t.Errorf("want session: %t, got: %+v", tt.wantSession, got)
+			}
+			if tt.wantSession && got.RefreshToken == session.RefreshToken {
+				t.Error("want new refresh token")
 			}
 			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("want: %v, got: %v", tt.wantErr, err)
@@ -425,3 +810,160 @@ func TestManager_SignInWithOAuth2(t *testing.T) {
 		})
 	}
 }
+
+// updateUser returns an implementation of UserStorage.Update that applies the
+// update to the user.
+func updateUser(u *User) func(string, func(*User) error) error {
+	return func(_ string, f func(*User) error) error {
+		return f(u)
+	}
+}
+
+func TestManager_sessions(t *testing.T) {
+	users := NewUserMemoryStorage()
+	m := &Manager{users: users, oauth2: map[oauth2.Provider]oauth2.Client{}, sessions: testSessions(t)}
+
+	u, err := NewUser("x@x.x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+
+	start := func() Session {
+		t.Helper()
+
+		s, err := m.startSession(u.ID, func(*User) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	valid := func(s Session) bool {
+		_, err := m.Authenticate(s.AccessToken)
+		return err == nil
+	}
+
+	first, second := start(), start()
+	if !valid(first) || !valid(second) {
+		t.Fatal("want started sessions valid")
+	}
+
+	refreshed, err := m.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if valid(first) || !valid(refreshed) {
+		t.Error("want refreshed session to replace the old one")
+	}
+	if _, err = m.Refresh(first.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("want reused refresh token: %v, got: %v", ErrInvalidToken, err)
+	}
+
+	if err = m.Logout(refreshed.AccessToken); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if valid(refreshed) || !valid(second) {
+		t.Error("want logout to end only the current session")
+	}
+
+	third := start()
+	if err = m.LogoutAll(context.TODO(), u.ID); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if valid(second) || valid(third) {
+		t.Error("want logout of all sessions to end every session")
+	}
+	if _, err = m.Refresh(third.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("want refresh after logout: %v, got: %v", ErrInvalidToken, err)
+	}
+
+	fourth := start()
+	if err = m.RevokeSessions(u.ID); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if valid(fourth) {
+		t.Error("want revoked sessions to end")
+	}
+}
+
+func TestManager_sessions_concurrent(t *testing.T) {
+	users := NewUserMemoryStorage()
+	m := &Manager{users: users, sessions: testSessions(t)}
+
+	u, err := NewUser("x@x.x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	first, err := m.startSession(u.ID, func(*User) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 10
+	sessions := make([]Session, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			sessions[i], _ = m.startSession(u.ID, func(*User) error { return nil })
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, _ = m.Authenticate(first.AccessToken)
+		}()
+	}
+	wg.Wait()
+
+	for i, s := range sessions {
+		if _, err = m.Authenticate(s.AccessToken); err != nil {
+			t.Errorf("want session %d kept: <nil>, got: %v", i, err)
+		}
+	}
+}
+
+func TestManager_DeleteUser(t *testing.T) {
+	for name, tt := range map[string]struct {
+		revokeErr error
+		wantErr   error
+	}{
+		"OK": {
+			revokeErr: nil,
+			wantErr:   nil,
+		},
+		"ErrRevokeFailed": {
+			revokeErr: oauth2.ErrRevokeFailed,
+			wantErr:   oauth2.ErrRevokeFailed,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			users := NewUserMemoryStorage()
+			token := oauth2.Token{Access: "accessToken", Provider: oauth2.Google}
+			u := &User{ID: "x-x-x-x-x", Email: "x@x.x", tokens: []oauth2.Token{token}}
+			if err := users.Create(u); err != nil {
+				t.Fatal(err)
+			}
+
+			client := oauth2.NewMockClient(gomock.NewController(t))
+			client.EXPECT().Revoke(context.TODO(), token).Return(tt.revokeErr)
+			m := &Manager{users: users, oauth2: map[oauth2.Provider]oauth2.Client{oauth2.Google: client}}
+
+			if err := m.DeleteUser(context.TODO(), u.ID); !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if _, err := users.GetByID(u.ID); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("want: %v, got: %v", ErrUserNotFound, err)
+			}
+		})
+	}
+
+	m := &Manager{users: NewUserMemoryStorage()}
+	if err := m.DeleteUser(context.TODO(), "x-x-x-x-x"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("want: %v, got: %v", ErrUserNotFound, err)
+	}
+}
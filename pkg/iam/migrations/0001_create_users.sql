@@ -0,0 +1,5 @@
+CREATE TABLE users (
+    id    UUID  PRIMARY KEY,
+    email TEXT  NOT NULL UNIQUE,
+    data  JSONB NOT NULL DEFAULT '{}'
+);
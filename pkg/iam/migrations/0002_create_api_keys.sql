@@ -0,0 +1,12 @@
+CREATE TABLE api_keys (
+    id         TEXT        PRIMARY KEY,
+    user_id    UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       TEXT        NOT NULL,
+    hash       BYTEA       NOT NULL,
+    scope      TEXT        NOT NULL,
+    prefixes   JSONB       NOT NULL DEFAULT '[]',
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX api_keys_user_id ON api_keys (user_id);
@@ -0,0 +1,2 @@
+-- Users that signed up before roles existed keep using the API as editors.
+UPDATE users SET data = jsonb_set(data, '{roles}', '["editor"]') WHERE NOT data ? 'roles';
@@ -0,0 +1 @@
+CREATE INDEX users_identities ON users USING GIN ((data->'identities') jsonb_path_ops);
@@ -0,0 +1,9 @@
+CREATE TABLE invitations (
+    id         TEXT        PRIMARY KEY,
+    email      TEXT        NOT NULL,
+    role       TEXT        NOT NULL,
+    hash       BYTEA       NOT NULL,
+    created_by TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
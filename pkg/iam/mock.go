@@ -33,6 +33,62 @@ func (m *MockUserStorage) EXPECT() *MockUserStorageMockRecorder {
 	return m.recorder
 }
 
+// Create mocks base method.
+func (m *MockUserStorage) Create(user *User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockUserStorageMockRecorder) Create(user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockUserStorage)(nil).Create), user)
+}
+
+// Delete mocks base method.
+func (m *MockUserStorage) Delete(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockUserStorageMockRecorder) Delete(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockUserStorage)(nil).Delete), id)
+}
+
+// DeleteAPIKey mocks base method.
+func (m *MockUserStorage) DeleteAPIKey(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAPIKey", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAPIKey indicates an expected call of DeleteAPIKey.
+func (mr *MockUserStorageMockRecorder) DeleteAPIKey(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAPIKey", reflect.TypeOf((*MockUserStorage)(nil).DeleteAPIKey), id)
+}
+
+// DeleteInvitation mocks base method.
+func (m *MockUserStorage) DeleteInvitation(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteInvitation", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteInvitation indicates an expected call of DeleteInvitation.
+func (mr *MockUserStorageMockRecorder) DeleteInvitation(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteInvitation", reflect.TypeOf((*MockUserStorage)(nil).DeleteInvitation), id)
+}
+
 // Get mocks base method.
 func (m *MockUserStorage) Get(email string) (*User, error) {
 	m.ctrl.T.Helper()
@@ -48,16 +104,149 @@ func (mr *MockUserStorageMockRecorder) Get(email interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockUserStorage)(nil).Get), email)
 }
 
-// Set mocks base method.
-func (m *MockUserStorage) Set(user *User) error {
+// GetAPIKey mocks base method.
+func (m *MockUserStorage) GetAPIKey(id string) (*APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKey", id)
+	ret0, _ := ret[0].(*APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKey indicates an expected call of GetAPIKey.
+func (mr *MockUserStorageMockRecorder) GetAPIKey(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKey", reflect.TypeOf((*MockUserStorage)(nil).GetAPIKey), id)
+}
+
+// GetByID mocks base method.
+func (m *MockUserStorage) GetByID(id string) (*User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByID", id)
+	ret0, _ := ret[0].(*User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByID indicates an expected call of GetByID.
+func (mr *MockUserStorageMockRecorder) GetByID(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockUserStorage)(nil).GetByID), id)
+}
+
+// GetByIdentity mocks base method.
+func (m *MockUserStorage) GetByIdentity(identity Identity) (*User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByIdentity", identity)
+	ret0, _ := ret[0].(*User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByIdentity indicates an expected call of GetByIdentity.
+func (mr *MockUserStorageMockRecorder) GetByIdentity(identity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByIdentity", reflect.TypeOf((*MockUserStorage)(nil).GetByIdentity), identity)
+}
+
+// GetInvitation mocks base method.
+func (m *MockUserStorage) GetInvitation(id string) (*Invitation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInvitation", id)
+	ret0, _ := ret[0].(*Invitation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInvitation indicates an expected call of GetInvitation.
+func (mr *MockUserStorageMockRecorder) GetInvitation(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInvitation", reflect.TypeOf((*MockUserStorage)(nil).GetInvitation), id)
+}
+
+// List mocks base method.
+func (m *MockUserStorage) List(opts UserListOptions) (*UserPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", opts)
+	ret0, _ := ret[0].(*UserPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockUserStorageMockRecorder) List(opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockUserStorage)(nil).List), opts)
+}
+
+// ListAPIKeys mocks base method.
+func (m *MockUserStorage) ListAPIKeys(userID string) ([]*APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAPIKeys", userID)
+	ret0, _ := ret[0].([]*APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAPIKeys indicates an expected call of ListAPIKeys.
+func (mr *MockUserStorageMockRecorder) ListAPIKeys(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAPIKeys", reflect.TypeOf((*MockUserStorage)(nil).ListAPIKeys), userID)
+}
+
+// ListInvitations mocks base method.
+func (m *MockUserStorage) ListInvitations() ([]*Invitation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListInvitations")
+	ret0, _ := ret[0].([]*Invitation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListInvitations indicates an expected call of ListInvitations.
+func (mr *MockUserStorageMockRecorder) ListInvitations() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListInvitations", reflect.TypeOf((*MockUserStorage)(nil).ListInvitations))
+}
+
+// SetAPIKey mocks base method.
+func (m *MockUserStorage) SetAPIKey(key *APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAPIKey", key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetAPIKey indicates an expected call of SetAPIKey.
+func (mr *MockUserStorageMockRecorder) SetAPIKey(key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAPIKey", reflect.TypeOf((*MockUserStorage)(nil).SetAPIKey), key)
+}
+
+// SetInvitation mocks base method.
+func (m *MockUserStorage) SetInvitation(invitation *Invitation) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetInvitation", invitation)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetInvitation indicates an expected call of SetInvitation.
+func (mr *MockUserStorageMockRecorder) SetInvitation(invitation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetInvitation", reflect.TypeOf((*MockUserStorage)(nil).SetInvitation), invitation)
+}
+
+// Update mocks base method.
+func (m *MockUserStorage) Update(id string, f func(*User) error) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Set", user)
+	ret := m.ctrl.Call(m, "Update", id, f)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// Set indicates an expected call of Set.
-func (mr *MockUserStorageMockRecorder) Set(user interface{}) *gomock.Call {
+// Update indicates an expected call of Update.
+func (mr *MockUserStorageMockRecorder) Update(id, f interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockUserStorage)(nil).Set), user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockUserStorage)(nil).Update), id, f)
 }
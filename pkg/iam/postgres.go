@@ -0,0 +1,472 @@
+package iam
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"counters/pkg/oauth2"
+	"counters/pkg/postgres"
+)
+
+//go:embed migrations/*.sql
+var PostgresMigrations embed.FS
+
+type UserPostgresStorage struct {
+	db   *sql.DB
+	keys *TokenKeys
+}
+
+// NewUserPostgresStorage returns a storage that encrypts provider tokens with
+// the keys. Without keys tokens are stored in plain.
+func NewUserPostgresStorage(db *sql.DB, keys *TokenKeys) *UserPostgresStorage {
+	return &UserPostgresStorage{db: db, keys: keys}
+}
+
+// userData holds the user fields that are stored in the data column. Tokens
+// are only stored in plain without token keys.
+type userData struct {
+	Tokens          []oauth2.Token       `json:"tokens"`
+	EncryptedTokens *encryptedTokens     `json:"encrypted_tokens,omitempty"`
+	Sessions        map[string]time.Time `json:"sessions,omitempty"`
+	Roles           []Role               `json:"roles,omitempty"`
+	Identities      []Identity           `json:"identities,omitempty"`
+}
+
+func (s *UserPostgresStorage) marshal(user *User) ([]byte, error) {
+	d := userData{Tokens: user.tokens, Sessions: user.sessions, Roles: user.Roles(), Identities: user.identities}
+	if s.keys != nil && len(user.tokens) > 0 {
+		e, err := s.keys.encrypt(user.ID, user.tokens)
+		if err != nil {
+			return nil, err
+		}
+		d.Tokens, d.EncryptedTokens = []oauth2.Token{}, e
+	}
+
+	return json.Marshal(d)
+}
+
+func (s *UserPostgresStorage) Create(user *User) error {
+	data, err := s.marshal(user)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.Exec(
+		`INSERT INTO users (id, email, data) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		user.ID, user.Email, data,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserExists
+	}
+
+	return nil
+}
+
+// Update reads the user, applies f and writes it back only if the data column
+// has not changed in between. Otherwise it starts over with the user as the
+// concurrent update left it.
+func (s *UserPostgresStorage) Update(id string, f func(*User) error) error {
+	for {
+		u, data, err := s.scanUser(s.db.QueryRow(`SELECT id, email, data FROM users WHERE id = $1`, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = f(u); err != nil {
+			return err
+		}
+
+		updated, err := s.marshal(u)
+		if err != nil {
+			return err
+		}
+
+		res, err := s.db.Exec(`UPDATE users SET data = $2 WHERE id = $1 AND data = $3`, u.ID, updated, data)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return nil
+		}
+	}
+}
+
+func (s *UserPostgresStorage) Get(email string) (*User, error) {
+	return s.get(`SELECT id, email, data FROM users WHERE email = $1`, email)
+}
+
+func (s *UserPostgresStorage) GetByID(id string) (*User, error) {
+	return s.get(`SELECT id, email, data FROM users WHERE id = $1`, id)
+}
+
+func (s *UserPostgresStorage) GetByIdentity(identity Identity) (*User, error) {
+	i, err := json.Marshal([]Identity{identity})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.get(`SELECT id, email, data FROM users WHERE data->'identities' @> $1`, string(i))
+}
+
+func (s *UserPostgresStorage) get(query string, args ...any) (*User, error) {
+	u, _, err := s.scanUser(s.db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+
+	return u, err
+}
+
+// scanUser returns the user along with the data column it was read from.
+func (s *UserPostgresStorage) scanUser(row interface{ Scan(dest ...any) error }) (*User, []byte, error) {
+	var (
+		u    User
+		data []byte
+	)
+
+	if err := row.Scan(&u.ID, &u.Email, &data); err != nil {
+		return nil, nil, err
+	}
+
+	var d userData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, nil, err
+	}
+	u.tokens, u.sessions, u.identities = d.Tokens, d.Sessions, d.Identities
+	for _, r := range d.Roles {
+		u.AddRole(r)
+	}
+
+	if d.EncryptedTokens != nil {
+		tokens, err := s.keys.decrypt(u.ID, d.EncryptedTokens)
+		if err != nil {
+			return nil, nil, err
+		}
+		u.tokens = tokens
+	}
+
+	return &u, data, nil
+}
+
+func (s *UserPostgresStorage) List(opts UserListOptions) (*UserPage, error) {
+	opts, after, err := parseUserListOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := "%" + postgres.EscapeLike(opts.Email) + "%"
+
+	page := &UserPage{}
+	err = s.db.QueryRow(`SELECT count(*) FROM users WHERE email ILIKE $1`, pattern).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(
+		`SELECT id, email, data FROM users WHERE email ILIKE $1 AND email > $2 ORDER BY email LIMIT $3`,
+		pattern, after, opts.Limit+1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		u, _, err := s.scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Users = append(page.Users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return paginateUsers(page, opts), nil
+}
+
+// ReencryptTokens encrypts the tokens of the users that are stored in plain
+// or with another key than the primary one, batch users at a time, and
+// returns the number of users it has updated. Users that are updated
+// concurrently are left to that update.
+func (s *UserPostgresStorage) ReencryptTokens(ctx context.Context, batch int) (int, error) {
+	if s.keys == nil {
+		return 0, nil
+	}
+
+	var n int
+	after := ""
+	for {
+		users, data, err := s.staleTokenUsers(ctx, after, batch)
+		if err != nil {
+			return n, err
+		}
+		if len(users) == 0 {
+			return n, nil
+		}
+
+		for i, u := range users {
+			updated, err := s.marshal(u)
+			if err != nil {
+				return n, err
+			}
+
+			res, err := s.db.ExecContext(ctx, `UPDATE users SET data = $2 WHERE id = $1 AND data = $3`, u.ID, updated, data[i])
+			if err != nil {
+				return n, err
+			}
+			rows, err := res.RowsAffected()
+			if err != nil {
+				return n, err
+			}
+			n += int(rows)
+		}
+		after = users[len(users)-1].ID
+	}
+}
+
+// staleTokenUsers returns the users after the ID whose tokens are not
+// encrypted with the primary key, along with their data columns.
+func (s *UserPostgresStorage) staleTokenUsers(ctx context.Context, after string, limit int) ([]*User, [][]byte, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT id, email, data FROM users
+		WHERE id::text > $1
+		AND COALESCE(data->'encrypted_tokens'->>'kid', '') <> $2
+		AND (data->'encrypted_tokens' IS NOT NULL OR COALESCE(data->'tokens', '[]') NOT IN ('[]', 'null'))
+		ORDER BY id::text LIMIT $3`,
+		after, s.keys.Primary(), limit,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var (
+		users []*User
+		data  [][]byte
+	)
+	for rows.Next() {
+		u, d, err := s.scanUser(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		users, data = append(users, u), append(data, d)
+	}
+
+	return users, data, rows.Err()
+}
+
+// Delete deletes the user. Its API keys are deleted by the database.
+func (s *UserPostgresStorage) Delete(id string) error {
+	res, err := s.db.Exec(`DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+const apiKeyColumns = "id, user_id, name, hash, scope, prefixes, created_at, expires_at"
+
+func (s *UserPostgresStorage) SetAPIKey(key *APIKey) error {
+	p := key.Prefixes
+	if p == nil {
+		p = []string{}
+	}
+
+	prefixes, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	var expiresAt sql.NullTime
+	if !key.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: key.ExpiresAt, Valid: true}
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, scope = EXCLUDED.scope,
+		prefixes = EXCLUDED.prefixes, expires_at = EXCLUDED.expires_at`,
+		key.ID, key.UserID, key.Name, key.hash, string(key.Scope), prefixes, key.CreatedAt, expiresAt,
+	)
+
+	return err
+}
+
+func (s *UserPostgresStorage) GetAPIKey(id string) (*APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return key, err
+}
+
+func (s *UserPostgresStorage) ListAPIKeys(userID string) ([]*APIKey, error) {
+	rows, err := s.db.Query(
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 ORDER BY created_at, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *UserPostgresStorage) DeleteAPIKey(id string) error {
+	res, err := s.db.Exec(`DELETE FROM api_keys WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (*APIKey, error) {
+	var (
+		key       APIKey
+		scope     string
+		prefixes  []byte
+		expiresAt sql.NullTime
+	)
+
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.hash, &scope, &prefixes, &key.CreatedAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scope = Scope(scope)
+	key.ExpiresAt = expiresAt.Time
+	if err = json.Unmarshal(prefixes, &key.Prefixes); err != nil {
+		return nil, err
+	}
+	if len(key.Prefixes) == 0 {
+		key.Prefixes = nil
+	}
+
+	return &key, nil
+}
+
+const invitationColumns = "id, email, role, hash, created_by, created_at, expires_at"
+
+func (s *UserPostgresStorage) SetInvitation(invitation *Invitation) error {
+	_, err := s.db.Exec(
+		`INSERT INTO invitations (`+invitationColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET role = EXCLUDED.role, expires_at = EXCLUDED.expires_at`,
+		invitation.ID, invitation.Email, string(invitation.Role), invitation.hash,
+		invitation.CreatedBy, invitation.CreatedAt, invitation.ExpiresAt,
+	)
+
+	return err
+}
+
+func (s *UserPostgresStorage) GetInvitation(id string) (*Invitation, error) {
+	invitation, err := scanInvitation(s.db.QueryRow(`SELECT `+invitationColumns+` FROM invitations WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	}
+
+	return invitation, err
+}
+
+func (s *UserPostgresStorage) ListInvitations() ([]*Invitation, error) {
+	rows, err := s.db.Query(`SELECT ` + invitationColumns + ` FROM invitations ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := make([]*Invitation, 0)
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+func (s *UserPostgresStorage) DeleteInvitation(id string) error {
+	res, err := s.db.Exec(`DELETE FROM invitations WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+func scanInvitation(row interface{ Scan(dest ...any) error }) (*Invitation, error) {
+	var (
+		invitation Invitation
+		role       string
+	)
+
+	err := row.Scan(
+		&invitation.ID, &invitation.Email, &role, &invitation.hash,
+		&invitation.CreatedBy, &invitation.CreatedAt, &invitation.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	invitation.Role = Role(role)
+
+	return &invitation, nil
+}
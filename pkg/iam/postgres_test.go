@@ -0,0 +1,512 @@
+package iam
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"counters/pkg/oauth2"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newTestUserPostgresStorage(t *testing.T) (*UserPostgresStorage, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, m, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := m.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	return NewUserPostgresStorage(db, nil), m
+}
+
+func TestUserPostgresStorage_Create(t *testing.T) {
+	s, m := newTestUserPostgresStorage(t)
+	m.
+		ExpectExec(`INSERT INTO users`).
+		WithArgs("x-x-x-x-x", "x@x.x", []byte(`{"tokens":[{"access":"accessToken","refresh":"refreshToken","type":"Bearer","expiry":"2023-01-01T00:00:00Z","provider":1}]}`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.Create(&User{
+		ID:    "x-x-x-x-x",
+		Email: "x@x.x",
+		tokens: []oauth2.Token{{
+			Access:   "accessToken",
+			Refresh:  "refreshToken",
+			Type:     "Bearer",
+			Expiry:   time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			Provider: oauth2.Google,
+		}},
+	})
+
+	if err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+}
+
+func TestUserPostgresStorage_Create_exists(t *testing.T) {
+	s, m := newTestUserPostgresStorage(t)
+	m.
+		ExpectExec(`INSERT INTO users .* ON CONFLICT DO NOTHING`).
+		WithArgs("x-x-x-x-x", "x@x.x", &dataArg{}).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := s.Create(&User{ID: "x-x-x-x-x", Email: "x@x.x"})
+
+	if !errors.Is(err, ErrUserExists) {
+		t.Errorf("want: %v, got: %v", ErrUserExists, err)
+	}
+}
+
+// dataArg matches any data column and keeps it.
+type dataArg struct {
+	data []byte
+}
+
+func (a *dataArg) Match(v driver.Value) bool {
+	a.data, _ = v.([]byte)
+	return a.data != nil
+}
+
+func TestUserPostgresStorage_Create_encrypted(t *testing.T) {
+	db, m, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := NewUserPostgresStorage(db, testTokenKeys(t, "key", "key"))
+
+	user := &User{
+		ID:     "x-x-x-x-x",
+		Email:  "x@x.x",
+		tokens: []oauth2.Token{{Access: "accessToken", Provider: oauth2.Google}},
+	}
+
+	data := &dataArg{}
+	m.ExpectExec(`INSERT INTO users`).WithArgs(user.ID, user.Email, data).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err = s.Create(user); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if bytes.Contains(data.data, []byte("accessToken")) || !bytes.Contains(data.data, []byte(`"tokens":[]`)) {
+		t.Errorf("want tokens encrypted, got: %s", data.data)
+	}
+
+	m.
+		ExpectQuery(`SELECT id, email, data FROM users WHERE email = \$1`).
+		WithArgs(user.Email).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "data"}).AddRow(user.ID, user.Email, data.data))
+	u, err := s.Get(user.Email)
+	if err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+	if !reflect.DeepEqual(u.tokens, user.tokens) {
+		t.Errorf("want: %+v, got: %+v", user.tokens, u.tokens)
+	}
+
+	if err = m.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUserPostgresStorage_ReencryptTokens(t *testing.T) {
+	db, m, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := NewUserPostgresStorage(db, testTokenKeys(t, "key", "key"))
+
+	plain := []byte(`{"tokens":[{"access":"accessToken","provider":1}]}`)
+	columns := []string{"id", "email", "data"}
+
+	m.
+		ExpectQuery(`SELECT id, email, data FROM users WHERE id::text > \$1`).
+		WithArgs("", "key", 1).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("x-x-x-x-x", "x@x.x", plain))
+	m.
+		ExpectExec(`UPDATE users SET data = \$2 WHERE id = \$1 AND data = \$3`).
+		WithArgs("x-x-x-x-x", &dataArg{}, plain).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	m.
+		ExpectQuery(`SELECT id, email, data FROM users WHERE id::text > \$1`).
+		WithArgs("x-x-x-x-x", "key", 1).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	n, err := s.ReencryptTokens(context.TODO(), 1)
+
+	if n != 1 || err != nil {
+		t.Errorf("want: 1, <nil>, got: %d, %v", n, err)
+	}
+	if err = m.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUserPostgresStorage_Update(t *testing.T) {
+	s, m := newTestUserPostgresStorage(t)
+
+	stale := []byte(`{"tokens":[],"roles":["viewer"]}`)
+	current := []byte(`{"tokens":[],"sessions":{"s":"2030-01-01T00:00:00Z"},"roles":["viewer"]}`)
+	columns := []string{"id", "email", "data"}
+	data := &dataArg{}
+
+	m.
+		ExpectQuery(`SELECT id, email, data FROM users WHERE id = \$1`).
+		WithArgs("x-x-x-x-x").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("x-x-x-x-x", "x@x.x", stale))
+	m.
+		ExpectExec(`UPDATE users SET data = \$2 WHERE id = \$1 AND data = \$3`).
+		WithArgs("x-x-x-x-x", &dataArg{}, stale).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	m.
+		ExpectQuery(`SELECT id, email, data FROM users WHERE id = \$1`).
+		WithArgs("x-x-x-x-x").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("x-x-x-x-x", "x@x.x", current))
+	m.
+		ExpectExec(`UPDATE users SET data = \$2 WHERE id = \$1 AND data = \$3`).
+		WithArgs("x-x-x-x-x", data, current).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.Update("x-x-x-x-x", func(u *User) error {
+		u.AddRole(RoleAdmin)
+		return nil
+	})
+
+	if err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+	want := `{"tokens":[],"sessions":{"s":"2030-01-01T00:00:00Z"},"roles":["admin","viewer"]}`
+	if string(data.data) != want {
+		t.Errorf("want: %s, got: %s", want, data.data)
+	}
+}
+
+func TestUserPostgresStorage_Update_notFound(t *testing.T) {
+	s, m := newTestUserPostgresStorage(t)
+	m.
+		ExpectQuery(`SELECT id, email, data FROM users WHERE id = \$1`).
+		WithArgs("x-x-x-x-x").
+		WillReturnError(sql.ErrNoRows)
+
+	err := s.Update("x-x-x-x-x", func(*User) error {
+		t.Error("want no update of a missing user")
+		return nil
+	})
+
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("want: %v, got: %v", ErrUserNotFound, err)
+	}
+}
+
+func TestUserPostgresStorage_Get(t *testing.T) {
+	for name, tt := range map[string]struct {
+		mock     func(sqlmock.Sqlmock)
+		wantUser *User
+		wantErr  error
+	}{
+		"OK": {
+			mock: func(m sqlmock.Sqlmock) {
+				m.
+					ExpectQuery(`SELECT id, email, data FROM users WHERE email = \$1`).
+					WithArgs("x@x.x").
+					WillReturnRows(
+						sqlmock.
+							NewRows([]string{"id", "email", "data"}).
+							AddRow("x-x-x-x-x", "x@x.x", []byte(`{"tokens":[{"access":"accessToken","provider":1}],"roles":["viewer"]}`)),
+					)
+			},
+			wantUser: &User{
+				ID:     "x-x-x-x-x",
+				Email:  "x@x.x",
+				tokens: []oauth2.Token{{Access: "accessToken", Provider: oauth2.Google}},
+				roles:  map[Role]bool{RoleViewer: true},
+			},
+			wantErr: nil,
+		},
+		"ErrUserNotFound": {
+			mock: func(m sqlmock.Sqlmock) {
+				m.
+					ExpectQuery(`SELECT id, email, data FROM users WHERE email = \$1`).
+					WithArgs("x@x.x").
+					WillReturnError(sql.ErrNoRows)
+			},
+			wantUser: nil,
+			wantErr:  ErrUserNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, m := newTestUserPostgresStorage(t)
+			tt.mock(m)
+
+			u, err := s.Get("x@x.x")
+
+			if !reflect.DeepEqual(u, tt.wantUser) {
+				t.Errorf("want: %+v, got: %+v", tt.wantUser, u)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUserPostgresStorage_GetByID(t *testing.T) {
+	s, m := newTestUserPostgresStorage(t)
+	m.
+		ExpectQuery(`SELECT id, email, data FROM users WHERE id = \$1`).
+		WithArgs("x-x-x-x-x").
+		WillReturnRows(
+			sqlmock.
+				NewRows([]string{"id", "email", "data"}).
+				AddRow("x-x-x-x-x", "x@x.x", []byte(`{"tokens":[{"access":"accessToken","provider":1}]}`)),
+		)
+
+	u, err := s.GetByID("x-x-x-x-x")
+
+	want := &User{
+		ID:     "x-x-x-x-x",
+		Email:  "x@x.x",
+		tokens: []oauth2.Token{{Access: "accessToken", Provider: oauth2.Google}},
+	}
+	if !reflect.DeepEqual(u, want) {
+		t.Errorf("want: %+v, got: %+v", want, u)
+	}
+	if err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+}
+
+func TestUserPostgresStorage_GetAPIKey(t *testing.T) {
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{"id", "user_id", "name", "hash", "scope", "prefixes", "created_at", "expires_at"}
+
+	for name, tt := range map[string]struct {
+		mock    func(sqlmock.Sqlmock)
+		wantKey *APIKey
+		wantErr error
+	}{
+		"OK": {
+			mock: func(m sqlmock.Sqlmock) {
+				m.
+					ExpectQuery(`SELECT id, user_id, name, hash, scope, prefixes, created_at, expires_at FROM api_keys WHERE id = \$1`).
+					WithArgs("id").
+					WillReturnRows(
+						sqlmock.
+							NewRows(columns).
+							AddRow("id", "x-x-x-x-x", "ci", []byte("hash"), "read", []byte(`["ci-"]`), created, nil),
+					)
+			},
+			wantKey: &APIKey{
+				ID:        "id",
+				UserID:    "x-x-x-x-x",
+				Name:      "ci",
+				Scope:     ScopeRead,
+				Prefixes:  []string{"ci-"},
+				CreatedAt: created,
+				hash:      []byte("hash"),
+			},
+			wantErr: nil,
+		},
+		"ErrAPIKeyNotFound": {
+			mock: func(m sqlmock.Sqlmock) {
+				m.
+					ExpectQuery(`SELECT .+ FROM api_keys WHERE id = \$1`).
+					WithArgs("id").
+					WillReturnRows(sqlmock.NewRows(columns))
+			},
+			wantKey: nil,
+			wantErr: ErrAPIKeyNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, m := newTestUserPostgresStorage(t)
+			tt.mock(m)
+
+			k, err := s.GetAPIKey("id")
+
+			if !reflect.DeepEqual(k, tt.wantKey) {
+				t.Errorf("want: %+v, got: %+v", tt.wantKey, k)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUserPostgresStorage_DeleteAPIKey(t *testing.T) {
+	for name, tt := range map[string]struct {
+		rows    int64
+		wantErr error
+	}{
+		"OK": {
+			rows:    1,
+			wantErr: nil,
+		},
+		"ErrAPIKeyNotFound": {
+			rows:    0,
+			wantErr: ErrAPIKeyNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, m := newTestUserPostgresStorage(t)
+			m.
+				ExpectExec(`DELETE FROM api_keys WHERE id = \$1`).
+				WithArgs("id").
+				WillReturnResult(sqlmock.NewResult(0, tt.rows))
+
+			if err := s.DeleteAPIKey("id"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUserPostgresStorage_GetInvitation(t *testing.T) {
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{"id", "email", "role", "hash", "created_by", "created_at", "expires_at"}
+
+	for name, tt := range map[string]struct {
+		mock           func(sqlmock.Sqlmock)
+		wantInvitation *Invitation
+		wantErr        error
+	}{
+		"OK": {
+			mock: func(m sqlmock.Sqlmock) {
+				m.
+					ExpectQuery(`SELECT id, email, role, hash, created_by, created_at, expires_at FROM invitations WHERE id = \$1`).
+					WithArgs("id").
+					WillReturnRows(
+						sqlmock.
+							NewRows(columns).
+							AddRow("id", "x@x.x", "viewer", []byte("hash"), "x-x-x-x-x", created, created.Add(time.Hour)),
+					)
+			},
+			wantInvitation: &Invitation{
+				ID:        "id",
+				Email:     "x@x.x",
+				Role:      RoleViewer,
+				CreatedBy: "x-x-x-x-x",
+				CreatedAt: created,
+				ExpiresAt: created.Add(time.Hour),
+				hash:      []byte("hash"),
+			},
+			wantErr: nil,
+		},
+		"ErrInvitationNotFound": {
+			mock: func(m sqlmock.Sqlmock) {
+				m.
+					ExpectQuery(`SELECT .+ FROM invitations WHERE id = \$1`).
+					WithArgs("id").
+					WillReturnRows(sqlmock.NewRows(columns))
+			},
+			wantInvitation: nil,
+			wantErr:        ErrInvitationNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, m := newTestUserPostgresStorage(t)
+			tt.mock(m)
+
+			i, err := s.GetInvitation("id")
+
+			if !reflect.DeepEqual(i, tt.wantInvitation) {
+				t.Errorf("want: %+v, got: %+v", tt.wantInvitation, i)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUserPostgresStorage_List(t *testing.T) {
+	s, m := newTestUserPostgresStorage(t)
+	m.
+		ExpectQuery(`SELECT count\(\*\) FROM users WHERE email ILIKE \$1`).
+		WithArgs(`%x\_%`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	m.
+		ExpectQuery(`SELECT id, email, data FROM users WHERE email ILIKE \$1 AND email > \$2 ORDER BY email LIMIT \$3`).
+		WithArgs(`%x\_%`, "a_x@x.x", 2).
+		WillReturnRows(
+			sqlmock.
+				NewRows([]string{"id", "email", "data"}).
+				AddRow("1", "b_x@x.x", []byte(`{}`)).
+				AddRow("2", "c_x@x.x", []byte(`{}`)),
+		)
+
+	page, err := s.List(UserListOptions{Email: "x_", Limit: 1, Cursor: "YV94QHgueA"})
+
+	want := &UserPage{
+		Users:      []*User{{ID: "1", Email: "b_x@x.x"}},
+		NextCursor: "Yl94QHgueA",
+		Total:      3,
+	}
+	if !reflect.DeepEqual(page, want) || err != nil {
+		t.Errorf("want: %+v, got: %+v, %v", want, page, err)
+	}
+}
+
+func TestUserPostgresStorage_Delete(t *testing.T) {
+	for name, tt := range map[string]struct {
+		rows    int64
+		wantErr error
+	}{
+		"OK": {
+			rows:    1,
+			wantErr: nil,
+		},
+		"ErrUserNotFound": {
+			rows:    0,
+			wantErr: ErrUserNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, m := newTestUserPostgresStorage(t)
+			m.
+				ExpectExec(`DELETE FROM users WHERE id = \$1`).
+				WithArgs("x-x-x-x-x").
+				WillReturnResult(sqlmock.NewResult(0, tt.rows))
+
+			if err := s.Delete("x-x-x-x-x"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUserPostgresStorage_GetByIdentity(t *testing.T) {
+	s, m := newTestUserPostgresStorage(t)
+	m.
+		ExpectQuery(`SELECT id, email, data FROM users WHERE data->'identities' @> \$1`).
+		WithArgs(`[{"provider":2,"subject":"42"}]`).
+		WillReturnRows(
+			sqlmock.
+				NewRows([]string{"id", "email", "data"}).
+				AddRow("x-x-x-x-x", "x@x.x", []byte(`{"identities":[{"provider":2,"subject":"42"}]}`)),
+		)
+
+	u, err := s.GetByIdentity(Identity{Provider: oauth2.GitHub, Subject: "42"})
+
+	want := &User{
+		ID:         "x-x-x-x-x",
+		Email:      "x@x.x",
+		identities: []Identity{{Provider: oauth2.GitHub, Subject: "42"}},
+	}
+	if !reflect.DeepEqual(u, want) || err != nil {
+		t.Errorf("want: %+v, got: %+v, %v", want, u, err)
+	}
+}
@@ -0,0 +1,128 @@
+package iam
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrInvalidRole     = errors.New("invalid role")
+	ErrConfiguredAdmin = errors.New("admin role is granted by configuration")
+)
+
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+// DefaultRole is granted to users on their first sign-in.
+const DefaultRole = RoleEditor
+
+type Permission string
+
+const (
+	PermissionReadCounters  Permission = "counters:read"
+	PermissionWriteCounters Permission = "counters:write"
+	PermissionManageUsers   Permission = "users:manage"
+)
+
+// permissions is the permission matrix of the roles.
+var permissions = map[Role][]Permission{
+	RoleAdmin:  {PermissionReadCounters, PermissionWriteCounters, PermissionManageUsers},
+	RoleEditor: {PermissionReadCounters, PermissionWriteCounters},
+	RoleViewer: {PermissionReadCounters},
+}
+
+func (r Role) Valid() bool {
+	_, ok := permissions[r]
+	return ok
+}
+
+// Can reports whether the role has the permission.
+func (r Role) Can(p Permission) bool {
+	for _, rp := range permissions[r] {
+		if rp == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Roles returns the roles of the user in lexical order.
+func (u *User) Roles() []Role {
+	roles := make([]Role, 0, len(u.roles))
+	for r := range u.roles {
+		roles = append(roles, r)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i] < roles[j] })
+
+	return roles
+}
+
+func (u *User) HasRole(r Role) bool {
+	return u.roles[r]
+}
+
+// Can reports whether any role of the user has the permission.
+func (u *User) Can(p Permission) bool {
+	for r := range u.roles {
+		if r.Can(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (u *User) AddRole(r Role) {
+	if u.roles == nil {
+		u.roles = make(map[Role]bool)
+	}
+	u.roles[r] = true
+}
+
+func (u *User) RemoveRole(r Role) {
+	delete(u.roles, r)
+}
+
+// GrantRole grants the role to the user with the given ID.
+func (m *Manager) GrantRole(userID string, r Role) error {
+	if !r.Valid() {
+		return ErrInvalidRole
+	}
+
+	return m.users.Update(userID, func(u *User) error {
+		u.AddRole(r)
+		return nil
+	})
+}
+
+// RevokeRole revokes the role from the user with the given ID. Users without
+// roles can still sign in, but not use the API. The admin role of users whose
+// emails are configured as admins cannot be revoked, since they are granted
+// it again when they sign in.
+func (m *Manager) RevokeRole(userID string, r Role) error {
+	if !r.Valid() {
+		return ErrInvalidRole
+	}
+
+	return m.users.Update(userID, func(u *User) error {
+		if r == RoleAdmin && m.admin(u.Email) {
+			return ErrConfiguredAdmin
+		}
+		u.RemoveRole(r)
+
+		return nil
+	})
+}
+
+// admin reports whether the email is configured as an admin. Emails match
+// regardless of case, like the domains of the sign-up policy.
+func (m *Manager) admin(email string) bool {
+	return m.admins[strings.ToLower(email)]
+}
@@ -0,0 +1,219 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"counters/pkg/oauth2"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestRole_Can(t *testing.T) {
+	for name, tt := range map[string]struct {
+		role Role
+		want map[Permission]bool
+	}{
+		"Admin": {
+			role: RoleAdmin,
+			want: map[Permission]bool{PermissionReadCounters: true, PermissionWriteCounters: true, PermissionManageUsers: true},
+		},
+		"Editor": {
+			role: RoleEditor,
+			want: map[Permission]bool{PermissionReadCounters: true, PermissionWriteCounters: true, PermissionManageUsers: false},
+		},
+		"Viewer": {
+			role: RoleViewer,
+			want: map[Permission]bool{PermissionReadCounters: true, PermissionWriteCounters: false, PermissionManageUsers: false},
+		},
+		"Unknown": {
+			role: "owner",
+			want: map[Permission]bool{PermissionReadCounters: false, PermissionWriteCounters: false, PermissionManageUsers: false},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for p, want := range tt.want {
+				if got := tt.role.Can(p); got != want {
+					t.Errorf("%s: want: %t, got: %t", p, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestManager_GrantRole(t *testing.T) {
+	users := NewUserMemoryStorage()
+	m := &Manager{users: users}
+
+	u := &User{ID: "x-x-x-x-x", Email: "x@x.x"}
+	u.AddRole(RoleViewer)
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.GrantRole(u.ID, RoleAdmin); err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+	u, _ = users.GetByID(u.ID)
+	if want := []Role{RoleAdmin, RoleViewer}; !reflect.DeepEqual(u.Roles(), want) {
+		t.Errorf("want: %v, got: %v", want, u.Roles())
+	}
+
+	if err := m.RevokeRole(u.ID, RoleViewer); err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+	u, _ = users.GetByID(u.ID)
+	if want := []Role{RoleAdmin}; !reflect.DeepEqual(u.Roles(), want) {
+		t.Errorf("want: %v, got: %v", want, u.Roles())
+	}
+
+	if err := m.GrantRole(u.ID, "owner"); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("want: %v, got: %v", ErrInvalidRole, err)
+	}
+	if err := m.RevokeRole("y-y-y-y-y", RoleAdmin); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("want: %v, got: %v", ErrUserNotFound, err)
+	}
+}
+
+func TestManager_GrantRole_concurrent(t *testing.T) {
+	users := NewUserMemoryStorage()
+	m := &Manager{users: users, sessions: testSessions(t)}
+
+	u := &User{ID: "x-x-x-x-x", Email: "x@x.x"}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	session, err := m.startSession(u.ID, func(*User) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles := []Role{RoleAdmin, RoleEditor, RoleViewer}
+	var wg sync.WaitGroup
+	for _, r := range roles {
+		wg.Add(2)
+		go func(r Role) {
+			defer wg.Done()
+			if err := m.GrantRole(u.ID, r); err != nil {
+				t.Errorf("want: <nil>, got: %v", err)
+			}
+		}(r)
+		go func() {
+			defer wg.Done()
+			if u, err := m.Authenticate(session.AccessToken); err == nil {
+				_ = u.Can(PermissionWriteCounters)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if u, _ = users.GetByID(u.ID); !reflect.DeepEqual(u.Roles(), roles) {
+		t.Errorf("want: %v, got: %v", roles, u.Roles())
+	}
+}
+
+func TestManager_RevokeRole_configuredAdmin(t *testing.T) {
+	users := NewUserMemoryStorage()
+	m := NewManager(users, nil, nil, SessionConfig{}, []string{"Admin@x.x"}, SignUpPolicy{})
+
+	u := &User{ID: "x-x-x-x-x", Email: "admin@X.x"}
+	u.AddRole(RoleAdmin)
+	u.AddRole(RoleEditor)
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RevokeRole(u.ID, RoleAdmin); !errors.Is(err, ErrConfiguredAdmin) {
+		t.Errorf("want: %v, got: %v", ErrConfiguredAdmin, err)
+	}
+	if err := m.RevokeRole(u.ID, RoleEditor); err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+
+	u, _ = users.GetByID(u.ID)
+	if want := []Role{RoleAdmin}; !reflect.DeepEqual(u.Roles(), want) {
+		t.Errorf("want: %v, got: %v", want, u.Roles())
+	}
+}
+
+func TestManager_SignInWithOAuth2_roles(t *testing.T) {
+	for name, tt := range map[string]struct {
+		email     string
+		existing  []Role
+		wantRoles []Role
+	}{
+		"NewUser": {
+			email:     "x@x.x",
+			existing:  nil,
+			wantRoles: []Role{RoleEditor},
+		},
+		"NewAdmin": {
+			email:     "admin@x.x",
+			existing:  nil,
+			wantRoles: []Role{RoleAdmin, RoleEditor},
+		},
+		"ExistingUserKeepsRoles": {
+			email:     "x@x.x",
+			existing:  []Role{RoleViewer},
+			wantRoles: []Role{RoleViewer},
+		},
+		"ExistingAdmin": {
+			email:     "admin@x.x",
+			existing:  []Role{RoleViewer},
+			wantRoles: []Role{RoleAdmin, RoleViewer},
+		},
+		"AdminOtherCase": {
+			email:     "Admin@X.x",
+			existing:  nil,
+			wantRoles: []Role{RoleAdmin, RoleEditor},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			users := NewUserMemoryStorage()
+			if tt.existing != nil {
+				u := &User{ID: "x-x-x-x-x", Email: tt.email}
+				for _, r := range tt.existing {
+					u.AddRole(r)
+				}
+				if err := users.Create(u); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			client := oauth2.NewMockClient(gomock.NewController(t))
+			token := oauth2.Token{Access: "accessToken", Provider: oauth2.Google}
+			client.EXPECT().Exchange(context.TODO(), "code", "verifier").Return(token, nil)
+			client.EXPECT().UserInfo(context.TODO(), token).Return(oauth2.UserInfo{Subject: "subject", Email: tt.email, EmailVerified: true}, nil)
+
+			states := oauth2.NewMemoryStateStore(time.Minute)
+			if err := states.Save("state", oauth2.State{Provider: oauth2.Google, Verifier: "verifier"}); err != nil {
+				t.Fatal(err)
+			}
+
+			m := NewManager(
+				users,
+				map[oauth2.Provider]oauth2.Client{oauth2.Google: client},
+				states,
+				testSessions(t),
+				[]string{"admin@x.x"},
+				SignUpPolicy{},
+			)
+
+			if _, err := m.SignInWithOAuth2(context.TODO(), oauth2.Google, "state", "code"); err != nil {
+				t.Fatalf("want: <nil>, got: %v", err)
+			}
+
+			u, err := users.Get(tt.email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(u.Roles(), tt.wantRoles) {
+				t.Errorf("want: %v, got: %v", tt.wantRoles, u.Roles())
+			}
+		})
+	}
+}
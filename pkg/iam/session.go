@@ -0,0 +1,128 @@
+package iam
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidKeySet = errors.New("invalid key set")
+
+// KeySet holds the keys that session tokens are signed with, by ID. Tokens
+// are signed with the signing key and verified with the key named in their
+// header, so keys can be rotated by adding a new key, making it the signing
+// key and removing the old one once the tokens it has signed have expired.
+type KeySet struct {
+	signingKey string
+	keys       map[string][]byte
+}
+
+func NewKeySet(signingKey string, keys map[string][]byte) (*KeySet, error) {
+	if _, ok := keys[signingKey]; !ok {
+		return nil, fmt.Errorf("%w: no signing key %q", ErrInvalidKeySet, signingKey)
+	}
+	for id, key := range keys {
+		if len(key) < 32 {
+			return nil, fmt.Errorf("%w: key %q is shorter than 32 bytes", ErrInvalidKeySet, id)
+		}
+	}
+
+	return &KeySet{signingKey: signingKey, keys: keys}, nil
+}
+
+type SessionConfig struct {
+	Keys       *KeySet
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+type tokenType string
+
+const (
+	accessToken  tokenType = "access"
+	refreshToken tokenType = "refresh"
+)
+
+// Session is a pair of tokens issued on sign-in. The access token
+// authenticates API calls and the refresh token is exchanged for a new
+// session once the access token has expired.
+type Session struct {
+	ID           string
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+type sessionClaims struct {
+	Type      tokenType `json:"typ"`
+	SessionID string    `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// issue starts a new session of the user. It is only valid once it has been
+// added to the sessions of the user.
+func (c SessionConfig) issue(user *User) (Session, error) {
+	now := time.Now()
+	id := uuid.NewString()
+
+	access, err := c.sign(user, id, accessToken, now, c.AccessTTL)
+	if err != nil {
+		return Session{}, err
+	}
+	refresh, err := c.sign(user, id, refreshToken, now, c.RefreshTTL)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return Session{
+		ID:           id,
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresAt:    now.Add(c.AccessTTL),
+	}, nil
+}
+
+func (c SessionConfig) sign(user *User, session string, typ tokenType, now time.Time, ttl time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, sessionClaims{
+		Type:      typ,
+		SessionID: session,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	})
+	token.Header["kid"] = c.Keys.signingKey
+
+	return token.SignedString(c.Keys.keys[c.Keys.signingKey])
+}
+
+// verify returns the claims of the token of the given type.
+func (c SessionConfig) verify(token string, typ tokenType) (*sessionClaims, error) {
+	var claims sessionClaims
+
+	_, err := jwt.ParseWithClaims(
+		token,
+		&claims,
+		func(t *jwt.Token) (any, error) {
+			id, _ := t.Header["kid"].(string)
+
+			key, ok := c.Keys.keys[id]
+			if !ok {
+				return nil, ErrInvalidToken
+			}
+
+			return key, nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+	)
+	if err != nil || claims.Type != typ || claims.Subject == "" || claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
@@ -0,0 +1,141 @@
+package iam
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testSessions(t *testing.T) SessionConfig {
+	t.Helper()
+
+	keys, err := NewKeySet("key", map[string][]byte{"key": bytes.Repeat([]byte("k"), 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return SessionConfig{Keys: keys, AccessTTL: time.Minute, RefreshTTL: time.Hour}
+}
+
+func TestNewKeySet(t *testing.T) {
+	for name, tt := range map[string]struct {
+		signingKey string
+		keys       map[string][]byte
+		wantErr    error
+	}{
+		"OK": {
+			signingKey: "new",
+			keys: map[string][]byte{
+				"old": bytes.Repeat([]byte("o"), 32),
+				"new": bytes.Repeat([]byte("n"), 32),
+			},
+			wantErr: nil,
+		},
+		"ErrInvalidKeySetNoSigningKey": {
+			signingKey: "new",
+			keys:       map[string][]byte{"old": bytes.Repeat([]byte("o"), 32)},
+			wantErr:    ErrInvalidKeySet,
+		},
+		"ErrInvalidKeySetShortKey": {
+			signingKey: "new",
+			keys: map[string][]byte{
+				"old": []byte("short"),
+				"new": bytes.Repeat([]byte("n"), 32),
+			},
+			wantErr: ErrInvalidKeySet,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewKeySet(tt.signingKey, tt.keys)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSessionConfig_verify(t *testing.T) {
+	old := bytes.Repeat([]byte("o"), 32)
+	new := bytes.Repeat([]byte("n"), 32)
+
+	sign := func(signingKey string, keys map[string][]byte, ttl time.Duration) SessionConfig {
+		ks, err := NewKeySet(signingKey, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return SessionConfig{Keys: ks, AccessTTL: ttl, RefreshTTL: ttl}
+	}
+
+	for name, tt := range map[string]struct {
+		issuer   SessionConfig
+		verifier SessionConfig
+		typ      tokenType
+		wantID   string
+		wantErr  error
+	}{
+		"OK": {
+			issuer:   sign("old", map[string][]byte{"old": old}, time.Minute),
+			verifier: sign("old", map[string][]byte{"old": old}, time.Minute),
+			typ:      accessToken,
+			wantID:   "x-x-x-x-x",
+			wantErr:  nil,
+		},
+		"OKRotatedKey": {
+			issuer:   sign("old", map[string][]byte{"old": old}, time.Minute),
+			verifier: sign("new", map[string][]byte{"old": old, "new": new}, time.Minute),
+			typ:      accessToken,
+			wantID:   "x-x-x-x-x",
+			wantErr:  nil,
+		},
+		"ErrInvalidTokenRemovedKey": {
+			issuer:   sign("old", map[string][]byte{"old": old}, time.Minute),
+			verifier: sign("new", map[string][]byte{"new": new}, time.Minute),
+			typ:      accessToken,
+			wantID:   "",
+			wantErr:  ErrInvalidToken,
+		},
+		"ErrInvalidTokenWrongKey": {
+			issuer:   sign("key", map[string][]byte{"key": old}, time.Minute),
+			verifier: sign("key", map[string][]byte{"key": new}, time.Minute),
+			typ:      accessToken,
+			wantID:   "",
+			wantErr:  ErrInvalidToken,
+		},
+		"ErrInvalidTokenExpired": {
+			issuer:   sign("old", map[string][]byte{"old": old}, -time.Minute),
+			verifier: sign("old", map[string][]byte{"old": old}, time.Minute),
+			typ:      accessToken,
+			wantID:   "",
+			wantErr:  ErrInvalidToken,
+		},
+		"ErrInvalidTokenWrongType": {
+			issuer:   sign("old", map[string][]byte{"old": old}, time.Minute),
+			verifier: sign("old", map[string][]byte{"old": old}, time.Minute),
+			typ:      refreshToken,
+			wantID:   "",
+			wantErr:  ErrInvalidToken,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			session, err := tt.issuer.issue(&User{ID: "x-x-x-x-x"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := tt.verifier.verify(session.AccessToken, tt.typ)
+
+			var id string
+			if claims != nil {
+				id = claims.Subject
+			}
+			if id != tt.wantID {
+				t.Errorf("want: %s, got: %s", tt.wantID, id)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -3,30 +3,102 @@ package iam
 
 import (
 	"errors"
+	"sort"
+	"strings"
 	"sync"
 )
 
-var ErrUserNotFound = errors.New("user not found")
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user already exists")
+)
 
 type UserStorage interface {
-	Set(user *User) error
+	// Create stores a new user. It fails with ErrUserExists if a user with
+	// the email or ID is stored already.
+	Create(user *User) error
+	// Update applies f to the user with the given ID and stores the result,
+	// unless f fails. Concurrent updates of the user are not lost, so f may
+	// be called again with the user as another update left it.
+	Update(id string, f func(*User) error) error
 	Get(email string) (*User, error)
+	GetByID(id string) (*User, error)
+	GetByIdentity(identity Identity) (*User, error)
+	List(opts UserListOptions) (*UserPage, error)
+	// Delete deletes the user along with its API keys.
+	Delete(id string) error
+
+	SetAPIKey(key *APIKey) error
+	GetAPIKey(id string) (*APIKey, error)
+	ListAPIKeys(userID string) ([]*APIKey, error)
+	DeleteAPIKey(id string) error
+
+	SetInvitation(invitation *Invitation) error
+	GetInvitation(id string) (*Invitation, error)
+	ListInvitations() ([]*Invitation, error)
+	DeleteInvitation(id string) error
 }
 
 type UserMemoryStorage struct {
-	mu    sync.RWMutex
-	users map[string]*User
+	mu      sync.RWMutex
+	users   map[string]*User
+	ids     map[string]string
+	apiKeys map[string]*APIKey
+	// identities maps identities to the IDs of the users they belong to.
+	identities  map[Identity]string
+	invitations map[string]*Invitation
 }
 
 func NewUserMemoryStorage() *UserMemoryStorage {
-	return &UserMemoryStorage{users: make(map[string]*User)}
+	return &UserMemoryStorage{
+		users:       make(map[string]*User),
+		ids:         make(map[string]string),
+		apiKeys:     make(map[string]*APIKey),
+		identities:  make(map[Identity]string),
+		invitations: make(map[string]*Invitation),
+	}
 }
 
-func (s *UserMemoryStorage) Set(user *User) error {
+// Create stores a copy of the user. Users are copied on the way out too, so
+// that callers never share them.
+func (s *UserMemoryStorage) Create(user *User) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if _, ok := s.users[user.Email]; ok {
+		return ErrUserExists
+	}
+	if _, ok := s.ids[user.ID]; ok {
+		return ErrUserExists
+	}
+
+	s.set(user.clone())
+
+	return nil
+}
+
+func (s *UserMemoryStorage) set(user *User) {
 	s.users[user.Email] = user
+	s.ids[user.ID] = user.Email
+	for _, i := range user.identities {
+		s.identities[i] = user.ID
+	}
+}
+
+func (s *UserMemoryStorage) Update(id string, f func(*User) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[s.ids[id]]
+	if !ok || user.ID != id {
+		return ErrUserNotFound
+	}
+
+	u := user.clone()
+	if err := f(u); err != nil {
+		return err
+	}
+	s.set(u)
 
 	return nil
 }
@@ -40,5 +112,193 @@ func (s *UserMemoryStorage) Get(email string) (*User, error) {
 		return nil, ErrUserNotFound
 	}
 
-	return user, nil
+	return user.clone(), nil
+}
+
+func (s *UserMemoryStorage) GetByID(id string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[s.ids[id]]
+	if !ok || user.ID != id {
+		return nil, ErrUserNotFound
+	}
+
+	return user.clone(), nil
+}
+
+func (s *UserMemoryStorage) GetByIdentity(identity Identity) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.identities[identity]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	user, ok := s.users[s.ids[id]]
+	if !ok || user.ID != id || !user.hasIdentity(identity) {
+		return nil, ErrUserNotFound
+	}
+
+	return user.clone(), nil
+}
+
+func (s *UserMemoryStorage) List(opts UserListOptions) (*UserPage, error) {
+	opts, after, err := parseUserListOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	search := strings.ToLower(opts.Email)
+	emails := make([]string, 0, len(s.users))
+	for email := range s.users {
+		if strings.Contains(strings.ToLower(email), search) {
+			emails = append(emails, email)
+		}
+	}
+	sort.Strings(emails)
+
+	page := &UserPage{Total: len(emails)}
+	i := sort.SearchStrings(emails, after)
+	if i < len(emails) && emails[i] == after {
+		i++
+	}
+	for ; i < len(emails) && len(page.Users) <= opts.Limit; i++ {
+		page.Users = append(page.Users, s.users[emails[i]].clone())
+	}
+
+	return paginateUsers(page, opts), nil
+}
+
+func (s *UserMemoryStorage) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[s.ids[id]]
+	if !ok || user.ID != id {
+		return ErrUserNotFound
+	}
+
+	delete(s.users, user.Email)
+	delete(s.ids, id)
+	for _, i := range user.identities {
+		delete(s.identities, i)
+	}
+	for keyID, k := range s.apiKeys {
+		if k.UserID == id {
+			delete(s.apiKeys, keyID)
+		}
+	}
+
+	return nil
+}
+
+func (s *UserMemoryStorage) SetAPIKey(key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apiKeys[key.ID] = key
+
+	return nil
+}
+
+func (s *UserMemoryStorage) GetAPIKey(id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.apiKeys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns the API keys of the user, oldest first.
+func (s *UserMemoryStorage) ListAPIKeys(userID string) ([]*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*APIKey, 0)
+	for _, key := range s.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+func (s *UserMemoryStorage) DeleteAPIKey(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apiKeys[id]; !ok {
+		return ErrAPIKeyNotFound
+	}
+	delete(s.apiKeys, id)
+
+	return nil
+}
+
+func (s *UserMemoryStorage) SetInvitation(invitation *Invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.invitations[invitation.ID] = invitation
+
+	return nil
+}
+
+func (s *UserMemoryStorage) GetInvitation(id string) (*Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invitation, ok := s.invitations[id]
+	if !ok {
+		return nil, ErrInvitationNotFound
+	}
+
+	return invitation, nil
+}
+
+// ListInvitations returns the invitations, oldest first.
+func (s *UserMemoryStorage) ListInvitations() ([]*Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invitations := make([]*Invitation, 0, len(s.invitations))
+	for _, i := range s.invitations {
+		invitations = append(invitations, i)
+	}
+	sort.Slice(invitations, func(i, j int) bool {
+		if !invitations[i].CreatedAt.Equal(invitations[j].CreatedAt) {
+			return invitations[i].CreatedAt.Before(invitations[j].CreatedAt)
+		}
+		return invitations[i].ID < invitations[j].ID
+	})
+
+	return invitations, nil
+}
+
+func (s *UserMemoryStorage) DeleteInvitation(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.invitations[id]; !ok {
+		return ErrInvitationNotFound
+	}
+	delete(s.invitations, id)
+
+	return nil
 }
@@ -4,12 +4,19 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"counters/pkg/oauth2"
 )
 
 func TestNewUserMemoryStorage(t *testing.T) {
-	wantStorage := &UserMemoryStorage{users: make(map[string]*User)}
+	wantStorage := &UserMemoryStorage{
+		users:       make(map[string]*User),
+		ids:         make(map[string]string),
+		apiKeys:     make(map[string]*APIKey),
+		identities:  make(map[Identity]string),
+		invitations: make(map[string]*Invitation),
+	}
 
 	storage := NewUserMemoryStorage()
 
@@ -18,11 +25,11 @@ func TestNewUserMemoryStorage(t *testing.T) {
 	}
 }
 
-func TestUserMemoryStorage_Set(t *testing.T) {
-	storage := &UserMemoryStorage{users: make(map[string]*User)}
+func TestUserMemoryStorage_Create(t *testing.T) {
+	storage := NewUserMemoryStorage()
 	user := &User{ID: "x-x-x-x-x", Email: "x@x.x", tokens: []oauth2.Token{}}
 
-	err := storage.Set(user)
+	err := storage.Create(user)
 
 	if err != nil {
 		t.Errorf("want: <nil>, got: %v", err)
@@ -30,6 +37,23 @@ func TestUserMemoryStorage_Set(t *testing.T) {
 	if u, ok := storage.users[user.Email]; !ok || !reflect.DeepEqual(u, user) {
 		t.Errorf("want: %+v, got: %+v", user, u)
 	}
+
+	user.AddRole(RoleAdmin)
+	if u := storage.users[user.Email]; u.HasRole(RoleAdmin) {
+		t.Error("want stored user not to change with the created one")
+	}
+
+	for name, u := range map[string]*User{
+		"SameEmail": {ID: "y-y-y-y-y", Email: "x@x.x"},
+		"SameID":    {ID: "x-x-x-x-x", Email: "y@x.x"},
+	} {
+		if err = storage.Create(u); !errors.Is(err, ErrUserExists) {
+			t.Errorf("%s: want: %v, got: %v", name, ErrUserExists, err)
+		}
+	}
+	if u := storage.users[user.Email]; u.ID != user.ID {
+		t.Errorf("want: %s, got: %s", user.ID, u.ID)
+	}
 }
 
 func TestUserMemoryStorage_Get(t *testing.T) {
@@ -68,3 +92,212 @@ func TestUserMemoryStorage_Get(t *testing.T) {
 		})
 	}
 }
+
+func TestUserMemoryStorage_GetByID(t *testing.T) {
+	storage := NewUserMemoryStorage()
+	user := &User{ID: "x-x-x-x-x", Email: "x@x.x"}
+	if err := storage.Create(user); err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	for name, tt := range map[string]struct {
+		id       string
+		wantUser *User
+		wantErr  error
+	}{
+		"OK": {
+			id:       "x-x-x-x-x",
+			wantUser: user,
+			wantErr:  nil,
+		},
+		"ErrUserNotFound": {
+			id:       "y-y-y-y-y",
+			wantUser: nil,
+			wantErr:  ErrUserNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			u, err := storage.GetByID(tt.id)
+
+			if !reflect.DeepEqual(u, tt.wantUser) {
+				t.Errorf("want: %+v, got: %+v", tt.wantUser, u)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUserMemoryStorage_Update(t *testing.T) {
+	errUnexpected := errors.New("unexpected error")
+
+	for name, tt := range map[string]struct {
+		id        string
+		err       error
+		wantRoles []Role
+		wantErr   error
+	}{
+		"OK": {
+			id:        "x-x-x-x-x",
+			err:       nil,
+			wantRoles: []Role{RoleAdmin, RoleViewer},
+			wantErr:   nil,
+		},
+		"ErrUnexpected": {
+			id:        "x-x-x-x-x",
+			err:       errUnexpected,
+			wantRoles: []Role{RoleViewer},
+			wantErr:   errUnexpected,
+		},
+		"ErrUserNotFound": {
+			id:        "y-y-y-y-y",
+			err:       nil,
+			wantRoles: []Role{RoleViewer},
+			wantErr:   ErrUserNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			storage := NewUserMemoryStorage()
+			user := &User{ID: "x-x-x-x-x", Email: "x@x.x"}
+			user.AddRole(RoleViewer)
+			if err := storage.Create(user); err != nil {
+				t.Fatal(err)
+			}
+
+			err := storage.Update(tt.id, func(u *User) error {
+				u.AddRole(RoleAdmin)
+				return tt.err
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if got := storage.users[user.Email].Roles(); !reflect.DeepEqual(got, tt.wantRoles) {
+				t.Errorf("want: %v, got: %v", tt.wantRoles, got)
+			}
+		})
+	}
+}
+
+func TestUserMemoryStorage_APIKeys(t *testing.T) {
+	storage := NewUserMemoryStorage()
+	now := time.Now()
+	first := &APIKey{ID: "b", UserID: "x-x-x-x-x", CreatedAt: now}
+	second := &APIKey{ID: "a", UserID: "x-x-x-x-x", CreatedAt: now.Add(time.Second)}
+	other := &APIKey{ID: "c", UserID: "y-y-y-y-y", CreatedAt: now}
+	for _, k := range []*APIKey{second, other, first} {
+		if err := storage.SetAPIKey(k); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+	}
+
+	if k, err := storage.GetAPIKey("a"); k != second || err != nil {
+		t.Errorf("want: %+v, got: %+v, %v", second, k, err)
+	}
+	if _, err := storage.GetAPIKey("d"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("want: %v, got: %v", ErrAPIKeyNotFound, err)
+	}
+
+	keys, err := storage.ListAPIKeys("x-x-x-x-x")
+	if want := []*APIKey{first, second}; !reflect.DeepEqual(keys, want) || err != nil {
+		t.Errorf("want: %+v, got: %+v, %v", want, keys, err)
+	}
+
+	if err = storage.DeleteAPIKey("a"); err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+	if err = storage.DeleteAPIKey("a"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("want: %v, got: %v", ErrAPIKeyNotFound, err)
+	}
+}
+
+func TestUserMemoryStorage_Invitations(t *testing.T) {
+	storage := NewUserMemoryStorage()
+	now := time.Now()
+	first := &Invitation{ID: "b", Email: "x@x.x", CreatedAt: now}
+	second := &Invitation{ID: "a", Email: "y@x.x", CreatedAt: now.Add(time.Second)}
+	for _, i := range []*Invitation{second, first} {
+		if err := storage.SetInvitation(i); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+	}
+
+	if i, err := storage.GetInvitation("a"); i != second || err != nil {
+		t.Errorf("want: %+v, got: %+v, %v", second, i, err)
+	}
+	if _, err := storage.GetInvitation("c"); !errors.Is(err, ErrInvitationNotFound) {
+		t.Errorf("want: %v, got: %v", ErrInvitationNotFound, err)
+	}
+
+	invitations, err := storage.ListInvitations()
+	if want := []*Invitation{first, second}; !reflect.DeepEqual(invitations, want) || err != nil {
+		t.Errorf("want: %+v, got: %+v, %v", want, invitations, err)
+	}
+
+	if err = storage.DeleteInvitation("a"); err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+	if err = storage.DeleteInvitation("a"); !errors.Is(err, ErrInvitationNotFound) {
+		t.Errorf("want: %v, got: %v", ErrInvitationNotFound, err)
+	}
+}
+
+func TestUserMemoryStorage_List(t *testing.T) {
+	storage := NewUserMemoryStorage()
+	for i, email := range []string{"c@x.x", "a@x.x", "B@y.y", "d@y.y"} {
+		if err := storage.Create(&User{ID: string(rune('1' + i)), Email: email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	emails := func(page *UserPage) []string {
+		var emails []string
+		for _, u := range page.Users {
+			emails = append(emails, u.Email)
+		}
+		return emails
+	}
+
+	first, err := storage.List(UserListOptions{Limit: 2})
+	if want := []string{"B@y.y", "a@x.x"}; err != nil || !reflect.DeepEqual(emails(first), want) || first.Total != 4 {
+		t.Fatalf("want: %v of 4, got: %v of %d, %v", want, emails(first), first.Total, err)
+	}
+
+	second, err := storage.List(UserListOptions{Limit: 2, Cursor: first.NextCursor})
+	if want := []string{"c@x.x", "d@y.y"}; err != nil || !reflect.DeepEqual(emails(second), want) || second.NextCursor != "" {
+		t.Errorf("want: %v, got: %v, %s, %v", want, emails(second), second.NextCursor, err)
+	}
+
+	search, err := storage.List(UserListOptions{Email: "b@Y"})
+	if want := []string{"B@y.y"}; err != nil || !reflect.DeepEqual(emails(search), want) || search.Total != 1 {
+		t.Errorf("want: %v, got: %v, %v", want, emails(search), err)
+	}
+
+	if _, err = storage.List(UserListOptions{Cursor: "!"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("want: %v, got: %v", ErrInvalidCursor, err)
+	}
+}
+
+func TestUserMemoryStorage_Delete(t *testing.T) {
+	storage := NewUserMemoryStorage()
+	if err := storage.Create(&User{ID: "x-x-x-x-x", Email: "x@x.x"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SetAPIKey(&APIKey{ID: "id", UserID: "x-x-x-x-x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.Delete("x-x-x-x-x"); err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+	if _, err := storage.Get("x@x.x"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("want: %v, got: %v", ErrUserNotFound, err)
+	}
+	if _, err := storage.GetAPIKey("id"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("want: %v, got: %v", ErrAPIKeyNotFound, err)
+	}
+	if err := storage.Delete("x-x-x-x-x"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("want: %v, got: %v", ErrUserNotFound, err)
+	}
+}
@@ -0,0 +1,151 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"counters/pkg/oauth2"
+)
+
+var ErrTokenNotFound = errors.New("provider token not found")
+
+// TokenSource returns a source of valid tokens of the provider for the user.
+// Expired tokens are refreshed at the provider and the refreshed token is
+// stored with the user. Failures to refresh are returned by the source.
+func (m *Manager) TokenSource(ctx context.Context, userID string, provider oauth2.Provider) (oauth2.TokenSource, error) {
+	c, ok := m.oauth2[provider]
+	if !ok {
+		return nil, ErrInvalidOAuth2Provider
+	}
+
+	return &tokenSource{ctx: ctx, users: m.users, client: c, userID: userID, provider: provider}, nil
+}
+
+type tokenSource struct {
+	ctx      context.Context
+	users    UserStorage
+	client   oauth2.Client
+	userID   string
+	provider oauth2.Provider
+
+	mu    sync.Mutex
+	token oauth2.Token
+}
+
+func (s *tokenSource) Token() (oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.Valid() {
+		return s.token, nil
+	}
+
+	u, err := s.users.GetByID(s.userID)
+	if err != nil {
+		return oauth2.Token{}, err
+	}
+
+	token, ok := u.Token(s.provider)
+	if !ok {
+		return oauth2.Token{}, ErrTokenNotFound
+	}
+
+	if !token.Valid() {
+		refreshed, err := s.client.Refresh(s.ctx, token)
+		if err != nil {
+			return oauth2.Token{}, err
+		}
+
+		if token, err = s.store(token, refreshed); err != nil {
+			return oauth2.Token{}, err
+		}
+	}
+
+	s.token = token
+
+	return token, nil
+}
+
+// store replaces the expired token of the user with the refreshed one and
+// returns the token to use. A valid token stored by a sign-in in the
+// meantime is kept and returned instead, and a token that was revoked in the
+// meantime is not stored again.
+func (s *tokenSource) store(expired, refreshed oauth2.Token) (oauth2.Token, error) {
+	var token oauth2.Token
+	err := s.users.Update(s.userID, func(u *User) error {
+		current, ok := u.Token(s.provider)
+		if !ok {
+			return ErrTokenNotFound
+		}
+		if current.Access != expired.Access && current.Valid() {
+			token = current
+			return nil
+		}
+
+		token = refreshed
+		u.SetToken(refreshed)
+
+		return nil
+	})
+	if err != nil {
+		return oauth2.Token{}, err
+	}
+
+	return token, nil
+}
+
+// RevokeTokens revokes the provider tokens of the user at their providers and
+// removes them. Tokens are removed even when revoking them fails, and the
+// first failure is returned. Tokens stored after they were read, by a
+// concurrent sign-in, are kept.
+func (m *Manager) RevokeTokens(ctx context.Context, userID string) error {
+	u, err := m.users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+
+	var revokeErr error
+	for _, t := range u.tokens {
+		c, ok := m.oauth2[t.Provider]
+		if !ok {
+			continue
+		}
+
+		if err := c.Revoke(ctx, t); err != nil && !errors.Is(err, oauth2.ErrRevokeNotSupported) && revokeErr == nil {
+			revokeErr = fmt.Errorf("revoking token of provider %d: %w", t.Provider, err)
+		}
+	}
+
+	revoked := u.tokens
+	err = m.users.Update(userID, func(u *User) error {
+		tokens := u.tokens[:0]
+		for _, t := range u.tokens {
+			if !containsToken(revoked, t) {
+				tokens = append(tokens, t)
+			}
+		}
+		if len(tokens) == 0 {
+			tokens = nil
+		}
+		u.tokens = tokens
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return revokeErr
+}
+
+func containsToken(tokens []oauth2.Token, token oauth2.Token) bool {
+	for _, t := range tokens {
+		if t.Provider == token.Provider && t.Access == token.Access {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,248 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"counters/pkg/oauth2"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestManager_TokenSource(t *testing.T) {
+	errUnexpected := errors.New("unexpected error")
+	valid := oauth2.Token{Access: "accessToken", Refresh: "refreshToken", Expiry: time.Now().Add(time.Hour), Provider: oauth2.Google}
+	expired := oauth2.Token{Access: "expired", Refresh: "refreshToken", Expiry: time.Now().Add(-time.Hour), Provider: oauth2.Google}
+	signedIn := oauth2.Token{Access: "signedIn", Expiry: time.Now().Add(time.Hour), Provider: oauth2.Google}
+
+	for name, tt := range map[string]struct {
+		// stored is the user as the token source updates it.
+		stored     *User
+		users      func(*gomock.Controller, *User) UserStorage
+		client     func(*gomock.Controller) oauth2.Client
+		wantToken  oauth2.Token
+		wantStored []oauth2.Token
+		wantErr    error
+	}{
+		"OK": {
+			stored: &User{ID: "x-x-x-x-x", tokens: []oauth2.Token{valid}},
+			users: func(c *gomock.Controller, _ *User) UserStorage {
+				s := NewMockUserStorage(c)
+				s.EXPECT().GetByID("x-x-x-x-x").Return(&User{ID: "x-x-x-x-x", tokens: []oauth2.Token{valid}}, nil)
+				return s
+			},
+			client: func(c *gomock.Controller) oauth2.Client {
+				return oauth2.NewMockClient(c)
+			},
+			wantToken:  valid,
+			wantStored: []oauth2.Token{valid},
+			wantErr:    nil,
+		},
+		"OKRefreshed": {
+			stored: &User{ID: "x-x-x-x-x", tokens: []oauth2.Token{expired}},
+			users: func(c *gomock.Controller, stored *User) UserStorage {
+				s := NewMockUserStorage(c)
+				s.EXPECT().GetByID("x-x-x-x-x").Return(&User{ID: "x-x-x-x-x", tokens: []oauth2.Token{expired}}, nil)
+				s.EXPECT().Update("x-x-x-x-x", gomock.Any()).DoAndReturn(updateUser(stored))
+				return s
+			},
+			client: func(c *gomock.Controller) oauth2.Client {
+				client := oauth2.NewMockClient(c)
+				client.EXPECT().Refresh(context.TODO(), expired).Return(valid, nil)
+				return client
+			},
+			wantToken:  valid,
+			wantStored: []oauth2.Token{valid},
+			wantErr:    nil,
+		},
+		"OKSignedInConcurrently": {
+			stored: &User{ID: "x-x-x-x-x", tokens: []oauth2.Token{signedIn}},
+			users: func(c *gomock.Controller, stored *User) UserStorage {
+				s := NewMockUserStorage(c)
+				s.EXPECT().GetByID("x-x-x-x-x").Return(&User{ID: "x-x-x-x-x", tokens: []oauth2.Token{expired}}, nil)
+				s.EXPECT().Update("x-x-x-x-x", gomock.Any()).DoAndReturn(updateUser(stored))
+				return s
+			},
+			client: func(c *gomock.Controller) oauth2.Client {
+				client := oauth2.NewMockClient(c)
+				client.EXPECT().Refresh(context.TODO(), expired).Return(valid, nil)
+				return client
+			},
+			wantToken:  signedIn,
+			wantStored: []oauth2.Token{signedIn},
+			wantErr:    nil,
+		},
+		"ErrRefreshFailed": {
+			stored: &User{ID: "x-x-x-x-x", tokens: []oauth2.Token{expired}},
+			users: func(c *gomock.Controller, _ *User) UserStorage {
+				s := NewMockUserStorage(c)
+				s.EXPECT().GetByID("x-x-x-x-x").Return(&User{ID: "x-x-x-x-x", tokens: []oauth2.Token{expired}}, nil)
+				return s
+			},
+			client: func(c *gomock.Controller) oauth2.Client {
+				client := oauth2.NewMockClient(c)
+				client.EXPECT().Refresh(context.TODO(), expired).Return(oauth2.Token{}, oauth2.ErrRefreshFailed)
+				return client
+			},
+			wantToken:  oauth2.Token{},
+			wantStored: []oauth2.Token{expired},
+			wantErr:    oauth2.ErrRefreshFailed,
+		},
+		"ErrTokenNotFound": {
+			stored: &User{ID: "x-x-x-x-x"},
+			users: func(c *gomock.Controller, _ *User) UserStorage {
+				s := NewMockUserStorage(c)
+				s.EXPECT().GetByID("x-x-x-x-x").Return(&User{ID: "x-x-x-x-x"}, nil)
+				return s
+			},
+			client: func(c *gomock.Controller) oauth2.Client {
+				return oauth2.NewMockClient(c)
+			},
+			wantToken:  oauth2.Token{},
+			wantStored: nil,
+			wantErr:    ErrTokenNotFound,
+		},
+		"ErrTokenNotFoundRevokedConcurrently": {
+			stored: &User{ID: "x-x-x-x-x"},
+			users: func(c *gomock.Controller, stored *User) UserStorage {
+				s := NewMockUserStorage(c)
+				s.EXPECT().GetByID("x-x-x-x-x").Return(&User{ID: "x-x-x-x-x", tokens: []oauth2.Token{expired}}, nil)
+				s.EXPECT().Update("x-x-x-x-x", gomock.Any()).DoAndReturn(updateUser(stored))
+				return s
+			},
+			client: func(c *gomock.Controller) oauth2.Client {
+				client := oauth2.NewMockClient(c)
+				client.EXPECT().Refresh(context.TODO(), expired).Return(valid, nil)
+				return client
+			},
+			wantToken:  oauth2.Token{},
+			wantStored: nil,
+			wantErr:    ErrTokenNotFound,
+		},
+		"UpdateUnexpectedError": {
+			stored: &User{ID: "x-x-x-x-x", tokens: []oauth2.Token{expired}},
+			users: func(c *gomock.Controller, _ *User) UserStorage {
+				s := NewMockUserStorage(c)
+				s.EXPECT().GetByID("x-x-x-x-x").Return(&User{ID: "x-x-x-x-x", tokens: []oauth2.Token{expired}}, nil)
+				s.EXPECT().Update("x-x-x-x-x", gomock.Any()).Return(errUnexpected)
+				return s
+			},
+			client: func(c *gomock.Controller) oauth2.Client {
+				client := oauth2.NewMockClient(c)
+				client.EXPECT().Refresh(context.TODO(), expired).Return(valid, nil)
+				return client
+			},
+			wantToken:  oauth2.Token{},
+			wantStored: []oauth2.Token{expired},
+			wantErr:    errUnexpected,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			m := &Manager{
+				users:  tt.users(c, tt.stored),
+				oauth2: map[oauth2.Provider]oauth2.Client{oauth2.Google: tt.client(c)},
+			}
+
+			ts, err := m.TokenSource(context.TODO(), "x-x-x-x-x", oauth2.Google)
+			if err != nil {
+				t.Fatalf("want: <nil>, got: %v", err)
+			}
+
+			token, err := ts.Token()
+
+			if token != tt.wantToken {
+				t.Errorf("want: %+v, got: %+v", tt.wantToken, token)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(tt.stored.tokens, tt.wantStored) {
+				t.Errorf("want: %+v, got: %+v", tt.wantStored, tt.stored.tokens)
+			}
+
+			// Valid tokens are kept without asking storage again.
+			if err == nil {
+				if token, err = ts.Token(); token != tt.wantToken || err != nil {
+					t.Errorf("want: %+v, got: %+v, %v", tt.wantToken, token, err)
+				}
+			}
+		})
+	}
+}
+
+func TestManager_TokenSourceInvalidOAuth2Provider(t *testing.T) {
+	m := &Manager{oauth2: map[oauth2.Provider]oauth2.Client{}}
+
+	_, err := m.TokenSource(context.TODO(), "x-x-x-x-x", oauth2.Google)
+
+	if !errors.Is(err, ErrInvalidOAuth2Provider) {
+		t.Errorf("want: %v, got: %v", ErrInvalidOAuth2Provider, err)
+	}
+}
+
+func TestManager_RevokeTokens(t *testing.T) {
+	errUnexpected := errors.New("unexpected error")
+	google := oauth2.Token{Access: "google", Provider: oauth2.Google}
+	oidc := oauth2.Token{Access: "oidc", Provider: oauth2.OIDC}
+	github := oauth2.Token{Access: "github", Provider: oauth2.GitHub}
+
+	for name, tt := range map[string]struct {
+		revokeGoogle error
+		revokeOIDC   error
+		wantErr      error
+	}{
+		"OK": {
+			revokeGoogle: nil,
+			revokeOIDC:   nil,
+			wantErr:      nil,
+		},
+		"OKRevokeNotSupported": {
+			revokeGoogle: nil,
+			revokeOIDC:   oauth2.ErrRevokeNotSupported,
+			wantErr:      nil,
+		},
+		"ErrRevokeFailed": {
+			revokeGoogle: oauth2.ErrRevokeFailed,
+			revokeOIDC:   errUnexpected,
+			wantErr:      oauth2.ErrRevokeFailed,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := gomock.NewController(t)
+
+			// The GitHub token is stored by a sign-in after the tokens are
+			// read, so it is not revoked and has to be kept.
+			stored := &User{ID: "x-x-x-x-x", tokens: []oauth2.Token{google, oidc, github}}
+
+			users := NewMockUserStorage(c)
+			users.EXPECT().GetByID("x-x-x-x-x").Return(&User{ID: "x-x-x-x-x", tokens: []oauth2.Token{google, oidc}}, nil)
+			users.EXPECT().Update("x-x-x-x-x", gomock.Any()).DoAndReturn(updateUser(stored))
+
+			googleClient := oauth2.NewMockClient(c)
+			googleClient.EXPECT().Revoke(context.TODO(), google).Return(tt.revokeGoogle)
+			oidcClient := oauth2.NewMockClient(c)
+			oidcClient.EXPECT().Revoke(context.TODO(), oidc).Return(tt.revokeOIDC)
+
+			m := &Manager{
+				users: users,
+				oauth2: map[oauth2.Provider]oauth2.Client{
+					oauth2.Google: googleClient,
+					oauth2.OIDC:   oidcClient,
+				},
+			}
+
+			err := m.RevokeTokens(context.TODO(), "x-x-x-x-x")
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if want := []oauth2.Token{github}; !reflect.DeepEqual(stored.tokens, want) {
+				t.Errorf("want: %+v, got: %+v", want, stored.tokens)
+			}
+		})
+	}
+}
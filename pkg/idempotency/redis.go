@@ -0,0 +1,72 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore shares responses between replicas. Keys are reserved with
+// SET NX for the lease and expire through the key TTL.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func NewRedisStore(client redis.UniversalClient, prefix string, ttl time.Duration) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix, ttl: ttl}
+}
+
+func (s *RedisStore) Begin(key, fingerprint string) (*Response, error) {
+	ctx := context.Background()
+
+	data, err := json.Marshal(entry{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.client.SetNX(ctx, s.key(key), data, lease(s.ttl)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, nil
+	}
+
+	data, err = s.client.Get(ctx, s.key(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// The key expired in between, so it can be reserved again.
+		return s.Begin(key, fingerprint)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var e entry
+	if err = json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	return e.check(fingerprint)
+}
+
+func (s *RedisStore) Complete(key, fingerprint string, r Response) error {
+	data, err := json.Marshal(entry{Fingerprint: fingerprint, Response: &r})
+	if err != nil {
+		return err
+	}
+
+	return s.client.Set(context.Background(), s.key(key), data, s.ttl).Err()
+}
+
+func (s *RedisStore) Release(key string) error {
+	return s.client.Del(context.Background(), s.key(key)).Err()
+}
+
+func (s *RedisStore) key(key string) string {
+	return s.prefix + "idempotency:" + key
+}
@@ -0,0 +1,141 @@
+package idempotency
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInProgress = errors.New("a request with the idempotency key is in progress")
+	ErrMismatch   = errors.New("the idempotency key was used for a different request")
+)
+
+// DefaultTTL is how long responses are kept when no TTL is configured.
+const DefaultTTL = 24 * time.Hour
+
+// Lease is how long a key stays reserved for a request in progress. A
+// request whose replica died before it completed can be retried once the
+// lease is over, rather than once the TTL is.
+const Lease = time.Minute
+
+// lease returns the lease for keys kept for the TTL.
+func lease(ttl time.Duration) time.Duration {
+	if ttl < Lease {
+		return ttl
+	}
+	return Lease
+}
+
+// Response is a stored response, replayed to retries of the request.
+type Response struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	ETag        string `json:"etag,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Store keeps the responses of requests by their idempotency key for a TTL.
+//
+// Begin reserves the key for the request with the fingerprint for the Lease.
+// It returns the response of a completed request with the key, ErrInProgress
+// while the request is being handled and ErrMismatch if the key was used for
+// a request with another fingerprint. A nil response and error mean the key
+// is reserved: the request is handled and its response stored with Complete,
+// or the key freed with Release if the request can be retried.
+type Store interface {
+	Begin(key, fingerprint string) (*Response, error)
+	Complete(key, fingerprint string, r Response) error
+	Release(key string) error
+}
+
+// entry is a reserved key, with the response once the request is completed.
+type entry struct {
+	Fingerprint string    `json:"fingerprint"`
+	Response    *Response `json:"response,omitempty"`
+}
+
+// check returns the response of the entry for a request with the
+// fingerprint.
+func (e entry) check(fingerprint string) (*Response, error) {
+	if e.Fingerprint != fingerprint {
+		return nil, ErrMismatch
+	}
+	if e.Response == nil {
+		return nil, ErrInProgress
+	}
+
+	return e.Response, nil
+}
+
+type memoryEntry struct {
+	entry
+	expiresAt time.Time
+}
+
+// MemoryStore expires the entry of a key when the key is used again, and
+// sweeps the entries of keys that are not used again once per lease.
+type MemoryStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]memoryEntry
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:     ttl,
+		entries: make(map[string]memoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Begin(key, fingerprint string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if !now.Before(s.nextSweep) {
+		s.sweep(now)
+	}
+
+	if e, ok := s.entries[key]; ok && now.Before(e.expiresAt) {
+		return e.check(fingerprint)
+	}
+
+	s.entries[key] = memoryEntry{entry: entry{Fingerprint: fingerprint}, expiresAt: now.Add(lease(s.ttl))}
+
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(key, fingerprint string, r Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = memoryEntry{
+		entry:     entry{Fingerprint: fingerprint, Response: &r},
+		expiresAt: s.now().Add(s.ttl),
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+
+	return nil
+}
+
+// sweep deletes the expired entries.
+func (s *MemoryStore) sweep(now time.Time) {
+	for k, v := range s.entries {
+		if !now.Before(v.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.nextSweep = now.Add(lease(s.ttl))
+}
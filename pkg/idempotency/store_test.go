@@ -0,0 +1,120 @@
+package idempotency
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore(time.Hour)
+	s.now = func() time.Time { return now }
+
+	testStore(t, s, func(d time.Duration) { now = now.Add(d) })
+}
+
+func TestRedisStore(t *testing.T) {
+	r := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: r.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	testStore(t, NewRedisStore(client, "prefix:", time.Hour), r.FastForward)
+}
+
+// testStore checks a store with a TTL of one hour. advance moves the
+// store's clock forward.
+func testStore(t *testing.T, s Store, advance func(time.Duration)) {
+	want := Response{Status: 200, ContentType: "application/json", ETag: `"2"`, Body: []byte(`{"value":1}`)}
+
+	t.Run("OKReplay", func(t *testing.T) {
+		resp, err := s.Begin("replay", "fingerprint")
+		if resp != nil || err != nil {
+			t.Fatalf("want: <nil>, <nil>, got: %v, %v", resp, err)
+		}
+		if err = s.Complete("replay", "fingerprint", want); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+		advance(Lease)
+
+		got, err := s.Begin("replay", "fingerprint")
+
+		if !reflect.DeepEqual(got, &want) {
+			t.Errorf("want: %+v, got: %+v", want, got)
+		}
+		if err != nil {
+			t.Errorf("want: <nil>, got: %v", err)
+		}
+	})
+	t.Run("ErrInProgress", func(t *testing.T) {
+		if _, err := s.Begin("progress", "fingerprint"); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+
+		_, err := s.Begin("progress", "fingerprint")
+
+		if !errors.Is(err, ErrInProgress) {
+			t.Errorf("want: %v, got: %v", ErrInProgress, err)
+		}
+	})
+	t.Run("ErrMismatch", func(t *testing.T) {
+		if _, err := s.Begin("mismatch", "fingerprint"); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+		if err := s.Complete("mismatch", "fingerprint", want); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+
+		_, err := s.Begin("mismatch", "other")
+
+		if !errors.Is(err, ErrMismatch) {
+			t.Errorf("want: %v, got: %v", ErrMismatch, err)
+		}
+	})
+	t.Run("OKReleased", func(t *testing.T) {
+		if _, err := s.Begin("released", "fingerprint"); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+		if err := s.Release("released"); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+
+		resp, err := s.Begin("released", "fingerprint")
+
+		if resp != nil || err != nil {
+			t.Errorf("want: <nil>, <nil>, got: %v, %v", resp, err)
+		}
+	})
+	t.Run("OKLeaseExpired", func(t *testing.T) {
+		if _, err := s.Begin("lease", "fingerprint"); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+		advance(Lease)
+
+		resp, err := s.Begin("lease", "fingerprint")
+
+		if resp != nil || err != nil {
+			t.Errorf("want: <nil>, <nil>, got: %v, %v", resp, err)
+		}
+	})
+	t.Run("OKExpired", func(t *testing.T) {
+		if _, err := s.Begin("expired", "fingerprint"); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+		if err := s.Complete("expired", "fingerprint", want); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+		advance(time.Hour)
+
+		resp, err := s.Begin("expired", "other")
+
+		if resp != nil || err != nil {
+			t.Errorf("want: <nil>, <nil>, got: %v, %v", resp, err)
+		}
+	})
+}
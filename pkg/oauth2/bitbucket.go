@@ -0,0 +1,105 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	nethttp "net/http"
+
+	"counters/pkg/http"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/bitbucket"
+)
+
+const bitbucketAPI = "https://api.bitbucket.org/2.0"
+
+type BitbucketClient struct {
+	cfg    oauth2.Config
+	client http.Client
+	apiURL string
+}
+
+// NewBitbucketClient asks for the account and email scopes unless scopes are
+// given, as UserInfo needs them.
+func NewBitbucketClient(cfg Config, client http.Client) *BitbucketClient {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"account", "email"}
+	}
+
+	return &BitbucketClient{
+		cfg: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     bitbucket.Endpoint,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+		},
+		client: client,
+		apiURL: bitbucketAPI,
+	}
+}
+
+func (c *BitbucketClient) AuthURL(state, verifier string) string {
+	return authCodeURL(&c.cfg, state, verifier)
+}
+
+func (c *BitbucketClient) Exchange(ctx context.Context, code, verifier string) (Token, error) {
+	token, err := exchange(withHTTPClient(ctx, c.client), &c.cfg, code, verifier)
+	if err != nil {
+		return Token{}, ErrInvalidCode
+	}
+
+	return newToken(token, Bitbucket), nil
+}
+
+// UserInfo returns the UUID and username of the user along with their
+// primary email, which Bitbucket does not return with the user.
+func (c *BitbucketClient) UserInfo(ctx context.Context, token Token) (UserInfo, error) {
+	var user struct {
+		UUID     string `json:"uuid"`
+		Username string `json:"username"`
+	}
+	if err := c.get(ctx, token, "/user", &user); err != nil {
+		return UserInfo{}, err
+	}
+
+	var emails struct {
+		Values []struct {
+			Email       string `json:"email"`
+			IsPrimary   bool   `json:"is_primary"`
+			IsConfirmed bool   `json:"is_confirmed"`
+		} `json:"values"`
+	}
+	if err := c.get(ctx, token, "/user/emails", &emails); err != nil {
+		return UserInfo{}, err
+	}
+
+	info := UserInfo{Subject: user.UUID, Login: user.Username}
+	for _, e := range emails.Values {
+		if e.IsPrimary {
+			info.Email, info.EmailVerified = e.Email, e.IsConfirmed
+		}
+	}
+
+	return info, nil
+}
+
+func (c *BitbucketClient) Refresh(ctx context.Context, token Token) (Token, error) {
+	return refresh(ctx, &c.cfg, c.client, token)
+}
+
+// Revoke is not supported, as Bitbucket has no endpoint to revoke tokens.
+func (c *BitbucketClient) Revoke(context.Context, Token) error {
+	return ErrRevokeNotSupported
+}
+
+func (c *BitbucketClient) get(ctx context.Context, token Token, path string, v any) error {
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, c.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token.Access))
+
+	return doJSON(c.client, req, v)
+}
@@ -0,0 +1,54 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestBitbucketClient_UserInfo(t *testing.T) {
+	for name, tt := range map[string]struct {
+		emails       string
+		token        string
+		wantUserInfo UserInfo
+		wantErr      bool
+	}{
+		"OK": {
+			emails:       `{"values":[{"email":"other@x.x","is_primary":false,"is_confirmed":true},{"email":"x@x.x","is_primary":true,"is_confirmed":true}]}`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "{uuid}", Login: "bucket", Email: "x@x.x", EmailVerified: true},
+		},
+		"OKNotConfirmed": {
+			emails:       `{"values":[{"email":"x@x.x","is_primary":true,"is_confirmed":false}]}`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "{uuid}", Login: "bucket", Email: "x@x.x", EmailVerified: false},
+		},
+		"OKNoEmails": {
+			emails:       `{"values":[]}`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "{uuid}", Login: "bucket"},
+		},
+		"ErrUnauthorized": {
+			emails:  `{"values":[]}`,
+			token:   "revoked",
+			wantErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewBitbucketClient(Config{}, http.DefaultClient)
+			c.apiURL = testAPI(t, map[string]string{
+				"/user":        `{"uuid":"{uuid}","username":"bucket"}`,
+				"/user/emails": tt.emails,
+			}).URL
+
+			info, err := c.UserInfo(context.TODO(), Token{Access: tt.token})
+
+			if info != tt.wantUserInfo {
+				t.Errorf("want: %+v, got: %+v", tt.wantUserInfo, info)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("want error: %t, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
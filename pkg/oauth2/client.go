@@ -4,22 +4,44 @@ package oauth2
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 )
 
 var (
-	ErrInvalidState = errors.New("invalid state")
-	ErrInvalidCode  = errors.New("invalid code")
+	ErrInvalidState       = errors.New("invalid state")
+	ErrInvalidCode        = errors.New("invalid code")
+	ErrNoRefreshToken     = errors.New("no refresh token")
+	ErrRefreshFailed      = errors.New("token refresh failed")
+	ErrRevokeFailed       = errors.New("token revocation failed")
+	ErrRevokeNotSupported = errors.New("token revocation not supported")
 )
 
+// Client runs the authorization code flow with PKCE. The caller is
+// responsible for the state parameter and for keeping the code verifier
+// between AuthURL and Exchange.
 type Client interface {
-	AuthURL() string
-	Exchange(ctx context.Context, state, code string) (Token, error)
+	AuthURL(state, verifier string) string
+	Exchange(ctx context.Context, code, verifier string) (Token, error)
 	UserInfo(ctx context.Context, token Token) (UserInfo, error)
+	// Refresh returns a new token for the refresh token of the given one.
+	Refresh(ctx context.Context, token Token) (Token, error)
+	// Revoke revokes the grant the token belongs to at the provider.
+	Revoke(ctx context.Context, token Token) error
 }
 
 type Token struct {
-	Access   string
-	Provider Provider
+	Access   string    `json:"access"`
+	Refresh  string    `json:"refresh,omitempty"`
+	Type     string    `json:"type,omitempty"`
+	Expiry   time.Time `json:"expiry"`
+	IDToken  string    `json:"id_token,omitempty"`
+	Provider Provider  `json:"provider"`
+}
+
+// TokenSource returns a valid token, refreshing it when it has expired.
+type TokenSource interface {
+	Token() (Token, error)
 }
 
 type Provider uint8
@@ -27,10 +49,67 @@ type Provider uint8
 const (
 	Google Provider = iota + 1
 	GitHub
+	OIDC
+	GitLab
+	Microsoft
+	Bitbucket
 )
 
+var providerNames = map[Provider]string{
+	Google:    "google",
+	GitHub:    "github",
+	OIDC:      "oidc",
+	GitLab:    "gitlab",
+	Microsoft: "microsoft",
+	Bitbucket: "bitbucket",
+}
+
+var providerDisplayNames = map[Provider]string{
+	Google:    "Google",
+	GitHub:    "GitHub",
+	OIDC:      "OpenID Connect",
+	GitLab:    "GitLab",
+	Microsoft: "Microsoft",
+	Bitbucket: "Bitbucket",
+}
+
+// String returns the name of the provider used in URLs.
+func (p Provider) String() string {
+	if name, ok := providerNames[p]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Provider(%d)", uint8(p))
+}
+
+// DisplayName returns the name of the provider shown to users.
+func (p Provider) DisplayName() string {
+	if name, ok := providerDisplayNames[p]; ok {
+		return name
+	}
+
+	return p.String()
+}
+
+// ParseProvider returns the provider with the given name.
+func ParseProvider(name string) (Provider, bool) {
+	for p, n := range providerNames {
+		if n == name {
+			return p, true
+		}
+	}
+
+	return 0, false
+}
+
+// UserInfo describes the user signed in at the provider. Subject is the
+// stable ID of the user at the provider, unlike the email, which can change.
+// Login is the username at providers that have one.
 type UserInfo struct {
-	Email string `json:"email"`
+	Subject       string
+	Login         string
+	Email         string
+	EmailVerified bool
 }
 
 type Config struct {
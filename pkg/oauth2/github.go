@@ -1,79 +1,136 @@
 package oauth2
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	nethttp "net/http"
+	"strconv"
 
 	"counters/pkg/http"
 
-	"github.com/google/uuid"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
 )
 
 type GitHubClient struct {
 	cfg    oauth2.Config
-	state  string
 	client http.Client
+	apiURL string
 }
 
+// NewGitHubClient asks for the user:email scope unless scopes are given, as
+// UserInfo needs it.
 func NewGitHubClient(cfg Config, client http.Client) *GitHubClient {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"user:email"}
+	}
+
 	return &GitHubClient{
 		cfg: oauth2.Config{
 			ClientID:     cfg.ClientID,
 			ClientSecret: cfg.ClientSecret,
 			Endpoint:     github.Endpoint,
 			RedirectURL:  cfg.RedirectURL,
-			Scopes:       cfg.Scopes,
+			Scopes:       scopes,
 		},
-		state:  uuid.NewString(),
 		client: client,
+		apiURL: gitHubAPI,
 	}
 }
 
-func (c *GitHubClient) AuthURL() string {
-	return c.cfg.AuthCodeURL(c.state)
+func (c *GitHubClient) AuthURL(state, verifier string) string {
+	return authCodeURL(&c.cfg, state, verifier)
 }
 
-func (c *GitHubClient) Exchange(ctx context.Context, state, code string) (Token, error) {
-	if state != c.state {
-		return Token{}, ErrInvalidState
-	}
-
-	token, err := c.cfg.Exchange(ctx, code)
+func (c *GitHubClient) Exchange(ctx context.Context, code, verifier string) (Token, error) {
+	token, err := exchange(withHTTPClient(ctx, c.client), &c.cfg, code, verifier)
 	if err != nil {
 		return Token{}, ErrInvalidCode
 	}
 
-	return Token{
-		Access:   token.AccessToken,
-		Provider: GitHub,
-	}, nil
+	return newToken(token, GitHub), nil
 }
 
-const gitHubUserInfoEndpoint = "https://api.github.com/user"
+// Refresh only works for GitHub Apps with expiring user tokens. Tokens of
+// OAuth Apps do not expire and come without a refresh token.
+func (c *GitHubClient) Refresh(ctx context.Context, token Token) (Token, error) {
+	return refresh(ctx, &c.cfg, c.client, token)
+}
 
-func (c *GitHubClient) UserInfo(ctx context.Context, token Token) (UserInfo, error) {
-	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, gitHubUserInfoEndpoint, nil)
+const gitHubAPI = "https://api.github.com"
+
+// Revoke deletes the authorization of the app for the user, which revokes
+// all of its tokens.
+func (c *GitHubClient) Revoke(ctx context.Context, token Token) error {
+	body, err := json.Marshal(map[string]string{"access_token": token.Access})
 	if err != nil {
-		return UserInfo{}, err
+		return err
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token.Access))
 
-	res, err := c.client.Do(req)
+	req, err := nethttp.NewRequestWithContext(
+		ctx,
+		nethttp.MethodDelete,
+		fmt.Sprintf("%s/applications/%s/grant", c.apiURL, c.cfg.ClientID),
+		bytes.NewReader(body),
+	)
 	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.cfg.ClientID, c.cfg.ClientSecret)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	return sendRevocation(c.client, req)
+}
+
+// UserInfo returns the numeric ID, login and email of the user. The email of
+// users who keep it private is null, so the primary verified one is taken
+// from their emails, which needs the user:email scope.
+func (c *GitHubClient) UserInfo(ctx context.Context, token Token) (UserInfo, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Email string `json:"email"`
+	}
+	if err := c.get(ctx, token, "/user", &user); err != nil {
 		return UserInfo{}, err
 	}
-	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := c.get(ctx, token, "/user/emails", &emails); err != nil {
 		return UserInfo{}, err
 	}
 
-	var info UserInfo
-	return info, json.Unmarshal(body, &info)
+	info := UserInfo{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Login:   user.Login,
+		Email:   user.Email,
+	}
+	for _, e := range emails {
+		switch {
+		case user.Email != "" && e.Email == user.Email:
+			info.EmailVerified = e.Verified
+		case user.Email == "" && e.Primary && e.Verified:
+			info.Email, info.EmailVerified = e.Email, true
+		}
+	}
+
+	return info, nil
+}
+
+func (c *GitHubClient) get(ctx context.Context, token Token, path string, v any) error {
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, c.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token.Access))
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	return doJSON(c.client, req, v)
 }
@@ -1,19 +1,157 @@
 package oauth2
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
 
 func TestNewGitHubClient(t *testing.T) {
 	// TODO: implement this test
 }
 
 func TestGitHubClient_AuthURL(t *testing.T) {
-	// TODO: implement this test
+	c := NewGitHubClient(Config{ClientID: "id", RedirectURL: "http://localhost/callback"}, nil)
+
+	u, err := url.Parse(c.AuthURL("state", "verifier"))
+	if err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	q := u.Query()
+	for key, want := range map[string]string{
+		"state":                 "state",
+		"code_challenge":        challenge("verifier"),
+		"code_challenge_method": "S256",
+	} {
+		if got := q.Get(key); got != want {
+			t.Errorf("want %s: %s, got: %s", key, want, got)
+		}
+	}
 }
 
 func TestGitHubClient_Exchange(t *testing.T) {
 	// TODO: implement this test
 }
 
+// testAPI stands in for the user endpoints of a provider API. It serves the
+// body of each path to requests authorized with accessToken.
+func testAPI(t *testing.T, bodies map[string]string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	for path, body := range bodies {
+		body := body
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if auth := r.Header.Get("Authorization"); auth != "Bearer accessToken" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, body)
+		})
+	}
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
 func TestGitHubClient_UserInfo(t *testing.T) {
-	// TODO: implement this test
+	for name, tt := range map[string]struct {
+		user         string
+		emails       string
+		token        string
+		wantUserInfo UserInfo
+		wantErr      bool
+	}{
+		"OKPublicEmail": {
+			user:         `{"id":42,"login":"octocat","email":"x@x.x"}`,
+			emails:       `[{"email":"other@x.x","primary":true,"verified":true},{"email":"x@x.x","primary":false,"verified":true}]`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "42", Login: "octocat", Email: "x@x.x", EmailVerified: true},
+		},
+		"OKPublicEmailNotVerified": {
+			user:         `{"id":42,"login":"octocat","email":"x@x.x"}`,
+			emails:       `[{"email":"x@x.x","primary":true,"verified":false}]`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "42", Login: "octocat", Email: "x@x.x", EmailVerified: false},
+		},
+		"OKPrivateEmail": {
+			user:         `{"id":42,"login":"octocat","email":null}`,
+			emails:       `[{"email":"other@x.x","primary":false,"verified":true},{"email":"x@x.x","primary":true,"verified":true}]`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "42", Login: "octocat", Email: "x@x.x", EmailVerified: true},
+		},
+		"OKPrivateEmailPrimaryNotVerified": {
+			user:         `{"id":42,"login":"octocat","email":null}`,
+			emails:       `[{"email":"other@x.x","primary":false,"verified":true},{"email":"x@x.x","primary":true,"verified":false}]`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "42", Login: "octocat"},
+		},
+		"ErrUnauthorized": {
+			user:    `{"id":42}`,
+			emails:  `[]`,
+			token:   "revoked",
+			wantErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewGitHubClient(Config{}, http.DefaultClient)
+			c.apiURL = testAPI(t, map[string]string{"/user": tt.user, "/user/emails": tt.emails}).URL
+
+			info, err := c.UserInfo(context.TODO(), Token{Access: tt.token})
+
+			if info != tt.wantUserInfo {
+				t.Errorf("want: %+v, got: %+v", tt.wantUserInfo, info)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("want error: %t, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGitHubClient_Revoke(t *testing.T) {
+	for name, tt := range map[string]struct {
+		status  int
+		wantErr error
+	}{
+		"OK": {
+			status:  http.StatusNoContent,
+			wantErr: nil,
+		},
+		"ErrRevokeFailed": {
+			status:  http.StatusUnprocessableEntity,
+			wantErr: ErrRevokeFailed,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewGitHubClient(Config{ClientID: "id", ClientSecret: "secret"}, clientFunc(func(r *http.Request) (*http.Response, error) {
+				if want := "https://api.github.com/applications/id/grant"; r.Method != http.MethodDelete || r.URL.String() != want {
+					t.Errorf("want DELETE %s, got: %s %s", want, r.Method, r.URL)
+				}
+				if id, secret, _ := r.BasicAuth(); id != "id" || secret != "secret" {
+					t.Errorf("want client credentials, got: %s:%s", id, secret)
+				}
+				if body, _ := io.ReadAll(r.Body); string(body) != `{"access_token":"accessToken"}` {
+					t.Errorf("want access token body, got: %s", body)
+				}
+
+				return response(tt.status, ""), nil
+			}))
+
+			err := c.Revoke(context.TODO(), Token{Access: "accessToken"})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
 }
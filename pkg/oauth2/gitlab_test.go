@@ -0,0 +1,114 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestNewGitLabClient(t *testing.T) {
+	for name, tt := range map[string]struct {
+		baseURL     string
+		wantAuthURL string
+	}{
+		"OKDefault": {
+			baseURL:     "",
+			wantAuthURL: "https://gitlab.com/oauth/authorize",
+		},
+		"OKSelfHosted": {
+			baseURL:     "https://git.example.com/",
+			wantAuthURL: "https://git.example.com/oauth/authorize",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewGitLabClient(GitLabConfig{BaseURL: tt.baseURL}, nil)
+
+			if c.cfg.Endpoint.AuthURL != tt.wantAuthURL {
+				t.Errorf("want: %s, got: %s", tt.wantAuthURL, c.cfg.Endpoint.AuthURL)
+			}
+			if len(c.cfg.Scopes) != 1 || c.cfg.Scopes[0] != "read_user" {
+				t.Errorf("want: [read_user], got: %v", c.cfg.Scopes)
+			}
+		})
+	}
+}
+
+func TestGitLabClient_UserInfo(t *testing.T) {
+	for name, tt := range map[string]struct {
+		user         string
+		token        string
+		wantUserInfo UserInfo
+		wantErr      bool
+	}{
+		"OK": {
+			user:         `{"id":42,"username":"tanuki","email":"x@x.x","confirmed_at":"2023-01-01T00:00:00Z"}`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "42", Login: "tanuki", Email: "x@x.x", EmailVerified: true},
+		},
+		"OKNotConfirmed": {
+			user:         `{"id":42,"username":"tanuki","email":"x@x.x","confirmed_at":null}`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "42", Login: "tanuki", Email: "x@x.x", EmailVerified: false},
+		},
+		"ErrUnauthorized": {
+			user:    `{"id":42}`,
+			token:   "revoked",
+			wantErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := testAPI(t, map[string]string{"/api/v4/user": tt.user})
+			c := NewGitLabClient(GitLabConfig{BaseURL: srv.URL}, http.DefaultClient)
+
+			info, err := c.UserInfo(context.TODO(), Token{Access: tt.token})
+
+			if info != tt.wantUserInfo {
+				t.Errorf("want: %+v, got: %+v", tt.wantUserInfo, info)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("want error: %t, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGitLabClient_Revoke(t *testing.T) {
+	for name, tt := range map[string]struct {
+		status  int
+		wantErr error
+	}{
+		"OK": {
+			status:  http.StatusOK,
+			wantErr: nil,
+		},
+		"ErrRevokeFailed": {
+			status:  http.StatusBadRequest,
+			wantErr: ErrRevokeFailed,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := GitLabConfig{Config: Config{ClientID: "id", ClientSecret: "secret"}, BaseURL: "https://git.example.com"}
+			c := NewGitLabClient(cfg, clientFunc(func(r *http.Request) (*http.Response, error) {
+				if want := "https://git.example.com/oauth/revoke"; r.Method != http.MethodPost || r.URL.String() != want {
+					t.Errorf("want POST %s, got: %s %s", want, r.Method, r.URL)
+				}
+				body, _ := io.ReadAll(r.Body)
+				form, _ := url.ParseQuery(string(body))
+				if form.Get("token") != "accessToken" || form.Get("client_id") != "id" || form.Get("client_secret") != "secret" {
+					t.Errorf("want token and client credentials, got: %s", body)
+				}
+
+				return response(tt.status, ""), nil
+			}))
+
+			err := c.Revoke(context.TODO(), Token{Access: "accessToken"})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
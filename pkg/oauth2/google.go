@@ -2,21 +2,19 @@ package oauth2
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	nethttp "net/http"
+	"net/url"
+	"strings"
 
 	"counters/pkg/http"
 
-	"github.com/google/uuid"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
 
 type GoogleClient struct {
 	cfg    oauth2.Config
-	state  string
 	client http.Client
 }
 
@@ -29,52 +27,69 @@ func NewGoogleClient(cfg Config, client http.Client) *GoogleClient {
 			RedirectURL:  cfg.RedirectURL,
 			Scopes:       cfg.Scopes,
 		},
-		state:  uuid.NewString(),
 		client: client,
 	}
 }
 
-func (c *GoogleClient) AuthURL() string {
-	return c.cfg.AuthCodeURL(c.state)
+// AuthURL asks for offline access, so that Google returns a refresh token.
+func (c *GoogleClient) AuthURL(state, verifier string) string {
+	return authCodeURL(&c.cfg, state, verifier, oauth2.AccessTypeOffline)
 }
 
-func (c *GoogleClient) Exchange(ctx context.Context, state, code string) (Token, error) {
-	if state != c.state {
-		return Token{}, ErrInvalidState
-	}
-
-	token, err := c.cfg.Exchange(ctx, code)
+func (c *GoogleClient) Exchange(ctx context.Context, code, verifier string) (Token, error) {
+	token, err := exchange(withHTTPClient(ctx, c.client), &c.cfg, code, verifier)
 	if err != nil {
 		return Token{}, ErrInvalidCode
 	}
 
-	return Token{
-		Access:   token.AccessToken,
-		Provider: Google,
-	}, nil
+	return newToken(token, Google), nil
 }
 
-const googleUserInfoEndpoint = "https://www.googleapis.com/oauth2/v2/userinfo"
+func (c *GoogleClient) Refresh(ctx context.Context, token Token) (Token, error) {
+	return refresh(ctx, &c.cfg, c.client, token)
+}
 
-func (c *GoogleClient) UserInfo(ctx context.Context, token Token) (UserInfo, error) {
-	url := fmt.Sprintf("%s?access_token=%s", googleUserInfoEndpoint, token.Access)
+const googleRevokeEndpoint = "https://oauth2.googleapis.com/revoke"
+
+// Revoke revokes the refresh token if there is one, which also revokes the
+// access tokens issued for it.
+func (c *GoogleClient) Revoke(ctx context.Context, token Token) error {
+	t := token.Refresh
+	if t == "" {
+		t = token.Access
+	}
 
-	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, url, nil)
+	req, err := nethttp.NewRequestWithContext(
+		ctx,
+		nethttp.MethodPost,
+		googleRevokeEndpoint,
+		strings.NewReader(url.Values{"token": {t}}.Encode()),
+	)
 	if err != nil {
-		return UserInfo{}, err
+		return err
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	res, err := c.client.Do(req)
+	return sendRevocation(c.client, req)
+}
+
+const googleUserInfoEndpoint = "https://www.googleapis.com/oauth2/v2/userinfo"
+
+func (c *GoogleClient) UserInfo(ctx context.Context, token Token) (UserInfo, error) {
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, googleUserInfoEndpoint, nil)
 	if err != nil {
 		return UserInfo{}, err
 	}
-	defer res.Body.Close()
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token.Access))
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
+	var info struct {
+		ID            string `json:"id"`
+		Email         string `json:"email"`
+		VerifiedEmail bool   `json:"verified_email"`
+	}
+	if err = doJSON(c.client, req, &info); err != nil {
 		return UserInfo{}, err
 	}
 
-	var info UserInfo
-	return info, json.Unmarshal(body, &info)
+	return UserInfo{Subject: info.ID, Email: info.Email, EmailVerified: info.VerifiedEmail}, nil
 }
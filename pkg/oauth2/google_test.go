@@ -1,13 +1,36 @@
 package oauth2
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
 
 func TestNewGoogleClient(t *testing.T) {
 	// TODO: implement this test
 }
 
 func TestGoogleClient_AuthURL(t *testing.T) {
-	// TODO: implement this test
+	c := NewGoogleClient(Config{ClientID: "id", RedirectURL: "http://localhost/callback"}, nil)
+
+	u, err := url.Parse(c.AuthURL("state", "verifier"))
+	if err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	q := u.Query()
+	for key, want := range map[string]string{
+		"state":                 "state",
+		"code_challenge":        challenge("verifier"),
+		"code_challenge_method": "S256",
+		"access_type":           "offline",
+	} {
+		if got := q.Get(key); got != want {
+			t.Errorf("want %s: %s, got: %s", key, want, got)
+		}
+	}
 }
 
 func TestGoogleClient_Exchange(t *testing.T) {
@@ -15,5 +38,85 @@ func TestGoogleClient_Exchange(t *testing.T) {
 }
 
 func TestGoogleClient_UserInfo(t *testing.T) {
-	// TODO: implement this test
+	for name, tt := range map[string]struct {
+		status   int
+		body     string
+		wantInfo UserInfo
+		wantErr  bool
+	}{
+		"OK": {
+			status:   http.StatusOK,
+			body:     `{"id":"42","email":"x@x.x","verified_email":true}`,
+			wantInfo: UserInfo{Subject: "42", Email: "x@x.x", EmailVerified: true},
+			wantErr:  false,
+		},
+		"Unauthorized": {
+			status:   http.StatusUnauthorized,
+			body:     `{"error":{"code":401,"message":"Invalid Credentials"}}`,
+			wantInfo: UserInfo{},
+			wantErr:  true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewGoogleClient(Config{}, clientFunc(func(r *http.Request) (*http.Response, error) {
+				if auth := r.Header.Get("Authorization"); auth != "Bearer accessToken" {
+					t.Errorf("want: Bearer accessToken, got: %s", auth)
+				}
+
+				return response(tt.status, tt.body), nil
+			}))
+
+			info, err := c.UserInfo(context.TODO(), Token{Access: "accessToken"})
+			if info != tt.wantInfo || (err != nil) != tt.wantErr {
+				t.Errorf("want: %+v, %v, got: %+v, %v", tt.wantInfo, tt.wantErr, info, err)
+			}
+		})
+	}
+}
+
+func TestGoogleClient_Revoke(t *testing.T) {
+	for name, tt := range map[string]struct {
+		token     Token
+		status    int
+		wantToken string
+		wantErr   error
+	}{
+		"OKRefreshToken": {
+			token:     Token{Access: "accessToken", Refresh: "refreshToken"},
+			status:    http.StatusOK,
+			wantToken: "refreshToken",
+			wantErr:   nil,
+		},
+		"OKAccessToken": {
+			token:     Token{Access: "accessToken"},
+			status:    http.StatusOK,
+			wantToken: "accessToken",
+			wantErr:   nil,
+		},
+		"ErrRevokeFailed": {
+			token:     Token{Access: "accessToken"},
+			status:    http.StatusBadRequest,
+			wantToken: "accessToken",
+			wantErr:   ErrRevokeFailed,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewGoogleClient(Config{}, clientFunc(func(r *http.Request) (*http.Response, error) {
+				if r.Method != http.MethodPost || r.URL.String() != googleRevokeEndpoint {
+					t.Errorf("want POST %s, got: %s %s", googleRevokeEndpoint, r.Method, r.URL)
+				}
+				if token := r.FormValue("token"); token != tt.wantToken {
+					t.Errorf("want token: %s, got: %s", tt.wantToken, token)
+				}
+
+				return response(tt.status, ""), nil
+			}))
+
+			err := c.Revoke(context.TODO(), tt.token)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
 }
@@ -0,0 +1,154 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"counters/pkg/http"
+)
+
+// jwksMinRefresh limits how often unknown key IDs make the key set to be
+// fetched again.
+const jwksMinRefresh = time.Minute
+
+// jwks caches the signing keys of an OpenID Connect provider. Keys the
+// provider rotated in are picked up by fetching the set again when a token
+// names an unknown key.
+type jwks struct {
+	url    string
+	client http.Client
+
+	mu        sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (s *jwks) get(ctx context.Context, id string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[id]; ok {
+		return key, nil
+	}
+	if time.Since(s.fetchedAt) < jwksMinRefresh {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+
+	if err := s.fetchLocked(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := s.keys[id]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key %q", id)
+}
+
+func (s *jwks) fetch(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.fetchLocked(ctx)
+}
+
+func (s *jwks) fetchLocked(ctx context.Context) error {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, s.client, s.url, &set); err != nil {
+		return err
+	}
+
+	// Keys of types or curves that are not supported are skipped, so that a
+	// provider adding such a key does not break the keys that can be used.
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 && len(set.Keys) > 0 {
+		return fmt.Errorf("none of the %d keys can be used", len(set.Keys))
+	}
+
+	s.keys, s.fetchedAt = keys, time.Now()
+
+	return nil
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %q", k.Crv)
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,145 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	nethttp "net/http"
+
+	"counters/pkg/http"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/microsoft"
+)
+
+const microsoftGraphAPI = "https://graph.microsoft.com/v1.0"
+
+// microsoftConsumersTenant is the tenant of personal Microsoft accounts,
+// whose emails Microsoft verifies.
+const microsoftConsumersTenant = "9188040d-6c67-4c5b-b112-36a304b66dad"
+
+// MicrosoftConfig configures a Microsoft Entra ID client. Tenant is the ID
+// or domain of the tenant users sign in with, or one of common,
+// organizations and consumers. It defaults to common, with which work
+// accounts only have a verified email if the app registration adds the
+// xms_edov optional claim to ID tokens.
+type MicrosoftConfig struct {
+	Config
+	Tenant string
+}
+
+type MicrosoftClient struct {
+	cfg    oauth2.Config
+	client http.Client
+	tenant string
+	apiURL string
+}
+
+func NewMicrosoftClient(cfg MicrosoftConfig, client http.Client) *MicrosoftClient {
+	tenant := cfg.Tenant
+	if tenant == "" {
+		tenant = "common"
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "offline_access", "User.Read"}
+	}
+
+	return &MicrosoftClient{
+		cfg: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     microsoft.AzureADEndpoint(tenant),
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+		},
+		client: client,
+		tenant: tenant,
+		apiURL: microsoftGraphAPI,
+	}
+}
+
+func (c *MicrosoftClient) AuthURL(state, verifier string) string {
+	return authCodeURL(&c.cfg, state, verifier)
+}
+
+func (c *MicrosoftClient) Exchange(ctx context.Context, code, verifier string) (Token, error) {
+	token, err := exchange(withHTTPClient(ctx, c.client), &c.cfg, code, verifier)
+	if err != nil {
+		return Token{}, ErrInvalidCode
+	}
+
+	return newToken(token, Microsoft), nil
+}
+
+// UserInfo reads the user from Microsoft Graph. The mail of work accounts is
+// set by the administrators of their tenant, so it only counts as verified
+// when the client is limited to a single tenant or to personal accounts.
+// Otherwise the email of the ID token is used if it is one of a personal
+// account or its domain is verified by the tenant (xms_edov).
+func (c *MicrosoftClient) UserInfo(ctx context.Context, token Token) (UserInfo, error) {
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, c.apiURL+"/me", nil)
+	if err != nil {
+		return UserInfo{}, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token.Access))
+
+	var user struct {
+		ID                string `json:"id"`
+		Mail              string `json:"mail"`
+		UserPrincipalName string `json:"userPrincipalName"`
+	}
+	if err = doJSON(c.client, req, &user); err != nil {
+		return UserInfo{}, err
+	}
+
+	info := UserInfo{
+		Subject:       user.ID,
+		Login:         user.UserPrincipalName,
+		Email:         user.Mail,
+		EmailVerified: user.Mail != "" && c.tenant != "common" && c.tenant != "organizations",
+	}
+	if claims, ok := c.idTokenClaims(token.IDToken); ok && claims.verifiedEmail() {
+		info.Email, info.EmailVerified = claims.Email, true
+	}
+
+	return info, nil
+}
+
+type microsoftClaims struct {
+	Email                    string    `json:"email"`
+	TenantID                 string    `json:"tid"`
+	EmailDomainOwnerVerified claimBool `json:"xms_edov"`
+	jwt.RegisteredClaims
+}
+
+func (c *microsoftClaims) verifiedEmail() bool {
+	return c.Email != "" && (c.TenantID == microsoftConsumersTenant || bool(c.EmailDomainOwnerVerified))
+}
+
+// idTokenClaims reads the claims of the ID token issued to the client. The
+// signature is not checked, as the token comes straight from the token
+// endpoint over TLS (OpenID Connect Core 3.1.3.7).
+func (c *MicrosoftClient) idTokenClaims(idToken string) (*microsoftClaims, bool) {
+	if idToken == "" {
+		return nil, false
+	}
+
+	var claims microsoftClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(idToken, &claims); err != nil {
+		return nil, false
+	}
+
+	return &claims, claims.VerifyAudience(c.cfg.ClientID, true)
+}
+
+func (c *MicrosoftClient) Refresh(ctx context.Context, token Token) (Token, error) {
+	return refresh(ctx, &c.cfg, c.client, token)
+}
+
+// Revoke is not supported, as Microsoft Entra ID has no endpoint for clients
+// to revoke their tokens.
+func (c *MicrosoftClient) Revoke(context.Context, Token) error {
+	return ErrRevokeNotSupported
+}
@@ -0,0 +1,145 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestNewMicrosoftClient(t *testing.T) {
+	for name, tt := range map[string]struct {
+		tenant      string
+		wantAuthURL string
+	}{
+		"OKDefault": {
+			tenant:      "",
+			wantAuthURL: "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+		},
+		"OKTenant": {
+			tenant:      "contoso.onmicrosoft.com",
+			wantAuthURL: "https://login.microsoftonline.com/contoso.onmicrosoft.com/oauth2/v2.0/authorize",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewMicrosoftClient(MicrosoftConfig{Tenant: tt.tenant}, nil)
+
+			if got := c.AuthURL("state", "verifier"); !strings.HasPrefix(got, tt.wantAuthURL+"?") {
+				t.Errorf("want: %s, got: %s", tt.wantAuthURL, got)
+			}
+		})
+	}
+}
+
+func TestMicrosoftClient_UserInfo(t *testing.T) {
+	for name, tt := range map[string]struct {
+		tenant       string
+		user         string
+		token        string
+		idToken      string
+		wantUserInfo UserInfo
+		wantErr      bool
+	}{
+		"OKTenant": {
+			tenant:       "contoso.onmicrosoft.com",
+			user:         `{"id":"id","userPrincipalName":"x@contoso.onmicrosoft.com","mail":"x@x.x"}`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "id", Login: "x@contoso.onmicrosoft.com", Email: "x@x.x", EmailVerified: true},
+		},
+		"OKConsumers": {
+			tenant:       "consumers",
+			user:         `{"id":"id","userPrincipalName":"x@x.x","mail":"x@x.x"}`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "id", Login: "x@x.x", Email: "x@x.x", EmailVerified: true},
+		},
+		"OKCommonNotVerified": {
+			tenant:       "common",
+			user:         `{"id":"id","userPrincipalName":"x@x.x","mail":"x@x.x"}`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "id", Login: "x@x.x", Email: "x@x.x", EmailVerified: false},
+		},
+		"OKDefaultPersonalAccount": {
+			tenant:       "",
+			user:         `{"id":"id","userPrincipalName":"x@x.x","mail":null}`,
+			token:        "accessToken",
+			idToken:      testMicrosoftIDToken(t, "id", microsoftConsumersTenant, "x@x.x", false),
+			wantUserInfo: UserInfo{Subject: "id", Login: "x@x.x", Email: "x@x.x", EmailVerified: true},
+		},
+		"OKDefaultDomainVerified": {
+			tenant:       "",
+			user:         `{"id":"id","userPrincipalName":"x@x.x","mail":"x@x.x"}`,
+			token:        "accessToken",
+			idToken:      testMicrosoftIDToken(t, "id", "contoso", "x@x.x", true),
+			wantUserInfo: UserInfo{Subject: "id", Login: "x@x.x", Email: "x@x.x", EmailVerified: true},
+		},
+		"OKDefaultNotVerified": {
+			tenant:       "",
+			user:         `{"id":"id","userPrincipalName":"x@x.x","mail":"x@x.x"}`,
+			token:        "accessToken",
+			idToken:      testMicrosoftIDToken(t, "id", "contoso", "x@x.x", false),
+			wantUserInfo: UserInfo{Subject: "id", Login: "x@x.x", Email: "x@x.x", EmailVerified: false},
+		},
+		"OKDefaultOtherAudience": {
+			tenant:       "",
+			user:         `{"id":"id","userPrincipalName":"x@x.x","mail":null}`,
+			token:        "accessToken",
+			idToken:      testMicrosoftIDToken(t, "other", microsoftConsumersTenant, "x@x.x", false),
+			wantUserInfo: UserInfo{Subject: "id", Login: "x@x.x"},
+		},
+		"OKNoMail": {
+			tenant:       "contoso.onmicrosoft.com",
+			user:         `{"id":"id","userPrincipalName":"x@contoso.onmicrosoft.com","mail":null}`,
+			token:        "accessToken",
+			wantUserInfo: UserInfo{Subject: "id", Login: "x@contoso.onmicrosoft.com"},
+		},
+		"ErrUnauthorized": {
+			tenant:  "common",
+			user:    `{"id":"id"}`,
+			token:   "revoked",
+			wantErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewMicrosoftClient(MicrosoftConfig{Config: Config{ClientID: "id"}, Tenant: tt.tenant}, http.DefaultClient)
+			c.apiURL = testAPI(t, map[string]string{"/me": tt.user}).URL
+
+			info, err := c.UserInfo(context.TODO(), Token{Access: tt.token, IDToken: tt.idToken})
+
+			if info != tt.wantUserInfo {
+				t.Errorf("want: %+v, got: %+v", tt.wantUserInfo, info)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("want error: %t, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// testMicrosoftIDToken returns an ID token for the audience with the email
+// of a user of the tenant.
+func testMicrosoftIDToken(t *testing.T, audience, tenant, email string, domainVerified bool) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, microsoftClaims{
+		Email:                    email,
+		TenantID:                 tenant,
+		EmailDomainOwnerVerified: claimBool(domainVerified),
+		RegisteredClaims:         jwt.RegisteredClaims{Audience: jwt.ClaimStrings{audience}},
+	}).SignedString([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestMicrosoftClient_Revoke(t *testing.T) {
+	c := NewMicrosoftClient(MicrosoftConfig{}, nil)
+
+	if err := c.Revoke(context.TODO(), Token{}); !errors.Is(err, ErrRevokeNotSupported) {
+		t.Errorf("want: %v, got: %v", ErrRevokeNotSupported, err)
+	}
+}
@@ -35,32 +35,61 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 }
 
 // AuthURL mocks base method.
-func (m *MockClient) AuthURL() string {
+func (m *MockClient) AuthURL(state, verifier string) string {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AuthURL")
+	ret := m.ctrl.Call(m, "AuthURL", state, verifier)
 	ret0, _ := ret[0].(string)
 	return ret0
 }
 
 // AuthURL indicates an expected call of AuthURL.
-func (mr *MockClientMockRecorder) AuthURL() *gomock.Call {
+func (mr *MockClientMockRecorder) AuthURL(state, verifier interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthURL", reflect.TypeOf((*MockClient)(nil).AuthURL))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthURL", reflect.TypeOf((*MockClient)(nil).AuthURL), state, verifier)
 }
 
 // Exchange mocks base method.
-func (m *MockClient) Exchange(ctx context.Context, state, code string) (Token, error) {
+func (m *MockClient) Exchange(ctx context.Context, code, verifier string) (Token, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Exchange", ctx, state, code)
+	ret := m.ctrl.Call(m, "Exchange", ctx, code, verifier)
 	ret0, _ := ret[0].(Token)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Exchange indicates an expected call of Exchange.
-func (mr *MockClientMockRecorder) Exchange(ctx, state, code interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) Exchange(ctx, code, verifier interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exchange", reflect.TypeOf((*MockClient)(nil).Exchange), ctx, state, code)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exchange", reflect.TypeOf((*MockClient)(nil).Exchange), ctx, code, verifier)
+}
+
+// Refresh mocks base method.
+func (m *MockClient) Refresh(ctx context.Context, token Token) (Token, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Refresh", ctx, token)
+	ret0, _ := ret[0].(Token)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Refresh indicates an expected call of Refresh.
+func (mr *MockClientMockRecorder) Refresh(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Refresh", reflect.TypeOf((*MockClient)(nil).Refresh), ctx, token)
+}
+
+// Revoke mocks base method.
+func (m *MockClient) Revoke(ctx context.Context, token Token) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", ctx, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Revoke indicates an expected call of Revoke.
+func (mr *MockClientMockRecorder) Revoke(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockClient)(nil).Revoke), ctx, token)
 }
 
 // UserInfo mocks base method.
@@ -77,3 +106,41 @@ func (mr *MockClientMockRecorder) UserInfo(ctx, token interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserInfo", reflect.TypeOf((*MockClient)(nil).UserInfo), ctx, token)
 }
+
+// MockTokenSource is a mock of TokenSource interface.
+type MockTokenSource struct {
+	ctrl     *gomock.Controller
+	recorder *MockTokenSourceMockRecorder
+}
+
+// MockTokenSourceMockRecorder is the mock recorder for MockTokenSource.
+type MockTokenSourceMockRecorder struct {
+	mock *MockTokenSource
+}
+
+// NewMockTokenSource creates a new mock instance.
+func NewMockTokenSource(ctrl *gomock.Controller) *MockTokenSource {
+	mock := &MockTokenSource{ctrl: ctrl}
+	mock.recorder = &MockTokenSourceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTokenSource) EXPECT() *MockTokenSourceMockRecorder {
+	return m.recorder
+}
+
+// Token mocks base method.
+func (m *MockTokenSource) Token() (Token, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Token")
+	ret0, _ := ret[0].(Token)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Token indicates an expected call of Token.
+func (mr *MockTokenSourceMockRecorder) Token() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Token", reflect.TypeOf((*MockTokenSource)(nil).Token))
+}
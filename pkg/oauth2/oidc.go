@@ -0,0 +1,250 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	nethttp "net/http"
+	"net/url"
+	"strings"
+
+	"counters/pkg/http"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/oauth2"
+)
+
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+type OIDCConfig struct {
+	Config
+	IssuerURL string
+}
+
+// OIDCClient is an OpenID Connect relying party for any provider that
+// supports discovery, such as Keycloak, Okta or Azure AD. The email is read
+// from the claims of the ID token returned by Exchange.
+type OIDCClient struct {
+	cfg           oauth2.Config
+	issuer        string
+	revocationURL string
+	keys          *jwks
+	client        http.Client
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	RevocationEndpoint    string `json:"revocation_endpoint"`
+}
+
+// NewOIDCClient discovers the provider configuration of the issuer and loads
+// its signing keys.
+func NewOIDCClient(ctx context.Context, cfg OIDCConfig, client http.Client) (*OIDCClient, error) {
+	issuer := strings.TrimSuffix(cfg.IssuerURL, "/")
+	if issuer == "" {
+		return nil, fmt.Errorf("%w: missing issuer URL", ErrIncompleteConfig)
+	}
+
+	var d oidcDiscovery
+	if err := getJSON(ctx, client, issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("OpenID Connect discovery: %w", err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OpenID Connect discovery: issuer %q does not match %q", d.Issuer, cfg.IssuerURL)
+	}
+
+	keys := &jwks{url: d.JWKSURI, client: client}
+	if err := keys.fetch(ctx); err != nil {
+		return nil, fmt.Errorf("OpenID Connect JWKS: %w", err)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email"}
+	}
+
+	return &OIDCClient{
+		cfg: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  d.AuthorizationEndpoint,
+				TokenURL: d.TokenEndpoint,
+			},
+			RedirectURL: cfg.RedirectURL,
+			Scopes:      scopes,
+		},
+		issuer:        d.Issuer,
+		revocationURL: d.RevocationEndpoint,
+		keys:          keys,
+		client:        client,
+	}, nil
+}
+
+func (c *OIDCClient) AuthURL(state, verifier string) string {
+	return c.cfg.AuthCodeURL(
+		state,
+		oauth2.SetAuthURLParam("code_challenge", challenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		oauth2.SetAuthURLParam("nonce", nonce(verifier)),
+	)
+}
+
+// Exchange exchanges the code for tokens and validates the ID token against
+// the nonce derived from the verifier.
+func (c *OIDCClient) Exchange(ctx context.Context, code, verifier string) (Token, error) {
+	token, err := exchange(withHTTPClient(ctx, c.client), &c.cfg, code, verifier)
+	if err != nil {
+		return Token{}, ErrInvalidCode
+	}
+
+	t := newToken(token, OIDC)
+
+	claims, err := c.verify(ctx, t.IDToken)
+	if err != nil {
+		return Token{}, err
+	}
+	if claims.Nonce != nonce(verifier) {
+		return Token{}, ErrInvalidIDToken
+	}
+
+	return t, nil
+}
+
+func (c *OIDCClient) UserInfo(ctx context.Context, token Token) (UserInfo, error) {
+	claims, err := c.verify(ctx, token.IDToken)
+	if err != nil {
+		return UserInfo{}, err
+	}
+
+	return UserInfo{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+	}, nil
+}
+
+// Refresh keeps the ID token of the sign-in when the provider does not
+// return a new one, so that UserInfo keeps working.
+func (c *OIDCClient) Refresh(ctx context.Context, token Token) (Token, error) {
+	refreshed, err := refresh(ctx, &c.cfg, c.client, token)
+	if err != nil {
+		return Token{}, err
+	}
+	if refreshed.IDToken == "" {
+		refreshed.IDToken = token.IDToken
+	}
+
+	return refreshed, nil
+}
+
+// Revoke revokes the refresh token if there is one at the RFC 7009
+// revocation endpoint of the provider.
+func (c *OIDCClient) Revoke(ctx context.Context, token Token) error {
+	if c.revocationURL == "" {
+		return ErrRevokeNotSupported
+	}
+
+	form := url.Values{"token": {token.Access}, "token_type_hint": {"access_token"}}
+	if token.Refresh != "" {
+		form = url.Values{"token": {token.Refresh}, "token_type_hint": {"refresh_token"}}
+	}
+
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodPost, c.revocationURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+
+	return sendRevocation(c.client, req)
+}
+
+type idTokenClaims struct {
+	Nonce         string    `json:"nonce"`
+	Email         string    `json:"email"`
+	EmailVerified claimBool `json:"email_verified"`
+	jwt.RegisteredClaims
+}
+
+// claimBool accepts both JSON booleans and the "true"/"false" strings some
+// providers send.
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = s == "true"
+		return nil
+	}
+
+	return json.Unmarshal(data, (*bool)(b))
+}
+
+// verify checks the signature, issuer, audience and expiry of the ID token.
+func (c *OIDCClient) verify(ctx context.Context, idToken string) (*idTokenClaims, error) {
+	var claims idTokenClaims
+
+	_, err := jwt.ParseWithClaims(
+		idToken,
+		&claims,
+		func(t *jwt.Token) (any, error) {
+			id, _ := t.Header["kid"].(string)
+			return c.keys.get(ctx, id)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	switch {
+	case claims.Issuer != c.issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	case !claims.VerifyAudience(c.cfg.ClientID, true):
+		return nil, fmt.Errorf("%w: unexpected audience %q", ErrInvalidIDToken, claims.Audience)
+	case claims.ExpiresAt == nil:
+		return nil, fmt.Errorf("%w: no expiry", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	return &claims, nil
+}
+
+// nonce derives the OpenID Connect nonce from the PKCE verifier, which is
+// only known to the store the authorization was started with.
+func nonce(verifier string) string {
+	sum := sha256.Sum256([]byte("nonce:" + verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func getJSON(ctx context.Context, client http.Client, url string, v any) error {
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	return doJSON(client, req, v)
+}
+
+// doJSON sends the request and decodes the JSON response into v.
+func doJSON(client http.Client, req *nethttp.Request, v any) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != nethttp.StatusOK {
+		return fmt.Errorf("%s %s: unexpected status %s", req.Method, req.URL, res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
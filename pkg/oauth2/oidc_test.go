@@ -0,0 +1,493 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// testIssuer is a stand-in OpenID Connect provider. The token endpoint
+// returns the ID token built by idToken for the nonce of the authorization.
+type testIssuer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	keys    map[string]any
+	idToken func(nonce string) string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	i := &testIssuer{keys: make(map[string]any)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                i.URL,
+			AuthorizationEndpoint: i.URL + "/authorize",
+			TokenEndpoint:         i.URL + "/token",
+			JWKSURI:               i.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+
+		var set struct {
+			Keys []jsonWebKey `json:"keys"`
+		}
+		for id, key := range i.keys {
+			set.Keys = append(set.Keys, publicJSONWebKey(id, key))
+		}
+		json.NewEncoder(w).Encode(set)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" || r.FormValue("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "accessToken",
+			"token_type":   "Bearer",
+			"id_token":     i.idToken(nonce("verifier")),
+		})
+	})
+	i.Server = httptest.NewServer(mux)
+	t.Cleanup(i.Close)
+
+	return i
+}
+
+func (i *testIssuer) addKey(id string, key any) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.keys[id] = key
+}
+
+func publicJSONWebKey(id string, key any) jsonWebKey {
+	encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return jsonWebKey{Kty: "RSA", Kid: id, Use: "sig", N: encode(key.N), E: encode(big.NewInt(int64(key.E)))}
+	case *ecdsa.PrivateKey:
+		return jsonWebKey{Kty: "EC", Kid: id, Crv: "P-256", X: encode(key.X), Y: encode(key.Y)}
+	}
+
+	panic("unsupported key")
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, id string, key any, claims jwt.Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = id
+
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestNewOIDCClient(t *testing.T) {
+	i := newTestIssuer(t)
+
+	for name, tt := range map[string]struct {
+		issuerURL string
+		wantErr   bool
+	}{
+		"OK": {
+			issuerURL: i.URL,
+			wantErr:   false,
+		},
+		"OKTrailingSlash": {
+			issuerURL: i.URL + "/",
+			wantErr:   false,
+		},
+		"ErrIssuerMismatch": {
+			issuerURL: i.URL + "/realms/other",
+			wantErr:   true,
+		},
+		"ErrNoIssuer": {
+			issuerURL: "",
+			wantErr:   true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewOIDCClient(context.TODO(), OIDCConfig{IssuerURL: tt.issuerURL}, i.Client())
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("want error: %t, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestOIDCClient_AuthURL(t *testing.T) {
+	i := newTestIssuer(t)
+	c, err := NewOIDCClient(context.TODO(), OIDCConfig{Config: Config{ClientID: "client"}, IssuerURL: i.URL}, i.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(c.AuthURL("state", "verifier"))
+	if err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	q := u.Query()
+	for key, want := range map[string]string{
+		"state":          "state",
+		"code_challenge": challenge("verifier"),
+		"nonce":          nonce("verifier"),
+		"scope":          "openid email",
+	} {
+		if got := q.Get(key); got != want {
+			t.Errorf("want %s: %s, got: %s", key, want, got)
+		}
+	}
+}
+
+func TestOIDCClient_Exchange(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := newTestIssuer(t)
+	i.addKey("rsa", rsaKey)
+	i.addKey("ec", ecKey)
+
+	c, err := NewOIDCClient(context.TODO(), OIDCConfig{Config: Config{ClientID: "client"}, IssuerURL: i.URL}, i.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := func(nonce string) idTokenClaims {
+		return idTokenClaims{
+			Nonce:         nonce,
+			Email:         "x@x.x",
+			EmailVerified: true,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    i.URL,
+				Subject:   "subject",
+				Audience:  jwt.ClaimStrings{"client"},
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		}
+	}
+
+	for name, tt := range map[string]struct {
+		code         string
+		idToken      func(nonce string) string
+		wantUserInfo UserInfo
+		wantErr      error
+	}{
+		"OK": {
+			code: "code",
+			idToken: func(nonce string) string {
+				return sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(nonce))
+			},
+			wantUserInfo: UserInfo{Subject: "subject", Email: "x@x.x", EmailVerified: true},
+			wantErr:      nil,
+		},
+		"OKECDSA": {
+			code: "code",
+			idToken: func(nonce string) string {
+				return sign(t, jwt.SigningMethodES256, "ec", ecKey, claims(nonce))
+			},
+			wantUserInfo: UserInfo{Subject: "subject", Email: "x@x.x", EmailVerified: true},
+			wantErr:      nil,
+		},
+		"OKEmailNotVerified": {
+			code: "code",
+			idToken: func(nonce string) string {
+				c := claims(nonce)
+				c.EmailVerified = false
+				return sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, c)
+			},
+			wantUserInfo: UserInfo{Subject: "subject", Email: "x@x.x", EmailVerified: false},
+			wantErr:      nil,
+		},
+		"ErrInvalidCode": {
+			code: "other",
+			idToken: func(nonce string) string {
+				return sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(nonce))
+			},
+			wantErr: ErrInvalidCode,
+		},
+		"ErrInvalidIDTokenSignature": {
+			code: "code",
+			idToken: func(nonce string) string {
+				return sign(t, jwt.SigningMethodRS256, "rsa", otherKey, claims(nonce))
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		"ErrInvalidIDTokenUnknownKey": {
+			code: "code",
+			idToken: func(nonce string) string {
+				return sign(t, jwt.SigningMethodRS256, "other", otherKey, claims(nonce))
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		"ErrInvalidIDTokenUnsigned": {
+			code: "code",
+			idToken: func(nonce string) string {
+				return sign(t, jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType, claims(nonce))
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		"ErrInvalidIDTokenIssuer": {
+			code: "code",
+			idToken: func(nonce string) string {
+				c := claims(nonce)
+				c.Issuer = "https://issuer.example"
+				return sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, c)
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		"ErrInvalidIDTokenAudience": {
+			code: "code",
+			idToken: func(nonce string) string {
+				c := claims(nonce)
+				c.Audience = jwt.ClaimStrings{"other"}
+				return sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, c)
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		"ErrInvalidIDTokenNonce": {
+			code: "code",
+			idToken: func(string) string {
+				return sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(nonce("other")))
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		"ErrInvalidIDTokenExpired": {
+			code: "code",
+			idToken: func(nonce string) string {
+				c := claims(nonce)
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+				return sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, c)
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		"ErrInvalidIDTokenMissing": {
+			code: "code",
+			idToken: func(string) string {
+				return ""
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			i.idToken = tt.idToken
+
+			token, err := c.Exchange(context.TODO(), tt.code, "verifier")
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if token.Access != "accessToken" || token.Provider != OIDC {
+				t.Errorf("want access token of OIDC provider, got: %+v", token)
+			}
+
+			info, err := c.UserInfo(context.TODO(), token)
+
+			if info != tt.wantUserInfo {
+				t.Errorf("want: %+v, got: %+v", tt.wantUserInfo, info)
+			}
+			if err != nil {
+				t.Errorf("want: <nil>, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestOIDCClient_ExchangeRotatedKey(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := newTestIssuer(t)
+	i.addKey("old", oldKey)
+
+	c, err := NewOIDCClient(context.TODO(), OIDCConfig{Config: Config{ClientID: "client"}, IssuerURL: i.URL}, i.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i.addKey("new", newKey)
+	i.idToken = func(nonce string) string {
+		return sign(t, jwt.SigningMethodRS256, "new", newKey, idTokenClaims{
+			Nonce: nonce,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    i.URL,
+				Subject:   "subject",
+				Audience:  jwt.ClaimStrings{"client"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		})
+	}
+
+	if _, err := c.Exchange(context.TODO(), "code", "verifier"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("want %v within the refresh interval, got: %v", ErrInvalidIDToken, err)
+	}
+
+	c.keys.fetchedAt = time.Time{}
+
+	if _, err := c.Exchange(context.TODO(), "code", "verifier"); err != nil {
+		t.Errorf("want: <nil>, got: %v", err)
+	}
+}
+
+func TestJWKS_fetch(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsupported := []jsonWebKey{
+		{Kty: "OKP", Kid: "ed25519", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+		{Kty: "oct", Kid: "oct"},
+		{Kty: "EC", Kid: "secp256k1", Crv: "secp256k1", X: "AA", Y: "AA"},
+		func() jsonWebKey { k := publicJSONWebKey("enc", rsaKey); k.Use = "enc"; return k }(),
+	}
+
+	for name, tt := range map[string]struct {
+		keys     []jsonWebKey
+		wantErr  bool
+		wantKeys []string
+	}{
+		"OKMixed": {
+			keys:     append([]jsonWebKey{publicJSONWebKey("rsa", rsaKey), publicJSONWebKey("ec", ecKey)}, unsupported...),
+			wantErr:  false,
+			wantKeys: []string{"ec", "rsa"},
+		},
+		"ErrNoUsableKey": {
+			keys:    unsupported,
+			wantErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]any{"keys": tt.keys})
+			}))
+			defer srv.Close()
+
+			s := &jwks{url: srv.URL, client: srv.Client()}
+			err := s.fetch(context.TODO())
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error: %t, got: %v", tt.wantErr, err)
+			}
+			for _, id := range tt.wantKeys {
+				if _, err := s.get(context.TODO(), id); err != nil {
+					t.Errorf("want key %q, got: %v", id, err)
+				}
+			}
+			if len(s.keys) != len(tt.wantKeys) {
+				t.Errorf("want %d keys, got: %d", len(tt.wantKeys), len(s.keys))
+			}
+			if _, err := s.get(context.TODO(), "ed25519"); err == nil {
+				t.Errorf("want error for unsupported key, got: <nil>")
+			}
+		})
+	}
+}
+
+func TestOIDCClient_Revoke(t *testing.T) {
+	i := newTestIssuer(t)
+
+	for name, tt := range map[string]struct {
+		revocationURL string
+		token         Token
+		wantForm      url.Values
+		wantErr       error
+	}{
+		"OKRefreshToken": {
+			revocationURL: i.URL + "/revoke",
+			token:         Token{Access: "accessToken", Refresh: "refreshToken"},
+			wantForm:      url.Values{"token": {"refreshToken"}, "token_type_hint": {"refresh_token"}},
+			wantErr:       nil,
+		},
+		"OKAccessToken": {
+			revocationURL: i.URL + "/revoke",
+			token:         Token{Access: "accessToken"},
+			wantForm:      url.Values{"token": {"accessToken"}, "token_type_hint": {"access_token"}},
+			wantErr:       nil,
+		},
+		"ErrRevokeNotSupported": {
+			revocationURL: "",
+			token:         Token{Access: "accessToken"},
+			wantErr:       ErrRevokeNotSupported,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := NewOIDCClient(context.TODO(), OIDCConfig{Config: Config{ClientID: "client", ClientSecret: "secret"}, IssuerURL: i.URL}, clientFunc(func(r *http.Request) (*http.Response, error) {
+				if r.URL.Path != "/revoke" {
+					return i.Client().Do(r)
+				}
+				if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+					t.Errorf("want client credentials, got: %s:%s", id, secret)
+				}
+				if err := r.ParseForm(); err != nil || !reflect.DeepEqual(r.PostForm, tt.wantForm) {
+					t.Errorf("want: %v, got: %v", tt.wantForm, r.PostForm)
+				}
+
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.revocationURL = tt.revocationURL
+
+			err = c.Revoke(context.TODO(), tt.token)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
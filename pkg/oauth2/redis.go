@@ -0,0 +1,48 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStateStore shares pending authorizations between replicas. States
+// expire through the key TTL and are consumed with GETDEL.
+type RedisStateStore struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func NewRedisStateStore(client redis.UniversalClient, prefix string, ttl time.Duration) *RedisStateStore {
+	return &RedisStateStore{client: client, prefix: prefix, ttl: ttl}
+}
+
+func (s *RedisStateStore) Save(state string, st State) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	return s.client.Set(context.Background(), s.key(state), data, s.ttl).Err()
+}
+
+func (s *RedisStateStore) Consume(state string) (State, error) {
+	data, err := s.client.GetDel(context.Background(), s.key(state)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return State{}, ErrInvalidState
+	}
+	if err != nil {
+		return State{}, err
+	}
+
+	var st State
+	return st, json.Unmarshal(data, &st)
+}
+
+func (s *RedisStateStore) key(state string) string {
+	return s.prefix + "oauth2:state:" + state
+}
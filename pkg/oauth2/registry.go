@@ -0,0 +1,46 @@
+package oauth2
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrIncompleteConfig = errors.New("incomplete OAuth2 config")
+
+// Registry holds the clients of the enabled providers.
+type Registry map[Provider]Client
+
+// Register enables the provider with the client newClient builds from cfg. An
+// empty config leaves the provider disabled, while a config that misses the
+// client ID, client secret or redirect URL returns ErrIncompleteConfig.
+// Settings beyond Config are checked by newClient.
+func (r Registry) Register(p Provider, cfg Config, newClient func(Config) (Client, error)) error {
+	var missing []string
+	for name, v := range map[string]string{
+		"client ID":     cfg.ClientID,
+		"client secret": cfg.ClientSecret,
+		"redirect URL":  cfg.RedirectURL,
+	} {
+		if v == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	switch {
+	case len(missing) == 3 && len(cfg.Scopes) == 0:
+		return nil
+	case len(missing) > 0:
+		sort.Strings(missing)
+		return fmt.Errorf("%w: %s: missing %s", ErrIncompleteConfig, p, strings.Join(missing, ", "))
+	}
+
+	c, err := newClient(cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	r[p] = c
+
+	return nil
+}
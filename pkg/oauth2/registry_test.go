@@ -0,0 +1,77 @@
+package oauth2
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestRegistry_Register(t *testing.T) {
+	errUnexpected := errors.New("unexpected error")
+
+	for name, tt := range map[string]struct {
+		cfg         Config
+		clientErr   error
+		wantEnabled bool
+		wantErr     error
+	}{
+		"OK": {
+			cfg:         Config{ClientID: "id", ClientSecret: "secret", RedirectURL: "http://localhost/callback"},
+			wantEnabled: true,
+			wantErr:     nil,
+		},
+		"OKEmpty": {
+			cfg:         Config{},
+			wantEnabled: false,
+			wantErr:     nil,
+		},
+		"ErrIncompleteConfig": {
+			cfg:         Config{ClientID: "id", RedirectURL: "http://localhost/callback"},
+			wantEnabled: false,
+			wantErr:     ErrIncompleteConfig,
+		},
+		"ErrIncompleteConfigScopesOnly": {
+			cfg:         Config{Scopes: []string{"email"}},
+			wantEnabled: false,
+			wantErr:     ErrIncompleteConfig,
+		},
+		"ErrUnexpected": {
+			cfg:         Config{ClientID: "id", ClientSecret: "secret", RedirectURL: "http://localhost/callback"},
+			clientErr:   errUnexpected,
+			wantEnabled: false,
+			wantErr:     errUnexpected,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := Registry{}
+
+			err := r.Register(GitLab, tt.cfg, func(cfg Config) (Client, error) {
+				if tt.clientErr != nil {
+					return nil, tt.clientErr
+				}
+
+				return NewMockClient(gomock.NewController(t)), nil
+			})
+
+			if _, ok := r[GitLab]; ok != tt.wantEnabled {
+				t.Errorf("want enabled: %t, got: %t", tt.wantEnabled, ok)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestProvider_DisplayName(t *testing.T) {
+	for p, want := range map[Provider]string{
+		GitHub:      "GitHub",
+		OIDC:        "OpenID Connect",
+		Provider(0): "Provider(0)",
+	} {
+		if got := p.DisplayName(); got != want {
+			t.Errorf("want: %s, got: %s", want, got)
+		}
+	}
+}
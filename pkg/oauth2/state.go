@@ -0,0 +1,128 @@
+//go:generate mockgen -source=state.go -destination=state_mock.go -package=oauth2
+package oauth2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// State is an authorization started by AuthURL and not yet completed by
+// Exchange. Verifier is the PKCE code verifier the authorization code has to
+// be exchanged with. User is the ID of the signed-in user that links the
+// provider to their account, if any. Invitation is the invitation token the
+// user signs up with, if any.
+type State struct {
+	Provider   Provider `json:"provider"`
+	Verifier   string   `json:"verifier"`
+	User       string   `json:"user,omitempty"`
+	Invitation string   `json:"invitation,omitempty"`
+}
+
+// StateStore keeps pending authorizations by their state parameter. Consume
+// returns ErrInvalidState for unknown, expired or already consumed states, so
+// every state can be used once.
+type StateStore interface {
+	Save(state string, s State) error
+	Consume(state string) (State, error)
+}
+
+// NewState returns a random state parameter and PKCE code verifier.
+func NewState() (state, verifier string, err error) {
+	if state, err = random(); err != nil {
+		return "", "", err
+	}
+	if verifier, err = random(); err != nil {
+		return "", "", err
+	}
+
+	return state, verifier, nil
+}
+
+func random() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// challenge returns the S256 PKCE code challenge of the verifier.
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func authCodeURL(cfg *oauth2.Config, state, verifier string, opts ...oauth2.AuthCodeOption) string {
+	return cfg.AuthCodeURL(
+		state,
+		append(
+			opts,
+			oauth2.SetAuthURLParam("code_challenge", challenge(verifier)),
+			oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		)...,
+	)
+}
+
+func exchange(ctx context.Context, cfg *oauth2.Config, code, verifier string) (*oauth2.Token, error) {
+	return cfg.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+}
+
+type pendingState struct {
+	State
+	expiresAt time.Time
+}
+
+type MemoryStateStore struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	states map[string]pendingState
+	now    func() time.Time
+}
+
+func NewMemoryStateStore(ttl time.Duration) *MemoryStateStore {
+	return &MemoryStateStore{
+		ttl:    ttl,
+		states: make(map[string]pendingState),
+		now:    time.Now,
+	}
+}
+
+func (s *MemoryStateStore) Save(state string, st State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, v := range s.states {
+		if !now.Before(v.expiresAt) {
+			delete(s.states, k)
+		}
+	}
+
+	s.states[state] = pendingState{State: st, expiresAt: now.Add(s.ttl)}
+
+	return nil
+}
+
+func (s *MemoryStateStore) Consume(state string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.states[state]
+	if !ok {
+		return State{}, ErrInvalidState
+	}
+	delete(s.states, state)
+
+	if !s.now().Before(st.expiresAt) {
+		return State{}, ErrInvalidState
+	}
+
+	return st.State, nil
+}
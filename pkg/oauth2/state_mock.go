@@ -0,0 +1,63 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: state.go
+
+// Package oauth2 is a generated GoMock package.
+package oauth2
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockStateStore is a mock of StateStore interface.
+type MockStateStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockStateStoreMockRecorder
+}
+
+// MockStateStoreMockRecorder is the mock recorder for MockStateStore.
+type MockStateStoreMockRecorder struct {
+	mock *MockStateStore
+}
+
+// NewMockStateStore creates a new mock instance.
+func NewMockStateStore(ctrl *gomock.Controller) *MockStateStore {
+	mock := &MockStateStore{ctrl: ctrl}
+	mock.recorder = &MockStateStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStateStore) EXPECT() *MockStateStoreMockRecorder {
+	return m.recorder
+}
+
+// Consume mocks base method.
+func (m *MockStateStore) Consume(state string) (State, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Consume", state)
+	ret0, _ := ret[0].(State)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Consume indicates an expected call of Consume.
+func (mr *MockStateStoreMockRecorder) Consume(state interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Consume", reflect.TypeOf((*MockStateStore)(nil).Consume), state)
+}
+
+// Save mocks base method.
+func (m *MockStateStore) Save(state string, s State) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", state, s)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockStateStoreMockRecorder) Save(state, s interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockStateStore)(nil).Save), state, s)
+}
@@ -0,0 +1,110 @@
+package oauth2
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNewState(t *testing.T) {
+	state, verifier, err := NewState()
+	if err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	other, _, err := NewState()
+	if err != nil {
+		t.Fatalf("want: <nil>, got: %v", err)
+	}
+
+	if state == other {
+		t.Errorf("want distinct states, got: %s twice", state)
+	}
+	if len(verifier) < 43 || len(verifier) > 128 {
+		t.Errorf("want verifier of 43 to 128 characters, got: %d", len(verifier))
+	}
+}
+
+func Test_challenge(t *testing.T) {
+	// RFC 7636 appendix B.
+	got := challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestMemoryStateStore(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStateStore(time.Minute)
+	s.now = func() time.Time { return now }
+
+	testStateStore(t, s, func(d time.Duration) { now = now.Add(d) })
+}
+
+func TestRedisStateStore(t *testing.T) {
+	r := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: r.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	testStateStore(t, NewRedisStateStore(client, "prefix:", time.Minute), r.FastForward)
+}
+
+// testStateStore checks a store with a TTL of one minute. advance moves the
+// store's clock forward.
+func testStateStore(t *testing.T, s StateStore, advance func(time.Duration)) {
+	want := State{Provider: Google, Verifier: "verifier"}
+
+	t.Run("OK", func(t *testing.T) {
+		if err := s.Save("ok", want); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+
+		got, err := s.Consume("ok")
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("want: %+v, got: %+v", want, got)
+		}
+		if err != nil {
+			t.Errorf("want: <nil>, got: %v", err)
+		}
+	})
+	t.Run("ErrInvalidStateReplay", func(t *testing.T) {
+		if err := s.Save("replay", want); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+		if _, err := s.Consume("replay"); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+
+		_, err := s.Consume("replay")
+
+		if !errors.Is(err, ErrInvalidState) {
+			t.Errorf("want: %v, got: %v", ErrInvalidState, err)
+		}
+	})
+	t.Run("ErrInvalidStateExpired", func(t *testing.T) {
+		if err := s.Save("expired", want); err != nil {
+			t.Fatalf("want: <nil>, got: %v", err)
+		}
+		advance(time.Minute)
+
+		_, err := s.Consume("expired")
+
+		if !errors.Is(err, ErrInvalidState) {
+			t.Errorf("want: %v, got: %v", ErrInvalidState, err)
+		}
+	})
+	t.Run("ErrInvalidStateUnknown", func(t *testing.T) {
+		_, err := s.Consume("unknown")
+
+		if !errors.Is(err, ErrInvalidState) {
+			t.Errorf("want: %v, got: %v", ErrInvalidState, err)
+		}
+	})
+}
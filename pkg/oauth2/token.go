@@ -0,0 +1,93 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	nethttp "net/http"
+	"time"
+
+	"counters/pkg/http"
+
+	"golang.org/x/oauth2"
+)
+
+// expiryDelta makes tokens count as expired slightly before they do at the
+// provider, so they do not expire in flight.
+const expiryDelta = 10 * time.Second
+
+// Valid reports whether the token has an access token that has not expired.
+// Tokens without an expiry never expire.
+func (t Token) Valid() bool {
+	return t.Access != "" && (t.Expiry.IsZero() || time.Now().Add(expiryDelta).Before(t.Expiry))
+}
+
+func newToken(t *oauth2.Token, provider Provider) Token {
+	idToken, _ := t.Extra("id_token").(string)
+
+	return Token{
+		Access:   t.AccessToken,
+		Refresh:  t.RefreshToken,
+		Type:     t.TokenType,
+		Expiry:   t.Expiry,
+		IDToken:  idToken,
+		Provider: provider,
+	}
+}
+
+// refresh exchanges the refresh token of the token for a new one. Providers
+// that do not rotate refresh tokens omit it, so the old one is kept.
+func refresh(ctx context.Context, cfg *oauth2.Config, client http.Client, token Token) (Token, error) {
+	if token.Refresh == "" {
+		return Token{}, ErrNoRefreshToken
+	}
+
+	t, err := cfg.TokenSource(withHTTPClient(ctx, client), &oauth2.Token{RefreshToken: token.Refresh}).Token()
+	if err != nil {
+		return Token{}, fmt.Errorf("%w: %v", ErrRefreshFailed, err)
+	}
+
+	refreshed := newToken(t, token.Provider)
+	if refreshed.Refresh == "" {
+		refreshed.Refresh = token.Refresh
+	}
+
+	return refreshed, nil
+}
+
+// withHTTPClient makes golang.org/x/oauth2 send its requests through the
+// client.
+func withHTTPClient(ctx context.Context, client http.Client) context.Context {
+	if client == nil {
+		return ctx
+	}
+
+	hc, ok := client.(*nethttp.Client)
+	if !ok {
+		hc = &nethttp.Client{Transport: transport{client: client}}
+	}
+
+	return context.WithValue(ctx, oauth2.HTTPClient, hc)
+}
+
+type transport struct {
+	client http.Client
+}
+
+func (t transport) RoundTrip(r *nethttp.Request) (*nethttp.Response, error) {
+	return t.client.Do(r)
+}
+
+// sendRevocation sends a revocation request and checks that it succeeded.
+func sendRevocation(client http.Client, req *nethttp.Request) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRevokeFailed, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%w: unexpected status %s", ErrRevokeFailed, res.Status)
+	}
+
+	return nil
+}
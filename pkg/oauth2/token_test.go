@@ -0,0 +1,134 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clientFunc stands in for the HTTP client of the provider clients.
+type clientFunc func(r *http.Request) (*http.Response, error)
+
+func (f clientFunc) Do(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func response(code int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestToken_Valid(t *testing.T) {
+	for name, tt := range map[string]struct {
+		token Token
+		want  bool
+	}{
+		"OKNoExpiry": {
+			token: Token{Access: "accessToken"},
+			want:  true,
+		},
+		"OKNotExpired": {
+			token: Token{Access: "accessToken", Expiry: time.Now().Add(time.Minute)},
+			want:  true,
+		},
+		"Expired": {
+			token: Token{Access: "accessToken", Expiry: time.Now().Add(-time.Minute)},
+			want:  false,
+		},
+		"ExpiresInFlight": {
+			token: Token{Access: "accessToken", Expiry: time.Now().Add(time.Second)},
+			want:  false,
+		},
+		"NoAccessToken": {
+			token: Token{},
+			want:  false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.token.Valid(); got != tt.want {
+				t.Errorf("want: %t, got: %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_refresh(t *testing.T) {
+	for name, tt := range map[string]struct {
+		token     Token
+		status    int
+		body      string
+		wantToken Token
+		wantErr   error
+	}{
+		"OK": {
+			token:  Token{Access: "old", Refresh: "refreshToken", Provider: Google},
+			status: http.StatusOK,
+			body:   `{"access_token":"new","refresh_token":"newRefreshToken","token_type":"Bearer"}`,
+			wantToken: Token{
+				Access:   "new",
+				Refresh:  "newRefreshToken",
+				Type:     "Bearer",
+				Provider: Google,
+			},
+			wantErr: nil,
+		},
+		"OKRefreshTokenKept": {
+			token:  Token{Access: "old", Refresh: "refreshToken", Provider: Google},
+			status: http.StatusOK,
+			body:   `{"access_token":"new","token_type":"Bearer"}`,
+			wantToken: Token{
+				Access:   "new",
+				Refresh:  "refreshToken",
+				Type:     "Bearer",
+				Provider: Google,
+			},
+			wantErr: nil,
+		},
+		"ErrNoRefreshToken": {
+			token:     Token{Access: "old", Provider: Google},
+			wantToken: Token{},
+			wantErr:   ErrNoRefreshToken,
+		},
+		"ErrRefreshFailed": {
+			token:     Token{Access: "old", Refresh: "refreshToken", Provider: Google},
+			status:    http.StatusBadRequest,
+			body:      `{"error":"invalid_grant"}`,
+			wantToken: Token{},
+			wantErr:   ErrRefreshFailed,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refreshToken" {
+					t.Errorf("want refresh token grant, got: %v", r.Form)
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			c := NewGoogleClient(Config{ClientID: "id", ClientSecret: "secret"}, srv.Client())
+			c.cfg.Endpoint.TokenURL = srv.URL
+
+			token, err := c.Refresh(context.TODO(), tt.token)
+
+			if token != tt.wantToken {
+				t.Errorf("want: %+v, got: %+v", tt.wantToken, token)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+type Config struct {
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+func Open(ctx context.Context, cfg Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+const migrationsDir = "migrations"
+
+// Migrate applies the not yet applied *.sql files from the migrations
+// directory of fsys in lexical order. Applied migrations are recorded per
+// component, so several packages can keep their own migrations in one
+// database. An advisory lock keeps concurrently starting replicas from
+// applying the same migration twice.
+func Migrate(ctx context.Context, db *sql.DB, component string, fsys fs.FS) error {
+	names, err := fs.Glob(fsys, path.Join(migrationsDir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock(hashtext($1))`, component); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, component)
+
+	if _, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			component  TEXT        NOT NULL,
+			name       TEXT        NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (component, name)
+		)`,
+	); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err = migrate(ctx, conn, component, fsys, name); err != nil {
+			return fmt.Errorf("applying migration %s/%s: %w", component, path.Base(name), err)
+		}
+	}
+
+	return nil
+}
+
+func migrate(ctx context.Context, conn *sql.Conn, component string, fsys fs.FS, name string) error {
+	query, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var applied bool
+	if err = tx.QueryRowContext(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE component = $1 AND name = $2)`,
+		component, path.Base(name),
+	).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	if _, err = tx.ExecContext(ctx, string(query)); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO schema_migrations (component, name) VALUES ($1, $2)`,
+		component, path.Base(name),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike escapes the LIKE wildcards in s, so that it matches literally.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMigrate(t *testing.T) {
+	errUnexpected := errors.New("unexpected error")
+	fsys := fstest.MapFS{
+		"migrations/0002_b.sql": {Data: []byte("CREATE TABLE b ()")},
+		"migrations/0001_a.sql": {Data: []byte("CREATE TABLE a ()")},
+		"migrations/README.md":  {Data: []byte("not a migration")},
+	}
+
+	for name, tt := range map[string]struct {
+		mock    func(sqlmock.Sqlmock)
+		wantErr error
+	}{
+		"OK": {
+			mock: func(m sqlmock.Sqlmock) {
+				m.ExpectExec(`SELECT pg_advisory_lock`).WithArgs("x").WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+				m.ExpectBegin()
+				m.ExpectQuery(`SELECT EXISTS`).
+					WithArgs("x", "0001_a.sql").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				m.ExpectRollback()
+
+				m.ExpectBegin()
+				m.ExpectQuery(`SELECT EXISTS`).
+					WithArgs("x", "0002_b.sql").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				m.ExpectExec(`CREATE TABLE b \(\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectExec(`INSERT INTO schema_migrations`).
+					WithArgs("x", "0002_b.sql").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectCommit()
+
+				m.ExpectExec(`SELECT pg_advisory_unlock`).WithArgs("x").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: nil,
+		},
+		"MigrationError": {
+			mock: func(m sqlmock.Sqlmock) {
+				m.ExpectExec(`SELECT pg_advisory_lock`).WithArgs("x").WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+				m.ExpectBegin()
+				m.ExpectQuery(`SELECT EXISTS`).
+					WithArgs("x", "0001_a.sql").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				m.ExpectExec(`CREATE TABLE a \(\)`).WillReturnError(errUnexpected)
+				m.ExpectRollback()
+
+				m.ExpectExec(`SELECT pg_advisory_unlock`).WithArgs("x").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: errUnexpected,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			db, m, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			tt.mock(m)
+
+			err = Migrate(context.TODO(), db, "x", fsys)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want: %v, got: %v", tt.wantErr, err)
+			}
+			if err := m.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}